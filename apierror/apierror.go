@@ -0,0 +1,203 @@
+// Package apierror defines the errors handlers return to API clients and writes
+// them in one JSON envelope:
+//
+//	{"error": {"code": "not_found", "message": "blog not found", "request_id": "..."}}
+//
+// Errors that are not an *Error are treated as internal: they are logged and the
+// client only learns that something went wrong.
+package apierror
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Codes of the errors created by this package.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeConflict           = "conflict"
+	CodePreconditionFailed = "precondition_failed"
+	CodeValidation         = "validation_failed"
+	CodeInternal           = "internal"
+)
+
+// FieldError describes why one field of a request was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// Error is an error that is safe to show to the client.
+type Error struct {
+	Status  int          `json:"-"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+
+	// Err is the underlying cause, it is logged but never sent.
+	Err error `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap records err as the cause of e.
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          CodeBadRequest,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusForbidden:           CodeForbidden,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusMethodNotAllowed:    CodeMethodNotAllowed,
+	http.StatusConflict:            CodeConflict,
+	http.StatusPreconditionFailed:  CodePreconditionFailed,
+	http.StatusUnprocessableEntity: CodeValidation,
+}
+
+// New creates an error with the code that goes with status.
+func New(status int, message string) *Error {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = CodeInternal
+		if status < 500 {
+			code = CodeBadRequest
+		}
+	}
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, message)
+}
+
+// PreconditionFailed reports that a conditional request, such as an update with
+// If-Match, did not hold.
+func PreconditionFailed(message string) *Error {
+	return New(http.StatusPreconditionFailed, message)
+}
+
+func MethodNotAllowed() *Error {
+	return New(http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// Validation reports the fields of a request that failed validation.
+func Validation(fields ...FieldError) *Error {
+	err := New(http.StatusUnprocessableEntity, "request is invalid")
+	err.Fields = fields
+	return err
+}
+
+// WithStatus turns err into an error with the given status. Server errors keep
+// err as is so its message is not exposed.
+func WithStatus(status int, err error) error {
+	if status >= 500 {
+		return err
+	}
+	return New(status, err.Error()).Wrap(err)
+}
+
+// IfNotFound returns replacement when err means a row does not exist, and err otherwise.
+func IfNotFound(err error, replacement *Error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return replacement.Wrap(err)
+	}
+	return err
+}
+
+// IsUniqueViolation reports whether err is a UNIQUE constraint violation.
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505" // unique_violation
+	}
+	return false
+}
+
+// From converts err to an *Error: missing rows become 404, unique violations 409
+// and anything else an internal error.
+func From(err error) *Error {
+	var apiErr *Error
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, sql.ErrNoRows):
+		return NotFound("not found").Wrap(err)
+	case IsUniqueViolation(err):
+		return Conflict("already exists").Wrap(err)
+	default:
+		return New(http.StatusInternalServerError, "internal server error").Wrap(err)
+	}
+}
+
+type envelope struct {
+	Error struct {
+		*Error
+		RequestID string `json:"request_id,omitempty"`
+	} `json:"error"`
+}
+
+// Write sends err to the client in the error envelope. Internal errors are logged
+// with their cause.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := From(err)
+
+	if apiErr.Status >= 500 {
+		slog.ErrorContext(r.Context(), "request failed", "method", r.Method, "path", r.URL.Path, "error", apiErr.Err)
+	}
+
+	var body envelope
+	body.Error.Error = apiErr
+	body.Error.RequestID = w.Header().Get("X-Request-ID")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(apiErr.Status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write error response", "error", err)
+	}
+}
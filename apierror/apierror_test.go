@@ -0,0 +1,150 @@
+package apierror
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// write runs Write with err and decodes the envelope it sent.
+func write(t *testing.T, err error) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Request-ID", "req-1")
+	Write(w, httptest.NewRequest(http.MethodGet, "/blogs/1", nil), err)
+
+	var body struct {
+		Error map[string]interface{} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("the response is not one JSON envelope: %v\n%s", err, w.Body)
+	}
+	return w, body.Error
+}
+
+func TestWriteEnvelope(t *testing.T) {
+	w, body := write(t, Validation(FieldError{Field: "title", Code: "required", Message: "title is required"}))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type: got %q", got)
+	}
+	if body["code"] != CodeValidation || body["message"] != "request is invalid" || body["request_id"] != "req-1" {
+		t.Errorf("envelope: got %v", body)
+	}
+
+	fields, _ := body["fields"].([]interface{})
+	if len(fields) != 1 {
+		t.Fatalf("fields: got %v", body["fields"])
+	}
+	if field := fields[0].(map[string]interface{}); field["field"] != "title" || field["code"] != "required" {
+		t.Errorf("field: got %v", field)
+	}
+}
+
+func TestWriteHidesInternalErrors(t *testing.T) {
+	w, body := write(t, errors.New("disk full at /var/lib/blog"))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status: got %d", w.Code)
+	}
+	if body["code"] != CodeInternal || body["message"] != "internal server error" {
+		t.Errorf("envelope: got %v", body)
+	}
+	if strings.Contains(w.Body.String(), "disk full") {
+		t.Errorf("the cause reached the client: %s", w.Body)
+	}
+	if _, ok := body["fields"]; ok {
+		t.Errorf("an error without fields has a fields member: %v", body)
+	}
+}
+
+func TestWriteKeepsTheCauseOutOfClientErrors(t *testing.T) {
+	w, body := write(t, NotFound("blog not found").Wrap(errors.New("select failed on row 7")))
+
+	if w.Code != http.StatusNotFound || body["code"] != CodeNotFound || body["message"] != "blog not found" {
+		t.Errorf("got %d %v", w.Code, body)
+	}
+	if strings.Contains(w.Body.String(), "row 7") {
+		t.Errorf("the cause reached the client: %s", w.Body)
+	}
+}
+
+func TestFrom(t *testing.T) {
+	unique := sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"api error", Forbidden("not yours"), http.StatusForbidden, CodeForbidden},
+		{"wrapped api error", fmt.Errorf("reading: %w", Conflict("taken")), http.StatusConflict, CodeConflict},
+		{"no rows", fmt.Errorf("reading: %w", sql.ErrNoRows), http.StatusNotFound, CodeNotFound},
+		{"unique violation", fmt.Errorf("creating: %w", unique), http.StatusConflict, CodeConflict},
+		{"anything else", errors.New("boom"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, test := range tests {
+		got := From(test.err)
+		if got.Status != test.status || got.Code != test.code {
+			t.Errorf("%s: got %d %s, want %d %s", test.name, got.Status, got.Code, test.status, test.code)
+		}
+	}
+}
+
+func TestNewPicksTheCodeOfTheStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		code   string
+	}{
+		{http.StatusPreconditionFailed, CodePreconditionFailed},
+		{http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{http.StatusTeapot, CodeBadRequest},
+		{http.StatusBadGateway, CodeInternal},
+	}
+
+	for _, test := range tests {
+		if got := New(test.status, "message").Code; got != test.code {
+			t.Errorf("New(%d): got %s, want %s", test.status, got, test.code)
+		}
+	}
+}
+
+func TestWithStatusHidesServerErrors(t *testing.T) {
+	cause := errors.New("bad gateway from upstream")
+
+	if err := WithStatus(http.StatusBadGateway, cause); err != cause {
+		t.Errorf("a server error was turned into a client error: %v", err)
+	}
+
+	var apiErr *Error
+	err := WithStatus(http.StatusRequestEntityTooLarge, errors.New("file is too large"))
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusRequestEntityTooLarge || apiErr.Message != "file is too large" {
+		t.Errorf("got %#v", err)
+	}
+}
+
+func TestIfNotFound(t *testing.T) {
+	replacement := NotFound("blog not found")
+
+	if err := IfNotFound(sql.ErrNoRows, replacement); err != replacement || !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing row: got %v", err)
+	}
+
+	other := errors.New("connection reset")
+	if err := IfNotFound(other, NotFound("blog not found")); err != other {
+		t.Errorf("other error: got %v", err)
+	}
+}
@@ -5,51 +5,102 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/metrics"
+	"github.com/immanuel-254/blog/store"
 )
 
-func AuthLogin(queries *models.Queries, ctx context.Context, data map[string]string) (string, int, error) {
-	user, err := queries.UserLoginRead(ctx, data["email"])
+func (s *Service) AuthLogin(ctx context.Context, input LoginInput) (string, int, error) {
+	queries := s.Store.Auth
+
+	user, err := queries.UserLoginRead(ctx, input.Email)
+
+	if err == sql.ErrNoRows {
+		// check the password anyway, so an unknown email takes as long to
+		// refuse as a wrong password and does not tell which emails have accounts
+		CheckPasswordHash(input.Password, s.dummyPasswordHash())
+		metrics.LoginFailures.Inc()
+		return "", http.StatusBadRequest, fmt.Errorf("invalid credentials")
+	}
 
 	if err != nil {
-		return "", http.StatusInternalServerError, fmt.Errorf("%s, (%s)", data["email"], err.Error())
+		return "", http.StatusInternalServerError, err
 	}
 
-	check := CheckPasswordHash(data["password"], user.Password)
+	check := CheckPasswordHash(input.Password, user.Password)
 
 	if !check {
+		metrics.LoginFailures.Inc()
 		return "", http.StatusBadRequest, fmt.Errorf("invalid credentials")
 	}
 
+	// upgrade hashes created with an outdated algorithm or parameters
+	if PasswordNeedsRehash(s.Config.Password, user.Password) {
+		if err := s.rehashPassword(ctx, user.ID, input.Password); err != nil {
+			slog.ErrorContext(ctx, "failed to rehash password", "user_id", user.ID, "error", err)
+		}
+	}
+
 	// create key
 	key := base64.StdEncoding.EncodeToString(GenerateAESKey())
 
 	// create session
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		session, err := tx.Auth.SessionCreate(ctx, models.SessionCreateParams{
+			Key:       key,
+			UserID:    user.ID,
+			CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
 
-	session, err := queries.SessionCreate(ctx, models.SessionCreateParams{
-		Key:       key,
-		UserID:    user.ID,
-		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		return LogAction(tx.Auth, ctx, "session", "create", session.ID, session.UserID)
 	})
 
 	if err != nil {
 		return "", http.StatusInternalServerError, err
 	}
 
-	err = queries.LogCreate(ctx, models.LogCreateParams{
-		DbTable:   "session",
-		Action:    "create",
-		ObjectID:  session.ID,
-		UserID:    session.UserID,
-		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	metrics.Logins.Inc()
+	setUserID(ctx, user.ID)
+
+	return key, http.StatusOK, nil
+}
+
+// dummyPasswordHash returns a hash of a random password made with the configured
+// hasher, so checking a password against it costs what checking a real one does.
+func (s *Service) dummyPasswordHash() string {
+	s.dummyHashOnce.Do(func() {
+		hash, err := HashPassword(s.Config.Password, randomToken(32))
+		if err != nil {
+			slog.Error("failed to create the dummy password hash", "error", err)
+		}
+		s.dummyHash = hash
 	})
+	return s.dummyHash
+}
 
+func (s *Service) rehashPassword(ctx context.Context, userId int64, password string) error {
+	hash, err := HashPassword(s.Config.Password, password)
 	if err != nil {
-		return "", http.StatusInternalServerError, err
+		return err
 	}
 
-	return key, http.StatusOK, nil
+	return s.Store.WithTx(ctx, func(tx *store.Store) error {
+		_, err := tx.Auth.UserUpdatePassword(ctx, models.UserUpdatePasswordParams{
+			ID:        userId,
+			Password:  hash,
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "user", "rehash", userId, userId)
+	})
 }
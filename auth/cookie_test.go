@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/immanuel-254/blog/auth/models"
+)
+
+func TestCSRF(t *testing.T) {
+	const key = "session key"
+
+	handler := CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		cookie bool
+		want   int
+	}{
+		{"safe method with the cookie", http.MethodGet, nil, true, http.StatusNoContent},
+		{"auth header", http.MethodPost, http.Header{"Auth": {key}}, false, http.StatusNoContent},
+		{"auth header and the cookie", http.MethodPost, http.Header{"Auth": {key}}, true, http.StatusNoContent},
+		{"no session", http.MethodPost, nil, false, http.StatusNoContent},
+		{"cookie without a token", http.MethodPost, nil, true, http.StatusForbidden},
+		{"cookie with another token", http.MethodDelete, http.Header{CSRFHeaderName: {CSRFToken("other key")}}, true, http.StatusForbidden},
+		{"cookie with its token", http.MethodPut, http.Header{CSRFHeaderName: {CSRFToken(key)}}, true, http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/blogs", nil)
+		for name, values := range test.header {
+			r.Header[http.CanonicalHeaderKey(name)] = values
+		}
+		if test.cookie {
+			r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: key})
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, w.Code, test.want)
+		}
+	}
+}
+
+// clearedCookies returns the names of the cookies the response expires.
+func clearedCookies(w *httptest.ResponseRecorder) map[string]bool {
+	cleared := map[string]bool{}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			cleared[cookie.Name] = true
+		}
+	}
+	return cleared
+}
+
+func TestLogoutClearsCookies(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	user := createUser(t, s, "jane@example.com", "not a hash")
+	if _, err := s.Store.Auth.SessionCreate(ctx, models.SessionCreateParams{Key: "live", UserID: user.ID, CreatedAt: sql.NullTime{Time: time.Now(), Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{"live session", "live", http.StatusOK},
+		{"unknown session", "unknown", http.StatusOK},
+		{"no session", "", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+		if test.key != "" {
+			r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: test.key})
+		}
+
+		w := httptest.NewRecorder()
+		s.Logout(w, r)
+
+		if w.Code != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, w.Code, test.want)
+		}
+		if cleared := clearedCookies(w); !cleared[SessionCookieName] || !cleared[CSRFCookieName] {
+			t.Errorf("%s: cleared %v, want both cookies", test.name, cleared)
+		}
+	}
+
+	if _, err := s.Store.Auth.SessionRead(ctx, "live"); err != sql.ErrNoRows {
+		t.Errorf("the session outlived the logout: %v", err)
+	}
+}
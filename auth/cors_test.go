@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// corsRequest sends a request from origin through Cors(cfg) and returns the
+// response and whether the handler behind it ran.
+func corsRequest(cfg CorsConfig, method, origin string, preflight bool) (*httptest.ResponseRecorder, bool) {
+	reached := false
+	handler := Cors(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest(method, "/blogs", nil)
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	if preflight {
+		r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, reached
+}
+
+func TestCors(t *testing.T) {
+	listed := CorsConfigDefault
+	listed.AllowOrigins = []string{"https://app.example.com/"}
+	listed.AllowCredentials = true
+	listed.ExposeHeaders = []string{"ETag"}
+
+	wildcard := CorsConfigDefault
+	wildcard.AllowOrigins = []string{"*"}
+
+	wildcardCredentials := wildcard
+	wildcardCredentials.AllowCredentials = true
+
+	tests := []struct {
+		name        string
+		cfg         CorsConfig
+		origin      string
+		preflight   bool
+		allowOrigin string
+		credentials bool
+		reached     bool
+	}{
+		{"listed origin", listed, "https://app.example.com", false, "https://app.example.com", true, true},
+		{"listed origin preflight", listed, "https://app.example.com", true, "https://app.example.com", true, false},
+		{"other origin", listed, "https://evil.example", false, "", false, true},
+		{"other origin preflight", listed, "https://evil.example", true, "", false, false},
+		{"same origin", listed, "", false, "", false, true},
+		{"wildcard", wildcard, "https://any.example", false, "*", false, true},
+		{"wildcard with credentials", wildcardCredentials, "https://evil.example", false, "", false, true},
+		{"wildcard with credentials preflight", wildcardCredentials, "https://evil.example", true, "", false, false},
+	}
+
+	for _, test := range tests {
+		method := http.MethodGet
+		if test.preflight {
+			method = http.MethodOptions
+		}
+
+		w, reached := corsRequest(test.cfg, method, test.origin, test.preflight)
+		header := w.Header()
+
+		if got := header.Get("Access-Control-Allow-Origin"); got != test.allowOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin %q, want %q", test.name, got, test.allowOrigin)
+		}
+		if got := header.Get("Access-Control-Allow-Credentials") == "true"; got != test.credentials {
+			t.Errorf("%s: credentials allowed %v, want %v", test.name, got, test.credentials)
+		}
+		if reached != test.reached {
+			t.Errorf("%s: handler reached %v, want %v", test.name, reached, test.reached)
+		}
+		if test.preflight && w.Code != http.StatusNoContent {
+			t.Errorf("%s: preflight answered %d", test.name, w.Code)
+		}
+		if header.Values("Vary")[0] != "Origin" {
+			t.Errorf("%s: Vary %v", test.name, header.Values("Vary"))
+		}
+	}
+}
+
+func TestCorsPreflightHeaders(t *testing.T) {
+	cfg := CorsConfigDefault
+	cfg.AllowOrigins = []string{"https://app.example.com"}
+
+	w, _ := corsRequest(cfg, http.MethodOptions, "https://app.example.com", true)
+	header := w.Header()
+
+	if got := header.Get("Access-Control-Allow-Methods"); got != "GET, POST, PUT, PATCH, DELETE, OPTIONS" {
+		t.Errorf("Access-Control-Allow-Methods: %q", got)
+	}
+	if got := header.Get("Access-Control-Allow-Headers"); got != "Content-Type, auth, "+CSRFHeaderName {
+		t.Errorf("Access-Control-Allow-Headers: %q", got)
+	}
+	if got := header.Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("Access-Control-Max-Age: %q", got)
+	}
+
+	// simple requests expose headers but get no preflight ones
+	cfg.ExposeHeaders = []string{"ETag", "X-Request-ID"}
+	w, _ = corsRequest(cfg, http.MethodGet, "https://app.example.com", false)
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "ETag, X-Request-ID" {
+		t.Errorf("Access-Control-Expose-Headers: %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "" {
+		t.Errorf("a simple request got Access-Control-Allow-Methods %q", got)
+	}
+}
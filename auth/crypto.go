@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"encoding/base64"
 )
 
 func GenerateAESKey() []byte {
@@ -12,3 +13,13 @@ func GenerateAESKey() []byte {
 	}
 	return key
 }
+
+// randomToken returns a URL safe random token for links that outlive the one time token store.
+func randomToken(length int) string {
+	token := make([]byte, length)
+	_, err := rand.Read(token)
+	if err != nil {
+		panic(err.Error())
+	}
+	return base64.URLEncoding.EncodeToString(token)
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/immanuel-254/blog/auth/models"
+	blogmodels "github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/media"
+	"github.com/immanuel-254/blog/store"
+)
+
+const (
+	// ContentDelete removes everything the user authored.
+	ContentDelete = "delete"
+	// ContentAnonymize keeps authored blogs and comments but reassigns them to the ghost user.
+	ContentAnonymize = "anonymize"
+
+	// GhostEmail identifies the inactive user that anonymized content is reassigned to.
+	GhostEmail = "ghost@deleted.invalid"
+)
+
+// DeletionGracePeriod returns how long a scheduled deletion can be cancelled.
+func DeletionGracePeriod(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.DeletionGraceDays) * 24 * time.Hour
+}
+
+// GhostUser returns the id of the ghost user, creating it the first time it is
+// needed with a password hashed by the hasher of cfg.
+func GhostUser(queries models.Querier, ctx context.Context, cfg config.PasswordConfig) (int64, error) {
+	ghost, err := queries.UserEmailRead(ctx, GhostEmail)
+	if err == nil {
+		return ghost.ID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	// the ghost user can never log in, its password is a hash of random bytes
+	hash, err := HashPassword(cfg, randomToken(32))
+	if err != nil {
+		return 0, err
+	}
+
+	user, err := queries.UserCreate(ctx, models.UserCreateParams{
+		Email:     GhostEmail,
+		Password:  hash,
+		Isactive:  sql.NullBool{Bool: false, Valid: true},
+		Isstaff:   sql.NullBool{Bool: false, Valid: true},
+		Isadmin:   sql.NullBool{Bool: false, Valid: true},
+		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return user.ID, nil
+}
+
+// PurgeUser permanently removes a user, deleting or anonymizing their content, in a single transaction.
+// The stored files of the uploads it deletes are removed once it is committed,
+// those that cannot be are left to the media purge worker.
+func (s *Service) PurgeUser(ctx context.Context, userId int64, content string) error {
+	var trashed []blogmodels.Media
+
+	err := s.Store.WithTx(ctx, func(tx *store.Store) (err error) {
+		trashed, err = s.purgeUser(tx, ctx, userId, content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range trashed {
+		if err := s.purgeMedia(context.WithoutCancel(ctx), item); err != nil {
+			slog.ErrorContext(ctx, "failed to remove the files of deleted media, they are retried later", "media", item.ID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// purgeMedia removes the files of trashed media, then its row.
+func (s *Service) purgeMedia(ctx context.Context, item blogmodels.Media) error {
+	var variants []media.Variant
+	if err := json.Unmarshal([]byte(item.Variants), &variants); err != nil {
+		return fmt.Errorf("media %d: reading variants: %w", item.ID, err)
+	}
+
+	if err := media.Remove(ctx, s.Media, item.Key, variants); err != nil {
+		return err
+	}
+
+	return s.Store.Blog.MediaPurge(ctx, item.ID)
+}
+
+// purgeUser removes the user in tx and returns the uploads it trashed.
+func (s *Service) purgeUser(tx *store.Store, ctx context.Context, userId int64, content string) ([]blogmodels.Media, error) {
+	queries := tx.Auth
+	blogqueries := tx.Blog
+
+	owner := sql.NullInt64{Int64: userId, Valid: true}
+
+	ghostId, err := GhostUser(queries, ctx, s.Config.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads, err := blogqueries.MediaUserList(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	var avatarId int64
+	profile, err := blogqueries.ProfileUserRead(ctx, owner)
+	if err == nil {
+		avatarId = profile.AvatarID.Int64
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// every upload is deleted with the content, only the avatar otherwise
+	var trashed []blogmodels.Media
+	for _, item := range uploads {
+		if content == ContentDelete || item.ID == avatarId {
+			trashed = append(trashed, item)
+		}
+	}
+
+	ghost := sql.NullInt64{Int64: ghostId, Valid: true}
+
+	// categories are shared by everyone's blogs, so they are always kept
+	err = blogqueries.CategoryUserReassign(ctx, blogmodels.CategoryUserReassignParams{UserID: ghost, UserID_2: owner})
+	if err != nil {
+		return nil, err
+	}
+
+	// the history of blogs they edited is kept, without their name on it
+	err = blogqueries.BlogRevisionAuthorReassign(ctx, blogmodels.BlogRevisionAuthorReassignParams{AuthorID: ghost, AuthorID_2: owner})
+	if err != nil {
+		return nil, err
+	}
+
+	switch content {
+	case ContentDelete:
+		if err = blogqueries.MediaUserBlogsUnlink(ctx, owner); err != nil {
+			return nil, err
+		}
+		err = blogqueries.MediaUserTrash(ctx, blogmodels.MediaUserTrashParams{DeletedAt: sql.NullTime{Time: time.Now(), Valid: true}, OwnerID: owner})
+		if err != nil {
+			return nil, err
+		}
+		if err = blogqueries.BlogRevisionUserDelete(ctx, owner); err != nil {
+			return nil, err
+		}
+		if err = blogqueries.CommentUserBlogsDelete(ctx, blogmodels.CommentUserBlogsDeleteParams{UserID: owner, UserID_2: owner}); err != nil {
+			return nil, err
+		}
+		if err = blogqueries.CategoryBlogUserDelete(ctx, owner); err != nil {
+			return nil, err
+		}
+		if err = blogqueries.BlogUserDelete(ctx, owner); err != nil {
+			return nil, err
+		}
+	case ContentAnonymize:
+		if err = blogqueries.MediaUserReassign(ctx, blogmodels.MediaUserReassignParams{OwnerID: ghost, OwnerID_2: owner}); err != nil {
+			return nil, err
+		}
+		if err = blogqueries.CommentUserReassign(ctx, blogmodels.CommentUserReassignParams{UserID: ghost, UserID_2: owner}); err != nil {
+			return nil, err
+		}
+		if err = blogqueries.BlogUserReassign(ctx, blogmodels.BlogUserReassignParams{UserID: ghost, UserID_2: owner}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid content option %q", content)
+	}
+
+	// an avatar goes with its profile, whatever happens to the other uploads
+	err = blogqueries.MediaUserAvatarTrash(ctx, blogmodels.MediaUserAvatarTrashParams{DeletedAt: sql.NullTime{Time: time.Now(), Valid: true}, UserID: owner})
+	if err != nil {
+		return nil, err
+	}
+	if err = blogqueries.ProfileUserDelete(ctx, owner); err != nil {
+		return nil, err
+	}
+	if err = queries.SessionUserDelete(ctx, userId); err != nil {
+		return nil, err
+	}
+	if err = queries.EmailChangeUserDelete(ctx, userId); err != nil {
+		return nil, err
+	}
+	if err = queries.UserDeletionUserDelete(ctx, userId); err != nil {
+		return nil, err
+	}
+	if err = queries.UserDelete(ctx, userId); err != nil {
+		return nil, err
+	}
+
+	return trashed, LogAction(queries, ctx, "user", "delete", userId, 0)
+}
+
+// PurgeScheduledDeletions purges every user whose grace period has passed.
+func (s *Service) PurgeScheduledDeletions(ctx context.Context) (int, error) {
+	queries := s.Store.Auth
+
+	due, err := queries.UserDeletionDueList(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, deletion := range due {
+		if err := s.PurgeUser(ctx, deletion.UserID, deletion.Content); err != nil {
+			return purged, fmt.Errorf("purging user %d: %w", deletion.UserID, err)
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// RunDeletionWorker purges due deletions every interval until ctx is cancelled.
+func (s *Service) RunDeletionWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeScheduledDeletions(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to purge scheduled deletions", "error", err)
+		} else if purged > 0 {
+			slog.InfoContext(ctx, "purged scheduled user deletions", "count", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
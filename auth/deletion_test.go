@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	blogmodels "github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/media"
+)
+
+// uploadedUser is a user with a blog, a revision of it, an upload with a variant
+// and an avatar, each file stored in the media of the service.
+type uploadedUser struct {
+	ID     int64
+	Upload blogmodels.Media
+	Avatar blogmodels.Media
+}
+
+func createUploadedUser(t *testing.T, s *Service) uploadedUser {
+	t.Helper()
+
+	ctx := context.Background()
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+
+	user := createUser(t, s, "jane@example.com", "not a hash")
+	owner := sql.NullInt64{Int64: user.ID, Valid: true}
+	blogqueries := s.Store.Blog
+
+	blog, err := blogqueries.BlogCreate(ctx, blogmodels.BlogCreateParams{UserID: owner, Title: "Title", Body: "Body", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blogqueries.BlogRevisionCreate(ctx, blogmodels.BlogRevisionCreateParams{BlogID: blog.ID, BlogID_2: blog.ID, Title: "Title", Body: "Body", AuthorID: owner, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := func(key string, variants ...media.Variant) blogmodels.Media {
+		for _, file := range append([]media.Variant{{Key: key}}, variants...) {
+			if err := s.Media.Put(ctx, file.Key, []byte("data of "+file.Key), "image/png"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		variantsJSON, _ := json.Marshal(variants)
+
+		item, err := blogqueries.MediaCreate(ctx, blogmodels.MediaCreateParams{
+			OwnerID:     owner,
+			Key:         key,
+			Filename:    "picture.png",
+			ContentType: "image/png",
+			Variants:    string(variantsJSON),
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return item
+	}
+
+	upload := store("uploads/picture.png", media.Variant{Name: "thumbnail", Key: "uploads/picture-thumbnail.png"})
+	avatar := store("avatars/jane.png")
+
+	profile, err := blogqueries.ProfileCreate(ctx, blogmodels.ProfileCreateParams{UserID: owner, Username: "jane", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blogqueries.ProfileAvatarUpdate(ctx, blogmodels.ProfileAvatarUpdateParams{ID: profile.ID, AvatarID: sql.NullInt64{Int64: avatar.ID, Valid: true}, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	return uploadedUser{ID: user.ID, Upload: upload, Avatar: avatar}
+}
+
+// stored reports whether the media of s holds a file under key.
+func stored(t *testing.T, s *Service, key string) bool {
+	t.Helper()
+
+	file, err := s.Media.Open(context.Background(), key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	return true
+}
+
+func TestExportIncludesUploadsAndRevisions(t *testing.T) {
+	s := newTestService(t)
+	user := createUploadedUser(t, s)
+
+	files, err := s.ExportFiles(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteExport(&buf, files); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(name string) []byte {
+		file, err := archive.Open(name)
+		if err != nil {
+			t.Fatalf("the export has no %s", name)
+		}
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		return data
+	}
+
+	for _, key := range []string{"uploads/picture.png", "uploads/picture-thumbnail.png", "avatars/jane.png"} {
+		if got := string(read("media/" + key)); got != "data of "+key {
+			t.Errorf("media/%s: got %q", key, got)
+		}
+	}
+
+	var uploads []blogmodels.Media
+	if err := json.Unmarshal(read("media.json"), &uploads); err != nil || len(uploads) != 2 {
+		t.Errorf("media.json: got %d uploads, %v", len(uploads), err)
+	}
+
+	var revisions []blogmodels.BlogRevision
+	if err := json.Unmarshal(read("revisions.json"), &revisions); err != nil || len(revisions) != 1 || revisions[0].Body != "Body" {
+		t.Errorf("revisions.json: got %+v, %v", revisions, err)
+	}
+}
+
+func TestPurgeUserRemovesStoredFiles(t *testing.T) {
+	t.Run(ContentDelete, func(t *testing.T) {
+		s := newTestService(t)
+		user := createUploadedUser(t, s)
+
+		if err := s.PurgeUser(context.Background(), user.ID, ContentDelete); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, key := range []string{"uploads/picture.png", "uploads/picture-thumbnail.png", "avatars/jane.png"} {
+			if stored(t, s, key) {
+				t.Errorf("%s is still stored", key)
+			}
+		}
+		if trashed, err := s.Store.Blog.MediaTrashedList(context.Background(), 10); err != nil || len(trashed) != 0 {
+			t.Errorf("the rows of the removed files are left: %d, %v", len(trashed), err)
+		}
+	})
+
+	t.Run(ContentAnonymize, func(t *testing.T) {
+		s := newTestService(t)
+		user := createUploadedUser(t, s)
+
+		if err := s.PurgeUser(context.Background(), user.ID, ContentAnonymize); err != nil {
+			t.Fatal(err)
+		}
+
+		if stored(t, s, "avatars/jane.png") {
+			t.Error("the avatar is still stored")
+		}
+		if !stored(t, s, "uploads/picture.png") || !stored(t, s, "uploads/picture-thumbnail.png") {
+			t.Error("the anonymized upload was removed")
+		}
+		if _, err := s.Store.Blog.MediaRead(context.Background(), user.Upload.ID); err != nil {
+			t.Errorf("the anonymized upload is gone: %v", err)
+		}
+	})
+}
+
+func TestDeleteUserContent(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		status     int
+		anonymized bool
+	}{
+		{"empty body", "", http.StatusOK, true},
+		{"anonymize", `{"content": "anonymize"}`, http.StatusOK, true},
+		{"delete", `{"content": "delete"}`, http.StatusOK, false},
+		{"unknown", `{"content": "keep"}`, http.StatusUnprocessableEntity, true},
+	}
+
+	for _, test := range tests {
+		s := newTestService(t)
+		s.Config.DeletionGraceDays = 0
+		user := createUploadedUser(t, s)
+
+		authUser, err := s.Store.Auth.AuthUserRead(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := GenerateOneTimeToken(32, uint(user.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodDelete, "/user/delete?token="+url.QueryEscape(token), strings.NewReader(test.body))
+		r = r.WithContext(context.WithValue(r.Context(), current_user, authUser))
+		w := httptest.NewRecorder()
+		s.DeleteUser(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s: got %d %s, want %d", test.name, w.Code, w.Body, test.status)
+		}
+		if kept := stored(t, s, "uploads/picture.png"); kept != test.anonymized {
+			t.Errorf("%s: the upload is kept %v, want %v", test.name, kept, test.anonymized)
+		}
+	}
+}
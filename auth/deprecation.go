@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Deprecation marks a route that is being retired. Responses carry the
+// Deprecation header of RFC 9745, the Sunset header of RFC 8594 once a date is
+// set, and a link to the route that replaces it.
+type Deprecation struct {
+	Since     time.Time // when the route was deprecated
+	Sunset    time.Time // when the route goes away, zero until that is decided
+	Successor string    // path of the replacing route, its wildcards are filled from the request
+}
+
+// Deprecated sets the deprecation headers on every response of next.
+func Deprecated(d Deprecation) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+			if !d.Sunset.IsZero() {
+				w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if d.Successor != "" {
+				w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", fillWildcards(d.Successor, r)))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Alias serves view at route as well, deprecated in favour of the view itself
+// at successor.
+func Alias(route string, view View, successor string, d Deprecation) View {
+	d.Successor = successor
+	view.Route = route
+	view.Deprecation = &d
+	return view
+}
+
+// Aliases serves views without the prefix of their group, deprecated in favour
+// of the prefixed routes. It keeps unversioned routes working while clients move
+// to a versioned API.
+func Aliases(views []View, prefix string, d Deprecation) []View {
+	aliases := make([]View, 0, len(views))
+	for _, view := range views {
+		aliases = append(aliases, Alias(view.Route, view, prefix+view.Route, d))
+	}
+	return aliases
+}
+
+// Override returns the views of base with those of overrides in place of the
+// views they replace, matched by route and method. It builds a new version of the
+// API from the previous one, so only the views that change need to be written:
+//
+//	v2 := auth.Override(v1, BlogReadViewV2)
+func Override(base []View, overrides ...View) []View {
+	views := make([]View, 0, len(base)+len(overrides))
+
+	for _, view := range base {
+		methods := slices.Clone(view.Methods)
+		for _, override := range overrides {
+			if override.Route != view.Route {
+				continue
+			}
+			methods = slices.DeleteFunc(methods, func(method string) bool {
+				return len(override.Methods) == 0 || slices.Contains(override.Methods, method)
+			})
+		}
+
+		if len(view.Methods) > 0 && len(methods) == 0 {
+			continue // replaced entirely
+		}
+		if len(view.Methods) == 0 && slices.ContainsFunc(overrides, func(o View) bool { return o.Route == view.Route }) {
+			continue
+		}
+
+		view.Methods = methods
+		views = append(views, view)
+	}
+
+	return append(views, overrides...)
+}
+
+// fillWildcards replaces the {name} wildcards of pattern with the values matched
+// for the request.
+func fillWildcards(pattern string, r *http.Request) string {
+	var path strings.Builder
+	for {
+		start := strings.IndexByte(pattern, '{')
+		end := strings.IndexByte(pattern, '}')
+		if start < 0 || end < start {
+			path.WriteString(pattern)
+			return path.String()
+		}
+
+		path.WriteString(pattern[:start])
+		if name := strings.TrimSuffix(pattern[start+1:end], "..."); name != "$" {
+			path.WriteString(r.PathValue(name))
+		}
+		pattern = pattern[end+1:]
+	}
+}
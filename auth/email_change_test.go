@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/immanuel-254/blog/auth/models"
+)
+
+// sentEmail is an email kept by recordingMailer.
+type sentEmail struct {
+	to, subject, html string
+}
+
+// recordingMailer keeps what would have been sent, and fails for the addresses
+// in fail.
+type recordingMailer struct {
+	sent []sentEmail
+	fail map[string]bool
+}
+
+func (m *recordingMailer) Send(ctx context.Context, to, subject, html string) error {
+	if m.fail[to] {
+		return errors.New("mailbox unavailable")
+	}
+	m.sent = append(m.sent, sentEmail{to, subject, html})
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=([A-Za-z0-9_=-]+)`)
+
+// token returns the token in the link of the last email sent to to.
+func (m *recordingMailer) token(t *testing.T, to string) string {
+	t.Helper()
+
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].to == to {
+			if match := linkToken.FindStringSubmatch(m.sent[i].html); match != nil {
+				return match[1]
+			}
+		}
+	}
+	t.Fatalf("no link was sent to %s", to)
+	return ""
+}
+
+// emailChangeRequest calls handler on target, as user when it is set.
+func emailChangeRequest(handler http.HandlerFunc, user *models.AuthUserReadRow, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if user != nil {
+		r = r.WithContext(context.WithValue(r.Context(), current_user, *user))
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// requestEmailChange creates a user and asks to move them to new@example.com.
+func requestEmailChange(t *testing.T) (*Service, *recordingMailer, models.AuthUserReadRow) {
+	t.Helper()
+
+	s := newTestService(t)
+	mailer := &recordingMailer{}
+	s.Mailer = mailer
+
+	user, err := s.Store.Auth.AuthUserRead(context.Background(), createUser(t, s, "old@example.com", "hash").ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := emailChangeRequest(s.ChangeEmailRequest, &user, http.MethodPost, "/change-email-request", `{"email": "new@example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("request: got %d %s", w.Code, w.Body)
+	}
+	return s, mailer, user
+}
+
+func emailOf(t *testing.T, s *Service, id int64) string {
+	t.Helper()
+
+	user, err := s.Store.Auth.AuthUserRead(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.Email
+}
+
+func TestChangeEmailRequest(t *testing.T) {
+	_, mailer, _ := requestEmailChange(t)
+
+	if len(mailer.sent) != 2 {
+		t.Fatalf("sent %d emails", len(mailer.sent))
+	}
+	if confirm := mailer.sent[0]; confirm.to != "new@example.com" || !strings.Contains(confirm.html, "/change-email/?token=") {
+		t.Errorf("confirmation: %+v", confirm)
+	}
+	if notice := mailer.sent[1]; notice.to != "old@example.com" || !strings.Contains(notice.html, "/change-email-cancel/?token=") {
+		t.Errorf("notification: %+v", notice)
+	}
+}
+
+func TestChangeEmailRequestMailFailures(t *testing.T) {
+	s := newTestService(t)
+	mailer := &recordingMailer{fail: map[string]bool{"new@example.com": true}}
+	s.Mailer = mailer
+
+	user, err := s.Store.Auth.AuthUserRead(context.Background(), createUser(t, s, "old@example.com", "hash").ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing can be confirmed, so nothing stays pending
+	w := emailChangeRequest(s.ChangeEmailRequest, &user, http.MethodPost, "/change-email-request", `{"email": "new@example.com"}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("failed confirmation: got %d %s", w.Code, w.Body)
+	}
+	if len(mailer.sent) != 0 {
+		t.Errorf("sent %d emails", len(mailer.sent))
+	}
+	var pending int
+	if err := s.Store.DB.QueryRow("SELECT COUNT(*) FROM email_changes").Scan(&pending); err != nil || pending != 0 {
+		t.Errorf("%d pending changes, %v", pending, err)
+	}
+
+	// a lost notification is only logged
+	mailer.fail = map[string]bool{"old@example.com": true}
+	w = emailChangeRequest(s.ChangeEmailRequest, &user, http.MethodPost, "/change-email-request", `{"email": "new@example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("failed notification: got %d %s", w.Code, w.Body)
+	}
+	w = emailChangeRequest(s.ChangeEmail, &user, http.MethodPut, "/change-email?token="+url.QueryEscape(mailer.token(t, "new@example.com")), "")
+	if w.Code != http.StatusOK || emailOf(t, s, user.ID) != "new@example.com" {
+		t.Errorf("confirm: got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	s, mailer, user := requestEmailChange(t)
+	confirm := "/change-email?token=" + url.QueryEscape(mailer.token(t, "new@example.com"))
+
+	// the cancel token does not confirm
+	w := emailChangeRequest(s.ChangeEmail, &user, http.MethodPut, "/change-email?token="+url.QueryEscape(mailer.token(t, "old@example.com")), "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("with the cancel token: got %d %s", w.Code, w.Body)
+	}
+
+	// only by the user who asked
+	other, err := s.Store.Auth.AuthUserRead(context.Background(), createUser(t, s, "other@example.com", "hash").ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := emailChangeRequest(s.ChangeEmail, &other, http.MethodPut, confirm, ""); w.Code != http.StatusForbidden {
+		t.Errorf("by another user: got %d %s", w.Code, w.Body)
+	}
+
+	if w := emailChangeRequest(s.ChangeEmail, &user, http.MethodPut, confirm, ""); w.Code != http.StatusOK {
+		t.Fatalf("confirm: got %d %s", w.Code, w.Body)
+	}
+	if email := emailOf(t, s, user.ID); email != "new@example.com" {
+		t.Errorf("the email is %s", email)
+	}
+
+	if w := emailChangeRequest(s.ChangeEmail, &user, http.MethodPut, confirm, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("confirm twice: got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestChangeEmailCancel(t *testing.T) {
+	s, mailer, user := requestEmailChange(t)
+
+	// the link works without a session and without anything kept in memory
+	s = &Service{Store: s.Store, Config: s.Config, Media: s.Media, Mailer: mailer}
+	cancel := "/change-email-cancel?token=" + url.QueryEscape(mailer.token(t, "old@example.com"))
+	if w := emailChangeRequest(s.ChangeEmailCancel, nil, http.MethodPut, cancel, ""); w.Code != http.StatusOK {
+		t.Fatalf("cancel: got %d %s", w.Code, w.Body)
+	}
+	if w := emailChangeRequest(s.ChangeEmailCancel, nil, http.MethodPut, cancel, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("cancel twice: got %d %s", w.Code, w.Body)
+	}
+
+	w := emailChangeRequest(s.ChangeEmail, &user, http.MethodPut, "/change-email?token="+url.QueryEscape(mailer.token(t, "new@example.com")), "")
+	if w.Code != http.StatusBadRequest || emailOf(t, s, user.ID) != "old@example.com" {
+		t.Errorf("confirm a cancelled change: got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestEmailChangeExpires(t *testing.T) {
+	s, mailer, user := requestEmailChange(t)
+
+	_, err := s.Store.DB.Exec("UPDATE email_changes SET created_at = ?", sql.NullTime{Time: time.Now().Add(-EmailChangeTTL - time.Minute), Valid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := emailChangeRequest(s.ChangeEmailCancel, nil, http.MethodPut, "/change-email-cancel?token="+url.QueryEscape(mailer.token(t, "old@example.com")), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("cancel: got %d %s", w.Code, w.Body)
+	}
+	if w := emailChangeRequest(s.ChangeEmail, &user, http.MethodPut, "/change-email?token="+url.QueryEscape(mailer.token(t, "new@example.com")), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("confirm: got %d %s", w.Code, w.Body)
+	}
+}
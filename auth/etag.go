@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/immanuel-254/blog/apierror"
+)
+
+// ETag returns the entity tag of a resource at version. Parts of its
+// representation that are not covered by the version, such as the comments of a
+// blog, are hashed into the tag so reads see them change. If-Match only compares
+// the version, so they never fail an update.
+func ETag(version int64, parts ...interface{}) string {
+	if len(parts) == 0 {
+		return fmt.Sprintf(`"%d"`, version)
+	}
+
+	hash := fnv.New64a()
+	encoder := json.NewEncoder(hash)
+	for _, part := range parts {
+		if err := encoder.Encode(part); err != nil {
+			panic(err) // parts are query results, which always encode
+		}
+	}
+
+	return fmt.Sprintf(`"%d-%x"`, version, hash.Sum64())
+}
+
+// NotModified sets the ETag header of a read. When If-None-Match already names
+// the tag, it responds 304 Not Modified and returns true.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	for _, tag := range entityTags(r.Header.Values("If-None-Match")) {
+		// If-None-Match uses the weak comparison
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckIfMatch returns a 412 Precondition Failed error unless If-Match is absent,
+// is * or names a tag of the resource at version. Run it in the transaction of
+// the update, after reading the version.
+func CheckIfMatch(r *http.Request, version int64) error {
+	tags := entityTags(r.Header.Values("If-Match"))
+	if len(tags) == 0 {
+		return nil
+	}
+
+	for _, tag := range tags {
+		if tag == "*" {
+			return nil
+		}
+		// If-Match uses the strong comparison, which weak tags never pass
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		if tagVersion, ok := etagVersion(tag); ok && tagVersion == version {
+			return nil
+		}
+	}
+
+	return apierror.PreconditionFailed("the resource was changed since it was read")
+}
+
+// entityTags splits the values of an If-Match or If-None-Match header.
+func entityTags(values []string) []string {
+	var tags []string
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// etagVersion returns the version of a tag made by ETag.
+func etagVersion(tag string) (int64, bool) {
+	tag, ok := strings.CutPrefix(tag, `"`)
+	if !ok {
+		return 0, false
+	}
+	tag, ok = strings.CutSuffix(tag, `"`)
+	if !ok {
+		return 0, false
+	}
+	tag, _, _ = strings.Cut(tag, "-")
+
+	version, err := strconv.ParseInt(tag, 10, 64)
+	return version, err == nil
+}
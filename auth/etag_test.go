@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/immanuel-254/blog/apierror"
+)
+
+func TestETag(t *testing.T) {
+	if got := ETag(3); got != `"3"` {
+		t.Errorf("version only: got %s", got)
+	}
+
+	tag := ETag(3, "comments")
+	if !strings.HasPrefix(tag, `"3-`) || tag == ETag(3, "other comments") || tag != ETag(3, "comments") {
+		t.Errorf("with parts: got %s", tag)
+	}
+	if version, ok := etagVersion(tag); !ok || version != 3 {
+		t.Errorf("version of %s: got %d %v", tag, version, ok)
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	etag := ETag(2, "comments")
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		notModified bool
+	}{
+		{"no header", "", false},
+		{"same tag", etag, true},
+		{"weak tag", "W/" + etag, true},
+		{"one of a list", `"1", ` + etag, true},
+		{"any", "*", true},
+		{"older version", ETag(1, "comments"), false},
+		{"other parts", ETag(2, "new comments"), false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/blogs/1", nil)
+		if test.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", test.ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+
+		if got := NotModified(w, r, etag); got != test.notModified {
+			t.Errorf("%s: got %v", test.name, got)
+		}
+		if test.notModified && w.Code != http.StatusNotModified {
+			t.Errorf("%s: answered %d", test.name, w.Code)
+		}
+		if got := w.Header().Get("ETag"); got != etag {
+			t.Errorf("%s: ETag %s", test.name, got)
+		}
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		ok      bool
+	}{
+		{"no header", "", true},
+		{"same version", ETag(2), true},
+		{"same version with parts", ETag(2, "old comments"), true},
+		{"one of a list", `"1", ` + ETag(2), true},
+		{"any", "*", true},
+		{"older version", ETag(1), false},
+		{"weak tag", "W/" + ETag(2), false},
+		{"not a tag", "2", false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/blogs/1", nil)
+		if test.ifMatch != "" {
+			r.Header.Set("If-Match", test.ifMatch)
+		}
+
+		err := CheckIfMatch(r, 2)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.ok && apierror.From(err).Status != http.StatusPreconditionFailed {
+			t.Errorf("%s: got %v, want 412", test.name, err)
+		}
+	}
+}
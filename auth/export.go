@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/immanuel-254/blog/apierror"
+	"github.com/immanuel-254/blog/auth/models"
+	blogmodels "github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/media"
+	"github.com/immanuel-254/blog/store"
+)
+
+// ExportFile is one file of a user export, Data encoded as JSON or, for
+// uploads, the file Open returns copied as is.
+type ExportFile struct {
+	Name string
+	Data interface{}
+	Open func() (io.ReadCloser, error)
+}
+
+// ExportFiles collects everything stored about a user.
+func (s *Service) ExportFiles(ctx context.Context, userId int64) ([]ExportFile, error) {
+	queries := s.Store.Auth
+	blogqueries := s.Store.Blog
+
+	owner := sql.NullInt64{Int64: userId, Valid: true}
+
+	user, err := queries.UserRead(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile *blogmodels.Profile
+
+	userProfile, err := blogqueries.ProfileUserRead(ctx, owner)
+	if err == nil {
+		profile = &userProfile
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	blogs, err := blogqueries.BlogUserList(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := blogqueries.CommentUserList(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	// session keys are credentials and are left out of the export
+	sessions, err := queries.SessionUserList(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := queries.LogUserList(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	// revisions they wrote and those of their blogs
+	revisions, err := blogqueries.BlogRevisionUserList(ctx, blogmodels.BlogRevisionUserListParams{AuthorID: owner, UserID: owner})
+	if err != nil {
+		return nil, err
+	}
+
+	// the avatar is one of the uploads, profile.json has its id
+	uploads, err := blogqueries.MediaUserList(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []ExportFile{
+		{Name: "user.json", Data: user},
+		{Name: "profile.json", Data: profile},
+		{Name: "blogs.json", Data: blogs},
+		{Name: "revisions.json", Data: revisions},
+		{Name: "comments.json", Data: comments},
+		{Name: "media.json", Data: uploads},
+		{Name: "sessions.json", Data: sessions},
+		{Name: "logs.json", Data: logs},
+	}
+
+	// the stored files go under media/ at their keys, variants included
+	for _, item := range uploads {
+		var variants []media.Variant
+		if err := json.Unmarshal([]byte(item.Variants), &variants); err != nil {
+			return nil, fmt.Errorf("media %d: reading variants: %w", item.ID, err)
+		}
+
+		keys := []string{item.Key}
+		for _, variant := range variants {
+			keys = append(keys, variant.Key)
+		}
+
+		for _, key := range keys {
+			files = append(files, ExportFile{
+				Name: "media/" + key,
+				Open: func() (io.ReadCloser, error) { return s.Media.Open(ctx, key) },
+			})
+		}
+	}
+
+	return files, nil
+}
+
+// WriteExport writes the files of a user export as a ZIP archive.
+func WriteExport(w io.Writer, files []ExportFile) error {
+	archive := zip.NewWriter(w)
+
+	for _, file := range files {
+		writer, err := archive.Create(file.Name)
+		if err != nil {
+			return err
+		}
+
+		if file.Open != nil {
+			if err := copyExportFile(writer, file); err != nil {
+				return err
+			}
+			continue
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(file.Data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func copyExportFile(w io.Writer, file ExportFile) error {
+	reader, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("exporting %s: %w", file.Name, err)
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(w, reader); err != nil {
+		return fmt.Errorf("exporting %s: %w", file.Name, err)
+	}
+
+	return nil
+}
+
+// UserExport sends the current user a ZIP of JSON files and uploads with everything stored about them.
+func (s *Service) UserExport(w http.ResponseWriter, r *http.Request) {
+	queries := s.Store.Auth
+	ctx := r.Context()
+
+	auth := ctx.Value(current_user)
+
+	if auth == nil {
+		apierror.Write(w, r, errNoCurrentUser)
+		return
+	}
+
+	authUser := auth.(models.AuthUserReadRow)
+
+	files, err := s.ExportFiles(ctx, authUser.ID)
+
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := LogAction(queries, ctx, "user", "export", authUser.ID, authUser.ID); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"user-%d-export-%s.zip\"", authUser.ID, time.Now().Format("20060102")))
+
+	if err := WriteExport(w, files); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write export", "error", err)
+	}
+}
+
+// ImportResult counts what ImportUser created.
+type ImportResult struct {
+	UserID   int64
+	Email    string
+	Profile  bool
+	Blogs    int
+	Comments int
+	Skipped  int // comments on blogs that were not part of the export
+}
+
+// ImportUser recreates a user from an export made by ExportFiles, in a single transaction.
+// Passwords are never exported, so the imported user gets a random one and has to reset it.
+// Uploads and the history of blogs are not imported.
+func (s *Service) ImportUser(ctx context.Context, archive *zip.Reader) (ImportResult, error) {
+	var result ImportResult
+
+	var (
+		user     models.UserReadRow
+		profile  *blogmodels.Profile
+		blogs    []blogmodels.Blog
+		comments []blogmodels.Comment
+	)
+
+	for _, file := range []ExportFile{
+		{Name: "user.json", Data: &user},
+		{Name: "profile.json", Data: &profile},
+		{Name: "blogs.json", Data: &blogs},
+		{Name: "comments.json", Data: &comments},
+	} {
+		if err := readExportFile(archive, file); err != nil {
+			return result, err
+		}
+	}
+
+	if user.Email == "" {
+		return result, fmt.Errorf("user.json has no email")
+	}
+
+	err := s.Store.WithTx(ctx, func(tx *store.Store) (err error) {
+		result, err = s.importUser(tx, ctx, user, profile, blogs, comments)
+		return err
+	})
+
+	return result, err
+}
+
+// importUser creates the user and their content read by ImportUser.
+
+func (s *Service) importUser(tx *store.Store, ctx context.Context, user models.UserReadRow, profile *blogmodels.Profile, blogs []blogmodels.Blog, comments []blogmodels.Comment) (ImportResult, error) {
+	var result ImportResult
+
+	queries := tx.Auth
+	blogqueries := tx.Blog
+
+	exists, err := queries.UserEmailExists(ctx, user.Email)
+	if err != nil {
+		return result, err
+	}
+	if exists != 0 {
+		return result, fmt.Errorf("a user with the email %s already exists", user.Email)
+	}
+
+	hash, err := HashPassword(s.Config.Password, randomToken(32))
+	if err != nil {
+		return result, err
+	}
+
+	created, err := queries.UserCreate(ctx, models.UserCreateParams{
+		Email:     user.Email,
+		Password:  hash,
+		Isactive:  sql.NullBool{Bool: true, Valid: true},
+		Isstaff:   sql.NullBool{Bool: false, Valid: true},
+		Isadmin:   sql.NullBool{Bool: false, Valid: true},
+		CreatedAt: user.CreatedAt,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	result.UserID = created.ID
+	result.Email = created.Email
+	owner := sql.NullInt64{Int64: created.ID, Valid: true}
+
+	if profile != nil {
+		_, err = blogqueries.ProfileImport(ctx, blogmodels.ProfileImportParams{
+			UserID:    owner,
+			Username:  profile.Username,
+			Image:     profile.Image,
+			Bio:       profile.Bio,
+			CreatedAt: profile.CreatedAt,
+			UpdatedAt: profile.UpdatedAt,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Profile = true
+	}
+
+	// blogs get new ids, so comments are pointed at the new blog
+	blogIds := make(map[int64]int64, len(blogs))
+
+	for _, blog := range blogs {
+		imported, err := blogqueries.BlogImport(ctx, blogmodels.BlogImportParams{
+			UserID:    owner,
+			Title:     blog.Title,
+			Body:      blog.Body,
+			Publish:   blog.Publish,
+			CreatedAt: blog.CreatedAt,
+			UpdatedAt: blog.UpdatedAt,
+		})
+		if err != nil {
+			return result, err
+		}
+
+		// the history of the blog is not exported, it starts over at what it holds
+		_, err = blogqueries.BlogRevisionCreate(ctx, blogmodels.BlogRevisionCreateParams{
+			BlogID:    imported.ID,
+			BlogID_2:  imported.ID,
+			Title:     imported.Title,
+			Body:      imported.Body,
+			AuthorID:  owner,
+			CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return result, err
+		}
+
+		blogIds[blog.ID] = imported.ID
+		result.Blogs++
+	}
+
+	for _, comment := range comments {
+		blogId, ok := blogIds[comment.BlogID.Int64]
+		if !comment.BlogID.Valid || !ok {
+			result.Skipped++
+			continue
+		}
+
+		_, err := blogqueries.CommentImport(ctx, blogmodels.CommentImportParams{
+			UserID:    owner,
+			BlogID:    sql.NullInt64{Int64: blogId, Valid: true},
+			Body:      comment.Body,
+			CreatedAt: comment.CreatedAt,
+			UpdatedAt: comment.UpdatedAt,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Comments++
+	}
+
+	err = queries.LogCreate(ctx, models.LogCreateParams{
+		DbTable:   "user",
+		Action:    "import",
+		ObjectID:  created.ID,
+		UserID:    0,
+		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func readExportFile(archive *zip.Reader, file ExportFile) error {
+	reader, err := archive.Open(file.Name)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", file.Name, err)
+	}
+	defer reader.Close()
+
+	if err := json.NewDecoder(reader).Decode(file.Data); err != nil {
+		return fmt.Errorf("reading %s: %w", file.Name, err)
+	}
+
+	return nil
+}
@@ -3,23 +3,22 @@ package auth
 import (
 	"net/http"
 
+	"github.com/immanuel-254/blog/apierror"
 	"github.com/immanuel-254/blog/auth/models"
-	"github.com/immanuel-254/blog/database"
 )
 
-func LogList(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+type LogListOutput struct {
+	Logs []models.LogListRow `json:"logs"`
+}
 
-	queries := models.New(database.DB)
+func (s *Service) LogList(w http.ResponseWriter, r *http.Request) {
+	queries := s.Store.Auth
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
@@ -28,11 +27,14 @@ func LogList(w http.ResponseWriter, r *http.Request) {
 	logs, err := queries.LogList(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	Logging(queries, ctx, "log", "list", 0, authUser.ID, w, r)
+	if err := LogAction(queries, ctx, "log", "list", 0, authUser.ID); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
 	SendData(map[string]interface{}{"logs": logs}, w, r)
 }
@@ -2,14 +2,17 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/immanuel-254/blog/apierror"
 	"github.com/immanuel-254/blog/auth/models"
-	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/config"
 )
 
 // Config defines the configuration for the middleware.
@@ -32,6 +35,7 @@ type Config struct {
 	HSTSMaxAge                int
 	HSTSExcludeSubdomains     bool
 	HSTSPreloadEnabled        bool
+	HTTPS                     bool // served over HTTPS by a proxy, so HSTS is sent on plain connections too
 }
 
 // ConfigDefault provides default configuration values.
@@ -49,6 +53,35 @@ var ConfigDefault = Config{
 	XPermittedCrossDomain:     "none",
 }
 
+// SecurityHeaders builds the security headers configuration from the application
+// configuration, for a site served over HTTPS when https is set.
+func SecurityHeaders(settings config.SecurityConfig, https bool) Config {
+	cfg := ConfigDefault
+	cfg.HTTPS = https
+
+	if settings.ContentSecurityPolicy != "" {
+		cfg.ContentSecurityPolicy = settings.ContentSecurityPolicy
+	}
+	cfg.CSPReportOnly = settings.CSPReportOnly
+	if settings.XFrameOptions != "" {
+		cfg.XFrameOptions = settings.XFrameOptions
+	}
+	if settings.ReferrerPolicy != "" {
+		cfg.ReferrerPolicy = settings.ReferrerPolicy
+	}
+	if settings.PermissionsPolicy != "" {
+		cfg.PermissionPolicy = settings.PermissionsPolicy
+	}
+	if settings.CrossOriginResourcePolicy != "" {
+		cfg.CrossOriginResourcePolicy = settings.CrossOriginResourcePolicy
+	}
+	cfg.HSTSMaxAge = settings.HSTSMaxAge
+	cfg.HSTSExcludeSubdomains = settings.HSTSExcludeSubdomains
+	cfg.HSTSPreloadEnabled = settings.HSTSPreload
+
+	return cfg
+}
+
 // New creates the middleware handler for `net/http`.
 func New(config ...Config) func(next http.Handler) http.Handler {
 	// Initialize the configuration.
@@ -98,7 +131,7 @@ func New(config ...Config) func(next http.Handler) http.Handler {
 			}
 
 			// Handle HSTS headers.
-			if r.TLS != nil && cfg.HSTSMaxAge > 0 {
+			if (r.TLS != nil || cfg.HTTPS) && cfg.HSTSMaxAge > 0 {
 				subdomains := ""
 				if !cfg.HSTSExcludeSubdomains {
 					subdomains = "; includeSubDomains"
@@ -175,201 +208,264 @@ func configDefault(config ...Config) Config {
 	return cfg
 }
 
-func Cors(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		allowedOrigin := os.Getenv("DOMAIN") // Replace with your origin
-		origin := r.Header.Get("Origin")
-		if origin != "" && origin != allowedOrigin {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
+// CorsConfig defines the CORS policy for the middleware.
+type CorsConfig struct {
+	Next             func(r *http.Request) bool
+	AllowOrigins     []string // "*" allows any origin, unless AllowCredentials is set
+	AllowMethods     []string
+	AllowHeaders     []string // empty allows the headers a preflight asks for
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           int // seconds a preflight response may be cached
+}
+
+// CorsConfigDefault provides default CORS values, allowing no cross-origin requests.
+var CorsConfigDefault = CorsConfig{
+	AllowMethods: []string{
+		http.MethodGet,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+		http.MethodOptions,
+	},
+	AllowHeaders: []string{"Content-Type", "auth", CSRFHeaderName},
+	MaxAge:       600,
+}
+
+// NewCorsConfig builds the CORS policy from the application configuration.
+func NewCorsConfig(settings config.CorsConfig) CorsConfig {
+	cfg := CorsConfigDefault
+
+	cfg.AllowOrigins = settings.AllowOrigins
+	if len(settings.AllowMethods) > 0 {
+		cfg.AllowMethods = settings.AllowMethods
+	}
+	if len(settings.AllowHeaders) > 0 {
+		cfg.AllowHeaders = settings.AllowHeaders
+	}
+	cfg.ExposeHeaders = settings.ExposeHeaders
+	cfg.AllowCredentials = settings.AllowCredentials
+	cfg.MaxAge = settings.MaxAge
+
+	return cfg
+}
+
+func (cfg CorsConfig) allowOrigin(origin string) (string, bool) {
+	for _, allowed := range cfg.AllowOrigins {
+		if allowed == "*" {
+			// never together with credentials, which browsers refuse on a wildcard
+			// and echoing the origin would grant to every site
+			if cfg.AllowCredentials {
+				return "", false
+			}
+			return "*", true
 		}
-		next.ServeHTTP(w, r)
-	})
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return origin, true
+		}
+	}
+	return "", false
 }
 
-type currentUser string
+// Cors creates the CORS middleware handler for `net/http`. Preflight requests are
+// answered directly; requests from origins outside the policy get no CORS headers,
+// which makes the browser withhold the response.
+func Cors(config ...CorsConfig) func(next http.Handler) http.Handler {
+	cfg := CorsConfigDefault
+	if len(config) > 0 {
+		cfg = config[0]
+	}
 
-const current_user currentUser = "current_user"
+	allowMethods := strings.Join(cfg.AllowMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(cfg.MaxAge)
 
-func RequireAuth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		queries := models.New(database.DB)
-		ctx := r.Context()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Check if the middleware should skip the request.
+			if cfg.Next != nil && cfg.Next(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-		var token string
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
 
-		// 1. Check for token in Authorization header
-		token = r.Header.Get("auth")
+			w.Header().Add("Vary", "Origin")
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
 
-		// 2. If no token in header, check for the session_token cookie
-		if token == "" {
-			cookie, err := r.Cookie("session_token")
-			if err == nil {
-				token = cookie.Value // Use token from cookie if available
+			allowedOrigin, allowed := cfg.allowOrigin(origin)
+
+			if origin == "" || !allowed {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
 			}
-		}
 
-		// 3. If no token found in either place, return error
-		if token == "" {
-			http.Error(w, "missing auth token", http.StatusForbidden)
-			return
-		}
+			w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
 
-		session, err := queries.SessionRead(ctx, token)
+			if !preflight {
+				if exposeHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+			w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+			if allowHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+			} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				w.Header().Set("Access-Control-Allow-Headers", requested)
+			}
+			if cfg.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
 
-		if session.CreatedAt.Time.AddDate(0, 0, 30).Unix() < time.Now().Unix() {
-			http.Error(w, "session has expired", http.StatusBadRequest)
-			return
-		}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
 
-		user, err := queries.AuthUserRead(ctx, session.UserID)
+type currentUser string
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+const current_user currentUser = "current_user"
 
-		if !user.Isactive.Bool {
-			http.Error(w, "inactive user", http.StatusForbidden)
-			return
-		}
+// errNoCurrentUser means a handler that needs the user was registered without RequireAuth.
+var errNoCurrentUser = errors.New("there is no current user")
 
-		ctx = context.WithValue(ctx, current_user, user) // Store user in context
-		r = r.WithContext(ctx)
+// CurrentUser returns the user RequireAuth signed in, for handlers of other
+// packages.
+func CurrentUser(ctx context.Context) (models.AuthUserReadRow, error) {
+	user, ok := ctx.Value(current_user).(models.AuthUserReadRow)
+	if !ok {
+		return user, errNoCurrentUser
+	}
+	return user, nil
+}
 
-		next.ServeHTTP(w, r)
-	})
+// WithCurrentUser returns ctx with user signed in, as RequireAuth leaves it.
+func WithCurrentUser(ctx context.Context, user models.AuthUserReadRow) context.Context {
+	return context.WithValue(ctx, current_user, user)
 }
 
-/*func RequireStaff(next http.Handler) http.Handler {
+func (s *Service) RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		queries := models.New(database.DB)
-		ctx := context.Background()
+		queries := s.Store.Auth
+		ctx := r.Context()
+
+		// Check for token in the auth header, then the session_token cookie
+		token, _ := sessionToken(r)
 
-		if w.Header().Get("auth") == "" {
-			http.Error(w, "missing auth token", http.StatusForbidden)
+		// If no token found in either place, return error
+		if token == "" {
+			apierror.Write(w, r, apierror.Forbidden("missing auth token"))
 			return
 		}
 
-		session, err := queries.SessionRead(ctx, w.Header().Get("auth"))
+		session, err := queries.SessionRead(ctx, token)
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, r, apierror.IfNotFound(err, apierror.BadRequest("invalid auth token")))
 			return
 		}
 
 		if session.CreatedAt.Time.AddDate(0, 0, 30).Unix() < time.Now().Unix() {
-			http.Error(w, "session has expired", http.StatusBadRequest)
+			apierror.Write(w, r, apierror.BadRequest("session has expired"))
 			return
 		}
 
 		user, err := queries.AuthUserRead(ctx, session.UserID)
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, r, apierror.IfNotFound(err, apierror.BadRequest("invalid auth token")))
 			return
 		}
 
 		if !user.Isactive.Bool {
-			http.Error(w, "invalid user", http.StatusForbidden)
-			return
-		}
-
-		if !user.Isstaff.Bool {
-			http.Error(w, "invalid user", http.StatusForbidden)
+			apierror.Write(w, r, apierror.Forbidden("inactive user"))
 			return
 		}
 
-		_ = context.WithValue(ctx, current_user, user)
+		setUserID(ctx, user.ID)
+		ctx = WithCurrentUser(ctx, user)
+		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
 	})
-}*/
+}
 
-func RequireAdmin(next http.Handler) http.Handler {
+func (s *Service) RequireAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		queries := models.New(database.DB)
+		queries := s.Store.Auth
 		ctx := r.Context()
 
-		var token string
-
-		// 1. Check for token in Authorization header
-		token = r.Header.Get("auth")
+		// Check for token in the auth header, then the session_token cookie
+		token, _ := sessionToken(r)
 
-		// 2. If no token in header, check for the session_token cookie
+		// If no token found in either place, return error
 		if token == "" {
-			cookie, err := r.Cookie("session_token")
-			if err == nil {
-				token = cookie.Value // Use token from cookie if available
-			}
-		}
-
-		// 3. If no token found in either place, return error
-		if token == "" {
-			http.Error(w, "Missing auth token", http.StatusForbidden)
+			apierror.Write(w, r, apierror.Forbidden("Missing auth token"))
 			return
 		}
 
 		session, err := queries.SessionRead(ctx, token)
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, r, apierror.IfNotFound(err, apierror.BadRequest("invalid auth token")))
 			return
 		}
 
 		if session.CreatedAt.Time.AddDate(0, 0, 30).Unix() < time.Now().Unix() {
-			http.Error(w, "session has expired", http.StatusBadRequest)
+			apierror.Write(w, r, apierror.BadRequest("session has expired"))
 			return
 		}
 
 		user, err := queries.AuthUserRead(ctx, session.UserID)
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, r, apierror.IfNotFound(err, apierror.BadRequest("invalid auth token")))
 			return
 		}
 
 		if !user.Isactive.Bool {
-			http.Error(w, "invalid user", http.StatusForbidden)
+			apierror.Write(w, r, apierror.Forbidden("invalid user"))
 			return
 		}
 
 		if !user.Isadmin.Bool {
-			http.Error(w, "invalid user", http.StatusForbidden)
+			apierror.Write(w, r, apierror.Forbidden("invalid user"))
 			return
 		}
 
-		ctx = context.WithValue(ctx, current_user, user) // Store user in context
+		setUserID(ctx, user.ID)
+		ctx = WithCurrentUser(ctx, user)
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
-func DashRequireAdmin(next http.Handler) http.Handler {
+func (s *Service) DashRequireAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		queries := models.New(database.DB)
+		queries := s.Store.Auth
 		ctx := r.Context()
 
-		var token string
+		// Check for token in the auth header, then the session_token cookie
+		token, _ := sessionToken(r)
 
-		// 1. Check for token in Authorization header
-		token = r.Header.Get("auth")
-
-		// 2. If no token in header, check for the session_token cookie
-		if token == "" {
-			cookie, err := r.Cookie("session_token")
-			if err == nil {
-				token = cookie.Value // Use token from cookie if available
-			}
-		}
-
-		// 3. If no token found in either place, return error
+		// If no token found in either place, return error
 		if token == "" {
 			http.Redirect(w, r, "/dash-login", http.StatusSeeOther)
 			return
@@ -378,7 +474,7 @@ func DashRequireAdmin(next http.Handler) http.Handler {
 		session, err := queries.SessionRead(ctx, token)
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, r, apierror.IfNotFound(err, apierror.BadRequest("invalid auth token")))
 			return
 		}
 
@@ -390,44 +486,71 @@ func DashRequireAdmin(next http.Handler) http.Handler {
 		user, err := queries.AuthUserRead(ctx, session.UserID)
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Write(w, r, apierror.IfNotFound(err, apierror.BadRequest("invalid auth token")))
 			return
 		}
 
 		if !user.Isactive.Bool {
-			http.Error(w, "invalid user", http.StatusForbidden)
+			apierror.Write(w, r, apierror.Forbidden("invalid user"))
 			return
 		}
 
 		if !user.Isadmin.Bool {
-			http.Error(w, "invalid user", http.StatusForbidden)
+			apierror.Write(w, r, apierror.Forbidden("invalid user"))
 			return
 		}
 
-		ctx = context.WithValue(ctx, current_user, user) // Store user in context
+		setUserID(ctx, user.ID)
+		ctx = WithCurrentUser(ctx, user)
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// LoggingMiddleware logs one line per request once it has been handled. Wrap it in
+// RequestID so the line carries the request id, route and user.
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		// Custom response writer to capture status code
+		// Custom response writer to capture status code and size
 		lrw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		next.ServeHTTP(lrw, r)
 
-		// Log details
-		log.Printf("%s %s %d %s", r.Method, r.URL.Path, lrw.statusCode, time.Since(start))
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", lrw.statusCode),
+			slog.Int("bytes", lrw.bytes),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if info := RequestInfoFromContext(r.Context()); info != nil {
+			if info.Route != "" {
+				attrs = append(attrs, slog.String("route", info.Route))
+			}
+			if info.UserID != 0 {
+				attrs = append(attrs, slog.Int64("user_id", info.UserID))
+			}
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case lrw.statusCode >= 500:
+			level = slog.LevelError
+		case lrw.statusCode >= 400:
+			level = slog.LevelWarn
+		}
+
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
 	})
 }
 
-// loggingResponseWriter captures the response status code
+// loggingResponseWriter captures the response status code and body size
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int
 }
 
 // Override WriteHeader to capture status code
@@ -435,3 +558,13 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.statusCode = code
 	lrw.ResponseWriter.WriteHeader(code)
 }
+
+func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
+	n, err := lrw.ResponseWriter.Write(b)
+	lrw.bytes += n
+	return n, err
+}
+
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
@@ -4,65 +4,85 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
 	"time"
 
+	"github.com/immanuel-254/blog/apierror"
 	"github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/metrics"
 	"github.com/resend/resend-go/v2"
 )
 
-func GetData(data map[string]string, w http.ResponseWriter, r *http.Request) {
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(err)
-		return
-	}
+// MessageOutput is the response of handlers that only report what they did.
+type MessageOutput struct {
+	Message string `json:"message"`
 }
 
 func SendData(data map[string]interface{}, w http.ResponseWriter, r *http.Request) {
 	resp, err := json.Marshal(data)
 	if err != nil {
-		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	if _, err := w.Write(resp); err != nil {
-		log.Printf("Failed to write response: %v", err)
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
 	}
 }
 
-func SendEmail(email, subject, link string, template func(route string) string, w http.ResponseWriter, r *http.Request) {
-	// send email
-	client := resend.NewClient(os.Getenv("RESENDAPIKEY"))
+// Mailer sends an email with an HTML body.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, html string) error
+}
+
+// ResendMailer sends emails through Resend, with the API key and sender of Config.
+type ResendMailer struct {
+	Config *config.Config
+}
+
+func (m ResendMailer) Send(ctx context.Context, to, subject, html string) error {
+	client := resend.NewClient(m.Config.ResendAPIKey)
 
 	params := &resend.SendEmailRequest{
-		From:    os.Getenv("RESENDEMAIL"),
-		To:      []string{email},
-		Html:    template(link),
+		From:    m.Config.ResendEmail,
+		To:      []string{to},
+		Html:    html,
 		Subject: subject,
 	}
 
-	_, err := client.Emails.Send(params)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	_, err := client.Emails.SendWithContext(ctx, params)
+	return err
+}
+
+// SendEmail sends the email rendered by template with link to email. Handlers
+// report a failure themselves, before anything else is written.
+func (s *Service) SendEmail(ctx context.Context, email, subject, link string, template func(ctx context.Context, route, company string) string) error {
+	mailer := s.Mailer
+	if mailer == nil {
+		mailer = ResendMailer{Config: s.Config}
+	}
+
+	if err := mailer.Send(ctx, email, subject, template(ctx, link, s.Config.CompanyName)); err != nil {
+		metrics.EmailsFailed.Inc()
+		return fmt.Errorf("sending email: %w", err)
 	}
+
+	metrics.EmailsSent.Inc()
+	return nil
 }
 
-func Logging(queries *models.Queries, ctx context.Context, dbtable, action string, objectId, userId int64, w http.ResponseWriter, r *http.Request) {
-	err := queries.LogCreate(ctx, models.LogCreateParams{
+// LogAction adds an entry to the audit log. It can be written in the transaction
+// of the action, and handlers stop on its error like on that of the action.
+func LogAction(queries models.Querier, ctx context.Context, dbtable, action string, objectId, userId int64) error {
+	return queries.LogCreate(ctx, models.LogCreateParams{
 		DbTable:   dbtable,
 		Action:    action,
 		ObjectID:  objectId,
 		UserID:    userId,
+		RequestID: requestID(ctx),
 		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
 	})
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
 }
@@ -1,16 +1,222 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 
-func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	"github.com/immanuel-254/blog/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// Argon2Params defines the cost parameters for Argon2id hashes.
+type Argon2Params struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Hasher defines which algorithm and parameters new password hashes are created with.
+type Hasher struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+// HasherDefault provides default hashing values, following the OWASP recommendations for Argon2id.
+var HasherDefault = Hasher{
+	Algorithm: AlgorithmArgon2id,
+	Argon2: Argon2Params{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	},
+	BcryptCost: bcrypt.DefaultCost,
+}
+
+var errInvalidHash = errors.New("invalid password hash format")
+
+const (
+	// bcrypt ignores every byte past the 72nd
+	bcryptMaxLength = 72
+
+	// argon2id takes passwords of any length, the limit only stops huge
+	// passwords from being hashed
+	argon2MaxLength = 1024
+)
+
+// NewHasher builds the hasher from the configuration.
+func NewHasher(cfg config.PasswordConfig) Hasher {
+	hasher := HasherDefault
+	hasher.Algorithm = strings.ToLower(cfg.Hasher)
+	hasher.Argon2.Memory = cfg.Argon2Memory
+	hasher.Argon2.Iterations = cfg.Argon2Iterations
+	hasher.Argon2.Parallelism = cfg.Argon2Parallelism
+	hasher.BcryptCost = cfg.BcryptCost
+	return hasher
+}
+
+// MaxLength returns the longest password in bytes the algorithm of the hasher
+// takes into account.
+func (h Hasher) MaxLength() int {
+	if h.Algorithm == AlgorithmBcrypt {
+		return bcryptMaxLength
+	}
+	return argon2MaxLength
+}
+
+// Hash creates a self-describing hash of the password using the configured algorithm.
+func (h Hasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case AlgorithmArgon2id:
+		salt := make([]byte, h.Argon2.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+
+		key := argon2.IDKey([]byte(password), salt, h.Argon2.Iterations, h.Argon2.Memory, h.Argon2.Parallelism, h.Argon2.KeyLength)
+
+		// PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version,
+			h.Argon2.Memory,
+			h.Argon2.Iterations,
+			h.Argon2.Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+
+	case AlgorithmBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+
+	default:
+		return "", fmt.Errorf("unsupported password hashing algorithm %q", h.Algorithm)
+	}
+}
+
+// Check compares a password with a stored hash of any supported format.
+func (h Hasher) Check(password, hash string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2Hash(hash)
+		if err != nil {
+			return false
+		}
+
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		return subtle.ConstantTimeCompare(key, other) == 1
+
+	case isBcryptHash(hash):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+
+	default:
+		return false
+	}
+}
+
+// NeedsRehash reports whether a stored hash was created with a different algorithm
+// or different parameters than the hasher would use now.
+func (h Hasher) NeedsRehash(hash string) bool {
+	switch h.Algorithm {
+	case AlgorithmArgon2id:
+		if !strings.HasPrefix(hash, "$argon2id$") {
+			return true
+		}
+
+		params, salt, _, err := decodeArgon2Hash(hash)
+		if err != nil {
+			return true
+		}
+
+		return params.Memory != h.Argon2.Memory ||
+			params.Iterations != h.Argon2.Iterations ||
+			params.Parallelism != h.Argon2.Parallelism ||
+			params.KeyLength != h.Argon2.KeyLength ||
+			uint32(len(salt)) != h.Argon2.SaltLength
+
+	case AlgorithmBcrypt:
+		if !isBcryptHash(hash) {
+			return true
+		}
+
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.BcryptCost
+
+	default:
+		return false
+	}
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func decodeArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, errInvalidHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, errInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
 	if err != nil {
-		return "", err
+		return params, nil, nil, errInvalidHash
 	}
-	return string(hash), err
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
 }
 
+// HashPassword hashes password with the configured hasher.
+func HashPassword(cfg config.PasswordConfig, password string) (string, error) {
+	return NewHasher(cfg).Hash(password)
+}
+
+// CheckPasswordHash recognizes the format of the stored hash, so it needs no configuration.
 func CheckPasswordHash(password string, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	return HasherDefault.Check(password, hash)
+}
+
+// PasswordNeedsRehash reports whether hash was made with other settings than the
+// configured hasher.
+func PasswordNeedsRehash(cfg config.PasswordConfig, hash string) bool {
+	return NewHasher(cfg).NeedsRehash(hash)
 }
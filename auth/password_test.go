@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/immanuel-254/blog/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheapHasher uses the smallest costs each algorithm accepts, to keep tests fast.
+func cheapHasher(algorithm string) Hasher {
+	hasher := HasherDefault
+	hasher.Algorithm = algorithm
+	hasher.Argon2.Memory = 64
+	hasher.Argon2.Iterations = 1
+	hasher.Argon2.Parallelism = 1
+	hasher.BcryptCost = bcrypt.MinCost
+	return hasher
+}
+
+func TestHasherRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmArgon2id, AlgorithmBcrypt} {
+		hasher := cheapHasher(algorithm)
+
+		hash, err := hasher.Hash("Sup3r-Secret-Pass!x")
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if algorithm == AlgorithmArgon2id && !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+			t.Errorf("argon2id: unexpected hash format %q", hash)
+		}
+
+		other, _ := hasher.Hash("Sup3r-Secret-Pass!x")
+		if other == hash {
+			t.Errorf("%s: two hashes of a password are equal, the salt is missing", algorithm)
+		}
+
+		// any hasher checks hashes of every format
+		if !HasherDefault.Check("Sup3r-Secret-Pass!x", hash) {
+			t.Errorf("%s: the password does not match its hash", algorithm)
+		}
+		if HasherDefault.Check("Sup3r-Secret-Pass!y", hash) {
+			t.Errorf("%s: another password matches the hash", algorithm)
+		}
+		if hasher.NeedsRehash(hash) {
+			t.Errorf("%s: a fresh hash needs a rehash", algorithm)
+		}
+	}
+}
+
+func TestHasherRejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plain text",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$not base64!$a2V5",
+	} {
+		if HasherDefault.Check("", hash) {
+			t.Errorf("%q matches", hash)
+		}
+		if !HasherDefault.NeedsRehash(hash) {
+			t.Errorf("%q does not need a rehash", hash)
+		}
+	}
+}
+
+func TestHasherNeedsRehash(t *testing.T) {
+	argon2id := cheapHasher(AlgorithmArgon2id)
+	bcryptHasher := cheapHasher(AlgorithmBcrypt)
+
+	argon2Hash, _ := argon2id.Hash("Sup3r-Secret-Pass!x")
+	bcryptHash, _ := bcryptHasher.Hash("Sup3r-Secret-Pass!x")
+
+	stronger := argon2id
+	stronger.Argon2.Iterations = 2
+
+	tests := []struct {
+		name   string
+		hasher Hasher
+		hash   string
+		want   bool
+	}{
+		{"same argon2id parameters", argon2id, argon2Hash, false},
+		{"more argon2id iterations", stronger, argon2Hash, true},
+		{"bcrypt to argon2id", argon2id, bcryptHash, true},
+		{"argon2id to bcrypt", bcryptHasher, argon2Hash, true},
+		{"higher bcrypt cost", Hasher{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost + 1}, bcryptHash, true},
+	}
+
+	for _, test := range tests {
+		if got := test.hasher.NeedsRehash(test.hash); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLoginRehashesOutdatedHashes(t *testing.T) {
+	s := newTestService(t)
+	s.Config.Password = cheapPasswordConfig()
+	ctx := context.Background()
+
+	bcryptHash, _ := cheapHasher(AlgorithmBcrypt).Hash("Sup3r-Secret-Pass!x")
+	createUser(t, s, "jane@example.com", bcryptHash)
+
+	if _, status, err := s.AuthLogin(ctx, LoginInput{Email: "jane@example.com", Password: "Sup3r-Secret-Pass!x"}); err != nil {
+		t.Fatalf("login: %d %v", status, err)
+	}
+
+	user, err := s.Store.Auth.UserLoginRead(ctx, "jane@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(user.Password, "$argon2id$") {
+		t.Fatalf("the bcrypt hash was not replaced: %q", user.Password)
+	}
+
+	// the new hash still signs the user in
+	if _, status, err := s.AuthLogin(ctx, LoginInput{Email: "jane@example.com", Password: "Sup3r-Secret-Pass!x"}); err != nil {
+		t.Fatalf("login after the rehash: %d %v", status, err)
+	}
+}
+
+func TestLoginTakesAsLongForUnknownEmails(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	// the default argon2id parameters, so a check costs enough to be measured
+	hash, err := HashPassword(s.Config.Password, "Sup3r-Secret-Pass!x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	createUser(t, s, "jane@example.com", hash)
+
+	login := func(email string) time.Duration {
+		start := time.Now()
+		_, status, err := s.AuthLogin(ctx, LoginInput{Email: email, Password: "wrong password"})
+		if err == nil || status != http.StatusBadRequest {
+			t.Fatalf("login as %s: got %d %v", email, status, err)
+		}
+		return time.Since(start)
+	}
+
+	login("nobody@example.com") // creates the dummy hash
+
+	var wrongPassword, unknownEmail time.Duration
+	for i := 0; i < 3; i++ {
+		wrongPassword += login("jane@example.com")
+		unknownEmail += login("nobody@example.com")
+	}
+
+	if unknownEmail < wrongPassword/2 {
+		t.Errorf("unknown emails are refused in %v, wrong passwords in %v", unknownEmail/3, wrongPassword/3)
+	}
+}
+
+// cheapPasswordConfig is the default configuration with the costs of cheapHasher.
+func cheapPasswordConfig() config.PasswordConfig {
+	cfg := config.Default().Password
+	cfg.Argon2Memory = 64
+	cfg.Argon2Iterations = 1
+	cfg.Argon2Parallelism = 1
+	cfg.BcryptCost = bcrypt.MinCost
+	return cfg
+}
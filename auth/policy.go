@@ -0,0 +1,376 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/immanuel-254/blog/apierror"
+	"github.com/immanuel-254/blog/config"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var (
+	commonPasswords     map[string]struct{}
+	commonPasswordsOnce sync.Once
+)
+
+// PasswordPolicy defines the rules a password has to satisfy before it is hashed.
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	MinStrength    int // 0 (very weak) to 4 (very strong)
+	DisallowEmail  bool
+	DisallowCommon bool
+}
+
+// PasswordPolicyDefault provides default policy values.
+var PasswordPolicyDefault = PasswordPolicy{
+	MinLength:      8,
+	MaxLength:      HasherDefault.MaxLength(),
+	MinStrength:    2,
+	DisallowEmail:  true,
+	DisallowCommon: true,
+}
+
+// PasswordViolation describes a single rule a password failed.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError is returned when a password fails one or more rules.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation `json:"violations"`
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return fmt.Sprintf("password does not meet policy: %s", strings.Join(messages, "; "))
+}
+
+// NewPasswordPolicy builds the password policy from the configuration. The
+// maximum length is the one of the configured hasher.
+func NewPasswordPolicy(cfg config.PasswordConfig) PasswordPolicy {
+	policy := PasswordPolicyDefault
+	policy.MaxLength = NewHasher(cfg).MaxLength()
+	policy.MinLength = cfg.MinLength
+	policy.MinStrength = cfg.MinStrength
+	policy.DisallowEmail = !cfg.AllowEmail
+	policy.DisallowCommon = !cfg.AllowCommon
+	return policy
+}
+
+// ValidatePassword checks a password against the configured policy.
+func ValidatePassword(cfg config.PasswordConfig, password, email string) error {
+	return NewPasswordPolicy(cfg).Validate(password, email)
+}
+
+// Validate checks a password against the policy and reports every failing rule.
+func (p PasswordPolicy) Validate(password, email string) error {
+	var violations []PasswordViolation
+
+	length := len([]rune(password))
+
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    "min_length",
+			Message: fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		})
+	}
+
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    "max_length",
+			Message: fmt.Sprintf("password must be at most %d bytes", p.MaxLength),
+		})
+	}
+
+	if p.DisallowEmail && containsEmail(password, email) {
+		violations = append(violations, PasswordViolation{
+			Code:    "contains_email",
+			Message: "password must not contain your email address",
+		})
+	}
+
+	if p.DisallowCommon && IsCommonPassword(password) {
+		violations = append(violations, PasswordViolation{
+			Code:    "common",
+			Message: "password is too common and appears in known breach lists",
+		})
+	}
+
+	if length > 0 && EstimatePasswordStrength(password, email) < p.MinStrength {
+		violations = append(violations, PasswordViolation{
+			Code:    "weak",
+			Message: "password is too easy to guess, use a longer mix of words, numbers and symbols",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// SendPasswordPolicyError writes a validation error listing every rule a rejected password breaks.
+func SendPasswordPolicyError(err error, w http.ResponseWriter, r *http.Request) {
+	policyErr, ok := err.(*PasswordPolicyError)
+	if !ok {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var fields []apierror.FieldError
+	for _, violation := range policyErr.Violations {
+		fields = append(fields, apierror.FieldError{
+			Field:   "password",
+			Code:    violation.Code,
+			Message: violation.Message,
+		})
+	}
+
+	apiErr := apierror.Validation(fields...).Wrap(err)
+	apiErr.Message = "password does not meet policy"
+	apierror.Write(w, r, apiErr)
+}
+
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	if email == "" {
+		return false
+	}
+
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 3 && strings.Contains(password, local)
+}
+
+func loadCommonPasswords() {
+	commonPasswords = make(map[string]struct{})
+
+	scanner := bufio.NewScanner(strings.NewReader(commonPasswordsFile))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commonPasswords[strings.ToLower(line)] = struct{}{}
+	}
+}
+
+// IsCommonPassword reports whether the password, or its leetspeak-normalised form,
+// appears in the bundled list of common and breached passwords.
+func IsCommonPassword(password string) bool {
+	commonPasswordsOnce.Do(loadCommonPasswords)
+
+	lower := strings.ToLower(password)
+	if _, ok := commonPasswords[lower]; ok {
+		return true
+	}
+
+	_, ok := commonPasswords[unleet(lower)]
+	return ok
+}
+
+var leetReplacer = strings.NewReplacer(
+	"@", "a", "4", "a", "8", "b", "3", "e", "6", "g", "1", "i", "!", "i",
+	"0", "o", "$", "s", "5", "s", "7", "t", "+", "t", "2", "z",
+)
+
+func unleet(password string) string {
+	return leetReplacer.Replace(password)
+}
+
+// EstimatePasswordStrength returns a zxcvbn-style score from 0 (too guessable) to 4
+// (very unguessable). It estimates the number of guesses an attacker would need,
+// discounting repeated characters, sequences, keyboard walks, dictionary words and
+// any of the supplied user inputs (such as the email address).
+func EstimatePasswordStrength(password string, userInputs ...string) int {
+	if password == "" || IsCommonPassword(password) {
+		return 0
+	}
+
+	lower := strings.ToLower(password)
+	runes := []rune(lower)
+
+	// mark characters that belong to predictable patterns
+	predictable := make([]bool, len(runes))
+
+	markRange := func(start, end int) {
+		for i := start; i < end && i < len(predictable); i++ {
+			predictable[i] = true
+		}
+	}
+
+	// repeats and sequences (aaaa, abcd, 4321)
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+		if j-i >= 3 {
+			markRange(i+1, j)
+			i = j
+			continue
+		}
+
+		if i+1 < len(runes) {
+			step := runes[i+1] - runes[i]
+			if step == 1 || step == -1 {
+				k := i + 2
+				for k < len(runes) && runes[k]-runes[k-1] == step {
+					k++
+				}
+				if k-i >= 3 {
+					markRange(i+1, k)
+					i = k
+					continue
+				}
+			}
+		}
+
+		i++
+	}
+
+	// keyboard walks and dictionary words
+	normalised := unleet(lower)
+	for _, pattern := range keyboardRows {
+		markSubstrings(lower, pattern, 4, markRange)
+	}
+
+	commonPasswordsOnce.Do(loadCommonPasswords)
+	for word := range commonPasswords {
+		if len(word) < 4 {
+			continue
+		}
+		for _, candidate := range []string{lower, normalised} {
+			if strings.Contains(candidate, word) {
+				index := utf8.RuneCountInString(candidate[:strings.Index(candidate, word)])
+				markRange(index+1, index+utf8.RuneCountInString(word))
+			}
+		}
+	}
+
+	for _, input := range userInputs {
+		for _, part := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len(part) >= 3 && strings.Contains(normalised, part) {
+				index := utf8.RuneCountInString(normalised[:strings.Index(normalised, part)])
+				markRange(index, index+utf8.RuneCountInString(part))
+			}
+		}
+	}
+
+	effective := 0
+	for _, isPredictable := range predictable {
+		if !isPredictable {
+			effective++
+		}
+	}
+
+	// each predictable run still costs an attacker a handful of guesses
+	guesses := math.Pow(float64(charsetSize(password)), float64(effective)) * float64(len(runes)-effective+1)
+	log10 := math.Log10(guesses)
+
+	switch {
+	case log10 < 3:
+		return 0
+	case log10 < 6:
+		return 1
+	case log10 < 8:
+		return 2
+	case log10 < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+	"qazwsxedcrfvtgbyhnujmik,ol.p;/",
+	"1qaz2wsx3edc4rfv5tgb6yhn7ujm8ik,9ol.0p;/",
+}
+
+// markSubstrings marks every run of at least minLength characters in password that
+// also appears, forwards or backwards, in pattern.
+func markSubstrings(password, pattern string, minLength int, mark func(start, end int)) {
+	reversed := []rune(pattern)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+
+	runes := []rune(password)
+	for _, candidate := range []string{pattern, string(reversed)} {
+		for start := 0; start+minLength <= len(runes); start++ {
+			end := start + minLength
+			if !strings.Contains(candidate, string(runes[start:end])) {
+				continue
+			}
+			for end < len(runes) && strings.Contains(candidate, string(runes[start:end+1])) {
+				end++
+			}
+			mark(start+1, end)
+		}
+	}
+}
+
+func charsetSize(password string) int {
+	var lower, upper, digit, symbol, other bool
+
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+
+	return size
+}
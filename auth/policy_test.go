@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/immanuel-254/blog/config"
+)
+
+// violations returns the codes of the rules password breaks under policy.
+func violations(t *testing.T, policy PasswordPolicy, password, email string) []string {
+	t.Helper()
+
+	err := policy.Validate(password, email)
+	if err == nil {
+		return nil
+	}
+
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Validate(%q): want a PasswordPolicyError, got %v", password, err)
+	}
+
+	var codes []string
+	for _, violation := range policyErr.Violations {
+		codes = append(codes, violation.Code)
+	}
+	return codes
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := NewPasswordPolicy(config.Default().Password)
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{"Sup3r-Secret-Pass!x", nil},
+		{"correct horse battery staple", nil},
+		{"Xy7!", []string{"min_length"}},
+		{"password", []string{"common", "weak"}},
+		{"P@ssw0rd", []string{"common", "weak"}},
+		{"aaaaaaaaaaaa", []string{"weak"}},
+		{"qwertyuiop1234", []string{"weak"}},
+		{"jane.doe-Tr0mb0ne!", []string{"contains_email"}},
+	}
+
+	for _, test := range tests {
+		if got := violations(t, policy, test.password, "jane.doe@example.com"); !slices.Equal(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.password, got, test.want)
+		}
+	}
+}
+
+func TestPasswordPolicyMaxLengthFollowsTheHasher(t *testing.T) {
+	cfg := config.Default().Password
+	long := strings.Repeat("Tr0mb0ne-", 20) // 180 bytes
+
+	cfg.Hasher = AlgorithmArgon2id
+	if got := violations(t, NewPasswordPolicy(cfg), long, ""); got != nil {
+		t.Errorf("argon2id: got %v", got)
+	}
+	if got := violations(t, NewPasswordPolicy(cfg), strings.Repeat(long, 6), ""); !slices.Equal(got, []string{"max_length"}) {
+		t.Errorf("argon2id, 1080 bytes: got %v", got)
+	}
+
+	cfg.Hasher = AlgorithmBcrypt
+	if got := violations(t, NewPasswordPolicy(cfg), long, ""); !slices.Equal(got, []string{"max_length"}) {
+		t.Errorf("bcrypt: got %v", got)
+	}
+	if got := violations(t, NewPasswordPolicy(cfg), long[:72], ""); got != nil {
+		t.Errorf("bcrypt, 72 bytes: got %v", got)
+	}
+}
+
+func TestPasswordPolicyOptions(t *testing.T) {
+	cfg := config.Default().Password
+	cfg.AllowEmail, cfg.AllowCommon = true, true
+	cfg.MinStrength = 0
+
+	if got := violations(t, NewPasswordPolicy(cfg), "P@ssw0rd", "jane@example.com"); got != nil {
+		t.Errorf("common password allowed: got %v", got)
+	}
+	if got := violations(t, NewPasswordPolicy(cfg), "jane@example.com", "jane@example.com"); got != nil {
+		t.Errorf("email allowed: got %v", got)
+	}
+}
+
+func TestTokenIsUsedUpOnlyByVerify(t *testing.T) {
+	token, err := GenerateOneTimeToken(32, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if sub, err := PeekToken(token); err != nil || sub != 7 {
+			t.Fatalf("PeekToken: got %d, %v", sub, err)
+		}
+	}
+
+	if sub, err := VerifyToken(token); err != nil || sub != 7 {
+		t.Fatalf("VerifyToken: got %d, %v", sub, err)
+	}
+	if _, err := PeekToken(token); err == nil {
+		t.Error("PeekToken accepts a used token")
+	}
+	if _, err := VerifyToken(token); err == nil {
+		t.Error("VerifyToken accepts a used token")
+	}
+	if _, err := PeekToken("unknown"); err == nil {
+		t.Error("PeekToken accepts an unknown token")
+	}
+}
@@ -0,0 +1,44 @@
+-- name: LogCreate :exec
+INSERT INTO logs (
+    db_table, 
+    action,
+    object_id, 
+    user_id, 
+    request_id,
+    created_at, 
+    updated_at
+    ) 
+    VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: LogList :many
+SELECT id, db_table, action, object_id, user_id, request_id, created_at, updated_at FROM logs
+ORDER BY id ASC;
+
+-- name: LogTodayList :many
+SELECT id, db_table, action, object_id, user_id, request_id, created_at, updated_at FROM logs
+WHERE created_at::date = CURRENT_DATE;
+
+-- name: LogYesterdayList :many
+SELECT id, db_table, action, object_id, user_id, request_id, created_at, updated_at FROM logs
+WHERE created_at::date = CURRENT_DATE - 1;
+
+-- name: LogPreviousWeeklyList :many
+SELECT id, db_table, action, object_id, user_id, request_id, created_at, updated_at FROM logs
+WHERE created_at::date >= (CURRENT_DATE + (7 - EXTRACT(DOW FROM CURRENT_DATE)::int) % 7) AND created_at::date <= CURRENT_DATE;
+
+-- name: LogWeeklyList :many
+SELECT id, db_table, action, object_id, user_id, request_id, created_at, updated_at FROM logs
+WHERE created_at >= (CURRENT_DATE + (7 - EXTRACT(DOW FROM CURRENT_DATE)::int) % 7) - 7 AND created_at < (CURRENT_DATE + (7 - EXTRACT(DOW FROM CURRENT_DATE)::int) % 7);
+
+-- name: LogMonthlyList :many
+SELECT id, db_table, action, object_id, user_id, request_id, created_at, updated_at FROM logs
+WHERE date_trunc('month', created_at) = date_trunc('month', CURRENT_DATE);
+
+-- name: LogPreviousMonthlyList :many
+SELECT id, db_table, action, object_id, user_id, request_id, created_at, updated_at FROM logs
+WHERE date_trunc('month', created_at) = date_trunc('month', CURRENT_DATE - INTERVAL '1 month');
+
+-- name: LogUserList :many
+SELECT id, db_table, action, object_id, user_id, request_id, created_at, updated_at FROM logs
+WHERE user_id = $1
+ORDER BY id ASC;
@@ -0,0 +1,54 @@
+-- name: SessionCreate :one
+INSERT INTO sessions (
+    key,
+    user_id, 
+    created_at
+    ) 
+    VALUES ($1, $2, $3)
+    RETURNING id, key, user_id, created_at;
+
+-- name: SessionRead :one
+SELECT id, key, user_id ,created_at FROM sessions
+WHERE key = $1;
+
+-- name: SessionList :many
+SELECT id, key, user_id, created_at FROM sessions
+ORDER BY id ASC;
+
+-- name: SessionTodayList :many
+SELECT id, db_table, action, object_id, user_id, created_at, updated_at FROM logs
+WHERE created_at::date = CURRENT_DATE AND db_table='session' And action='create';
+
+-- name: SessionYesterdayList :many
+SELECT id, db_table, action, object_id, user_id, created_at, updated_at FROM logs
+WHERE created_at::date = CURRENT_DATE - 1 AND db_table='session' And action='create';
+
+-- name: SessionPreviousWeeklyList :many
+SELECT id, db_table, action, object_id, user_id, created_at, updated_at FROM logs
+WHERE created_at::date >= (CURRENT_DATE + (7 - EXTRACT(DOW FROM CURRENT_DATE)::int) % 7) AND created_at::date <= CURRENT_DATE AND db_table='session' And action='create';
+
+-- name: SessionWeeklyList :many
+SELECT id, db_table, action, object_id, user_id, created_at, updated_at FROM logs
+WHERE created_at >= (CURRENT_DATE + (7 - EXTRACT(DOW FROM CURRENT_DATE)::int) % 7) - 7 AND created_at < (CURRENT_DATE + (7 - EXTRACT(DOW FROM CURRENT_DATE)::int) % 7) AND db_table='session' And action='create';
+
+-- name: SessionMonthlyList :many
+SELECT id, db_table, action, object_id, user_id, created_at, updated_at FROM logs
+WHERE date_trunc('month', created_at) = date_trunc('month', CURRENT_DATE) AND db_table='session' And action='create';
+
+-- name: SessionPreviousMonthlyList :many
+SELECT id, db_table, action, object_id, user_id, created_at, updated_at FROM logs
+WHERE date_trunc('month', created_at) = date_trunc('month', CURRENT_DATE - INTERVAL '1 month') AND db_table='session' And action='create';
+
+-- name: SessionDelete :exec
+DELETE FROM sessions WHERE key = $1;
+
+-- name: SessionUserList :many
+SELECT id, user_id, created_at FROM sessions
+WHERE user_id = $1
+ORDER BY id ASC;
+
+-- name: SessionUserDelete :exec
+DELETE FROM sessions WHERE user_id = $1;
+
+-- name: SessionPurge :execrows
+DELETE FROM sessions WHERE created_at < $1;
@@ -0,0 +1,68 @@
+-- name: UserCreate :one
+INSERT INTO users (
+    email, 
+    password,
+    isactive, 
+    isstaff,
+    isadmin,
+    created_at
+    ) 
+    VALUES ($1, $2, $3, $4, $5, $6)
+    RETURNING id, email, created_at, updated_at;
+
+-- name: UserList :many
+SELECT id, email, created_at, updated_at FROM users
+ORDER BY id ASC;
+
+-- name: UserRead :one
+SELECT id, email, created_at, updated_at, version FROM users
+WHERE id = $1;
+
+-- name: AuthUserRead :one
+SELECT id, email, isactive, isadmin, isstaff, created_at, updated_at FROM users
+WHERE id = $1;
+
+-- name: UserLoginRead :one
+SELECT id, email, password FROM users
+WHERE email = $1;
+
+-- name: UserUpdatePassword :one
+UPDATE users SET password = $1, updated_at = $2, version = version + 1 WHERE id = $3 
+RETURNING id, email, created_at, updated_at;
+
+-- name: UserUpdateEmail :one
+UPDATE users SET email = $1, updated_at = $2, version = version + 1 WHERE id = $3 
+RETURNING id, email, created_at, updated_at;
+
+-- name: UserUpdateIsActive :one
+UPDATE users SET isactive = $1, updated_at = $2, version = version + 1 WHERE id = $3 
+RETURNING id, email, created_at, updated_at;
+
+-- name: UserUpdateIsStaff :one
+UPDATE users SET isstaff = $1, updated_at = $2, version = version + 1 WHERE id = $3 
+RETURNING id, email, created_at, updated_at;
+
+-- name: UserDelete :exec
+DELETE FROM users WHERE id = $1;
+
+-- name: UserEmailExists :one
+SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)::int::bigint;
+
+-- name: UserEmailRead :one
+SELECT id, email, created_at, updated_at FROM users
+WHERE email = $1;
+
+-- name: UserRoleList :many
+SELECT id, email, isactive, isstaff, isadmin, created_at FROM users
+ORDER BY id ASC;
+
+-- name: UserUpdateRole :one
+UPDATE users SET isstaff = $1, isadmin = $2, updated_at = $3, version = version + 1 WHERE id = $4
+RETURNING id, email, created_at, updated_at;
+
+-- name: UserExists :one
+SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)::int::bigint;
+
+-- name: UserVersion :one
+SELECT version FROM users
+WHERE id = $1 FOR UPDATE;
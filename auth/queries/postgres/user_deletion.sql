@@ -0,0 +1,22 @@
+-- name: UserDeletionCreate :one
+INSERT INTO user_deletions (
+    user_id,
+    content,
+    cancel_token,
+    scheduled_for,
+    created_at
+    )
+    VALUES ($1, $2, $3, $4, $5)
+    RETURNING id, user_id, content, scheduled_for, created_at;
+
+-- name: UserDeletionCancelRead :one
+SELECT id, user_id, content, scheduled_for, created_at FROM user_deletions
+WHERE cancel_token = $1;
+
+-- name: UserDeletionDueList :many
+SELECT id, user_id, content, scheduled_for, created_at FROM user_deletions
+WHERE scheduled_for <= $1
+ORDER BY scheduled_for ASC;
+
+-- name: UserDeletionUserDelete :exec
+DELETE FROM user_deletions WHERE user_id = $1;
@@ -0,0 +1,24 @@
+-- name: EmailChangeCreate :one
+INSERT INTO email_changes (
+    user_id,
+    new_email,
+    confirm_token,
+    cancel_token,
+    created_at
+    )
+    VALUES (?, ?, ?, ?, ?)
+    RETURNING id, user_id, new_email, created_at;
+
+-- name: EmailChangeConfirmRead :one
+SELECT id, user_id, new_email, created_at FROM email_changes
+WHERE confirm_token = ?;
+
+-- name: EmailChangeCancelRead :one
+SELECT id, user_id, new_email, created_at FROM email_changes
+WHERE cancel_token = ?;
+
+-- name: EmailChangeUserDelete :exec
+DELETE FROM email_changes WHERE user_id = ?;
+
+-- name: EmailChangePurge :execrows
+DELETE FROM email_changes WHERE created_at < ?;
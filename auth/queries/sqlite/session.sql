@@ -41,3 +41,14 @@ WHERE strftime('%Y-%m', created_at) = strftime('%Y-%m', 'now', '-1 month') AND d
 
 -- name: SessionDelete :exec
 DELETE FROM sessions WHERE key = ?;
+
+-- name: SessionUserList :many
+SELECT id, user_id, created_at FROM sessions
+WHERE user_id = ?
+ORDER BY id ASC;
+
+-- name: SessionUserDelete :exec
+DELETE FROM sessions WHERE user_id = ?;
+
+-- name: SessionPurge :execrows
+DELETE FROM sessions WHERE created_at < ?;
@@ -15,7 +15,7 @@ SELECT id, email, created_at, updated_at FROM users
 ORDER BY id ASC;
 
 -- name: UserRead :one
-SELECT id, email, created_at, updated_at FROM users
+SELECT id, email, created_at, updated_at, version FROM users
 WHERE id = ?;
 
 -- name: AuthUserRead :one
@@ -27,20 +27,42 @@ SELECT id, email, password FROM users
 WHERE email = ?;
 
 -- name: UserUpdatePassword :one
-UPDATE users SET password = ?, updated_at = ? WHERE id = ? 
+UPDATE users SET password = ?, updated_at = ?, version = version + 1 WHERE id = ? 
 RETURNING id, email, created_at, updated_at;
 
 -- name: UserUpdateEmail :one
-UPDATE users SET email = ?, updated_at = ? WHERE id = ? 
+UPDATE users SET email = ?, updated_at = ?, version = version + 1 WHERE id = ? 
 RETURNING id, email, created_at, updated_at;
 
 -- name: UserUpdateIsActive :one
-UPDATE users SET isactive = ?, updated_at = ? WHERE id = ? 
+UPDATE users SET isactive = ?, updated_at = ?, version = version + 1 WHERE id = ? 
 RETURNING id, email, created_at, updated_at;
 
 -- name: UserUpdateIsStaff :one
-UPDATE users SET isstaff = ?, updated_at = ? WHERE id = ? 
+UPDATE users SET isstaff = ?, updated_at = ?, version = version + 1 WHERE id = ? 
 RETURNING id, email, created_at, updated_at;
 
 -- name: UserDelete :exec
 DELETE FROM users WHERE id = ?;
+
+-- name: UserEmailExists :one
+SELECT EXISTS(SELECT 1 FROM users WHERE email = ?);
+
+-- name: UserEmailRead :one
+SELECT id, email, created_at, updated_at FROM users
+WHERE email = ?;
+
+-- name: UserRoleList :many
+SELECT id, email, isactive, isstaff, isadmin, created_at FROM users
+ORDER BY id ASC;
+
+-- name: UserUpdateRole :one
+UPDATE users SET isstaff = ?, isadmin = ?, updated_at = ?, version = version + 1 WHERE id = ?
+RETURNING id, email, created_at, updated_at;
+
+-- name: UserExists :one
+SELECT EXISTS(SELECT 1 FROM users WHERE id = ?);
+
+-- name: UserVersion :one
+SELECT version FROM users
+WHERE id = ?;
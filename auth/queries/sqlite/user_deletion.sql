@@ -0,0 +1,22 @@
+-- name: UserDeletionCreate :one
+INSERT INTO user_deletions (
+    user_id,
+    content,
+    cancel_token,
+    scheduled_for,
+    created_at
+    )
+    VALUES (?, ?, ?, ?, ?)
+    RETURNING id, user_id, content, scheduled_for, created_at;
+
+-- name: UserDeletionCancelRead :one
+SELECT id, user_id, content, scheduled_for, created_at FROM user_deletions
+WHERE cancel_token = ?;
+
+-- name: UserDeletionDueList :many
+SELECT id, user_id, content, scheduled_for, created_at FROM user_deletions
+WHERE scheduled_for <= ?
+ORDER BY scheduled_for ASC;
+
+-- name: UserDeletionUserDelete :exec
+DELETE FROM user_deletions WHERE user_id = ?;
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDHeader carries the request id in both directions, so a caller can
+// correlate its own logs with ours.
+const RequestIDHeader = "X-Request-ID"
+
+type requestInfoKey string
+
+const request_info requestInfoKey = "request_info"
+
+// RequestInfo is filled in as a request passes through the handlers and
+// reported by LoggingMiddleware once it is done.
+type RequestInfo struct {
+	ID     string
+	Route  string
+	UserID int64
+}
+
+// RequestInfoFromContext returns the request info stored by RequestID, or nil.
+func RequestInfoFromContext(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(request_info).(*RequestInfo)
+	return info
+}
+
+// RequestIDFromContext returns the id of the current request, or "" outside of one.
+func RequestIDFromContext(ctx context.Context) string {
+	if info := RequestInfoFromContext(ctx); info != nil {
+		return info.ID
+	}
+	return ""
+}
+
+// SetRoute records the route pattern the request was matched to.
+func SetRoute(ctx context.Context, route string) {
+	if info := RequestInfoFromContext(ctx); info != nil {
+		info.Route = route
+	}
+}
+
+func setUserID(ctx context.Context, userId int64) {
+	if info := RequestInfoFromContext(ctx); info != nil {
+		info.UserID = userId
+	}
+}
+
+// requestID returns the request id for the audit log.
+func requestID(ctx context.Context) sql.NullString {
+	id := RequestIDFromContext(ctx)
+	return sql.NullString{String: id, Valid: id != ""}
+}
+
+// validRequestID accepts short ids of printable characters that are safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestID gives every request an id, taken from the X-Request-ID header when the
+// caller sent a valid one, and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), request_info, &RequestInfo{ID: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// contextHandler adds the request id to every record logged with a request context.
+type contextHandler struct {
+	slog.Handler
+}
+
+// NewLogHandler wraps handler so records logged with the *Context functions of
+// log/slog carry the id of the request they were logged in.
+func NewLogHandler(handler slog.Handler) slog.Handler {
+	return contextHandler{handler}
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
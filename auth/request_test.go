@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"req-2026.10.19_12:00:00", true},
+		{strings.Repeat("a", 128), true},
+		{"", false},
+		{strings.Repeat("a", 129), false},
+		{"two words", false},
+		{"line\nbreak", false},
+		{`quote"d`, false},
+		{"slash/ed", false},
+		{"ünïcode", false},
+		{"\x1b[31mred", false},
+	}
+
+	for _, test := range tests {
+		if got := validRequestID(test.id); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.id, got, test.want)
+		}
+	}
+}
+
+// sendRequestID serves a request with the X-Request-ID header id, when it is not
+// empty, and returns the id the handlers saw and the one sent back.
+func sendRequestID(id string) (string, string) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if id != "" {
+		r.Header.Set(RequestIDHeader, id)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return seen, w.Header().Get(RequestIDHeader)
+}
+
+func TestRequestID(t *testing.T) {
+	// a valid id of the caller is kept
+	if seen, sent := sendRequestID("req-42"); seen != "req-42" || sent != "req-42" {
+		t.Errorf("a valid id: saw %q, sent %q", seen, sent)
+	}
+
+	// others are replaced by one of ours
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	ids := map[string]bool{}
+	for _, id := range []string{"", "two words", "evil\ninjected=1", strings.Repeat("a", 129)} {
+		seen, sent := sendRequestID(id)
+		if !generated.MatchString(seen) || sent != seen {
+			t.Errorf("%q: saw %q, sent %q", id, seen, sent)
+		}
+		ids[seen] = true
+	}
+	if len(ids) != 4 {
+		t.Errorf("generated the same id twice: %v", ids)
+	}
+
+	if id := RequestIDFromContext(context.Background()); id != "" {
+		t.Errorf("outside of a request: got %q", id)
+	}
+}
+
+// logRecords decodes the JSON records in out.
+func logRecords(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+	decoder := json.NewDecoder(out)
+	for decoder.More() {
+		var record map[string]any
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNewLogHandler(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&out, nil)))
+	ctx := context.WithValue(context.Background(), request_info, &RequestInfo{ID: "req-42"})
+
+	logger.InfoContext(ctx, "in a request")
+	logger.Info("outside of a request")
+	logger.With("app", "blog").WarnContext(ctx, "with attributes")
+	logger.WithGroup("upload").ErrorContext(ctx, "in a group", "size", 1)
+
+	records := logRecords(t, &out)
+	if len(records) != 4 {
+		t.Fatalf("logged %v", records)
+	}
+	if records[0]["request_id"] != "req-42" {
+		t.Errorf("in a request: %v", records[0])
+	}
+	if _, ok := records[1]["request_id"]; ok {
+		t.Errorf("outside of a request: %v", records[1])
+	}
+	if records[2]["request_id"] != "req-42" || records[2]["app"] != "blog" {
+		t.Errorf("with attributes: %v", records[2])
+	}
+	if group, _ := records[3]["upload"].(map[string]any); group["request_id"] != "req-42" || group["size"] != 1.0 {
+		t.Errorf("in a group: %v", records[3])
+	}
+}
+
+func TestRequestLog(t *testing.T) {
+	var out bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(NewLogHandler(slog.NewJSONHandler(&out, nil))))
+
+	handler := RequestID(LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), "GET /blogs/{id}")
+		setUserID(r.Context(), 7)
+		slog.InfoContext(r.Context(), "reading the blog")
+		w.WriteHeader(http.StatusNotFound)
+	})))
+
+	r := httptest.NewRequest(http.MethodGet, "/blogs/3", nil)
+	r.Header.Set(RequestIDHeader, "req-42")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	// the records of the handlers and the request line carry the id
+	records := logRecords(t, &out)
+	if len(records) != 2 {
+		t.Fatalf("logged %v", records)
+	}
+	if records[0]["msg"] != "reading the blog" || records[0]["request_id"] != "req-42" {
+		t.Errorf("logged %v", records[0])
+	}
+	line := records[1]
+	if line["msg"] != "request" || line["request_id"] != "req-42" || line["level"] != "WARN" || line["status"] != 404.0 ||
+		line["route"] != "GET /blogs/{id}" || line["user_id"] != 7.0 || line["path"] != "/blogs/3" {
+		t.Errorf("logged %v", line)
+	}
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"context"
+	"sync"
+
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/media"
+	"github.com/immanuel-254/blog/store"
+	"github.com/immanuel-254/blog/validate"
+)
+
+// Service serves the auth views and runs the account workflows on a store, with
+// the settings of cfg. Media holds the uploads of users, which are exported and
+// removed with their accounts.
+type Service struct {
+	Store  *store.Store
+	Config *config.Config
+	Media  media.Storage
+	Mailer Mailer // Resend with the settings of Config when nil
+
+	dummyHashOnce sync.Once
+	dummyHash     string // checked against when a login names no user
+}
+
+// NewService returns the auth service on st, and registers the user validator
+// used by the exists tag.
+func NewService(st *store.Store, cfg *config.Config, storage media.Storage) *Service {
+	s := &Service{Store: st, Config: cfg, Media: storage}
+
+	validate.RegisterExists("user", func(ctx context.Context, id int64) (bool, error) {
+		exists, err := s.Store.Auth.UserExists(ctx, id)
+		return exists == 1, err
+	})
+
+	return s
+}
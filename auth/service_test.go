@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/internal/testdb"
+	"github.com/immanuel-254/blog/media"
+	"github.com/immanuel-254/blog/store"
+)
+
+// newTestService returns the auth service on a scratch database, with uploads in
+// a scratch directory.
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Domain = "https://example.com"
+
+	return NewService(store.New(testdb.New(t)), &cfg, &media.Local{Dir: t.TempDir(), BaseURL: cfg.Domain + "/media"})
+}
+
+// createUser adds an active user whose password is stored as hash.
+func createUser(t *testing.T, s *Service, email, hash string) models.UserCreateRow {
+	t.Helper()
+
+	user, err := s.Store.Auth.UserCreate(context.Background(), models.UserCreateParams{
+		Email:     email,
+		Password:  hash,
+		Isactive:  sql.NullBool{Bool: true, Valid: true},
+		Isstaff:   sql.NullBool{Bool: false, Valid: true},
+		Isadmin:   sql.NullBool{Bool: false, Valid: true},
+		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
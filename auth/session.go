@@ -1,93 +1,109 @@
 package auth
 
 import (
-	"context"
 	"database/sql"
+	"errors"
 	"net/http"
-	"time"
 
+	"github.com/immanuel-254/blog/apierror"
 	"github.com/immanuel-254/blog/auth/models"
-	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/store"
+	"github.com/immanuel-254/blog/validate"
 )
 
-func Login(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	queries := models.New(database.DB)
-	ctx := context.Background()
-
-	// get data
-	var data map[string]string
-	GetData(data, w, r)
-
-	key, code, err := AuthLogin(queries, ctx, data)
-
-	if err != nil {
-		http.Error(w, err.Error(), code)
-		return
-	}
+type LoginInput struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+	Cookie   bool   `json:"cookie"` // keep the session in a cookie instead of returning it
+}
 
-	resp := map[string]interface{}{"auth": key}
-	SendData(resp, w, r)
+// LoginOutput holds the session token, or the CSRF token when the session is
+// kept in a cookie.
+type LoginOutput struct {
+	Auth      string `json:"auth,omitempty"`
+	CSRFToken string `json:"csrf_token,omitempty"`
 }
 
-func Logout(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+func (s *Service) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// get data
+	var input LoginInput
+	if !validate.Bind(w, r, &input) {
 		return
 	}
 
-	queries := models.New(database.DB)
-	ctx := r.Context()
-
-	session, err := queries.SessionRead(ctx, w.Header().Get("auth"))
+	key, code, err := s.AuthLogin(ctx, input)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.WithStatus(code, err))
 		return
 	}
 
-	// delete session
-	err = queries.SessionDelete(ctx, w.Header().Get("auth"))
+	resp := map[string]interface{}{"auth": key}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	// browser clients can ask for the session to be kept in a cookie instead
+	if input.Cookie {
+		s.SetSessionCookies(w, key)
+		resp = map[string]interface{}{"csrf_token": CSRFToken(key)}
 	}
 
-	err = queries.LogCreate(ctx, models.LogCreateParams{
-		DbTable:   "session",
-		Action:    "delete",
-		ObjectID:  session.ID,
-		UserID:    session.UserID,
-		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
-	})
+	SendData(resp, w, r)
+}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+func (s *Service) Logout(w http.ResponseWriter, r *http.Request) {
+	queries := s.Store.Auth
+	ctx := r.Context()
+
+	// the cookies go whatever happens to the session, a browser holding one that
+	// is expired or unknown is signed out too
+	s.ClearSessionCookies(w)
+
+	token, _ := sessionToken(r)
+
+	// without a session, or with one that is gone, the client is already
+	// logged out
+	if token != "" {
+		session, err := queries.SessionRead(ctx, token)
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			apierror.Write(w, r, err)
+			return
+		default:
+			// delete session
+			err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+				if err := tx.Auth.SessionDelete(ctx, token); err != nil {
+					return err
+				}
+
+				return LogAction(tx.Auth, ctx, "session", "delete", session.ID, session.UserID)
+			})
+
+			if err != nil {
+				apierror.Write(w, r, err)
+				return
+			}
+		}
 	}
 
 	resp := map[string]interface{}{"message": "user logged out"}
 	SendData(resp, w, r)
 }
 
-func SessionList(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+type SessionListOutput struct {
+	Sessions []models.SessionListRow `json:"sessions"`
+}
 
-	queries := models.New(database.DB)
+func (s *Service) SessionList(w http.ResponseWriter, r *http.Request) {
+	queries := s.Store.Auth
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
@@ -96,11 +112,14 @@ func SessionList(w http.ResponseWriter, r *http.Request) {
 	sessions, err := queries.SessionList(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	Logging(queries, ctx, "session", "list", 0, authUser.ID, w, r)
+	if err := LogAction(queries, ctx, "session", "list", 0, authUser.ID); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
 	SendData(map[string]interface{}{"sessions": sessions}, w, r)
 }
@@ -6,9 +6,9 @@ import (
 	"github.com/a-h/templ"
 )
 
-func base(title, link string, template func(route string) templ.Component) string {
-	component := EmailBaseTemplate(title, template(link))
-	htmlString, err := templ.ToGoHTML(context.Background(), component)
+func base(ctx context.Context, title, link, company string, template func(route, company string) templ.Component) string {
+	component := EmailBaseTemplate(title, template(link, company))
+	htmlString, err := templ.ToGoHTML(ctx, component)
 	if err != nil {
 		panic(err)
 	}
@@ -19,22 +19,30 @@ func base(title, link string, template func(route string) templ.Component) strin
 	return stringValue
 }
 
-func EmailVerificationTemplate(route string) string {
-	return base("Verify Email", route, EmailVerification)
+func EmailVerificationTemplate(ctx context.Context, route, company string) string {
+	return base(ctx, "Verify Email", route, company, EmailVerification)
 }
 
-func ChangeEmailVerificationTemplate(route string) string {
-	return base("Change Email", route, ChangeEmailVerification)
+func ChangeEmailVerificationTemplate(ctx context.Context, route, company string) string {
+	return base(ctx, "Change Email", route, company, ChangeEmailVerification)
 }
 
-func ChangePasswordVerificationTemplate(route string) string {
-	return base("Change Password", route, ChangePasswordVerifcation)
+func ChangeEmailNotificationTemplate(ctx context.Context, route, company string) string {
+	return base(ctx, "Change Email", route, company, ChangeEmailNotification)
 }
 
-func ResetPasswordVerificationTemplate(route string) string {
-	return base("Reset Password", route, ResetPasswordVerification)
+func ChangePasswordVerificationTemplate(ctx context.Context, route, company string) string {
+	return base(ctx, "Change Password", route, company, ChangePasswordVerifcation)
 }
 
-func DeleteUserVerificationTemplate(route string) string {
-	return base("Delete User", route, DeleteUserVerification)
+func ResetPasswordVerificationTemplate(ctx context.Context, route, company string) string {
+	return base(ctx, "Reset Password", route, company, ResetPasswordVerification)
+}
+
+func DeleteUserVerificationTemplate(ctx context.Context, route, company string) string {
+	return base(ctx, "Delete User", route, company, DeleteUserVerification)
+}
+
+func DeleteUserScheduledTemplate(ctx context.Context, route, company string) string {
+	return base(ctx, "Delete User", route, company, DeleteUserScheduled)
 }
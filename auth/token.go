@@ -15,6 +15,9 @@ type TokenStatus struct {
 	sub       uint
 }
 
+// OneTimeTokenTTL is how long a one time token stays valid.
+const OneTimeTokenTTL = 15 * time.Minute
+
 var (
 	tokenStore = make(map[string]*TokenStatus) // Token storage
 	mu         sync.Mutex                      // To protect the map from concurrent access
@@ -39,15 +42,25 @@ func GenerateOneTimeToken(length int, sub uint) (string, error) {
 	tokenStore[encodedToken] = &TokenStatus{
 		Token:     encodedToken,
 		Used:      false,
-		ExpiresAt: time.Now().Add(time.Minute * 15),
+		ExpiresAt: time.Now().Add(OneTimeTokenTTL),
 		sub:       sub,
 	}
 
 	return encodedToken, nil
 }
 
-// VerifyToken checks if the token is valid and not used yet
+// VerifyToken checks if the token is valid and not used yet, and uses it up.
 func VerifyToken(token string) (uint, error) {
+	return checkToken(token, true)
+}
+
+// PeekToken checks the token like VerifyToken but leaves it unused, so a handler
+// can validate the rest of the request before spending the token on it.
+func PeekToken(token string) (uint, error) {
+	return checkToken(token, false)
+}
+
+func checkToken(token string, consume bool) (uint, error) {
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -68,7 +81,9 @@ func VerifyToken(token string) (uint, error) {
 	}
 
 	// Mark the token as used
-	tokenData.Used = true
+	if consume {
+		tokenData.Used = true
+	}
 
 	return tokenData.sub, nil
 }
@@ -4,80 +4,97 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/immanuel-254/blog/apierror"
 	"github.com/immanuel-254/blog/auth/models"
-	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/metrics"
+	"github.com/immanuel-254/blog/store"
+	"github.com/immanuel-254/blog/validate"
 )
 
-func Signup(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+type SignupInput struct {
+	Email           string `json:"email" validate:"required,email,max=254"`
+	Password        string `json:"password" validate:"required"`
+	ConfirmPassword string `json:"confirm-password" validate:"required,eqfield=Password"`
+}
 
-	queries := models.New(database.DB)
-	ctx := context.Background()
+func (s *Service) Signup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
 	// get data
-	var data map[string]string
-	GetData(data, w, r)
+	var input SignupInput
+	if !validate.Bind(w, r, &input) {
+		return
+	}
 
-	// check if password match
-	if data["password"] != data["confirm-password"] {
-		http.Error(w, "invalid password or email", http.StatusBadRequest)
+	// validate password
+	if err := ValidatePassword(s.Config.Password, input.Password, input.Email); err != nil {
+		SendPasswordPolicyError(err, w, r)
 		return
 	}
 
 	// hash password
-	hash, err := HashPassword(data["password"])
+	hash, err := HashPassword(s.Config.Password, input.Password)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	// create user
-	user, err := queries.UserCreate(ctx, models.UserCreateParams{
-		Email:     data["email"],
-		Password:  hash,
-		Isactive:  sql.NullBool{Bool: false, Valid: true},
-		Isstaff:   sql.NullBool{Bool: false, Valid: true},
-		Isadmin:   sql.NullBool{Bool: false, Valid: true},
-		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	var user models.UserCreateRow
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		user, err = tx.Auth.UserCreate(ctx, models.UserCreateParams{
+			Email:     input.Email,
+			Password:  hash,
+			Isactive:  sql.NullBool{Bool: false, Valid: true},
+			Isstaff:   sql.NullBool{Bool: false, Valid: true},
+			Isadmin:   sql.NullBool{Bool: false, Valid: true},
+			CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "user", "create", user.ID, 0)
 	})
 
+	if apierror.IsUniqueViolation(err) {
+		apierror.Write(w, r, apierror.Conflict("this email is already in use"))
+		return
+	}
+
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	Logging(queries, ctx, "user", "create", user.ID, 0, w, r)
+	metrics.Signups.Inc()
 
 	// send email
 	one_time, err := GenerateOneTimeToken(32, uint(user.ID))
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	SendEmail(user.Email, "Activate Your Email", fmt.Sprintf("%s/activate/?token=%s", os.Getenv("DOMAIN"), one_time), EmailVerificationTemplate, w, r)
+	if err := s.SendEmail(ctx, user.Email, "Activate Your Email", fmt.Sprintf("%s/activate/?token=%s", s.Config.Domain, one_time), EmailVerificationTemplate); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
 	resp := map[string]interface{}{"message": "signup successful"}
 	SendData(resp, w, r)
 
 }
 
-func ActivateEmail(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
+func (s *Service) ActivateEmail(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 
 	token := queryParams.Get("token")
@@ -86,53 +103,54 @@ func ActivateEmail(w http.ResponseWriter, r *http.Request) {
 	user_id, err := VerifyToken(token)
 
 	if err != nil {
-		http.Error(w, "Invalid auth token", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid auth token"))
 		return
 	}
 
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	ctx := r.Context()
 
 	// activate user
-	user, err := queries.UserUpdateIsActive(ctx, models.UserUpdateIsActiveParams{
-		ID:        int64(user_id),
-		Isactive:  sql.NullBool{Bool: true, Valid: true},
-		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		user, err := tx.Auth.UserUpdateIsActive(ctx, models.UserUpdateIsActiveParams{
+			ID:        int64(user_id),
+			Isactive:  sql.NullBool{Bool: true, Valid: true},
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "user", "update", user.ID, int64(user_id))
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	Logging(queries, ctx, "user", "update", user.ID, int64(user_id), w, r)
-
 	resp := map[string]interface{}{"message": "email has been verified"}
 	SendData(resp, w, r)
 }
 
-func UserRead(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	queryParams := r.URL.Query()
+type UserReadOutput struct {
+	User models.UserReadRow `json:"user"`
+}
 
-	user_id, err := strconv.ParseInt(queryParams.Get("user"), 10, 64)
+func (s *Service) UserRead(w http.ResponseWriter, r *http.Request) {
+	user_id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.NotFound("user not found").Wrap(err))
 		return
 	}
 
-	queries := models.New(database.DB)
+	queries := s.Store.Auth
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
@@ -141,29 +159,35 @@ func UserRead(w http.ResponseWriter, r *http.Request) {
 	user, err := queries.UserRead(ctx, user_id)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("user not found")))
+		return
+	}
+
+	if err := LogAction(queries, ctx, "user", "read", user.ID, authUser.ID); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	Logging(queries, ctx, "user", "read", user.ID, authUser.ID, w, r)
+	if NotModified(w, r, ETag(user.Version)) {
+		return
+	}
 
 	SendData(map[string]interface{}{"user": user}, w, r)
 }
 
-func UserList(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+type UserListOutput struct {
+	Users []models.UserListRow `json:"users"`
+}
 
-	queries := models.New(database.DB)
+func (s *Service) UserList(w http.ResponseWriter, r *http.Request) {
+	queries := s.Store.Auth
 
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
@@ -172,123 +196,230 @@ func UserList(w http.ResponseWriter, r *http.Request) {
 	users, err := queries.UserList(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	Logging(queries, ctx, "user", "list", 0, authUser.ID, w, r)
+	if err := LogAction(queries, ctx, "user", "list", 0, authUser.ID); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
 	SendData(map[string]interface{}{"users": users}, w, r)
 }
 
+// EmailChangeTTL is how long a pending email change can be confirmed from the
+// new address, or cancelled from the old one.
+const EmailChangeTTL = 24 * time.Hour
+
+// emailChangeExpired reports whether a pending change created at createdAt can
+// no longer be confirmed or cancelled.
+func emailChangeExpired(createdAt sql.NullTime) bool {
+	return !createdAt.Valid || time.Since(createdAt.Time) > EmailChangeTTL
+}
+
 // Require auth
-func ChangeEmailRequest(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+type ChangeEmailInput struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
 
+func (s *Service) ChangeEmailRequest(w http.ResponseWriter, r *http.Request) {
 	// get data
-	var data map[string]string
-	GetData(data, w, r)
+	var input ChangeEmailInput
+	if !validate.Bind(w, r, &input) {
+		return
+	}
 
+	queries := s.Store.Auth
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
 	authUser := auth.(models.AuthUserReadRow)
 
-	if data["email"] != authUser.Email {
-		http.Error(w, "invalid email", http.StatusBadRequest)
+	newEmail := input.Email
+
+	if strings.EqualFold(newEmail, authUser.Email) {
+		apierror.Write(w, r, apierror.BadRequest("the new email is the same as the current email"))
 		return
 	}
 
-	// send email
-	one_time, err := GenerateOneTimeToken(32, uint(authUser.ID))
+	exists, err := queries.UserEmailExists(ctx, newEmail)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	SendEmail(data["email"], "Change Your Email", fmt.Sprintf("%s/change-email/?token=%s", os.Getenv("DOMAIN"), one_time), ChangeEmailVerificationTemplate, w, r)
-
-	SendData(map[string]interface{}{"message": "email sent"}, w, r)
-
-}
-
-func ChangeEmail(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	if exists == 1 {
+		apierror.Write(w, r, apierror.Conflict("this email is already in use"))
 		return
 	}
 
-	queryParams := r.URL.Query()
+	// both links are kept with the change, so they last as long as it does and
+	// survive a restart
+	confirmToken := randomToken(32)
+	cancelToken := randomToken(32)
 
-	token := queryParams.Get("token")
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		// only the latest request can be confirmed
+		if err := tx.Auth.EmailChangeUserDelete(ctx, authUser.ID); err != nil {
+			return err
+		}
 
-	// verify token
-	user_id, err := VerifyToken(token)
+		change, err := tx.Auth.EmailChangeCreate(ctx, models.EmailChangeCreateParams{
+			UserID:       authUser.ID,
+			NewEmail:     newEmail,
+			ConfirmToken: confirmToken,
+			CancelToken:  cancelToken,
+			CreatedAt:    sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "email_change", "create", change.ID, authUser.ID)
+	})
 
 	if err != nil {
-		http.Error(w, "Invalid auth token", http.StatusBadRequest)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	queries := models.New(database.DB)
+	// confirm with the new address, a change that cannot be confirmed is dropped
+	// again so the request can simply be repeated
+	if err := s.SendEmail(ctx, newEmail, "Confirm Your New Email", fmt.Sprintf("%s/change-email/?token=%s", s.Config.Domain, confirmToken), ChangeEmailVerificationTemplate); err != nil {
+		if dropErr := queries.EmailChangeUserDelete(context.WithoutCancel(ctx), authUser.ID); dropErr != nil {
+			slog.ErrorContext(ctx, "failed to drop an unconfirmable email change", "user_id", authUser.ID, "error", dropErr)
+		}
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// notify the old one, the change stands without it
+	if err := s.SendEmail(ctx, authUser.Email, "Your Email Is Being Changed", fmt.Sprintf("%s/change-email-cancel/?token=%s", s.Config.Domain, cancelToken), ChangeEmailNotificationTemplate); err != nil {
+		slog.ErrorContext(ctx, "failed to notify the old address of an email change", "user_id", authUser.ID, "error", err)
+	}
+
+	SendData(map[string]interface{}{"message": "email sent"}, w, r)
+
+}
+
+func (s *Service) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+
+	token := queryParams.Get("token")
+
+	queries := s.Store.Auth
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
 	authUser := auth.(models.AuthUserReadRow)
 
-	if authUser.ID != int64(user_id) {
-		http.Error(w, "Forbidden User", http.StatusForbidden)
+	// verify token
+	change, err := queries.EmailChangeConfirmRead(ctx, token)
+
+	if err == nil && emailChangeExpired(change.CreatedAt) {
+		err = sql.ErrNoRows
+	}
+
+	if err != nil {
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.BadRequest("there is no pending email change")))
 		return
 	}
 
-	// get data
-	var data map[string]string
-	GetData(data, w, r)
+	if change.UserID != authUser.ID {
+		apierror.Write(w, r, apierror.Forbidden("Forbidden User"))
+		return
+	}
+
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		user, err := tx.Auth.UserUpdateEmail(ctx, models.UserUpdateEmailParams{
+			ID:        change.UserID,
+			Email:     change.NewEmail,
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
 
-	user, err := queries.UserUpdateEmail(ctx, models.UserUpdateEmailParams{
-		ID:        int64(user_id),
-		Email:     data["email"],
-		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		if err := tx.Auth.EmailChangeUserDelete(ctx, authUser.ID); err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "user", "update", user.ID, authUser.ID)
 	})
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if apierror.IsUniqueViolation(err) {
+		apierror.Write(w, r, apierror.Conflict("this email is already in use"))
 		return
 	}
 
-	Logging(queries, ctx, "user", "update", user.ID, int64(user_id), w, r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
 	SendData(map[string]interface{}{"message": "email updated successfully"}, w, r)
 }
 
-func ChangePasswordRequest(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+// ChangeEmailCancel is reached from the link sent to the old address, so it
+// only requires the cancel token and not a session. The token is kept with the
+// change and works for as long as the change could be confirmed.
+func (s *Service) ChangeEmailCancel(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+
+	token := queryParams.Get("token")
+
+	queries := s.Store.Auth
+	ctx := r.Context()
+
+	// verify token
+	change, err := queries.EmailChangeCancelRead(ctx, token)
+
+	if err == nil && emailChangeExpired(change.CreatedAt) {
+		err = sql.ErrNoRows
+	}
+
+	if err != nil {
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.BadRequest("there is no pending email change")))
+		return
+	}
+
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		if err := tx.Auth.EmailChangeUserDelete(ctx, change.UserID); err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "email_change", "delete", change.ID, change.UserID)
+	})
+
+	if err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
+	SendData(map[string]interface{}{"message": "email change cancelled"}, w, r)
+}
+
+func (s *Service) ChangePasswordRequest(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
@@ -298,109 +429,121 @@ func ChangePasswordRequest(w http.ResponseWriter, r *http.Request) {
 	one_time, err := GenerateOneTimeToken(32, uint(authUser.ID))
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	SendEmail(authUser.Email, "Change Your Password", fmt.Sprintf("%s/change-password/?token=%s", os.Getenv("DOMAIN"), one_time), ChangePasswordVerificationTemplate, w, r)
+	if err := s.SendEmail(ctx, authUser.Email, "Change Your Password", fmt.Sprintf("%s/change-password/?token=%s", s.Config.Domain, one_time), ChangePasswordVerificationTemplate); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
 	SendData(map[string]interface{}{"message": "email sent"}, w, r)
 
 }
 
-func ChangePassword(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+type ChangePasswordInput struct {
+	OldPassword     string `json:"old_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+	ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=NewPassword"`
+}
 
+func (s *Service) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 
 	token := queryParams.Get("token")
 
-	// verify token
-	user_id, err := VerifyToken(token)
+	// verify token, it is used up once the rest of the request is valid
+	user_id, err := PeekToken(token)
 
 	if err != nil {
-		http.Error(w, "Invalid auth token", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid auth token"))
 		return
 	}
 
-	queries := models.New(database.DB)
+	queries := s.Store.Auth
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
 	authUser := auth.(models.AuthUserReadRow)
 
 	if authUser.ID != int64(user_id) {
-		http.Error(w, "Forbidden User", http.StatusForbidden)
+		apierror.Write(w, r, apierror.Forbidden("Forbidden User"))
 		return
 	}
 
 	user, err := queries.UserLoginRead(ctx, authUser.Email)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	// get data
-	var data map[string]string
-	GetData(data, w, r)
+	var input ChangePasswordInput
+	if !validate.Bind(w, r, &input) {
+		return
+	}
 
-	check := CheckPasswordHash(data["old_password"], user.Password)
+	check := CheckPasswordHash(input.OldPassword, user.Password)
 
 	if !check {
-		http.Error(w, "Invalid Password", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid Password"))
 		return
 	}
 
-	if data["new_password"] != data["confirm_password"] {
-		http.Error(w, "Invalid Password", http.StatusBadRequest)
+	if err := ValidatePassword(s.Config.Password, input.NewPassword, user.Email); err != nil {
+		SendPasswordPolicyError(err, w, r)
 		return
 	}
 
-	hash, err := HashPassword(data["new_password"])
+	hash, err := HashPassword(s.Config.Password, input.NewPassword)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// use up the token
+	if _, err := VerifyToken(token); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid auth token"))
 		return
 	}
 
-	_, err = queries.UserUpdatePassword(ctx, models.UserUpdatePasswordParams{
-		ID:        int64(user_id),
-		Password:  hash,
-		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		_, err := tx.Auth.UserUpdatePassword(ctx, models.UserUpdatePasswordParams{
+			ID:        int64(user_id),
+			Password:  hash,
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "user", "update", user.ID, int64(user_id))
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	Logging(queries, ctx, "user", "update", user.ID, int64(user_id), w, r)
-
 	SendData(map[string]interface{}{"message": "password updated successfully"}, w, r)
 }
 
-func ResetPasswordRequest(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
+func (s *Service) ResetPasswordRequest(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
@@ -410,101 +553,112 @@ func ResetPasswordRequest(w http.ResponseWriter, r *http.Request) {
 	one_time, err := GenerateOneTimeToken(32, uint(authUser.ID))
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	SendEmail(authUser.Email, "Reset Your Password", fmt.Sprintf("%s/reset-password/?token=%s", os.Getenv("DOMAIN"), one_time), ResetPasswordVerificationTemplate, w, r)
+	if err := s.SendEmail(ctx, authUser.Email, "Reset Your Password", fmt.Sprintf("%s/reset-password/?token=%s", s.Config.Domain, one_time), ResetPasswordVerificationTemplate); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
 	SendData(map[string]interface{}{"message": "email sent"}, w, r)
 }
 
-func ResetPassword(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+type ResetPasswordInput struct {
+	NewPassword     string `json:"new_password" validate:"required"`
+	ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=NewPassword"`
+}
 
+func (s *Service) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 
 	token := queryParams.Get("token")
 
-	// verify token
-	user_id, err := VerifyToken(token)
+	// verify token, it is used up once the rest of the request is valid
+	user_id, err := PeekToken(token)
 
 	if err != nil {
-		http.Error(w, "Invalid auth token", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid auth token"))
 		return
 	}
 
-	queries := models.New(database.DB)
+	queries := s.Store.Auth
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
 	authUser := auth.(models.AuthUserReadRow)
 
 	if authUser.ID != int64(user_id) {
-		http.Error(w, "Forbidden User", http.StatusForbidden)
+		apierror.Write(w, r, apierror.Forbidden("Forbidden User"))
 		return
 	}
 
 	user, err := queries.UserLoginRead(ctx, authUser.Email)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	// get data
-	var data map[string]string
-	GetData(data, w, r)
+	var input ResetPasswordInput
+	if !validate.Bind(w, r, &input) {
+		return
+	}
 
-	if data["new_password"] != data["confirm_password"] {
-		http.Error(w, "Invalid Password", http.StatusBadRequest)
+	if err := ValidatePassword(s.Config.Password, input.NewPassword, user.Email); err != nil {
+		SendPasswordPolicyError(err, w, r)
 		return
 	}
 
-	hash, err := HashPassword(data["new_password"])
+	hash, err := HashPassword(s.Config.Password, input.NewPassword)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// use up the token
+	if _, err := VerifyToken(token); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid auth token"))
 		return
 	}
 
-	_, err = queries.UserUpdatePassword(ctx, models.UserUpdatePasswordParams{
-		ID:        int64(user_id),
-		Password:  hash,
-		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		_, err := tx.Auth.UserUpdatePassword(ctx, models.UserUpdatePasswordParams{
+			ID:        int64(user_id),
+			Password:  hash,
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "user", "update", user.ID, int64(user_id))
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	Logging(queries, ctx, "user", "update", user.ID, int64(user_id), w, r)
-
 	SendData(map[string]interface{}{"message": "password updated successfully"}, w, r)
 }
 
-func DeleteUserRequest(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
+func (s *Service) DeleteUserRequest(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
@@ -514,167 +668,279 @@ func DeleteUserRequest(w http.ResponseWriter, r *http.Request) {
 	one_time, err := GenerateOneTimeToken(32, uint(authUser.ID))
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	SendEmail(authUser.Email, "Delete User Account", fmt.Sprintf("%s/delete-user/?token=%s", os.Getenv("DOMAIN"), one_time), DeleteUserVerificationTemplate, w, r)
+	if err := s.SendEmail(ctx, authUser.Email, "Delete User Account", fmt.Sprintf("%s/delete-user/?token=%s", s.Config.Domain, one_time), DeleteUserVerificationTemplate); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
 	SendData(map[string]interface{}{"message": "email sent"}, w, r)
 }
 
-func DeleteUser(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+type DeleteUserInput struct {
+	Content string `json:"content" validate:"oneof=delete anonymize"` // what happens to the user's posts, anonymize by default
+}
+
+// DeleteUserOutput is the response when the deletion is scheduled rather than
+// carried out at once.
+type DeleteUserOutput struct {
+	Message      string    `json:"message"`
+	Content      string    `json:"content,omitempty"`
+	ScheduledFor time.Time `json:"scheduled_for,omitempty"`
+}
 
+func (s *Service) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 
 	token := queryParams.Get("token")
 
-	// verify token
-	user_id, err := VerifyToken(token)
+	// verify token, it is used up once the rest of the request is valid
+	user_id, err := PeekToken(token)
 
 	if err != nil {
-		http.Error(w, "Invalid auth token", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid auth token"))
 		return
 	}
 
-	queries := models.New(database.DB)
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
 	authUser := auth.(models.AuthUserReadRow)
 
 	if authUser.ID != int64(user_id) {
-		http.Error(w, "Forbidden User", http.StatusForbidden)
+		apierror.Write(w, r, apierror.Forbidden("Forbidden User"))
 		return
 	}
 
-	err = queries.UserDelete(ctx, int64(user_id))
+	// get data, the body is optional and an empty one keeps the defaults
+	var input DeleteUserInput
+	if r.ContentLength != 0 && !validate.Bind(w, r, &input) {
+		return
+	}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// use up the token
+	if _, err := VerifyToken(token); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid auth token"))
 		return
 	}
 
-	Logging(queries, ctx, "user", "delete", 0, int64(user_id), w, r)
+	content := input.Content
 
-	SendData(map[string]interface{}{"message": "user account deleted"}, w, r)
-}
+	if content == "" {
+		content = ContentAnonymize
+	}
 
-// require admin
-func IsActiveChange(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	grace := DeletionGracePeriod(s.Config)
+
+	if grace == 0 {
+		err = s.PurgeUser(ctx, authUser.ID, content)
+
+		if err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+
+		SendData(map[string]interface{}{"message": "user account deleted"}, w, r)
 		return
 	}
 
-	queryParams := r.URL.Query()
+	cancelToken := randomToken(32)
+
+	var deletion models.UserDeletionCreateRow
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		// replace any earlier schedule
+		if err := tx.Auth.UserDeletionUserDelete(ctx, authUser.ID); err != nil {
+			return err
+		}
 
-	user_id, err := strconv.ParseInt(queryParams.Get("user"), 10, 64)
+		deletion, err = tx.Auth.UserDeletionCreate(ctx, models.UserDeletionCreateParams{
+			UserID:       authUser.ID,
+			Content:      content,
+			CancelToken:  cancelToken,
+			ScheduledFor: time.Now().Add(grace),
+			CreatedAt:    sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "user_deletion", "create", deletion.ID, authUser.ID)
+	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	queries := models.New(database.DB)
-	ctx := r.Context()
-
-	auth := ctx.Value(current_user)
-
-	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+	if err := s.SendEmail(ctx, authUser.Email, "Your Account Is Scheduled For Deletion", fmt.Sprintf("%s/delete-user-cancel/?token=%s", s.Config.Domain, cancelToken), DeleteUserScheduledTemplate); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	authUser := auth.(models.AuthUserReadRow)
+	SendData(map[string]interface{}{
+		"message":       "user account scheduled for deletion",
+		"content":       deletion.Content,
+		"scheduled_for": deletion.ScheduledFor,
+	}, w, r)
+}
 
-	// get data
-	var data map[string]string
-	GetData(data, w, r)
+// DeleteUserCancel is reached from the link in the scheduled deletion email and
+// only requires the cancel token, which stays valid for the whole grace period.
+func (s *Service) DeleteUserCancel(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+
+	token := queryParams.Get("token")
+
+	queries := s.Store.Auth
+	ctx := r.Context()
 
-	status, err := strconv.ParseBool(data["active"])
+	deletion, err := queries.UserDeletionCancelRead(ctx, token)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.BadRequest("Invalid auth token"))
 		return
 	}
 
-	user, err := queries.UserUpdateIsActive(ctx, models.UserUpdateIsActiveParams{
-		ID:        user_id,
-		Isactive:  sql.NullBool{Bool: status, Valid: true},
-		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		if err := tx.Auth.UserDeletionUserDelete(ctx, deletion.UserID); err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "user_deletion", "delete", deletion.ID, deletion.UserID)
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	Logging(queries, ctx, "user", "update", user.ID, authUser.ID, w, r)
-
-	SendData(map[string]interface{}{"message": "user active status updated successfully"}, w, r)
+	SendData(map[string]interface{}{"message": "user account deletion cancelled"}, w, r)
 }
 
-func IsStaffChange(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	queryParams := r.URL.Query()
+// require admin
+type IsActiveInput struct {
+	Active *bool `json:"active" validate:"required"`
+}
 
-	user_id, err := strconv.ParseInt(queryParams.Get("user"), 10, 64)
+func (s *Service) IsActiveChange(w http.ResponseWriter, r *http.Request) {
+	user_id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.NotFound("user not found").Wrap(err))
 		return
 	}
 
-	queries := models.New(database.DB)
 	ctx := r.Context()
 
 	auth := ctx.Value(current_user)
 
 	if auth == nil {
-		http.Error(w, "there is no current user", http.StatusInternalServerError)
+		apierror.Write(w, r, errNoCurrentUser)
 		return
 	}
 
 	authUser := auth.(models.AuthUserReadRow)
 
 	// get data
-	var data map[string]string
-	GetData(data, w, r)
+	var input IsActiveInput
+	if !validate.Bind(w, r, &input) {
+		return
+	}
+	status := *input.Active
+
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		version, err := tx.Auth.UserVersion(ctx, user_id)
+		if err != nil {
+			return apierror.IfNotFound(err, apierror.NotFound("user not found"))
+		}
+		if err := CheckIfMatch(r, version); err != nil {
+			return err
+		}
+
+		user, err := tx.Auth.UserUpdateIsActive(ctx, models.UserUpdateIsActiveParams{
+			ID:        user_id,
+			Isactive:  sql.NullBool{Bool: status, Valid: true},
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "user", "update", user.ID, authUser.ID)
+	})
+
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	SendData(map[string]interface{}{"message": "user active status updated successfully"}, w, r)
+}
+
+type IsStaffInput struct {
+	Staff *bool `json:"staff" validate:"required"`
+}
 
-	status, err := strconv.ParseBool(data["staff"])
+func (s *Service) IsStaffChange(w http.ResponseWriter, r *http.Request) {
+	user_id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.NotFound("user not found").Wrap(err))
 		return
 	}
 
-	user, err := queries.UserUpdateIsStaff(ctx, models.UserUpdateIsStaffParams{
-		ID:        user_id,
-		Isstaff:   sql.NullBool{Bool: status, Valid: true},
-		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	ctx := r.Context()
+
+	auth := ctx.Value(current_user)
+
+	if auth == nil {
+		apierror.Write(w, r, errNoCurrentUser)
+		return
+	}
+
+	authUser := auth.(models.AuthUserReadRow)
+
+	// get data
+	var input IsStaffInput
+	if !validate.Bind(w, r, &input) {
+		return
+	}
+	status := *input.Staff
+
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		version, err := tx.Auth.UserVersion(ctx, user_id)
+		if err != nil {
+			return apierror.IfNotFound(err, apierror.NotFound("user not found"))
+		}
+		if err := CheckIfMatch(r, version); err != nil {
+			return err
+		}
+
+		user, err := tx.Auth.UserUpdateIsStaff(ctx, models.UserUpdateIsStaffParams{
+			ID:        user_id,
+			Isstaff:   sql.NullBool{Bool: status, Valid: true},
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		return LogAction(tx.Auth, ctx, "user", "update", user.ID, authUser.ID)
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	Logging(queries, ctx, "user", "update", user.ID, authUser.ID, w, r)
-
 	SendData(map[string]interface{}{"message": "user staff status updated successfully"}, w, r)
 }
@@ -2,12 +2,24 @@ package auth
 
 import (
 	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/immanuel-254/blog/apierror"
+	"github.com/immanuel-254/blog/metrics"
+	"github.com/immanuel-254/blog/openapi"
 )
 
 type View struct {
-	Route       string
+	Route       string   // path pattern, wildcards such as {id} are read with r.PathValue
+	Methods     []string // empty accepts every method
 	Middlewares []func(http.Handler) http.Handler
+	Auth        func(http.Handler) http.Handler // signs the user in before the middlewares, such as RequireAuth; documents the route as secured
 	Handler     http.Handler
+	Cors        *CorsConfig // overrides the configured CORS policy
+	Headers     *Config     // overrides the global security headers
+	Deprecation *Deprecation
+	Doc         openapi.Operation
 }
 
 // Middleware chaining
@@ -18,13 +30,156 @@ func chainMiddlewares(handler http.Handler, middlewares []func(http.Handler) htt
 	return handler
 }
 
-// Routes function
-func Routes(mux *http.ServeMux, views []View) {
+// RoutePolicy wraps a route handler with its CORS policy and any security header
+// overrides. CORS is applied outermost so preflight requests are answered before
+// authentication middlewares run. Without a policy no CORS headers are sent, so
+// only pages of the same origin can read the responses.
+func RoutePolicy(handler http.Handler, cors *CorsConfig, headers *Config) http.Handler {
+	if headers != nil {
+		handler = New(*headers)(handler)
+	}
+
+	if cors != nil {
+		return Cors(*cors)(handler)
+	}
+
+	return handler
+}
+
+// Group registers views under a common path prefix, wrapped in middlewares shared
+// by all of them. The group middlewares run before those of the view. A version of
+// the API is a group:
+//
+//	auth.Group{Prefix: "/api/v1"}.Routes(mux, v1)
+type Group struct {
+	Prefix      string
+	Middlewares []func(http.Handler) http.Handler
+	Deprecation *Deprecation // applies to views without a deprecation of their own
+	Cors        *CorsConfig  // applies to views without a policy of their own
+}
+
+// Routes registers every view with a method pattern per method, so the mux answers
+// other methods with 405 and an Allow header. Each path also accepts OPTIONS so
+// CORS preflight requests reach the route policy.
+func (g Group) Routes(mux *http.ServeMux, views []View) {
+	allowed := map[string][]string{}
+	for _, view := range views {
+		allowed[view.Route] = append(allowed[view.Route], view.Methods...)
+	}
+	for route, methods := range allowed {
+		if slices.Contains(methods, http.MethodOptions) {
+			delete(allowed, route) // the view answers OPTIONS itself
+		}
+	}
+
 	for _, view := range views {
-		handlerWithMiddlewares := chainMiddlewares(view.Handler, view.Middlewares)
-		mux.HandleFunc(view.Route, func(w http.ResponseWriter, r *http.Request) {
-			handlerWithMiddlewares.ServeHTTP(w, r)
-		})
+		route := g.Prefix + view.Route
+		handler := chainMiddlewares(view.Handler, view.Middlewares)
+		if view.Auth != nil {
+			handler = view.Auth(handler)
+		}
+		handler = chainMiddlewares(handler, g.Middlewares)
+
+		deprecation := view.Deprecation
+		if deprecation == nil {
+			deprecation = g.Deprecation
+		}
+		if deprecation != nil {
+			handler = Deprecated(*deprecation)(handler)
+		}
+
+		cors := view.Cors
+		if cors == nil {
+			cors = g.Cors
+		}
+		handler = metrics.Instrument(route, RoutePolicy(handler, cors, view.Headers))
+
+		doc := view.Doc
+		doc.Secured = doc.Secured || view.Auth != nil
+		doc.Deprecated = doc.Deprecated || deprecation != nil
+
+		if len(view.Methods) == 0 {
+			mux.Handle(route, withRoute(route, handler))
+			openapi.Default.Add("", route, doc)
+			continue
+		}
+
+		for _, method := range view.Methods {
+			mux.Handle(method+" "+route, withRoute(route, handler))
+			openapi.Default.Add(method, route, doc)
+		}
+
+		if methods, ok := allowed[view.Route]; ok {
+			delete(allowed, view.Route) // one OPTIONS handler per path
+			options := metrics.Instrument(route, RoutePolicy(optionsHandler(methods), cors, view.Headers))
+			mux.Handle(http.MethodOptions+" "+route, withRoute(route, options))
+		}
+	}
+}
+
+// Routes registers views at the root of mux.
+func Routes(mux *http.ServeMux, views []View) {
+	Group{}.Routes(mux, views)
+}
+
+func withRoute(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), route)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// optionsHandler answers OPTIONS requests that are not CORS preflights.
+func optionsHandler(methods []string) http.Handler {
+	allow := slices.Clone(methods)
+	if slices.Contains(allow, http.MethodGet) {
+		allow = append(allow, http.MethodHead)
+	}
+	allow = append(allow, http.MethodOptions)
+
+	header := strings.Join(allow, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", header)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// MuxErrors answers requests that match no route in the error envelope instead of
+// the plain text responses of http.ServeMux.
+func MuxErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(&muxErrorWriter{ResponseWriter: w, r: r}, r)
+	})
+}
+
+// muxErrorWriter replaces the 404 and 405 bodies written by http.ServeMux. Other
+// responses, such as redirects to the clean path, pass through.
+type muxErrorWriter struct {
+	http.ResponseWriter
+	r        *http.Request
+	replaced bool
+}
+
+func (w *muxErrorWriter) WriteHeader(status int) {
+	switch status {
+	case http.StatusNotFound:
+		w.replaced = true
+		apierror.Write(w.ResponseWriter, w.r, apierror.NotFound("route not found"))
+	case http.StatusMethodNotAllowed:
+		w.replaced = true
+		apierror.Write(w.ResponseWriter, w.r, apierror.MethodNotAllowed())
+	default:
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
 
+func (w *muxErrorWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
 	}
+	return w.ResponseWriter.Write(b)
 }
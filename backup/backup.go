@@ -0,0 +1,385 @@
+// Package backup takes snapshots of a SQLite database while it is in use, prunes
+// old ones and restores them in place of the database.
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/migrations"
+)
+
+const (
+	prefix     = "blog-"
+	timeLayout = "20060102-150405"
+	extension  = ".sqlite"
+	gzipSuffix = ".gz"
+)
+
+// ErrUnsupported is returned for databases that are not SQLite, which are backed
+// up with the tools of their engine.
+var ErrUnsupported = errors.New("backups only support SQLite")
+
+// Snapshot is a backup written to a directory by Take.
+type Snapshot struct {
+	Path string
+	Time time.Time
+	Size int64
+}
+
+// Name returns the file name of the snapshot taken at t.
+func Name(t time.Time, compress bool) string {
+	name := prefix + t.UTC().Format(timeLayout) + extension
+	if compress {
+		name += gzipSuffix
+	}
+	return name
+}
+
+// Write writes a consistent copy of db to path, gzip compressed if path ends in
+// .gz. The copy is made with VACUUM INTO on a reader connection, so writers are
+// not held up, and path only appears once it is complete.
+func Write(ctx context.Context, db *database.Database, path string) error {
+	if db.Driver != database.SQLite {
+		return ErrUnsupported
+	}
+
+	raw, err := tempName(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(raw)
+
+	if err := vacuumInto(ctx, db, raw); err != nil {
+		return err
+	}
+	// the backup holds password hashes and session keys
+	if err := os.Chmod(raw, 0o600); err != nil {
+		return err
+	}
+
+	if !strings.HasSuffix(path, gzipSuffix) {
+		return os.Rename(raw, path)
+	}
+
+	compressed, err := tempName(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(compressed)
+
+	if err := compress(raw, compressed); err != nil {
+		return err
+	}
+
+	return os.Rename(compressed, path)
+}
+
+// vacuumInto copies db to path on a connection of its own, from the reader pool
+// when there is one. Readers are query only, which VACUUM INTO counts as a write,
+// so the pragma is lifted for the copy and the connection dropped if it cannot be
+// restored.
+func vacuumInto(ctx context.Context, db *database.Database, path string) error {
+	pool := db.DB
+	if db.Reader != nil {
+		pool = db.Reader
+	}
+
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if db.Reader != nil {
+		if _, err := conn.ExecContext(ctx, "PRAGMA query_only = false"); err != nil {
+			return err
+		}
+		defer func() {
+			if _, err := conn.ExecContext(context.Background(), "PRAGMA query_only = true"); err != nil {
+				conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+			}
+		}()
+	}
+
+	_, err = conn.ExecContext(ctx, "VACUUM INTO ?", path)
+	return err
+}
+
+// Take writes a timestamped backup of db to dir, which is created if needed,
+// and returns its path.
+func Take(ctx context.Context, db *database.Database, dir string, compress bool) (string, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, Name(time.Now(), compress))
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("%s already exists", path)
+	}
+
+	if err := Write(ctx, db, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// List returns the snapshots in dir, newest first. Other files are ignored.
+func List(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		stamp, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok {
+			continue
+		}
+		stamp = strings.TrimSuffix(stamp, gzipSuffix)
+		stamp, ok = strings.CutSuffix(stamp, extension)
+		if !ok {
+			continue
+		}
+		taken, err := time.Parse(timeLayout, stamp)
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		snapshots = append(snapshots, Snapshot{Path: filepath.Join(dir, entry.Name()), Time: taken, Size: info.Size()})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.After(snapshots[j].Time) })
+	return snapshots, nil
+}
+
+// Prune deletes the snapshots in dir beyond the newest keep, and those taken more
+// than maxAge before now. A zero keep or maxAge disables that rule. The newest
+// snapshot is never deleted. It returns the deleted snapshots.
+func Prune(dir string, keep int, maxAge time.Duration, now time.Time) ([]Snapshot, error) {
+	snapshots, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []Snapshot
+	for i, snapshot := range snapshots {
+		if i == 0 {
+			continue
+		}
+		tooMany := keep > 0 && i >= keep
+		tooOld := maxAge > 0 && now.Sub(snapshot.Time) > maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		if err := os.Remove(snapshot.Path); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, snapshot)
+	}
+
+	return pruned, nil
+}
+
+// Run takes a snapshot of db and prunes old ones as set by cfg every
+// cfg.Interval, until ctx is cancelled.
+func Run(ctx context.Context, db *database.Database, cfg config.BackupConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		path, err := Take(ctx, db, cfg.Dir, cfg.Gzip)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to back up the database", "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "backed up the database", "path", path)
+
+		pruned, err := Prune(cfg.Dir, cfg.Keep, cfg.MaxAge, time.Now())
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to prune backups", "error", err)
+		} else if len(pruned) > 0 {
+			slog.InfoContext(ctx, "pruned backups", "count", len(pruned))
+		}
+	}
+}
+
+// Result describes a backup restored by Restore.
+type Result struct {
+	Version int64 // migration the backup is at
+	Latest  int64 // migration this build expects, the backup needs migrating when it is higher
+}
+
+// Restore replaces the SQLite database at dbPath with the backup at path, which
+// may be gzip compressed. The backup is copied next to the database and checked
+// for integrity and a schema this build knows before it is renamed into place,
+// so a bad backup leaves the database untouched. The server must be stopped.
+func Restore(ctx context.Context, path, dbPath string) (Result, error) {
+	var result Result
+
+	tmp, err := tempName(filepath.Dir(dbPath), filepath.Base(dbPath))
+	if err != nil {
+		return result, err
+	}
+	defer os.Remove(tmp)
+
+	if strings.HasSuffix(path, gzipSuffix) {
+		err = decompress(path, tmp)
+	} else {
+		err = copyFile(path, tmp)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result, err = Check(ctx, tmp)
+	if err != nil {
+		return result, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// the journal of the old database must not be applied to the backup
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+	}
+
+	return result, os.Rename(tmp, dbPath)
+}
+
+// Check makes sure the uncompressed backup at path is an intact SQLite database
+// whose schema is not newer than the migrations of this build.
+func Check(ctx context.Context, path string) (Result, error) {
+	var result Result
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return result, err
+	}
+	defer db.Close()
+
+	var integrity string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return result, fmt.Errorf("not a SQLite database: %w", err)
+	}
+	if integrity != "ok" {
+		return result, fmt.Errorf("the database is corrupt: %s", integrity)
+	}
+
+	result.Version, result.Latest, err = migrations.Versions(ctx, database.SQLite, db)
+	if err != nil {
+		return result, fmt.Errorf("reading the schema version: %w", err)
+	}
+	if result.Version > result.Latest {
+		return result, fmt.Errorf("the schema is at version %d, newer than this build knows (%d), restore it with a newer build", result.Version, result.Latest)
+	}
+
+	return result, nil
+}
+
+// tempName returns the name of a file that does not exist yet in dir, as VACUUM
+// INTO refuses to write over one.
+func tempName(dir, base string) (string, error) {
+	file, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	name := file.Name()
+	file.Close()
+	return name, os.Remove(name)
+}
+
+func compress(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(out)
+	if _, err := io.Copy(writer, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func decompress(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	reader, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+	defer reader.Close()
+
+	return writeFile(dst, reader)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeFile(dst, in)
+}
+
+func writeFile(path string, r io.Reader) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
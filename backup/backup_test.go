@@ -0,0 +1,325 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/internal/testdb"
+	"github.com/immanuel-254/blog/migrations"
+	"github.com/pressly/goose/v3"
+)
+
+// openDB opens the SQLite database at path, migrated and with a note written to
+// it, and closes it when the test ends.
+func openDB(t *testing.T, path string) *database.Database {
+	t.Helper()
+
+	db, err := database.Open(database.SQLite, path, config.Default().SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	testdb.Migrate(t, db)
+	if _, err := db.Exec("CREATE TABLE notes (body TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	addNote(t, db.DB, "first")
+	return db
+}
+
+func addNote(t *testing.T, db *sql.DB, body string) {
+	t.Helper()
+
+	if _, err := db.Exec("INSERT INTO notes (body) VALUES (?)", body); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// notes returns the notes in the SQLite database at path.
+func notes(t *testing.T, path string) []string {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT body FROM notes ORDER BY rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var bodies []string
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, body)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return bodies
+}
+
+func TestTake(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, filepath.Join(t.TempDir(), "blog.sqlite"))
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	plain, err := Take(ctx, db, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := Take(ctx, db, dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(compressed, extension+gzipSuffix) {
+		t.Errorf("compressed to %s", compressed)
+	}
+
+	for _, path := range []string{plain, compressed} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("%s has the mode %v", path, info.Mode())
+		}
+	}
+
+	// only the snapshots are left in the directory
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("the directory has %d files, %v", len(entries), err)
+	}
+	snapshots, err := List(dir)
+	if err != nil || len(snapshots) != 2 {
+		t.Errorf("listed %v, %v", snapshots, err)
+	}
+
+	if got := notes(t, plain); len(got) != 1 || got[0] != "first" {
+		t.Errorf("the snapshot holds %v", got)
+	}
+	result, err := Check(ctx, plain)
+	if err != nil || result.Version != result.Latest || result.Version == 0 {
+		t.Errorf("checked %+v, %v", result, err)
+	}
+}
+
+func TestTakeKeepsReadersQueryOnly(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, filepath.Join(t.TempDir(), "blog.sqlite"))
+
+	if _, err := Take(ctx, db, t.TempDir(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	// every open reader, the one that made the copy too
+	open := db.Reader.Stats().OpenConnections
+	if open == 0 {
+		t.Fatal("the copy was not made on a reader")
+	}
+	for i := 0; i < open; i++ {
+		conn, err := db.Reader.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		var queryOnly bool
+		if err := conn.QueryRowContext(ctx, "PRAGMA query_only").Scan(&queryOnly); err != nil || !queryOnly {
+			t.Errorf("reader %d: query_only %v, %v", i, queryOnly, err)
+		}
+	}
+
+	if err := db.Verify(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTakeRefusesPostgres(t *testing.T) {
+	if _, err := Take(context.Background(), &database.Database{Driver: database.Postgres}, t.TempDir(), false); err != ErrUnsupported {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		ages   []time.Duration // of the snapshots, newest first
+		keep   int
+		maxAge time.Duration
+		pruned int
+	}{
+		{"keep all", []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour}, 0, 0, 0},
+		{"keep 2", []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour}, 2, 0, 1},
+		{"max age", []time.Duration{time.Hour, 50 * time.Hour, 72 * time.Hour}, 0, 48 * time.Hour, 2},
+		{"both", []time.Duration{time.Hour, 2 * time.Hour, 72 * time.Hour}, 2, 48 * time.Hour, 1},
+		{"the newest is too old", []time.Duration{72 * time.Hour, 96 * time.Hour}, 0, 48 * time.Hour, 1},
+		{"keep 1 of 1", []time.Duration{time.Hour}, 1, time.Minute, 0},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		for i, age := range test.ages {
+			if err := os.WriteFile(filepath.Join(dir, Name(now.Add(-age), i%2 == 1)), []byte("snapshot"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// other files are left alone
+		for _, name := range []string{"notes.txt", "blog-latest.sqlite", Name(now.Add(-1000*time.Hour), false) + ".bak"} {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		pruned, err := Prune(dir, test.keep, test.maxAge, now)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(pruned) != test.pruned {
+			t.Errorf("%s: pruned %v", test.name, pruned)
+		}
+
+		left, err := List(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) != len(test.ages)-test.pruned || !left[0].Time.Equal(now.Add(-test.ages[0])) {
+			t.Errorf("%s: left %v", test.name, left)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != len(left)+3 {
+			t.Errorf("%s: %d files in the directory", test.name, len(entries))
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "blog.sqlite")
+	db := openDB(t, dbPath)
+
+	for _, name := range []string{"backup.sqlite", "backup.sqlite.gz"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := Write(ctx, db, path); err != nil {
+			t.Fatal(err)
+		}
+
+		addNote(t, db.DB, "after the backup")
+		db.Close()
+
+		result, err := Restore(ctx, path, dbPath)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if result.Version == 0 || result.Version != result.Latest {
+			t.Errorf("%s: restored %+v", name, result)
+		}
+		if got := notes(t, dbPath); len(got) != 1 || got[0] != "first" {
+			t.Errorf("%s: the database holds %v", name, got)
+		}
+
+		// the restored database is usable
+		reopened, err := database.Open(database.SQLite, dbPath, config.Default().SQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { reopened.Close() })
+		if err := reopened.Verify(ctx); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		db = reopened
+	}
+}
+
+func TestRestoreRefusesBadBackups(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "blog.sqlite")
+	db := openDB(t, dbPath)
+
+	// a schema newer than this build
+	newer := filepath.Join(t.TempDir(), "newer.sqlite")
+	if err := Write(ctx, db, newer); err != nil {
+		t.Fatal(err)
+	}
+	_, latest, err := migrations.Versions(ctx, database.SQLite, db.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := sql.Open("sqlite3", newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backup.Exec("INSERT INTO "+goose.DefaultTablename+" (version_id, is_applied) VALUES (?, true)", latest+1); err != nil {
+		t.Fatal(err)
+	}
+	backup.Close()
+
+	// a file that is not a database
+	garbage := filepath.Join(t.TempDir(), "garbage.sqlite")
+	if err := os.WriteFile(garbage, []byte(strings.Repeat("not a database ", 100)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// a database missing half of its pages
+	data, err := os.ReadFile(newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(t.TempDir(), "truncated.sqlite")
+	if err := os.WriteFile(truncated, data[:len(data)/2], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+	before, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, want string
+	}{
+		{newer, "newer than this build knows"},
+		{garbage, "not a SQLite database"},
+		{truncated, "SQLite database"},
+		{garbage + ".gz", "no such file"},
+	}
+
+	for _, test := range tests {
+		_, err := Restore(ctx, test.path, dbPath)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v", filepath.Base(test.path), err)
+		}
+	}
+
+	// the database is untouched, and no copies are left next to it
+	after, err := os.ReadFile(dbPath)
+	if err != nil || string(after) != string(before) {
+		t.Errorf("the database changed, %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(dbPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("left %s behind", entry.Name())
+		}
+	}
+}
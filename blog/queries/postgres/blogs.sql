@@ -0,0 +1,109 @@
+-- name: BlogCreate :one
+INSERT INTO blogs (
+    user_id, 
+    title, 
+    body, 
+    created_at, 
+    updated_at
+    ) 
+    VALUES ($1, $2, $3, $4, $5)
+    RETURNING *;
+
+-- name: AssignBlogToCategory :exec
+INSERT INTO category_blogs (blog_id, category_id, created_at, updated_at) VALUES ($1, $2, $3, $4);
+
+-- name: CategoryBlogDelete :exec
+DELETE FROM category_blogs WHERE blog_id = $1 and category_id = $2;
+
+-- name: BlogList :many
+SELECT id, user_id, title, body, created_at, updated_at FROM blogs
+ORDER BY id ASC;
+
+-- name: CategoryBlogList :many
+SELECT blog_id, category_id, created_at, updated_at FROM category_blogs
+ORDER BY blog_id ASC, category_id ASC;
+
+-- name: BlogRead :one
+SELECT 
+    b.id AS blog_id,
+    b.title AS blog_title,
+    b.body AS blog_body,
+    b.publish AS blog_publish,
+    b.created_at AS blog_created_at,
+    b.updated_at AS blog_updated_at,
+    b.version AS blog_version,
+    p.user_id AS blog_auth_id,
+    p.username AS user_name,
+
+    COALESCE(string_agg(DISTINCT 
+        CONCAT('{"id":', cat.id, ',"name":"', cat.name, '"}'), ','
+    ), '[]') AS categories,
+    COALESCE(string_agg(DISTINCT 
+        CONCAT('{"id":', c.id, ',"user_id":', c.user_id, ',"body":"', c.body, '"}'), ','
+    ), '[]') AS comments
+    
+FROM blogs b
+LEFT JOIN profiles p ON b.user_id = p.user_id
+LEFT JOIN comments c ON b.id = c.blog_id
+LEFT JOIN category_blogs cb ON b.id = cb.blog_id
+LEFT JOIN categories cat ON cb.category_id = cat.id
+WHERE b.id = $1
+GROUP BY b.id, p.user_id, p.username; 
+
+-- name: BlogCategoriesList :many
+SELECT blog_id, category_id, created_at, updated_at FROM category_blogs
+WHERE blog_id = $1 ORDER BY blog_id ASC, category_id ASC;
+
+-- name: BlogCommentsList :many
+SELECT id, blog_id, user_id, body ,created_at, updated_at FROM comments
+WHERE blog_id = $1 ORDER BY blog_id ASC;
+
+-- name: BlogUpdate :one
+UPDATE blogs
+SET 
+    title = $1,
+    body = $2,
+    updated_at = $3,
+    version = version + 1
+WHERE id = $4
+RETURNING user_id, title, body, created_at, updated_at, version;
+
+-- name: BlogDelete :exec
+DELETE FROM blogs WHERE id = $1;
+
+-- name: BlogUserList :many
+SELECT id, user_id, title, body, publish, created_at, updated_at FROM blogs
+WHERE user_id = $1
+ORDER BY id ASC;
+
+-- name: BlogUserReassign :exec
+UPDATE blogs SET user_id = $1 WHERE user_id = $2;
+
+-- name: CategoryBlogUserDelete :exec
+DELETE FROM category_blogs WHERE blog_id IN (SELECT id FROM blogs WHERE user_id = $1);
+
+-- name: BlogUserDelete :exec
+DELETE FROM blogs WHERE user_id = $1;
+
+-- name: BlogImport :one
+INSERT INTO blogs (
+    user_id,
+    title,
+    body,
+    publish,
+    created_at,
+    updated_at
+    )
+    VALUES ($1, $2, $3, $4, $5, $6)
+    RETURNING *;
+
+-- name: BlogExists :one
+SELECT EXISTS(SELECT 1 FROM blogs WHERE id = $1)::int::bigint;
+
+-- name: BlogOwner :one
+SELECT user_id FROM blogs
+WHERE id = $1;
+
+-- name: BlogVersion :one
+SELECT version FROM blogs
+WHERE id = $1 FOR UPDATE;
@@ -0,0 +1,39 @@
+-- name: CategoryCreate :one
+INSERT INTO categories (
+    user_id, 
+    name, 
+    created_at, 
+    updated_at
+    ) 
+    VALUES ($1, $2, $3, $4)
+    RETURNING *;
+
+-- name: CategoryList :many
+SELECT id, user_id, name, created_at, updated_at FROM categories
+ORDER BY id ASC;
+
+-- name: CategoryRead :one
+SELECT id, user_id, name, created_at, updated_at, version FROM categories
+WHERE id = $1;
+
+-- name: CategoryUpdate :one
+UPDATE categories
+SET 
+    name = $1,
+    updated_at = $2,
+    version = version + 1
+WHERE id = $3
+RETURNING id, user_id, name, created_at, updated_at, version;
+
+-- name: CategoryDelete :exec
+DELETE FROM categories WHERE id = $1;
+
+-- name: CategoryUserReassign :exec
+UPDATE categories SET user_id = $1 WHERE user_id = $2;
+
+-- name: CategoryExists :one
+SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)::int::bigint;
+
+-- name: CategoryVersion :one
+SELECT version FROM categories
+WHERE id = $1 FOR UPDATE;
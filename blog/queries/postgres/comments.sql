@@ -0,0 +1,56 @@
+-- name: CommentCreate :one
+INSERT INTO comments (
+    user_id, 
+    blog_id, 
+    body, 
+    created_at, 
+    updated_at
+    ) 
+    VALUES ($1, $2, $3, $4, $5)
+    RETURNING *;
+
+-- name: CommentList :many
+SELECT id, user_id, body, created_at, updated_at FROM comments
+ORDER BY id ASC;
+
+-- name: CommentRead :one
+SELECT id, user_id, body, created_at, updated_at, version FROM comments
+WHERE id = $1;
+
+-- name: CommentUpdate :one
+UPDATE comments
+SET 
+    body = $1,
+    updated_at = $2,
+    version = version + 1
+WHERE id = $3
+RETURNING id, user_id, body, created_at, updated_at, version;
+
+-- name: CommentDelete :exec
+DELETE FROM comments WHERE id = $1;
+
+-- name: CommentUserList :many
+SELECT id, user_id, blog_id, body, created_at, updated_at FROM comments
+WHERE user_id = $1
+ORDER BY id ASC;
+
+-- name: CommentUserReassign :exec
+UPDATE comments SET user_id = $1 WHERE user_id = $2;
+
+-- name: CommentUserBlogsDelete :exec
+DELETE FROM comments WHERE comments.user_id = $1 OR comments.blog_id IN (SELECT b.id FROM blogs b WHERE b.user_id = $2);
+
+-- name: CommentImport :one
+INSERT INTO comments (
+    user_id,
+    blog_id,
+    body,
+    created_at,
+    updated_at
+    )
+    VALUES ($1, $2, $3, $4, $5)
+    RETURNING *;
+
+-- name: CommentVersion :one
+SELECT version FROM comments
+WHERE id = $1 FOR UPDATE;
@@ -0,0 +1,77 @@
+-- name: MediaCreate :one
+INSERT INTO media (
+    owner_id,
+    blog_id,
+    key,
+    filename,
+    content_type,
+    size,
+    width,
+    height,
+    alt,
+    variants,
+    created_at,
+    updated_at
+    )
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+    RETURNING *;
+
+-- name: MediaRead :one
+SELECT * FROM media
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: MediaList :many
+SELECT * FROM media
+WHERE deleted_at IS NULL
+    AND (owner_id = sqlc.narg(owner_id) OR sqlc.narg(owner_id)::BIGINT IS NULL)
+    AND (blog_id = sqlc.narg(blog_id) OR sqlc.narg(blog_id)::BIGINT IS NULL)
+    AND content_type LIKE sqlc.arg(content_type)
+ORDER BY id DESC
+LIMIT sqlc.arg('limit')::BIGINT OFFSET sqlc.arg('offset')::BIGINT;
+
+-- name: MediaUpdate :one
+UPDATE media
+SET
+    blog_id = $1,
+    alt = $2,
+    updated_at = $3
+WHERE id = $4 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: MediaTrash :exec
+UPDATE media SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL;
+
+-- name: MediaTrashedList :many
+SELECT * FROM media
+WHERE deleted_at IS NOT NULL
+ORDER BY id ASC
+LIMIT sqlc.arg('limit')::BIGINT;
+
+-- name: MediaPurge :exec
+DELETE FROM media WHERE id = $1 AND deleted_at IS NOT NULL;
+
+-- name: MediaBlogUnlink :exec
+UPDATE media SET blog_id = NULL WHERE blog_id = $1;
+
+-- name: MediaUserBlogsUnlink :exec
+UPDATE media SET blog_id = NULL WHERE blog_id IN (SELECT id FROM blogs WHERE user_id = $1);
+
+-- name: MediaUserTrash :exec
+UPDATE media SET deleted_at = $1 WHERE owner_id = $2 AND deleted_at IS NULL;
+
+-- name: MediaUserReassign :exec
+UPDATE media SET owner_id = $1 WHERE owner_id = $2;
+
+-- name: MediaAvatarList :many
+SELECT media.* FROM media
+JOIN profiles ON profiles.avatar_id = media.id
+WHERE media.deleted_at IS NULL;
+
+-- name: MediaUserAvatarTrash :exec
+UPDATE media SET deleted_at = $1
+WHERE id IN (SELECT avatar_id FROM profiles WHERE user_id = $2) AND deleted_at IS NULL;
+
+-- name: MediaUserList :many
+SELECT * FROM media
+WHERE owner_id = $1 AND deleted_at IS NULL
+ORDER BY id;
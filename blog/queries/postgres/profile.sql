@@ -0,0 +1,59 @@
+-- name: ProfileCreate :one
+INSERT INTO profiles (user_id, username, image, bio, created_at, updated_at)
+SELECT
+    sqlc.narg(user_id)::bigint,
+    sqlc.arg(username)::text,
+    sqlc.narg(image)::text,
+    sqlc.narg(bio)::text,
+    sqlc.narg(created_at)::timestamptz,
+    sqlc.narg(updated_at)::timestamptz
+WHERE NOT EXISTS (SELECT 1 FROM profiles WHERE user_id = sqlc.narg(user_id))
+RETURNING *;
+
+-- name: ProfileList :many
+SELECT id, user_id, username, image, bio, created_at, updated_at, version, avatar_id FROM profiles
+ORDER BY id ASC;
+
+-- name: ProfileRead :one
+SELECT id, user_id, username, image, bio, created_at, updated_at, version, avatar_id FROM profiles
+WHERE id = $1;
+
+-- name: ProfileUpdate :one
+UPDATE profiles
+SET 
+    username = $1,
+    image = $2,
+    bio = $3,
+    created_at = $4,
+    updated_at = $5,
+    version = version + 1
+WHERE id = $6
+RETURNING id, user_id, username, image, bio, created_at, updated_at, version, avatar_id;
+
+-- name: ProfileDelete :exec
+DELETE FROM profiles WHERE id = $1;
+
+-- name: ProfileUserRead :one
+SELECT id, user_id, username, image, bio, created_at, updated_at, version, avatar_id FROM profiles
+WHERE user_id = $1;
+
+-- name: ProfileUserDelete :exec
+DELETE FROM profiles WHERE user_id = $1;
+
+-- name: ProfileImport :one
+INSERT INTO profiles (user_id, username, image, bio, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: ProfileVersion :one
+SELECT version FROM profiles
+WHERE id = $1 FOR UPDATE;
+
+-- name: ProfileAvatarUpdate :one
+UPDATE profiles
+SET
+    avatar_id = $1,
+    updated_at = $2,
+    version = version + 1
+WHERE id = $3
+RETURNING id, user_id, username, image, bio, created_at, updated_at, version, avatar_id;
@@ -0,0 +1,47 @@
+-- name: BlogRevisionCreate :one
+INSERT INTO blog_revisions (
+    blog_id,
+    number,
+    title,
+    body,
+    author_id,
+    restored_from,
+    created_at
+    )
+    VALUES ($1, (SELECT COALESCE(MAX(r.number), 0) + 1 FROM blog_revisions r WHERE r.blog_id = $2), $3, $4, $5, $6, $7)
+    RETURNING *;
+
+-- name: BlogRevisionList :many
+SELECT id, blog_id, number, title, author_id, restored_from, created_at FROM blog_revisions
+WHERE blog_id = $1
+ORDER BY number DESC;
+
+-- name: BlogRevisionRead :one
+SELECT * FROM blog_revisions
+WHERE blog_id = $1 AND number = $2;
+
+-- name: BlogRevisionLatest :one
+SELECT * FROM blog_revisions
+WHERE blog_id = $1
+ORDER BY number DESC
+LIMIT 1;
+
+-- name: BlogRevisionPrune :execrows
+DELETE FROM blog_revisions
+WHERE blog_revisions.blog_id = sqlc.arg(blog_id) AND blog_revisions.id NOT IN (
+    SELECT r.id FROM blog_revisions r WHERE r.blog_id = sqlc.arg(blog_id) ORDER BY r.number DESC LIMIT sqlc.arg('limit')::BIGINT
+);
+
+-- name: BlogRevisionBlogDelete :exec
+DELETE FROM blog_revisions WHERE blog_id = $1;
+
+-- name: BlogRevisionUserDelete :exec
+DELETE FROM blog_revisions WHERE blog_id IN (SELECT id FROM blogs WHERE user_id = $1);
+
+-- name: BlogRevisionAuthorReassign :exec
+UPDATE blog_revisions SET author_id = $1 WHERE author_id = $2;
+
+-- name: BlogRevisionUserList :many
+SELECT * FROM blog_revisions
+WHERE author_id = $1 OR blog_id IN (SELECT id FROM blogs WHERE user_id = $1)
+ORDER BY blog_id, number;
@@ -31,6 +31,7 @@ SELECT
     b.publish AS blog_publish,
     b.created_at AS blog_created_at,
     b.updated_at AS blog_updated_at,
+    b.version AS blog_version,
     p.user_id AS blog_auth_id,
     p.username AS user_name,
 
@@ -61,9 +62,47 @@ UPDATE blogs
 SET 
     title = ?,
     body = ?,
-    updated_at = ?
+    updated_at = ?,
+    version = version + 1
 WHERE id = ?
-RETURNING user_id, title, body, created_at, updated_at;
+RETURNING user_id, title, body, created_at, updated_at, version;
 
 -- name: BlogDelete :exec
 DELETE FROM blogs WHERE id = ?;
+
+-- name: BlogUserList :many
+SELECT id, user_id, title, body, publish, created_at, updated_at FROM blogs
+WHERE user_id = ?
+ORDER BY id ASC;
+
+-- name: BlogUserReassign :exec
+UPDATE blogs SET user_id = ? WHERE user_id = ?;
+
+-- name: CategoryBlogUserDelete :exec
+DELETE FROM category_blogs WHERE blog_id IN (SELECT id FROM blogs WHERE user_id = ?);
+
+-- name: BlogUserDelete :exec
+DELETE FROM blogs WHERE user_id = ?;
+
+-- name: BlogImport :one
+INSERT INTO blogs (
+    user_id,
+    title,
+    body,
+    publish,
+    created_at,
+    updated_at
+    )
+    VALUES (?, ?, ?, ?, ?, ?)
+    RETURNING *;
+
+-- name: BlogExists :one
+SELECT EXISTS(SELECT 1 FROM blogs WHERE id = ?);
+
+-- name: BlogOwner :one
+SELECT user_id FROM blogs
+WHERE id = ?;
+
+-- name: BlogVersion :one
+SELECT version FROM blogs
+WHERE id = ?;
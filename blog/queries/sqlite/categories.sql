@@ -0,0 +1,39 @@
+-- name: CategoryCreate :one
+INSERT INTO categories (
+    user_id, 
+    name, 
+    created_at, 
+    updated_at
+    ) 
+    VALUES (?, ?, ?, ?)
+    RETURNING *;
+
+-- name: CategoryList :many
+SELECT id, user_id, name, created_at, updated_at FROM categories
+ORDER BY id ASC;
+
+-- name: CategoryRead :one
+SELECT id, user_id, name, created_at, updated_at, version FROM categories
+WHERE id = ?;
+
+-- name: CategoryUpdate :one
+UPDATE categories
+SET 
+    name = ?,
+    updated_at = ?,
+    version = version + 1
+WHERE id = ?
+RETURNING id, user_id, name, created_at, updated_at, version;
+
+-- name: CategoryDelete :exec
+DELETE FROM categories WHERE id = ?;
+
+-- name: CategoryUserReassign :exec
+UPDATE categories SET user_id = ? WHERE user_id = ?;
+
+-- name: CategoryExists :one
+SELECT EXISTS(SELECT 1 FROM categories WHERE id = ?);
+
+-- name: CategoryVersion :one
+SELECT version FROM categories
+WHERE id = ?;
@@ -0,0 +1,56 @@
+-- name: CommentCreate :one
+INSERT INTO comments (
+    user_id, 
+    blog_id, 
+    body, 
+    created_at, 
+    updated_at
+    ) 
+    VALUES (?, ?, ?, ?, ?)
+    RETURNING *;
+
+-- name: CommentList :many
+SELECT id, user_id, body, created_at, updated_at FROM comments
+ORDER BY id ASC;
+
+-- name: CommentRead :one
+SELECT id, user_id, body, created_at, updated_at, version FROM comments
+WHERE id = ?;
+
+-- name: CommentUpdate :one
+UPDATE comments
+SET 
+    body = ?,
+    updated_at = ?,
+    version = version + 1
+WHERE id = ?
+RETURNING id, user_id, body, created_at, updated_at, version;
+
+-- name: CommentDelete :exec
+DELETE FROM comments WHERE id = ?;
+
+-- name: CommentUserList :many
+SELECT id, user_id, blog_id, body, created_at, updated_at FROM comments
+WHERE user_id = ?
+ORDER BY id ASC;
+
+-- name: CommentUserReassign :exec
+UPDATE comments SET user_id = ? WHERE user_id = ?;
+
+-- name: CommentUserBlogsDelete :exec
+DELETE FROM comments WHERE comments.user_id = ? OR comments.blog_id IN (SELECT b.id FROM blogs b WHERE b.user_id = ?);
+
+-- name: CommentImport :one
+INSERT INTO comments (
+    user_id,
+    blog_id,
+    body,
+    created_at,
+    updated_at
+    )
+    VALUES (?, ?, ?, ?, ?)
+    RETURNING *;
+
+-- name: CommentVersion :one
+SELECT version FROM comments
+WHERE id = ?;
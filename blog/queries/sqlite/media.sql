@@ -0,0 +1,77 @@
+-- name: MediaCreate :one
+INSERT INTO media (
+    owner_id,
+    blog_id,
+    key,
+    filename,
+    content_type,
+    size,
+    width,
+    height,
+    alt,
+    variants,
+    created_at,
+    updated_at
+    )
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    RETURNING *;
+
+-- name: MediaRead :one
+SELECT * FROM media
+WHERE id = ? AND deleted_at IS NULL;
+
+-- name: MediaList :many
+SELECT * FROM media
+WHERE deleted_at IS NULL
+    AND (owner_id = sqlc.narg(owner_id) OR sqlc.narg(owner_id) IS NULL)
+    AND (blog_id = sqlc.narg(blog_id) OR sqlc.narg(blog_id) IS NULL)
+    AND content_type LIKE sqlc.arg(content_type)
+ORDER BY id DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: MediaUpdate :one
+UPDATE media
+SET
+    blog_id = ?,
+    alt = ?,
+    updated_at = ?
+WHERE id = ? AND deleted_at IS NULL
+RETURNING *;
+
+-- name: MediaTrash :exec
+UPDATE media SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL;
+
+-- name: MediaTrashedList :many
+SELECT * FROM media
+WHERE deleted_at IS NOT NULL
+ORDER BY id ASC
+LIMIT ?;
+
+-- name: MediaPurge :exec
+DELETE FROM media WHERE id = ? AND deleted_at IS NOT NULL;
+
+-- name: MediaBlogUnlink :exec
+UPDATE media SET blog_id = NULL WHERE blog_id = ?;
+
+-- name: MediaUserBlogsUnlink :exec
+UPDATE media SET blog_id = NULL WHERE blog_id IN (SELECT id FROM blogs WHERE user_id = ?);
+
+-- name: MediaUserTrash :exec
+UPDATE media SET deleted_at = ? WHERE owner_id = ? AND deleted_at IS NULL;
+
+-- name: MediaUserReassign :exec
+UPDATE media SET owner_id = ? WHERE owner_id = ?;
+
+-- name: MediaAvatarList :many
+SELECT media.* FROM media
+JOIN profiles ON profiles.avatar_id = media.id
+WHERE media.deleted_at IS NULL;
+
+-- name: MediaUserAvatarTrash :exec
+UPDATE media SET deleted_at = ?
+WHERE id IN (SELECT avatar_id FROM profiles WHERE user_id = ?) AND deleted_at IS NULL;
+
+-- name: MediaUserList :many
+SELECT * FROM media
+WHERE owner_id = ? AND deleted_at IS NULL
+ORDER BY id;
@@ -0,0 +1,53 @@
+-- name: ProfileCreate :one
+INSERT INTO profiles (user_id, username, image, bio, created_at, updated_at)
+SELECT ?1, ?2, ?3, ?4, ?5, ?6
+WHERE NOT EXISTS (SELECT 1 FROM profiles WHERE user_id = ?1)
+RETURNING *;
+
+-- name: ProfileList :many
+SELECT id, user_id, username, image, bio, created_at, updated_at, version, avatar_id FROM profiles
+ORDER BY id ASC;
+
+-- name: ProfileRead :one
+SELECT id, user_id, username, image, bio, created_at, updated_at, version, avatar_id FROM profiles
+WHERE id = ?;
+
+-- name: ProfileUpdate :one
+UPDATE profiles
+SET 
+    username = ?,
+    image = ?,
+    bio = ?,
+    created_at = ?,
+    updated_at = ?,
+    version = version + 1
+WHERE id = ?
+RETURNING id, user_id, username, image, bio, created_at, updated_at, version, avatar_id;
+
+-- name: ProfileDelete :exec
+DELETE FROM profiles WHERE id = ?;
+
+-- name: ProfileUserRead :one
+SELECT id, user_id, username, image, bio, created_at, updated_at, version, avatar_id FROM profiles
+WHERE user_id = ?;
+
+-- name: ProfileUserDelete :exec
+DELETE FROM profiles WHERE user_id = ?;
+
+-- name: ProfileImport :one
+INSERT INTO profiles (user_id, username, image, bio, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: ProfileVersion :one
+SELECT version FROM profiles
+WHERE id = ?;
+
+-- name: ProfileAvatarUpdate :one
+UPDATE profiles
+SET
+    avatar_id = ?,
+    updated_at = ?,
+    version = version + 1
+WHERE id = ?
+RETURNING id, user_id, username, image, bio, created_at, updated_at, version, avatar_id;
@@ -0,0 +1,47 @@
+-- name: BlogRevisionCreate :one
+INSERT INTO blog_revisions (
+    blog_id,
+    number,
+    title,
+    body,
+    author_id,
+    restored_from,
+    created_at
+    )
+    VALUES (?, (SELECT COALESCE(MAX(r.number), 0) + 1 FROM blog_revisions r WHERE r.blog_id = ?), ?, ?, ?, ?, ?)
+    RETURNING *;
+
+-- name: BlogRevisionList :many
+SELECT id, blog_id, number, title, author_id, restored_from, created_at FROM blog_revisions
+WHERE blog_id = ?
+ORDER BY number DESC;
+
+-- name: BlogRevisionRead :one
+SELECT * FROM blog_revisions
+WHERE blog_id = ? AND number = ?;
+
+-- name: BlogRevisionLatest :one
+SELECT * FROM blog_revisions
+WHERE blog_id = ?
+ORDER BY number DESC
+LIMIT 1;
+
+-- name: BlogRevisionPrune :execrows
+DELETE FROM blog_revisions
+WHERE blog_revisions.blog_id = ? AND blog_revisions.id NOT IN (
+    SELECT r.id FROM blog_revisions r WHERE r.blog_id = ? ORDER BY r.number DESC LIMIT ?
+);
+
+-- name: BlogRevisionBlogDelete :exec
+DELETE FROM blog_revisions WHERE blog_id = ?;
+
+-- name: BlogRevisionUserDelete :exec
+DELETE FROM blog_revisions WHERE blog_id IN (SELECT id FROM blogs WHERE user_id = ?);
+
+-- name: BlogRevisionAuthorReassign :exec
+UPDATE blog_revisions SET author_id = ? WHERE author_id = ?;
+
+-- name: BlogRevisionUserList :many
+SELECT * FROM blog_revisions
+WHERE author_id = ? OR blog_id IN (SELECT id FROM blogs WHERE user_id = ?)
+ORDER BY blog_id, number;
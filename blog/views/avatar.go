@@ -0,0 +1,408 @@
+package views
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/immanuel-254/blog/apierror"
+	"github.com/immanuel-254/blog/auth"
+	"github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/media"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/store"
+	"github.com/immanuel-254/blog/validate"
+)
+
+// defaultAvatarSize is the side of the avatar sent when no size is asked for.
+const defaultAvatarSize = 128
+
+// The avatar upload and delete views need a signed in user, they are
+// registered behind RequireAuth.
+
+func (s *Service) ProfileAvatarView() View {
+	return View{
+		Route:   ProfileRouteGroup + "/{id}/avatar",
+		Handler: http.HandlerFunc(s.ProfileAvatar),
+		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:     "Download the avatar of a profile",
+			Description: "Redirects to the uploaded avatar or image of the profile, or sends a generated SVG with its initials. size is one of the avatar_url sizes, 128 by default.",
+			Tags:        []string{"Profiles"},
+			Query:       []string{"size"},
+		},
+	}
+}
+
+func (s *Service) ProfileAvatarUploadView() View {
+	return View{
+		Route:   ProfileRouteGroup + "/{id}/avatar",
+		Handler: http.HandlerFunc(s.ProfileAvatarUpload),
+		Methods: []string{http.MethodPost},
+		Doc: openapi.Operation{
+			Summary:     "Upload the avatar of a profile",
+			Description: "The middle square of the image is kept, at each of the avatar_url sizes. The avatar it replaces is deleted.",
+			Tags:        []string{"Profiles"},
+			Request:     ProfileAvatarInput{},
+			RequestType: "multipart/form-data",
+			Response:    ProfileUpdateOutput{},
+		},
+	}
+}
+
+func (s *Service) ProfileAvatarDeleteView() View {
+	return View{
+		Route:   ProfileRouteGroup + "/{id}/avatar",
+		Handler: http.HandlerFunc(s.ProfileAvatarDelete),
+		Methods: []string{http.MethodDelete},
+		Doc: openapi.Operation{
+			Summary:  "Delete the uploaded avatar of a profile",
+			Tags:     []string{"Profiles"},
+			Response: ProfileUpdateOutput{},
+		},
+	}
+}
+
+// ProfileItem is a profile as clients see it.
+type ProfileItem struct {
+	models.Profile
+	// AvatarURL has a link to the avatar for each side in pixels, 32 to 512:
+	// the uploaded avatar, else the image of the profile, else a generated one.
+	AvatarURL map[string]string `json:"avatar_url"`
+}
+
+// profileItem returns profile with the links to its avatar, whose upload is
+// avatar, or nil when it has none.
+func (s *Service) profileItem(profile models.Profile, avatar *models.Media) (ProfileItem, error) {
+	output := ProfileItem{Profile: profile, AvatarURL: map[string]string{}}
+
+	switch {
+	case avatar != nil:
+		var variants []media.Variant
+		if err := json.Unmarshal([]byte(avatar.Variants), &variants); err != nil {
+			return output, fmt.Errorf("media %d: reading variants: %w", avatar.ID, err)
+		}
+		for _, variant := range variants {
+			output.AvatarURL[strings.TrimPrefix(variant.Name, "s")] = s.Media.URL(variant.Key)
+		}
+		// the largest size is stored as the original
+		output.AvatarURL[strconv.Itoa(media.AvatarSizes[len(media.AvatarSizes)-1])] = s.Media.URL(avatar.Key)
+	case hasImage(profile):
+		for _, size := range media.AvatarSizes {
+			output.AvatarURL[strconv.Itoa(size)] = profile.Image.String
+		}
+	default:
+		for _, size := range media.AvatarSizes {
+			output.AvatarURL[strconv.Itoa(size)] = fmt.Sprintf("%s%s/%d/avatar?size=%d", s.APIURL, ProfileRouteGroup, profile.ID, size)
+		}
+	}
+
+	return output, nil
+}
+
+// hasImage reports whether profile links to an image kept elsewhere. Links that
+// are not http or https, saved before they were checked, are ignored so they are
+// never redirected to.
+func hasImage(profile models.Profile) bool {
+	return profile.Image.Valid && validate.IsHTTPURL(profile.Image.String)
+}
+
+// profileAvatar returns the uploaded avatar of profile, or nil when it has none.
+func (s *Service) profileAvatar(ctx context.Context, profile models.Profile) (*models.Media, error) {
+	if !profile.AvatarID.Valid {
+		return nil, nil
+	}
+
+	avatar, err := s.Store.Blog.MediaRead(ctx, profile.AvatarID.Int64)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // deleted from the media views
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &avatar, nil
+}
+
+func (s *Service) ProfileAvatar(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound("profile not found").Wrap(err))
+		return
+	}
+
+	size := defaultAvatarSize
+	if value := r.URL.Query().Get("size"); value != "" {
+		size, err = strconv.Atoi(value)
+		if err != nil || !isAvatarSize(size) {
+			apierror.Write(w, r, apierror.Validation(apierror.FieldError{Field: "size", Code: "oneof", Message: fmt.Sprintf("must be one of %v", media.AvatarSizes)}))
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	profile, err := s.Store.Blog.ProfileRead(ctx, id)
+	if err != nil {
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("profile not found")))
+		return
+	}
+
+	avatar, err := s.profileAvatar(ctx, profile)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if avatar != nil || hasImage(profile) {
+		item, err := s.profileItem(profile, avatar)
+		if err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+		if target := item.AvatarURL[strconv.Itoa(size)]; validate.IsHTTPURL(target) {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		slog.WarnContext(ctx, "not redirecting to an avatar that is not an http URL", "profile", profile.ID)
+	}
+
+	// the picture only changes with the username
+	if auth.NotModified(w, r, auth.ETag(profile.Version, size)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
+	w.WriteHeader(http.StatusOK)
+	w.Write(media.GeneratedAvatar(strconv.FormatInt(profile.ID, 10), profile.Username, size))
+}
+
+func isAvatarSize(size int) bool {
+	for _, avatarSize := range media.AvatarSizes {
+		if size == avatarSize {
+			return true
+		}
+	}
+	return false
+}
+
+// readOwnProfile returns the profile {id} when the signed in user may change
+// its avatar: its user and staff can.
+func (s *Service) readOwnProfile(r *http.Request) (models.Profile, error) {
+	var profile models.Profile
+
+	user, err := auth.CurrentUser(r.Context())
+	if err != nil {
+		return profile, err
+	}
+
+	id, err := pathID(r)
+	if err != nil {
+		return profile, apierror.NotFound("profile not found").Wrap(err)
+	}
+
+	profile, err = s.Store.Blog.ProfileRead(r.Context(), id)
+	if err != nil {
+		return profile, apierror.IfNotFound(err, apierror.NotFound("profile not found"))
+	}
+	if !user.Isstaff.Bool && !user.Isadmin.Bool && profile.UserID.Int64 != user.ID {
+		return profile, apierror.Forbidden("only its user can change the avatar of a profile")
+	}
+
+	return profile, nil
+}
+
+type ProfileAvatarInput struct {
+	File []byte `json:"file" validate:"required"`
+	Alt  string `json:"alt" validate:"max=500"`
+}
+
+func (s *Service) ProfileAvatarUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cfg := s.Config.Media
+
+	profile, err := s.readOwnProfile(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// Entities To be Created; Media
+	extendDeadlines(w, cfg.UploadTimeout)
+	form, filename, err := readUpload(w, r, cfg.MaxSize)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if form.BlogID != 0 {
+		apierror.Write(w, r, apierror.Validation(apierror.FieldError{Field: "blogid", Code: "unknown", Message: "is not a known field"}))
+		return
+	}
+	input := ProfileAvatarInput{File: form.File, Alt: form.Alt}
+	if err := validate.Struct(ctx, &input); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	upload, err := media.Avatar(input.File, cfg.MaxPixels)
+	if err != nil {
+		apierror.Write(w, r, processError(err))
+		return
+	}
+
+	key, variants, err := media.Save(ctx, s.Media, upload, time.Now())
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	variantsJSON, err := json.Marshal(variants)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// Entities To Update; Profile
+	var (
+		avatar   models.Media
+		replaced *models.Media
+	)
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		var err error
+		avatar, err = tx.Blog.MediaCreate(ctx, models.MediaCreateParams{
+			OwnerID:     profile.UserID,
+			Key:         key,
+			Filename:    filename,
+			ContentType: upload.ContentType,
+			Size:        int64(len(upload.Data)),
+			Width:       sql.NullInt64{Int64: int64(upload.Width), Valid: true},
+			Height:      sql.NullInt64{Int64: int64(upload.Height), Valid: true},
+			Alt:         input.Alt,
+			Variants:    string(variantsJSON),
+			CreatedAt:   sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		profile, replaced, err = setAvatar(ctx, tx, r, profile.ID, sql.NullInt64{Int64: avatar.ID, Valid: true})
+		return err
+	})
+
+	if err != nil {
+		// the files are only kept with their row
+		if err := media.Remove(context.WithoutCancel(ctx), s.Media, key, variants); err != nil {
+			slog.ErrorContext(ctx, "failed to remove the files of a failed upload", "key", key, "error", err)
+		}
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("profile not found")))
+		return
+	}
+
+	s.writeAvatarChange(w, r, profile, &avatar, replaced)
+}
+
+func (s *Service) ProfileAvatarDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	profile, err := s.readOwnProfile(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// Entities To Update; Profile
+	var replaced *models.Media
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		var err error
+		profile, replaced, err = setAvatar(ctx, tx, r, profile.ID, sql.NullInt64{})
+		return err
+	})
+
+	if err != nil {
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("profile not found")))
+		return
+	}
+
+	s.writeAvatarChange(w, r, profile, nil, replaced)
+}
+
+// setAvatar makes avatarID the avatar of the profile id, after checking the
+// If-Match header of r, and trashes the avatar it replaces, which it returns.
+func setAvatar(ctx context.Context, tx *store.Store, r *http.Request, id int64, avatarID sql.NullInt64) (models.Profile, *models.Media, error) {
+	version, err := tx.Blog.ProfileVersion(ctx, id)
+	if err != nil {
+		return models.Profile{}, nil, err
+	}
+	if err := auth.CheckIfMatch(r, version); err != nil {
+		return models.Profile{}, nil, err
+	}
+
+	// read again under the lock of ProfileVersion, another upload may have
+	// replaced the avatar since
+	current, err := tx.Blog.ProfileRead(ctx, id)
+	if err != nil {
+		return current, nil, err
+	}
+
+	var replaced *models.Media
+	if current.AvatarID.Valid {
+		old, err := tx.Blog.MediaRead(ctx, current.AvatarID.Int64)
+		switch {
+		case err == nil:
+			err = tx.Blog.MediaTrash(ctx, models.MediaTrashParams{
+				ID:        old.ID,
+				DeletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			})
+			if err != nil {
+				return current, nil, err
+			}
+			replaced = &old
+		case !errors.Is(err, sql.ErrNoRows):
+			return current, nil, err
+		}
+	}
+
+	profile, err := tx.Blog.ProfileAvatarUpdate(ctx, models.ProfileAvatarUpdateParams{
+		ID:        id,
+		AvatarID:  avatarID,
+		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	return profile, replaced, err
+}
+
+// writeAvatarChange removes the files of the replaced avatar, if any, and
+// responds with profile.
+func (s *Service) writeAvatarChange(w http.ResponseWriter, r *http.Request, profile models.Profile, avatar, replaced *models.Media) {
+	ctx := r.Context()
+
+	if replaced != nil {
+		// PurgeTrashedMedia tries again if this fails
+		if err := s.purgeMedia(context.WithoutCancel(ctx), *replaced); err != nil {
+			slog.ErrorContext(ctx, "failed to remove the files of a replaced avatar, they are retried later", "media", replaced.ID, "error", err)
+		}
+	}
+
+	item, err := s.profileItem(profile, avatar)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var output ProfileUpdateOutput
+
+	output.Profile = item
+
+	w.Header().Set("ETag", auth.ETag(profile.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(output)
+}
@@ -0,0 +1,162 @@
+package views
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	authmodels "github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/media"
+	"github.com/immanuel-254/blog/validate"
+)
+
+// createProfile adds a user and their profile linking to image, which is not
+// checked, as if it was saved before links were.
+func createProfile(t *testing.T, s *Service, image string) models.Profile {
+	t.Helper()
+
+	ctx := context.Background()
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+
+	user, err := s.Store.Auth.UserCreate(ctx, authmodels.UserCreateParams{Email: "jane@example.com", Password: "not a hash", CreatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := s.Store.Blog.ProfileCreate(ctx, models.ProfileCreateParams{
+		UserID:    sql.NullInt64{Int64: user.ID, Valid: true},
+		Username:  "Jane Doe",
+		Image:     sql.NullString{String: image, Valid: image != ""},
+		CreatedAt: now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profile
+}
+
+func TestProfileImageMustBeHTTP(t *testing.T) {
+	s := newTestService(t)
+	profile := createProfile(t, s, "")
+
+	// the auth app checks users exist on a server
+	validate.RegisterExists("user", func(ctx context.Context, id int64) (bool, error) {
+		_, err := s.Store.Auth.AuthUserRead(ctx, id)
+		return err == nil, nil
+	})
+
+	tests := []struct {
+		image  string
+		status int
+	}{
+		{"https://cdn.example.com/jane.png", http.StatusOK},
+		{"http://cdn.example.com/jane.png", http.StatusOK},
+		{"//evil.example/jane.png", http.StatusUnprocessableEntity},
+		{"javascript:alert(1)", http.StatusUnprocessableEntity},
+		{"/media/jane.png", http.StatusUnprocessableEntity},
+	}
+
+	for _, test := range tests {
+		body, _ := json.Marshal(ProfileUpdateInput{Username: "Jane Doe", Image: test.image})
+		if w := serve(s.ProfileUpdate, httptest.NewRequest(http.MethodPut, "/profiles/1", strings.NewReader(string(body))), profile.ID); w.Code != test.status {
+			t.Errorf("update to %s: got %d %s", test.image, w.Code, w.Body)
+		}
+
+		// the profile exists, so a valid image conflicts
+		body, _ = json.Marshal(ProfileCreateInput{UserID: profile.UserID.Int64, Username: "Jane Doe", Image: test.image})
+		w := httptest.NewRecorder()
+		s.ProfileCreate(w, httptest.NewRequest(http.MethodPost, "/profiles", strings.NewReader(string(body))))
+		if invalid := w.Code == http.StatusUnprocessableEntity; invalid != (test.status == http.StatusUnprocessableEntity) {
+			t.Errorf("create with %s: got %d %s", test.image, w.Code, w.Body)
+		}
+	}
+}
+
+func TestProfileItem(t *testing.T) {
+	s := newTestService(t)
+
+	variants := []media.Variant{}
+	for _, size := range media.AvatarSizes[:len(media.AvatarSizes)-1] {
+		variants = append(variants, media.Variant{Name: media.AvatarVariant(size), Key: "2026/10/jane_" + strconv.Itoa(size) + ".jpg"})
+	}
+	variantsJSON, err := json.Marshal(variants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	avatar := &models.Media{ID: 7, Key: "2026/10/jane.jpg", Variants: string(variantsJSON)}
+
+	withImage := models.Profile{ID: 3, Image: sql.NullString{String: "https://cdn.example.com/jane.png", Valid: true}}
+	generated := func(size int) string {
+		return "https://example.com/api/v1/profiles/3/avatar?size=" + strconv.Itoa(size)
+	}
+
+	tests := []struct {
+		name    string
+		profile models.Profile
+		avatar  *models.Media
+		want    func(size int) string
+	}{
+		{"an upload", withImage, avatar, func(size int) string {
+			if size == 512 {
+				return "https://example.com/media/2026/10/jane.jpg"
+			}
+			return "https://example.com/media/2026/10/jane_" + strconv.Itoa(size) + ".jpg"
+		}},
+		{"an image", withImage, nil, func(int) string { return "https://cdn.example.com/jane.png" }},
+		{"nothing", models.Profile{ID: 3}, nil, generated},
+		{"an unsafe image", models.Profile{ID: 3, Image: sql.NullString{String: "javascript:alert(1)", Valid: true}}, nil, generated},
+	}
+
+	for _, test := range tests {
+		item, err := s.profileItem(test.profile, test.avatar)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(item.AvatarURL) != len(media.AvatarSizes) {
+			t.Errorf("%s: got %v", test.name, item.AvatarURL)
+		}
+		for _, size := range media.AvatarSizes {
+			if got := item.AvatarURL[strconv.Itoa(size)]; got != test.want(size) {
+				t.Errorf("%s, size %d: got %s, want %s", test.name, size, got, test.want(size))
+			}
+		}
+	}
+
+	if _, err := s.profileItem(withImage, &models.Media{ID: 7, Variants: "not json"}); err == nil {
+		t.Error("damaged variants were read")
+	}
+}
+
+func TestProfileAvatar(t *testing.T) {
+	tests := []struct {
+		image    string
+		status   int
+		location string
+	}{
+		{"https://cdn.example.com/jane.png", http.StatusFound, "https://cdn.example.com/jane.png"},
+		{"", http.StatusOK, ""},
+		// saved before links were checked
+		{"//evil.example/jane.png", http.StatusOK, ""},
+		{"javascript:alert(1)", http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		s := newTestService(t)
+		profile := createProfile(t, s, test.image)
+
+		w := serve(s.ProfileAvatar, httptest.NewRequest(http.MethodGet, "/profiles/1/avatar?size=64", nil), profile.ID)
+		if w.Code != test.status || w.Header().Get("Location") != test.location {
+			t.Errorf("image %q: got %d to %q", test.image, w.Code, w.Header().Get("Location"))
+		}
+		if test.status == http.StatusOK && (w.Header().Get("Content-Type") != "image/svg+xml" || !strings.Contains(w.Body.String(), `width="64"`)) {
+			t.Errorf("image %q: sent %s %s", test.image, w.Header().Get("Content-Type"), w.Body)
+		}
+	}
+}
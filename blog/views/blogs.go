@@ -1,143 +1,149 @@
 package views
 
 import (
-	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
+	"github.com/immanuel-254/blog/apierror"
 	"github.com/immanuel-254/blog/auth"
 	"github.com/immanuel-254/blog/blog/models"
-	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/metrics"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/store"
+	"github.com/immanuel-254/blog/validate"
 )
 
-const BlogRouteGroup = "/blog"
+const BlogRouteGroup = "/blogs"
 
-var (
-	BlogCreateView = View{
-		Route:   fmt.Sprintf("%s/create", BlogRouteGroup),
-		Handler: http.HandlerFunc(BlogCreate),
+func (s *Service) BlogCreateView() View {
+	return View{
+		Route:   BlogRouteGroup,
+		Handler: http.HandlerFunc(s.BlogCreate),
 		Methods: []string{http.MethodPost},
+		Doc: openapi.Operation{
+			Summary:  "Create a blog",
+			Tags:     []string{"Blogs"},
+			Request:  BlogCreateInput{},
+			Response: BlogCreateOutput{},
+		},
 	}
+}
 
-	BlogReadView = View{
-		Route:   fmt.Sprintf("%s/read/", BlogRouteGroup),
-		Handler: http.HandlerFunc(BlogRead),
+func (s *Service) BlogReadView() View {
+	return View{
+		Route:   BlogRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.BlogRead),
 		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:  "Read a blog",
+			Tags:     []string{"Blogs"},
+			Response: BlogReadOutput{},
+		},
 	}
+}
 
-	BlogListView = View{
-		Route:   fmt.Sprintf("%s/list", BlogRouteGroup),
-		Handler: http.HandlerFunc(BlogList),
+func (s *Service) BlogListView() View {
+	return View{
+		Route:   BlogRouteGroup,
+		Handler: http.HandlerFunc(s.BlogList),
 		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:  "List blogs",
+			Tags:     []string{"Blogs"},
+			Response: BlogListOutput{},
+		},
 	}
+}
 
-	BlogUpdateView = View{
-		Route:   fmt.Sprintf("%s/update/", BlogRouteGroup),
-		Handler: http.HandlerFunc(BlogUpdate),
+func (s *Service) BlogUpdateView() View {
+	return View{
+		Route:   BlogRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.BlogUpdate),
 		Methods: []string{http.MethodPut},
+		Doc: openapi.Operation{
+			Summary:  "Update a blog",
+			Tags:     []string{"Blogs"},
+			Request:  BlogUpdateInput{},
+			Response: BlogUpdateOutput{},
+		},
 	}
+}
 
-	BlogDeleteView = View{
-		Route:   fmt.Sprintf("%s/delete/", BlogRouteGroup),
-		Handler: http.HandlerFunc(BlogDelete),
+func (s *Service) BlogDeleteView() View {
+	return View{
+		Route:   BlogRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.BlogDelete),
 		Methods: []string{http.MethodDelete},
+		Doc: openapi.Operation{
+			Summary: "Delete a blog",
+			Tags:    []string{"Blogs"},
+		},
 	}
-)
-
-func BlogCreate(w http.ResponseWriter, r *http.Request) {
-	// Entities To be Created; Blog
-	var data map[string]string
-	auth.GetData(data, w, r)
-
-	queries := models.New(database.DB)
-	ctx := context.Background()
-
-	var input struct {
-		userid int64
-	}
-
-	if _, ok := data["userid"]; ok {
-		id, err := strconv.ParseInt(data["userid"], 10, 64)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+}
 
-		input.userid = id
-	}
+type BlogCreateInput struct {
+	UserID     int64   `json:"userid" validate:"required,exists=user"`
+	Title      string  `json:"title" validate:"required,max=200"`
+	Body       string  `json:"body" validate:"required,max=100000"`
+	Categories []int64 `json:"categories" validate:"exists=category"`
+}
 
-	blog, err := queries.BlogCreate(ctx, models.BlogCreateParams{
-		UserID:    sql.NullInt64{Int64: input.userid, Valid: true},
-		Title:     data["title"],
-		Body:      data["body"],
-		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
-	})
+type BlogCreateOutput struct {
+	Blog models.Blog `json:"blog"`
+}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+func (s *Service) BlogCreate(w http.ResponseWriter, r *http.Request) {
+	// Entities To be Created; Blog
+	var input BlogCreateInput
+	if !validate.Bind(w, r, &input) {
 		return
 	}
 
-	var categories []int64
-
-	if _, ok := data["categories"]; ok {
-
-		rawCategories := data["categories"]
-		parts := strings.Split(rawCategories, ",")
-
-		for _, part := range parts {
-			trimmedPart := strings.TrimSpace(part) // Remove any extra spaces
-			if part == "" {
-				continue // Skip empty parts (e.g., due to a trailing comma)
-			}
-			num, err := strconv.ParseInt(trimmedPart, 10, 64) // Convert to int64
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			categories = append(categories, num)
+	ctx := r.Context()
+	keep := s.Config.Blog.RevisionsKeep
+
+	// the blog is only created with all of its categories and its first revision
+	var blog models.Blog
+	err := s.Store.WithTx(ctx, func(tx *store.Store) (err error) {
+		blog, err = tx.Blog.BlogCreate(ctx, models.BlogCreateParams{
+			UserID:    sql.NullInt64{Int64: input.UserID, Valid: true},
+			Title:     input.Title,
+			Body:      input.Body,
+			CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
 		}
-	}
-
-	rawCategories := []interface{}{}
-
-	if _, ok := data["categories"]; ok {
-		err := json.Unmarshal([]byte(data["categories"]), &rawCategories)
 
+		_, err = recordRevision(tx, ctx, blog.ID, blog.Title, blog.Body, revisionAuthor(r), 0, keep)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return err
 		}
 
-		for i, v := range rawCategories {
-			if num, ok := v.(float64); ok {
-				categories[i] = int64(num)
+		for _, value := range input.Categories {
+			err = tx.Blog.AssignBlogToCategory(ctx, models.AssignBlogToCategoryParams{
+				BlogID:     blog.ID,
+				CategoryID: value,
+				CreatedAt:  sql.NullTime{Time: time.Now(), Valid: true},
+			})
+			if err != nil {
+				return err
 			}
 		}
-	}
 
-	for _, value := range categories {
-		err = queries.AssignBlogToCategory(ctx, models.AssignBlogToCategoryParams{
-			BlogID:     blog.ID,
-			CategoryID: value,
-			CreatedAt:  sql.NullTime{Time: time.Now(), Valid: true},
-		})
+		return nil
+	})
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
 	}
 
-	var output struct {
-		Blog models.Blog `json:"blog"`
-	}
+	metrics.PostsPublished.Inc()
+
+	var output BlogCreateOutput
 
 	output.Blog = blog
 
@@ -146,31 +152,41 @@ func BlogCreate(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(output)
 }
 
-func BlogRead(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("%s/read/", BlogRouteGroup))
-	idStr = strings.TrimLeft(idStr, "/")
-	id, err := strconv.Atoi(idStr)
+type BlogReadOutput struct {
+	Blog models.BlogReadRow `json:"blog"`
+}
+
+// blogETag returns the entity tag of a blog as BlogRead shows it. Writes read
+// the blog back and use it too, so the tag they send is one a read would match.
+func blogETag(blog models.BlogReadRow) string {
+	return auth.ETag(blog.BlogVersion, blog.Categories, blog.Comments)
+}
+
+func (s *Service) BlogRead(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, r, apierror.NotFound("blog not found").Wrap(err))
 		return
 	}
 
 	// Entities To Read; Blog
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	queries := s.Store.Blog
+	ctx := r.Context()
 
-	blog, err := queries.BlogRead(ctx, int64(id))
+	blog, err := queries.BlogRead(ctx, id)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("blog not found")))
 		return
 	}
 
-	var output struct {
-		Blog models.BlogReadRow `json:"blog"`
+	if auth.NotModified(w, r, blogETag(blog)) {
+		return
 	}
 
+	var output BlogReadOutput
+
 	output.Blog = blog
 
 	w.WriteHeader(http.StatusOK)
@@ -178,21 +194,23 @@ func BlogRead(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(output)
 }
 
-func BlogList(w http.ResponseWriter, r *http.Request) {
+type BlogListOutput struct {
+	Blogs []models.BlogListRow `json:"blogs"`
+}
+
+func (s *Service) BlogList(w http.ResponseWriter, r *http.Request) {
 	// Entities To Read; Blog, Category
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	queries := s.Store.Blog
+	ctx := r.Context()
 
 	blogs, err := queries.BlogList(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	var output struct {
-		Blogs []models.BlogListRow `json:"blogs"`
-	}
+	var output BlogListOutput
 
 	output.Blogs = blogs
 
@@ -201,108 +219,136 @@ func BlogList(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(output)
 }
 
-func BlogUpdate(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("%s/update/", BlogRouteGroup))
-	idStr = strings.TrimLeft(idStr, "/")
-	id, err := strconv.Atoi(idStr)
+type BlogUpdateInput struct {
+	Title string `json:"title" validate:"required,max=200"`
+	Body  string `json:"body" validate:"required,max=100000"`
+}
+
+type BlogUpdateOutput struct {
+	Blog models.BlogUpdateRow `json:"blog"`
+}
+
+func (s *Service) BlogUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.NotFound("blog not found").Wrap(err))
 		return
 	}
 
 	// Entities To Update; Blog, Category
-	var data map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var input BlogUpdateInput
+	if !validate.Bind(w, r, &input) {
 		return
 	}
 
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	ctx := r.Context()
+	keep := s.Config.Blog.RevisionsKeep
 
-	blog, err := queries.BlogUpdate(ctx, models.BlogUpdateParams{
-		ID:        int64(id),
-		Title:     data["title"].(string),
-		Body:      data["body"].(string),
-		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	// every update is kept as a revision
+	var (
+		blog models.BlogUpdateRow
+		etag string
+	)
+	err = s.Store.WithTx(ctx, func(tx *store.Store) (err error) {
+		version, err := tx.Blog.BlogVersion(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := auth.CheckIfMatch(r, version); err != nil {
+			return err
+		}
+
+		blog, err = tx.Blog.BlogUpdate(ctx, models.BlogUpdateParams{
+			ID:        id,
+			Title:     input.Title,
+			Body:      input.Body,
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = recordRevision(tx, ctx, id, blog.Title, blog.Body, revisionAuthor(r), 0, keep)
+		if err != nil {
+			return err
+		}
+
+		read, err := tx.Blog.BlogRead(ctx, id)
+		etag = blogETag(read)
+		return err
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("blog not found")))
 		return
 	}
 
-	var output struct {
-		Blog models.BlogUpdateRow `json:"blog"`
-	}
+	var output BlogUpdateOutput
 
 	output.Blog = blog
 
+	w.Header().Set("ETag", etag)
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(output)
 }
 
-func BlogDelete(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("%s/delete/", BlogRouteGroup))
-	idStr = strings.TrimLeft(idStr, "/")
-	id, err := strconv.Atoi(idStr)
+func (s *Service) BlogDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.NotFound("blog not found").Wrap(err))
 		return
 	}
 
 	// Entities To Delete; Blog
-	queries := models.New(database.DB)
-	ctx := context.Background()
-
-	err = queries.BlogDelete(ctx, int64(id))
+	ctx := r.Context()
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// get blog categories
-	categories, err := queries.BlogCategoriesList(ctx, int64(id))
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// get blog comments
-	comments, err := queries.BlogCommentsList(ctx, sql.NullInt64{Int64: int64(id), Valid: true})
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// delete many to many relations
-	for _, category := range categories {
-		err = queries.CategoryBlogDelete(ctx, models.CategoryBlogDeleteParams{
-			BlogID:     int64(id),
-			CategoryID: category.CategoryID,
-		})
+	// the relations, comments, revisions and media links go first, so nothing points at a deleted blog
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		categories, err := tx.Blog.BlogCategoriesList(ctx, id)
+		if err != nil {
+			return err
+		}
 
+		comments, err := tx.Blog.BlogCommentsList(ctx, sql.NullInt64{Int64: id, Valid: true})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return err
 		}
 
-	}
+		// delete many to many relations
+		for _, category := range categories {
+			err = tx.Blog.CategoryBlogDelete(ctx, models.CategoryBlogDeleteParams{
+				BlogID:     id,
+				CategoryID: category.CategoryID,
+			})
+			if err != nil {
+				return err
+			}
+		}
 
-	for _, comment := range comments {
-		err = queries.CommentDelete(ctx, int64(comment.ID))
+		for _, comment := range comments {
+			if err := tx.Blog.CommentDelete(ctx, int64(comment.ID)); err != nil {
+				return err
+			}
+		}
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if err := tx.Blog.BlogRevisionBlogDelete(ctx, id); err != nil {
+			return err
 		}
 
+		// uploads stay in the library of their owner
+		if err := tx.Blog.MediaBlogUnlink(ctx, sql.NullInt64{Int64: id, Valid: true}); err != nil {
+			return err
+		}
+
+		return tx.Blog.BlogDelete(ctx, id)
+	})
+
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,81 @@
+package views
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/immanuel-254/blog/auth"
+	"github.com/immanuel-254/blog/blog/models"
+)
+
+// TestBlogETags checks that the writes of a blog send the tag a read of it
+// sends, comments included, and that both tags serve If-None-Match and If-Match.
+func TestBlogETags(t *testing.T) {
+	s := newTestService(t)
+	blog := createBlog(t, s, "Title", "Body")
+
+	_, err := s.Store.Blog.CommentCreate(context.Background(), models.CommentCreateParams{
+		UserID:    blog.UserID,
+		BlogID:    sql.NullInt64{Int64: blog.ID, Valid: true},
+		Body:      "A comment",
+		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/blogs/1", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return serve(s.BlogRead, r, blog.ID)
+	}
+
+	update := func(ifMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/blogs/1", strings.NewReader(`{"title": "New title", "body": "New body"}`))
+		r.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		return serve(s.BlogUpdate, r, blog.ID)
+	}
+
+	etag := read("").Header().Get("ETag")
+	if w := read(etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("a read with the current tag answered %d", w.Code)
+	}
+
+	w := update(etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("an update with the current tag answered %d %s", w.Code, w.Body)
+	}
+	updated := w.Header().Get("ETag")
+	if updated == etag || updated != read("").Header().Get("ETag") {
+		t.Errorf("the update sent %s, a read sends %s", updated, read("").Header().Get("ETag"))
+	}
+
+	if w := update(etag); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("an update with a stale tag answered %d", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/blogs/1/revisions/1/restore", nil)
+	r = r.WithContext(auth.WithCurrentUser(r.Context(), signedIn(t, s, blog.UserID.Int64)))
+	r.Header.Set("If-Match", updated)
+	r.SetPathValue("number", "1")
+	w = serve(s.BlogRevisionRestore, r, blog.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("a restore with the current tag answered %d %s", w.Code, w.Body)
+	}
+	if restored := w.Header().Get("ETag"); restored == updated || restored != read("").Header().Get("ETag") {
+		t.Errorf("the restore sent %s, a read sends %s", restored, read("").Header().Get("ETag"))
+	}
+	if w := read(w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("a read with the tag of the restore answered %d", w.Code)
+	}
+}
@@ -1,97 +1,118 @@
 package views
 
 import (
-	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
+	"github.com/immanuel-254/blog/apierror"
+	"github.com/immanuel-254/blog/auth"
 	"github.com/immanuel-254/blog/blog/models"
-	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/store"
+	"github.com/immanuel-254/blog/validate"
 )
 
-const CategoryRouteGroup = "/category"
+const CategoryRouteGroup = "/categories"
 
-var (
-	CategoryCreateView = View{
-		Route:   fmt.Sprintf("%s/create", CategoryRouteGroup),
-		Handler: http.HandlerFunc(CategoryCreate),
+func (s *Service) CategoryCreateView() View {
+	return View{
+		Route:   CategoryRouteGroup,
+		Handler: http.HandlerFunc(s.CategoryCreate),
 		Methods: []string{http.MethodPost},
+		Doc: openapi.Operation{
+			Summary:  "Create a category",
+			Tags:     []string{"Categories"},
+			Request:  CategoryCreateInput{},
+			Response: CategoryCreateOutput{},
+		},
 	}
+}
 
-	CategoryReadView = View{
-		Route:   fmt.Sprintf("%s/read/", CategoryRouteGroup),
-		Handler: http.HandlerFunc(CategoryRead),
+func (s *Service) CategoryReadView() View {
+	return View{
+		Route:   CategoryRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.CategoryRead),
 		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:  "Read a category",
+			Tags:     []string{"Categories"},
+			Response: CategoryReadOutput{},
+		},
 	}
+}
 
-	CategoryListView = View{
-		Route:   fmt.Sprintf("%s/list", CategoryRouteGroup),
-		Handler: http.HandlerFunc(CategoryList),
+func (s *Service) CategoryListView() View {
+	return View{
+		Route:   CategoryRouteGroup,
+		Handler: http.HandlerFunc(s.CategoryList),
 		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:  "List categories",
+			Tags:     []string{"Categories"},
+			Response: CategoryListOutput{},
+		},
 	}
+}
 
-	CategoryUpdateView = View{
-		Route:   fmt.Sprintf("%s/update/", CategoryRouteGroup),
-		Handler: http.HandlerFunc(CategoryUpdate),
+func (s *Service) CategoryUpdateView() View {
+	return View{
+		Route:   CategoryRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.CategoryUpdate),
 		Methods: []string{http.MethodPut},
+		Doc: openapi.Operation{
+			Summary:  "Update a category",
+			Tags:     []string{"Categories"},
+			Request:  CategoryUpdateInput{},
+			Response: CategoryUpdateOutput{},
+		},
 	}
+}
 
-	CategoryDeleteView = View{
-		Route:   fmt.Sprintf("%s/delete/", CategoryRouteGroup),
-		Handler: http.HandlerFunc(CategoryDelete),
+func (s *Service) CategoryDeleteView() View {
+	return View{
+		Route:   CategoryRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.CategoryDelete),
 		Methods: []string{http.MethodDelete},
+		Doc: openapi.Operation{
+			Summary: "Delete a category",
+			Tags:    []string{"Categories"},
+		},
 	}
-)
-
-func CategoryCreate(w http.ResponseWriter, r *http.Request) {
-	// Entities To be Created; Category
-	var data map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	queries := models.New(database.DB)
-	ctx := context.Background()
-
-	var input struct {
-		userid int64
-	}
+}
 
-	if _, ok := data["userid"].(string); ok {
-		id, err := strconv.ParseInt(data["userid"].(string), 10, 64)
+type CategoryCreateInput struct {
+	UserID int64  `json:"userid" validate:"required,exists=user"`
+	Name   string `json:"name" validate:"required,max=100"`
+}
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+type CategoryCreateOutput struct {
+	Category models.Category `json:"category"`
+}
 
-		input.userid = id
+func (s *Service) CategoryCreate(w http.ResponseWriter, r *http.Request) {
+	// Entities To be Created; Category
+	var input CategoryCreateInput
+	if !validate.Bind(w, r, &input) {
+		return
 	}
 
-	if _, ok := data["userid"].(float64); ok {
-		input.userid = int64(data["userid"].(float64))
-	}
+	queries := s.Store.Blog
+	ctx := r.Context()
 
 	category, err := queries.CategoryCreate(ctx, models.CategoryCreateParams{
-		UserID:    sql.NullInt64{Int64: input.userid, Valid: true},
-		Name:      data["name"].(string),
+		UserID:    sql.NullInt64{Int64: input.UserID, Valid: true},
+		Name:      input.Name,
 		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	var output struct {
-		Category models.Category `json:"category"`
-	}
+	var output CategoryCreateOutput
 
 	output.Category = category
 
@@ -100,30 +121,34 @@ func CategoryCreate(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(output)
 }
 
-func CategoryRead(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("%s/read/", CategoryRouteGroup))
-	idStr = strings.TrimLeft(idStr, "/")
-	id, err := strconv.Atoi(idStr)
+type CategoryReadOutput struct {
+	Category models.CategoryReadRow `json:"category"`
+}
+
+func (s *Service) CategoryRead(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, r, apierror.NotFound("category not found").Wrap(err))
 		return
 	}
 	// Entities To Read; Category
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	queries := s.Store.Blog
+	ctx := r.Context()
 
-	category, err := queries.CategoryRead(ctx, int64(id))
+	category, err := queries.CategoryRead(ctx, id)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("category not found")))
 		return
 	}
 
-	var output struct {
-		Category models.CategoryReadRow `json:"category"`
+	if auth.NotModified(w, r, auth.ETag(category.Version)) {
+		return
 	}
 
+	var output CategoryReadOutput
+
 	output.Category = category
 
 	w.WriteHeader(http.StatusOK)
@@ -131,21 +156,23 @@ func CategoryRead(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(output)
 }
 
-func CategoryList(w http.ResponseWriter, r *http.Request) {
+type CategoryListOutput struct {
+	Categories []models.CategoryBlogListRow `json:"categories"`
+}
+
+func (s *Service) CategoryList(w http.ResponseWriter, r *http.Request) {
 	// Entities To List; Category
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	queries := s.Store.Blog
+	ctx := r.Context()
 
 	categories, err := queries.CategoryBlogList(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	var output struct {
-		Categories []models.CategoryBlogListRow `json:"categories"`
-	}
+	var output CategoryListOutput
 
 	output.Categories = categories
 
@@ -154,92 +181,101 @@ func CategoryList(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(output)
 }
 
-func CategoryUpdate(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("%s/update/", CategoryRouteGroup))
-	idStr = strings.TrimLeft(idStr, "/")
-	id, err := strconv.Atoi(idStr)
+type CategoryUpdateInput struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type CategoryUpdateOutput struct {
+	Category models.CategoryUpdateRow `json:"category"`
+}
+
+func (s *Service) CategoryUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, r, apierror.NotFound("category not found").Wrap(err))
 		return
 	}
 	// Entities To Update; Category
-	var data map[string]string
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	var input CategoryUpdateInput
+	if !validate.Bind(w, r, &input) {
 		return
 	}
 
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	ctx := r.Context()
 
-	category, err := queries.CategoryUpdate(ctx, models.CategoryUpdateParams{
-		ID:        int64(id),
-		Name:      data["name"],
-		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	var category models.CategoryUpdateRow
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		version, err := tx.Blog.CategoryVersion(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := auth.CheckIfMatch(r, version); err != nil {
+			return err
+		}
+
+		category, err = tx.Blog.CategoryUpdate(ctx, models.CategoryUpdateParams{
+			ID:        id,
+			Name:      input.Name,
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		return err
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("category not found")))
 		return
 	}
 
-	var output struct {
-		Category models.CategoryUpdateRow `json:"category"`
-	}
+	var output CategoryUpdateOutput
 
 	output.Category = category
 
+	w.Header().Set("ETag", auth.ETag(category.Version))
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(output)
 }
 
-func CategoryDelete(w http.ResponseWriter, r *http.Request) {
+func (s *Service) CategoryDelete(w http.ResponseWriter, r *http.Request) {
 	// Entities To Delete; Category
-	idStr := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("%s/delete/", CategoryRouteGroup))
-	idStr = strings.TrimLeft(idStr, "/")
-	id, err := strconv.Atoi(idStr)
+	id, err := pathID(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, r, apierror.NotFound("category not found").Wrap(err))
 		return
 	}
 
-	queries := models.New(database.DB)
-	ctx := context.Background()
-
-	err = queries.CategoryDelete(ctx, int64(id))
+	ctx := r.Context()
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// the relations go first, so no blog points at a deleted category
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		categories, err := tx.Blog.CategoryBlogList(ctx)
+		if err != nil {
+			return err
+		}
 
-		return
-	}
+		// delete many to many relations
+		for _, category := range categories {
+			if category.CategoryID == id {
+				err = tx.Blog.CategoryBlogDelete(ctx, models.CategoryBlogDeleteParams{
+					BlogID:     category.BlogID,
+					CategoryID: id,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
 
-	// get all categories
-	categories, err := queries.CategoryBlogList(ctx)
+		return tx.Blog.CategoryDelete(ctx, id)
+	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	// delete many to many relations
-	for _, category := range categories {
-		if category.CategoryID == int64(id) {
-			err = queries.CategoryBlogDelete(ctx, models.CategoryBlogDeleteParams{
-				BlogID:     category.BlogID,
-				CategoryID: int64(id),
-			})
-
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-	}
-
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 }
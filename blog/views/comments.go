@@ -1,97 +1,123 @@
 package views
 
 import (
-	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
+	"github.com/immanuel-254/blog/apierror"
+	"github.com/immanuel-254/blog/auth"
 	"github.com/immanuel-254/blog/blog/models"
-	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/metrics"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/store"
+	"github.com/immanuel-254/blog/validate"
 )
 
-const CommentRouteGroup = "/comment"
+const CommentRouteGroup = "/comments"
 
-var (
-	CommentCreateView = View{
-		Route:   fmt.Sprintf("%s/create", CommentRouteGroup),
-		Handler: http.HandlerFunc(CommentCreate),
+func (s *Service) CommentCreateView() View {
+	return View{
+		Route:   CommentRouteGroup,
+		Handler: http.HandlerFunc(s.CommentCreate),
 		Methods: []string{http.MethodPost},
+		Doc: openapi.Operation{
+			Summary:  "Create a comment",
+			Tags:     []string{"Comments"},
+			Request:  CommentCreateInput{},
+			Response: CommentCreateOutput{},
+		},
 	}
+}
 
-	CommentReadView = View{
-		Route:   fmt.Sprintf("%s/read/", CommentRouteGroup),
-		Handler: http.HandlerFunc(CommentRead),
+func (s *Service) CommentReadView() View {
+	return View{
+		Route:   CommentRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.CommentRead),
 		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:  "Read a comment",
+			Tags:     []string{"Comments"},
+			Response: CommentReadOutput{},
+		},
 	}
+}
 
-	CommentListView = View{
-		Route:   fmt.Sprintf("%s/list", CommentRouteGroup),
-		Handler: http.HandlerFunc(CommentList),
+func (s *Service) CommentListView() View {
+	return View{
+		Route:   CommentRouteGroup,
+		Handler: http.HandlerFunc(s.CommentList),
 		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:  "List comments",
+			Tags:     []string{"Comments"},
+			Response: CommentListOutput{},
+		},
 	}
+}
 
-	CommentUpdateView = View{
-		Route:   fmt.Sprintf("%s/update/", CommentRouteGroup),
-		Handler: http.HandlerFunc(CommentUpdate),
+func (s *Service) CommentUpdateView() View {
+	return View{
+		Route:   CommentRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.CommentUpdate),
 		Methods: []string{http.MethodPut},
+		Doc: openapi.Operation{
+			Summary:  "Update a comment",
+			Tags:     []string{"Comments"},
+			Request:  CommentUpdateInput{},
+			Response: CommentUpdateOutput{},
+		},
 	}
+}
 
-	CommentDeleteView = View{
-		Route:   fmt.Sprintf("%s/delete/", CommentRouteGroup),
-		Handler: http.HandlerFunc(CommentDelete),
+func (s *Service) CommentDeleteView() View {
+	return View{
+		Route:   CommentRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.CommentDelete),
 		Methods: []string{http.MethodDelete},
+		Doc: openapi.Operation{
+			Summary: "Delete a comment",
+			Tags:    []string{"Comments"},
+		},
 	}
-)
-
-func CommentCreate(w http.ResponseWriter, r *http.Request) {
-	// Entities To be Created; Comment
-	var data map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	queries := models.New(database.DB)
-	ctx := context.Background()
-
-	var input struct {
-		userid int64
-	}
+}
 
-	if _, ok := data["userid"].(string); ok {
-		id, err := strconv.ParseInt(data["userid"].(string), 10, 64)
+type CommentCreateInput struct {
+	UserID int64  `json:"userid" validate:"required,exists=user"`
+	BlogID int64  `json:"blogid" validate:"required,exists=blog"`
+	Body   string `json:"body" validate:"required,max=5000"`
+}
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+type CommentCreateOutput struct {
+	Comment models.Comment `json:"comment"`
+}
 
-		input.userid = id
+func (s *Service) CommentCreate(w http.ResponseWriter, r *http.Request) {
+	// Entities To be Created; Comment
+	var input CommentCreateInput
+	if !validate.Bind(w, r, &input) {
+		return
 	}
 
-	if _, ok := data["userid"].(float64); ok {
-		input.userid = int64(data["userid"].(float64))
-	}
+	queries := s.Store.Blog
+	ctx := r.Context()
 
 	comment, err := queries.CommentCreate(ctx, models.CommentCreateParams{
-		UserID:    sql.NullInt64{Int64: input.userid, Valid: true},
-		Body:      data["body"].(string),
+		UserID:    sql.NullInt64{Int64: input.UserID, Valid: true},
+		BlogID:    sql.NullInt64{Int64: input.BlogID, Valid: true},
+		Body:      input.Body,
 		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	var output struct {
-		Comment models.Comment `json:"comment"`
-	}
+	metrics.Comments.Inc()
+
+	var output CommentCreateOutput
 
 	output.Comment = comment
 
@@ -100,30 +126,34 @@ func CommentCreate(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(output)
 }
 
-func CommentRead(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("%s/read/", CategoryRouteGroup))
-	idStr = strings.TrimLeft(idStr, "/")
-	id, err := strconv.Atoi(idStr)
+type CommentReadOutput struct {
+	Comment models.CommentReadRow `json:"comment"`
+}
+
+func (s *Service) CommentRead(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, r, apierror.NotFound("comment not found").Wrap(err))
 		return
 	}
 	// Entities To Read; Comment
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	queries := s.Store.Blog
+	ctx := r.Context()
 
-	comment, err := queries.CommentRead(ctx, int64(id))
+	comment, err := queries.CommentRead(ctx, id)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("comment not found")))
 		return
 	}
 
-	var output struct {
-		Comment models.CommentReadRow `json:"comment"`
+	if auth.NotModified(w, r, auth.ETag(comment.Version)) {
+		return
 	}
 
+	var output CommentReadOutput
+
 	output.Comment = comment
 
 	w.WriteHeader(http.StatusOK)
@@ -131,21 +161,23 @@ func CommentRead(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(output)
 }
 
-func CommentList(w http.ResponseWriter, r *http.Request) {
+type CommentListOutput struct {
+	Comments []models.CommentListRow `json:"comments"`
+}
+
+func (s *Service) CommentList(w http.ResponseWriter, r *http.Request) {
 	// Entities To List; Comment
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	queries := s.Store.Blog
+	ctx := r.Context()
 
 	comments, err := queries.CommentList(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	var output struct {
-		Comments []models.CommentListRow `json:"comments"`
-	}
+	var output CommentListOutput
 
 	output.Comments = comments
 
@@ -154,65 +186,78 @@ func CommentList(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(output)
 }
 
-func CommentUpdate(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("%s/update/", CategoryRouteGroup))
-	idStr = strings.TrimLeft(idStr, "/")
-	id, err := strconv.Atoi(idStr)
+type CommentUpdateInput struct {
+	Body string `json:"body" validate:"required,max=5000"`
+}
+
+type CommentUpdateOutput struct {
+	Comment models.CommentUpdateRow `json:"comment"`
+}
+
+func (s *Service) CommentUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, r, apierror.NotFound("comment not found").Wrap(err))
 		return
 	}
 	// Entities To Update; Comment
-	var data map[string]string
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	var input CommentUpdateInput
+	if !validate.Bind(w, r, &input) {
 		return
 	}
 
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	ctx := r.Context()
 
-	comment, err := queries.CommentUpdate(ctx, models.CommentUpdateParams{
-		ID:        int64(id),
-		Body:      data["body"],
-		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	var comment models.CommentUpdateRow
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		version, err := tx.Blog.CommentVersion(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := auth.CheckIfMatch(r, version); err != nil {
+			return err
+		}
+
+		comment, err = tx.Blog.CommentUpdate(ctx, models.CommentUpdateParams{
+			ID:        id,
+			Body:      input.Body,
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		return err
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("comment not found")))
 		return
 	}
 
-	var output struct {
-		Comment models.CommentUpdateRow `json:"comment"`
-	}
+	var output CommentUpdateOutput
 
 	output.Comment = comment
 
+	w.Header().Set("ETag", auth.ETag(comment.Version))
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(output)
 }
 
-func CommentDelete(w http.ResponseWriter, r *http.Request) {
+func (s *Service) CommentDelete(w http.ResponseWriter, r *http.Request) {
 	// Entities To Delete; Comment
-	idStr := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("%s/delete/", CategoryRouteGroup))
-	idStr = strings.TrimLeft(idStr, "/")
-	id, err := strconv.Atoi(idStr)
+	id, err := pathID(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierror.Write(w, r, apierror.NotFound("comment not found").Wrap(err))
 		return
 	}
 
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	queries := s.Store.Blog
+	ctx := r.Context()
 
-	err = queries.CommentDelete(ctx, int64(id))
+	err = queries.CommentDelete(ctx, id)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 
 		return
 	}
@@ -0,0 +1,603 @@
+package views
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/immanuel-254/blog/apierror"
+	"github.com/immanuel-254/blog/auth"
+	authmodels "github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/media"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/validate"
+)
+
+const MediaRouteGroup = "/media"
+
+const (
+	// formOverhead is what an upload may add to the file for its other fields
+	// and the headers of its parts.
+	formOverhead = 64 << 10
+	// maxFieldBytes bounds the form fields other than the file.
+	maxFieldBytes = 4 << 10
+
+	mediaListLimit    = 50
+	mediaListMaxLimit = 200
+)
+
+// The media views need a signed in user, they are registered behind RequireAuth.
+
+func (s *Service) MediaUploadView() View {
+	return View{
+		Route:   MediaRouteGroup,
+		Handler: http.HandlerFunc(s.MediaUpload),
+		Methods: []string{http.MethodPost},
+		Doc: openapi.Operation{
+			Summary:     "Upload a file",
+			Description: "JPEG, PNG, GIF and WebP images and PDF documents are accepted, by their content. Images are stripped of their metadata and get a square thumbnail and narrower copies for responsive pages. A file can only be put on a blog of the signed in user, unless they are staff.",
+			Tags:        []string{"Media"},
+			Request:     MediaUploadInput{},
+			RequestType: "multipart/form-data",
+			Response:    MediaOutput{},
+		},
+	}
+}
+
+func (s *Service) MediaListView() View {
+	return View{
+		Route:   MediaRouteGroup,
+		Handler: http.HandlerFunc(s.MediaList),
+		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:     "List uploaded files, newest first",
+			Description: "Lists the files of the signed in user, or of any user for staff, who may filter by owner. type is a content type such as image/png, or its first part such as image.",
+			Tags:        []string{"Media"},
+			Query:       []string{"owner", "blog", "type", "limit", "offset"},
+			Response:    MediaListOutput{},
+		},
+	}
+}
+
+func (s *Service) MediaReadView() View {
+	return View{
+		Route:   MediaRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.MediaRead),
+		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:  "Read an uploaded file",
+			Tags:     []string{"Media"},
+			Response: MediaOutput{},
+		},
+	}
+}
+
+func (s *Service) MediaUpdateView() View {
+	return View{
+		Route:   MediaRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.MediaUpdate),
+		Methods: []string{http.MethodPut},
+		Doc: openapi.Operation{
+			Summary:     "Change the blog and alternative text of an uploaded file",
+			Description: "A file can only be put on a blog of the signed in user, unless they are staff.",
+			Tags:        []string{"Media"},
+			Request:     MediaUpdateInput{},
+			Response:    MediaOutput{},
+		},
+	}
+}
+
+func (s *Service) MediaDeleteView() View {
+	return View{
+		Route:   MediaRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.MediaDelete),
+		Methods: []string{http.MethodDelete},
+		Doc: openapi.Operation{
+			Summary: "Delete an uploaded file and its variants",
+			Tags:    []string{"Media"},
+		},
+	}
+}
+
+// MediaItem is an uploaded file as clients see it.
+type MediaItem struct {
+	models.Media
+	URL      string          `json:"url"`
+	Variants []media.Variant `json:"variants"`
+}
+
+func (s *Service) mediaItem(item models.Media) (MediaItem, error) {
+	output := MediaItem{Media: item, URL: s.Media.URL(item.Key)}
+	if err := json.Unmarshal([]byte(item.Variants), &output.Variants); err != nil {
+		return output, fmt.Errorf("media %d: reading variants: %w", item.ID, err)
+	}
+	for i, variant := range output.Variants {
+		output.Variants[i].URL = s.Media.URL(variant.Key)
+	}
+	return output, nil
+}
+
+// canManage reports whether user may see and change item: its owner and staff can.
+func canManage(user authmodels.AuthUserReadRow, item models.Media) bool {
+	return user.Isstaff.Bool || user.Isadmin.Bool || (item.OwnerID.Valid && item.OwnerID.Int64 == user.ID)
+}
+
+// checkBlog returns an error unless user may put files on the blog id: its owner
+// and staff can. The id 0 is no blog.
+func (s *Service) checkBlog(ctx context.Context, user authmodels.AuthUserReadRow, id int64) error {
+	if id == 0 || user.Isstaff.Bool || user.Isadmin.Bool {
+		return nil
+	}
+
+	owner, err := s.Store.Blog.BlogOwner(ctx, id)
+	if err != nil {
+		return apierror.IfNotFound(err, apierror.NotFound("blog not found"))
+	}
+	if !owner.Valid || owner.Int64 != user.ID {
+		return apierror.Forbidden("files can only be put on your own blogs")
+	}
+	return nil
+}
+
+// readMedia returns the file {id} when the signed in user may manage it.
+func (s *Service) readMedia(r *http.Request) (authmodels.AuthUserReadRow, models.Media, error) {
+	var item models.Media
+
+	user, err := auth.CurrentUser(r.Context())
+	if err != nil {
+		return user, item, err
+	}
+
+	id, err := pathID(r)
+	if err != nil {
+		return user, item, apierror.NotFound("media not found").Wrap(err)
+	}
+
+	item, err = s.Store.Blog.MediaRead(r.Context(), id)
+	if err != nil {
+		return user, item, apierror.IfNotFound(err, apierror.NotFound("media not found"))
+	}
+	// files of others are not found, rather than forbidden, so ids reveal nothing
+	if !canManage(user, item) {
+		return user, item, apierror.NotFound("media not found")
+	}
+
+	return user, item, nil
+}
+
+type MediaUploadInput struct {
+	File   []byte `json:"file" validate:"required"`
+	BlogID int64  `json:"blogid" validate:"exists=blog"`
+	Alt    string `json:"alt" validate:"max=500"`
+}
+
+type MediaOutput struct {
+	Media MediaItem `json:"media"`
+}
+
+// extendDeadlines gives an upload timeout to be read and answered, in place of
+// the read and write timeouts of the server, which are meant for small bodies.
+// Writers without deadlines, such as test recorders, are left as they are.
+func extendDeadlines(w http.ResponseWriter, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(deadline)
+	controller.SetWriteDeadline(deadline)
+}
+
+// readUpload reads the multipart form of an upload, with a file of at most
+// maxSize bytes, and returns it with the name the client gave the file.
+func readUpload(w http.ResponseWriter, r *http.Request, maxSize int) (MediaUploadInput, string, error) {
+	var (
+		input    MediaUploadInput
+		filename string
+	)
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxSize)+formOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return input, "", apierror.BadRequest("request body must be multipart/form-data").Wrap(err)
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return input, "", uploadError(err)
+		}
+
+		name := part.FormName()
+		if name == "file" {
+			data, err := io.ReadAll(io.LimitReader(part, int64(maxSize)+1))
+			if err != nil {
+				return input, "", uploadError(err)
+			}
+			if len(data) > maxSize {
+				return input, "", apierror.New(http.StatusRequestEntityTooLarge, fmt.Sprintf("file must not be larger than %d bytes", maxSize))
+			}
+			if len(data) > 0 {
+				input.File = data
+				filename = part.FileName()
+			}
+			continue
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxFieldBytes+1))
+		if err != nil {
+			return input, "", uploadError(err)
+		}
+		if len(value) > maxFieldBytes {
+			return input, "", apierror.New(http.StatusRequestEntityTooLarge, fmt.Sprintf("form field %s must not be larger than %d bytes", name, maxFieldBytes))
+		}
+
+		switch name {
+		case "blogid":
+			input.BlogID, err = strconv.ParseInt(strings.TrimSpace(string(value)), 10, 64)
+			if err != nil {
+				return input, "", apierror.Validation(apierror.FieldError{Field: name, Code: "type", Message: "must be a integer"})
+			}
+		case "alt":
+			input.Alt = string(value)
+		default:
+			return input, "", apierror.Validation(apierror.FieldError{Field: name, Code: "unknown", Message: "is not a known field"})
+		}
+	}
+
+	// the name is only shown back, without the directories some clients send
+	filename = filepath.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if filename == "." || filename == "/" {
+		filename = ""
+	}
+	if len(filename) > 255 {
+		filename = filename[:255]
+	}
+
+	return input, filename, nil
+}
+
+func uploadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return apierror.New(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body must not be larger than %d bytes", maxBytesErr.Limit))
+	}
+	return apierror.BadRequest("request body could not be read").Wrap(err)
+}
+
+// processError turns the errors of media.Process about the file into validation
+// errors of the file field.
+func processError(err error) error {
+	var code string
+	switch {
+	case errors.Is(err, media.ErrUnsupported):
+		code = "type"
+	case errors.Is(err, media.ErrInvalid):
+		code = "invalid"
+	case errors.Is(err, media.ErrTooManyPixels):
+		code = "max"
+	default:
+		return err
+	}
+	return apierror.Validation(apierror.FieldError{Field: "file", Code: code, Message: err.Error()}).Wrap(err)
+}
+
+func (s *Service) MediaUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cfg := s.Config.Media
+
+	user, err := auth.CurrentUser(ctx)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// Entities To be Created; Media
+	extendDeadlines(w, cfg.UploadTimeout)
+	input, filename, err := readUpload(w, r, cfg.MaxSize)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if err := validate.Struct(ctx, &input); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if err := s.checkBlog(ctx, user, input.BlogID); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	upload, err := media.Process(input.File, cfg.MaxPixels)
+	if err != nil {
+		apierror.Write(w, r, processError(err))
+		return
+	}
+
+	key, variants, err := media.Save(ctx, s.Media, upload, time.Now())
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	variantsJSON, err := json.Marshal(variants)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	item, err := s.Store.Blog.MediaCreate(ctx, models.MediaCreateParams{
+		OwnerID:     sql.NullInt64{Int64: user.ID, Valid: true},
+		BlogID:      sql.NullInt64{Int64: input.BlogID, Valid: input.BlogID != 0},
+		Key:         key,
+		Filename:    filename,
+		ContentType: upload.ContentType,
+		Size:        int64(len(upload.Data)),
+		Width:       sql.NullInt64{Int64: int64(upload.Width), Valid: upload.Width != 0},
+		Height:      sql.NullInt64{Int64: int64(upload.Height), Valid: upload.Height != 0},
+		Alt:         input.Alt,
+		Variants:    string(variantsJSON),
+		CreatedAt:   sql.NullTime{Time: time.Now(), Valid: true},
+	})
+
+	if err != nil {
+		// the files are only kept with their row
+		if err := media.Remove(context.WithoutCancel(ctx), s.Media, key, variants); err != nil {
+			slog.ErrorContext(ctx, "failed to remove the files of a failed upload", "key", key, "error", err)
+		}
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var output MediaOutput
+
+	output.Media, err = s.mediaItem(item)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(output)
+}
+
+type MediaListOutput struct {
+	Media []MediaItem `json:"media"`
+}
+
+func (s *Service) MediaList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := auth.CurrentUser(ctx)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	queryParams := r.URL.Query()
+
+	numbers := map[string]int64{"owner": 0, "blog": 0, "limit": mediaListLimit, "offset": 0}
+	for name := range numbers {
+		value := queryParams.Get(name)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || number < 0 || (name != "offset" && number == 0) {
+			apierror.Write(w, r, apierror.Validation(apierror.FieldError{Field: name, Message: "must be a positive number"}))
+			return
+		}
+		numbers[name] = number
+	}
+
+	// everyone but staff only sees their own files
+	owner := numbers["owner"]
+	if !user.Isstaff.Bool && !user.Isadmin.Bool {
+		owner = user.ID
+	}
+
+	contentType := "%"
+	if value := queryParams.Get("type"); value != "" {
+		if strings.ContainsAny(value, `%_\`) {
+			apierror.Write(w, r, apierror.Validation(apierror.FieldError{Field: "type", Message: "must be a content type such as image/png, or image"}))
+			return
+		}
+		contentType = value
+		if !strings.Contains(value, "/") {
+			contentType += "/%"
+		}
+	}
+
+	items, err := s.Store.Blog.MediaList(ctx, models.MediaListParams{
+		OwnerID:     sql.NullInt64{Int64: owner, Valid: owner != 0},
+		BlogID:      sql.NullInt64{Int64: numbers["blog"], Valid: numbers["blog"] != 0},
+		ContentType: contentType,
+		Limit:       min(numbers["limit"], mediaListMaxLimit),
+		Offset:      numbers["offset"],
+	})
+
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	output := MediaListOutput{Media: []MediaItem{}}
+
+	for _, item := range items {
+		listed, err := s.mediaItem(item)
+		if err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+		output.Media = append(output.Media, listed)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(output)
+}
+
+func (s *Service) MediaRead(w http.ResponseWriter, r *http.Request) {
+	_, item, err := s.readMedia(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var output MediaOutput
+
+	output.Media, err = s.mediaItem(item)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(output)
+}
+
+type MediaUpdateInput struct {
+	BlogID int64  `json:"blogid" validate:"exists=blog"` // 0 takes the file off its blog
+	Alt    string `json:"alt" validate:"max=500"`
+}
+
+func (s *Service) MediaUpdate(w http.ResponseWriter, r *http.Request) {
+	user, item, err := s.readMedia(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// Entities To Update; Media
+	var input MediaUpdateInput
+	if !validate.Bind(w, r, &input) {
+		return
+	}
+	if err := s.checkBlog(r.Context(), user, input.BlogID); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	item, err = s.Store.Blog.MediaUpdate(r.Context(), models.MediaUpdateParams{
+		ID:        item.ID,
+		BlogID:    sql.NullInt64{Int64: input.BlogID, Valid: input.BlogID != 0},
+		Alt:       input.Alt,
+		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+
+	if err != nil {
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("media not found")))
+		return
+	}
+
+	var output MediaOutput
+
+	output.Media, err = s.mediaItem(item)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(output)
+}
+
+func (s *Service) MediaDelete(w http.ResponseWriter, r *http.Request) {
+	_, item, err := s.readMedia(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// Entities To Delete; Media
+	ctx := r.Context()
+
+	// the row is trashed first, so the files are removed again by
+	// PurgeTrashedMedia if removing them now fails
+	err = s.Store.Blog.MediaTrash(ctx, models.MediaTrashParams{
+		ID:        item.ID,
+		DeletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := s.purgeMedia(context.WithoutCancel(ctx), item); err != nil {
+		slog.ErrorContext(ctx, "failed to remove the files of deleted media, they are retried later", "media", item.ID, "error", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// purgeMedia removes the files of trashed media, then its row.
+func (s *Service) purgeMedia(ctx context.Context, item models.Media) error {
+	var variants []media.Variant
+	if err := json.Unmarshal([]byte(item.Variants), &variants); err != nil {
+		return fmt.Errorf("media %d: reading variants: %w", item.ID, err)
+	}
+
+	if err := media.Remove(ctx, s.Media, item.Key, variants); err != nil {
+		return err
+	}
+
+	return s.Store.Blog.MediaPurge(ctx, item.ID)
+}
+
+// PurgeTrashedMedia removes the files and rows of media that were deleted, or
+// whose owner was, and returns how many it purged.
+func (s *Service) PurgeTrashedMedia(ctx context.Context) (int, error) {
+	trashed, err := s.Store.Blog.MediaTrashedList(ctx, 100)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	purged := 0
+	for _, item := range trashed {
+		if err := s.purgeMedia(ctx, item); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+// RunMediaPurgeWorker purges trashed media every interval until ctx is cancelled.
+func (s *Service) RunMediaPurgeWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeTrashedMedia(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to purge deleted media", "error", err)
+		}
+		if purged > 0 {
+			slog.InfoContext(ctx, "purged deleted media", "count", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
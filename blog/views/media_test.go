@@ -0,0 +1,387 @@
+package views
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/immanuel-254/blog/auth"
+	authmodels "github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/media"
+)
+
+// slowUpload posts a body that takes longer than the read timeout of the server
+// to arrive, and returns the status and the body the handler read.
+func slowUpload(t *testing.T, timeout time.Duration) (int, string) {
+	t.Helper()
+
+	var read string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extendDeadlines(w, timeout)
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		read = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Config.ReadTimeout = 100 * time.Millisecond
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	body, writer := io.Pipe()
+	go func() {
+		for _, chunk := range []string{"slow ", "connection"} {
+			writer.Write([]byte(chunk))
+			time.Sleep(150 * time.Millisecond)
+		}
+		writer.Close()
+	}()
+
+	resp, err := http.Post(server.URL, "text/plain", body)
+	if err != nil {
+		// the server hung up without an answer
+		return 0, read
+	}
+	resp.Body.Close()
+	return resp.StatusCode, read
+}
+
+func TestExtendDeadlines(t *testing.T) {
+	if status, read := slowUpload(t, 5*time.Second); status != http.StatusOK || read != "slow connection" {
+		t.Errorf("with a longer deadline: got %d %q", status, read)
+	}
+	if status, read := slowUpload(t, 50*time.Millisecond); status == http.StatusOK || strings.Contains(read, "connection") {
+		t.Errorf("with a shorter deadline: got %d %q", status, read)
+	}
+}
+
+// testPNG returns a PNG image width by height pixels.
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i)
+	}
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// upload posts file and fields as user to the upload view.
+func upload(t *testing.T, s *Service, user authmodels.AuthUserReadRow, file []byte, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, err := form.CreateFormFile("file", "../photos/holiday.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(file)
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/media", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r = r.WithContext(auth.WithCurrentUser(r.Context(), user))
+
+	w := httptest.NewRecorder()
+	s.MediaUpload(w, r)
+	return w
+}
+
+// uploaded returns the file in the answer of an upload.
+func uploaded(t *testing.T, w *httptest.ResponseRecorder) MediaItem {
+	t.Helper()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("the upload answered %d %s", w.Code, w.Body)
+	}
+	var output MediaOutput
+	if err := json.Unmarshal(w.Body.Bytes(), &output); err != nil {
+		t.Fatal(err)
+	}
+	return output.Media
+}
+
+func TestMediaUpload(t *testing.T) {
+	s := newTestService(t)
+	blog := createBlog(t, s, "Title", "Body")
+	owner := signedIn(t, s, blog.UserID.Int64)
+
+	item := uploaded(t, upload(t, s, owner, testPNG(t, 600, 300), map[string]string{"blogid": strconv.FormatInt(blog.ID, 10), "alt": "A holiday"}))
+	if item.ContentType != "image/png" || item.Filename != "holiday.png" || item.Alt != "A holiday" || item.BlogID.Int64 != blog.ID || item.OwnerID.Int64 != owner.ID {
+		t.Errorf("uploaded %+v", item.Media)
+	}
+	if item.Width.Int64 != 600 || item.Height.Int64 != 300 || item.URL != "https://example.com/media/"+item.Key {
+		t.Errorf("uploaded %+v to %s", item.Media, item.URL)
+	}
+
+	// a square thumbnail no larger than the image, and a copy for each width
+	// narrower than it
+	want := map[string][2]int{"thumbnail": {300, 300}, "w480": {480, 240}}
+	if len(item.Variants) != len(want) {
+		t.Errorf("got the variants %+v", item.Variants)
+	}
+	for _, v := range item.Variants {
+		if size := want[v.Name]; v.Width != size[0] || v.Height != size[1] || v.URL != "https://example.com/media/"+v.Key {
+			t.Errorf("variant %+v", v)
+		}
+		file, err := s.Media.Open(context.Background(), v.Key)
+		if err != nil {
+			t.Errorf("variant %s: %v", v.Name, err)
+			continue
+		}
+		file.Close()
+	}
+}
+
+func TestMediaUploadRefuses(t *testing.T) {
+	s := newTestService(t)
+	s.Config.Media.MaxSize = 4096
+	blog := createBlog(t, s, "Title", "Body")
+	owner := signedIn(t, s, blog.UserID.Int64)
+	other := createUser(t, s, "john@example.com", false)
+	blogID := strconv.FormatInt(blog.ID, 10)
+
+	tests := []struct {
+		name   string
+		user   authmodels.AuthUserReadRow
+		file   []byte
+		fields map[string]string
+		status int
+		want   string
+	}{
+		// the type is sniffed, whatever the name of the file says
+		{"text", owner, []byte("just some text, named holiday.png"), nil, http.StatusUnprocessableEntity, `"code":"type"`},
+		{"HTML", owner, []byte("<!DOCTYPE html><script>alert(1)</script>"), nil, http.StatusUnprocessableEntity, `"code":"type"`},
+		{"a damaged image", owner, testPNG(t, 10, 10)[:40], nil, http.StatusUnprocessableEntity, `"code":"invalid"`},
+		{"a large file", owner, bytes.Repeat([]byte("x"), 4097), nil, http.StatusRequestEntityTooLarge, "4096 bytes"},
+		{"an unknown field", owner, testPNG(t, 10, 10), map[string]string{"owner": "1"}, http.StatusUnprocessableEntity, `"code":"unknown"`},
+		{"a missing blog", owner, testPNG(t, 10, 10), map[string]string{"blogid": "999"}, http.StatusUnprocessableEntity, `"field":"blogid"`},
+		{"the blog of another user", other, testPNG(t, 10, 10), map[string]string{"blogid": blogID}, http.StatusForbidden, "your own blogs"},
+	}
+
+	for _, test := range tests {
+		w := upload(t, s, test.user, test.file, test.fields)
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s: got %d %s", test.name, w.Code, w.Body)
+		}
+	}
+
+	// nothing was stored
+	if items, err := s.Store.Blog.MediaUserList(context.Background(), sql.NullInt64{Int64: other.ID, Valid: true}); err != nil || len(items) != 0 {
+		t.Errorf("stored %v, %v", items, err)
+	}
+	entries, err := os.ReadDir(s.Media.(*media.Local).Dir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("left %v, %v", entries, err)
+	}
+
+	// staff may put files on any blog
+	staff := createUser(t, s, "staff@example.com", true)
+	if item := uploaded(t, upload(t, s, staff, testPNG(t, 10, 10), map[string]string{"blogid": blogID})); item.BlogID.Int64 != blog.ID {
+		t.Errorf("uploaded %+v", item.Media)
+	}
+}
+
+func TestMediaUpdateBlog(t *testing.T) {
+	s := newTestService(t)
+	blog := createBlog(t, s, "Title", "Body")
+	other := createUser(t, s, "john@example.com", false)
+	item := uploaded(t, upload(t, s, other, testPNG(t, 10, 10), nil))
+
+	update := func(user authmodels.AuthUserReadRow, blogID int64) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(MediaUpdateInput{BlogID: blogID, Alt: "A holiday"})
+		r := httptest.NewRequest(http.MethodPut, "/media/1", bytes.NewReader(body))
+		r = r.WithContext(auth.WithCurrentUser(r.Context(), user))
+		return serve(s.MediaUpdate, r, item.ID)
+	}
+
+	if w := update(other, blog.ID); w.Code != http.StatusForbidden {
+		t.Errorf("a move to the blog of another user answered %d %s", w.Code, w.Body)
+	}
+	if w := update(other, 0); w.Code != http.StatusOK {
+		t.Errorf("an update answered %d %s", w.Code, w.Body)
+	}
+	// the owner of the blog cannot change the files of others
+	if w := update(signedIn(t, s, blog.UserID.Int64), blog.ID); w.Code != http.StatusNotFound {
+		t.Errorf("an update of the file of another user answered %d %s", w.Code, w.Body)
+	}
+	if w := update(createUser(t, s, "staff@example.com", true), blog.ID); w.Code != http.StatusOK {
+		t.Errorf("an update by staff answered %d %s", w.Code, w.Body)
+	}
+}
+
+func TestMediaList(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	jane := createUser(t, s, "jane@example.com", false)
+	john := createUser(t, s, "john@example.com", false)
+	staff := createUser(t, s, "staff@example.com", true)
+
+	for _, file := range []struct {
+		owner       int64
+		contentType string
+	}{
+		{jane.ID, "image/png"},
+		{jane.ID, "image/jpeg"},
+		{jane.ID, "application/pdf"},
+		{john.ID, "image/png"},
+	} {
+		_, err := s.Store.Blog.MediaCreate(ctx, models.MediaCreateParams{
+			OwnerID:     sql.NullInt64{Int64: file.owner, Valid: true},
+			Key:         "2026/10/" + strconv.FormatInt(file.owner, 10) + "/" + file.contentType,
+			ContentType: file.contentType,
+			Variants:    "[]",
+			CreatedAt:   sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(user authmodels.AuthUserReadRow, query string) ([]string, int) {
+		r := httptest.NewRequest(http.MethodGet, "/media?"+query, nil)
+		r = r.WithContext(auth.WithCurrentUser(r.Context(), user))
+		w := httptest.NewRecorder()
+		s.MediaList(w, r)
+
+		var output MediaListOutput
+		json.Unmarshal(w.Body.Bytes(), &output)
+		var listed []string
+		for _, item := range output.Media {
+			listed = append(listed, strconv.FormatInt(item.OwnerID.Int64, 10)+" "+item.ContentType)
+		}
+		return listed, w.Code
+	}
+
+	janes, johns := strconv.FormatInt(jane.ID, 10), strconv.FormatInt(john.ID, 10)
+	tests := []struct {
+		user  authmodels.AuthUserReadRow
+		query string
+		want  string
+	}{
+		{jane, "", janes + " application/pdf," + janes + " image/jpeg," + janes + " image/png"},
+		// the owner of others is ignored, but for staff
+		{jane, "owner=" + johns, janes + " application/pdf," + janes + " image/jpeg," + janes + " image/png"},
+		{john, "", johns + " image/png"},
+		{staff, "", johns + " image/png," + janes + " application/pdf," + janes + " image/jpeg," + janes + " image/png"},
+		{staff, "owner=" + johns, johns + " image/png"},
+		{jane, "type=image", janes + " image/jpeg," + janes + " image/png"},
+		{jane, "type=image/png", janes + " image/png"},
+		{jane, "type=application/pdf", janes + " application/pdf"},
+		{staff, "type=image/png", johns + " image/png," + janes + " image/png"},
+		{jane, "type=video", ""},
+		{jane, "limit=1&offset=1", janes + " image/jpeg"},
+	}
+
+	for _, test := range tests {
+		listed, status := list(test.user, test.query)
+		if got := strings.Join(listed, ","); status != http.StatusOK || got != test.want {
+			t.Errorf("user %d, %q: got %d %s, want %s", test.user.ID, test.query, status, got, test.want)
+		}
+	}
+
+	for _, query := range []string{"type=%25", "type=image_png", "limit=0", "owner=-1"} {
+		if _, status := list(staff, query); status != http.StatusUnprocessableEntity {
+			t.Errorf("%q answered %d", query, status)
+		}
+	}
+}
+
+// flakyStorage fails to delete files while broken is set.
+type flakyStorage struct {
+	media.Storage
+	broken bool
+}
+
+func (s *flakyStorage) Delete(ctx context.Context, key string) error {
+	if s.broken {
+		return errors.New("the storage is unreachable")
+	}
+	return s.Storage.Delete(ctx, key)
+}
+
+func TestMediaDelete(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	storage := &flakyStorage{Storage: s.Media}
+	s.Media = storage
+	jane := createUser(t, s, "jane@example.com", false)
+	john := createUser(t, s, "john@example.com", false)
+
+	remove := func(user authmodels.AuthUserReadRow, id int64) int {
+		r := httptest.NewRequest(http.MethodDelete, "/media/1", nil)
+		r = r.WithContext(auth.WithCurrentUser(r.Context(), user))
+		return serve(s.MediaDelete, r, id).Code
+	}
+	stored := func(item MediaItem) bool {
+		file, err := s.Media.Open(ctx, item.Key)
+		if err != nil {
+			return false
+		}
+		file.Close()
+		return true
+	}
+
+	first := uploaded(t, upload(t, s, jane, testPNG(t, 600, 300), nil))
+	second := uploaded(t, upload(t, s, jane, testPNG(t, 600, 300), nil))
+
+	if status := remove(john, first.ID); status != http.StatusNotFound || !stored(first) {
+		t.Errorf("a delete by another user answered %d", status)
+	}
+
+	if status := remove(jane, first.ID); status != http.StatusOK {
+		t.Errorf("a delete answered %d", status)
+	}
+	if _, err := s.Store.Blog.MediaRead(ctx, first.ID); !errors.Is(err, sql.ErrNoRows) || stored(first) {
+		t.Errorf("the file is still there, %v", err)
+	}
+
+	// files that cannot be removed now are trashed, and purged later
+	storage.broken = true
+	if status := remove(jane, second.ID); status != http.StatusOK {
+		t.Errorf("a delete with a broken storage answered %d", status)
+	}
+	if _, err := s.Store.Blog.MediaRead(ctx, second.ID); !errors.Is(err, sql.ErrNoRows) || !stored(second) {
+		t.Errorf("the file was not trashed, %v", err)
+	}
+	if purged, err := s.PurgeTrashedMedia(ctx); purged != 0 || err == nil {
+		t.Errorf("purged %d with a broken storage, %v", purged, err)
+	}
+
+	storage.broken = false
+	if purged, err := s.PurgeTrashedMedia(ctx); purged != 1 || err != nil {
+		t.Errorf("purged %d, %v", purged, err)
+	}
+	if trashed, err := s.Store.Blog.MediaTrashedList(ctx, 10); len(trashed) != 0 || err != nil || stored(second) {
+		t.Errorf("left %v, %v", trashed, err)
+	}
+	entries, err := os.ReadDir(storage.Storage.(*media.Local).Dir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("left %v, %v", entries, err)
+	}
+}
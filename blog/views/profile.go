@@ -1,181 +1,231 @@
 package views
 
 import (
-	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
-	auth "github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/apierror"
+	"github.com/immanuel-254/blog/auth"
+	authmodels "github.com/immanuel-254/blog/auth/models"
 	"github.com/immanuel-254/blog/blog/models"
-	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/store"
+	"github.com/immanuel-254/blog/validate"
 )
 
-const ProfileRouteGroup = "/profile"
+const ProfileRouteGroup = "/profiles"
 
-var (
-	ProfileCreateView = View{
-		Route:   fmt.Sprintf("%s/create/", ProfileRouteGroup),
-		Handler: http.HandlerFunc(ProfileCreate),
+func (s *Service) ProfileCreateView() View {
+	return View{
+		Route:   ProfileRouteGroup,
+		Handler: http.HandlerFunc(s.ProfileCreate),
 		Methods: []string{http.MethodPost},
+		Doc: openapi.Operation{
+			Summary:  "Create a profile",
+			Tags:     []string{"Profiles"},
+			Request:  ProfileCreateInput{},
+			Response: ProfileCreateOutput{},
+		},
 	}
+}
 
-	ProfileReadView = View{
-		Route:   fmt.Sprintf("%s/read/", ProfileRouteGroup),
-		Handler: http.HandlerFunc(ProfileRead),
+func (s *Service) ProfileReadView() View {
+	return View{
+		Route:   ProfileRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.ProfileRead),
 		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:  "Read a profile",
+			Tags:     []string{"Profiles"},
+			Response: ProfileReadOutput{},
+		},
 	}
+}
 
-	ProfileListView = View{
-		Route:   fmt.Sprintf("%s/list", ProfileRouteGroup),
-		Handler: http.HandlerFunc(ProfileList),
+func (s *Service) ProfileListView() View {
+	return View{
+		Route:   ProfileRouteGroup,
+		Handler: http.HandlerFunc(s.ProfileList),
 		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:  "List profiles",
+			Tags:     []string{"Profiles"},
+			Response: []ProfileListItem{},
+		},
 	}
+}
 
-	ProfileUpdateView = View{
-		Route:   fmt.Sprintf("%s/update/", ProfileRouteGroup),
-		Handler: http.HandlerFunc(ProfileUpdate),
+func (s *Service) ProfileUpdateView() View {
+	return View{
+		Route:   ProfileRouteGroup + "/{id}",
+		Handler: http.HandlerFunc(s.ProfileUpdate),
 		Methods: []string{http.MethodPut},
+		Doc: openapi.Operation{
+			Summary:  "Update a profile",
+			Tags:     []string{"Profiles"},
+			Request:  ProfileUpdateInput{},
+			Response: ProfileUpdateOutput{},
+		},
 	}
-)
+}
 
-func ProfileCreate(w http.ResponseWriter, r *http.Request) {
-	// Entities To be Created; Blog
-	var data map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+type ProfileCreateInput struct {
+	UserID   int64  `json:"userid" validate:"required,exists=user"`
+	Username string `json:"username" validate:"required,max=50"`
+	Image    string `json:"image" validate:"max=2048,http_url"` // a link to an avatar kept elsewhere, used until one is uploaded
+	Bio      string `json:"bio" validate:"max=1000"`
+}
 
-	queries := models.New(database.DB)
-	ctx := context.Background()
+type ProfileCreateOutput struct {
+	Profile ProfileItem `json:"profile"`
+}
 
-	var input struct {
-		userid int64
+func (s *Service) ProfileCreate(w http.ResponseWriter, r *http.Request) {
+	// Entities To be Created; Profile
+	var input ProfileCreateInput
+	if !validate.Bind(w, r, &input) {
+		return
 	}
 
-	if _, ok := data["userid"].(string); ok {
-		id, err := strconv.ParseInt(data["userid"].(string), 10, 64)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		input.userid = id
-
-	}
+	queries := s.Store.Blog
+	ctx := r.Context()
 
 	profile, err := queries.ProfileCreate(ctx, models.ProfileCreateParams{
-		UserID:    sql.NullInt64{Int64: input.userid, Valid: true},
-		Username:  data["username"].(string),
-		Image:     sql.NullString{String: data["image"].(string), Valid: true},
+		UserID:    sql.NullInt64{Int64: input.UserID, Valid: true},
+		Username:  input.Username,
+		Image:     sql.NullString{String: input.Image, Valid: input.Image != ""},
+		Bio:       sql.NullString{String: input.Bio, Valid: input.Bio != ""},
 		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
 	})
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		// the insert returns no row when the user already has a profile
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.Conflict("this user already has a profile")))
 		return
 	}
 
-	var output struct {
-		Profile models.Profile `json:"profile"`
-	}
+	var output ProfileCreateOutput
 
-	output.Profile = profile
+	output.Profile, err = s.profileItem(profile, nil)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(output)
 }
 
-func ProfileRead(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("%s/read/", ProfileRouteGroup))
-	idStr = strings.TrimLeft(idStr, "/")
-	id, err := strconv.Atoi(idStr)
+type ProfileReadOutput struct {
+	User    authmodels.UserReadRow `json:"user"`
+	Profile ProfileItem            `json:"profile"`
+}
+
+func (s *Service) ProfileRead(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(err)
+		apierror.Write(w, r, apierror.NotFound("profile not found").Wrap(err))
 		return
 	}
 	// Entities To Read; Profile, User
-	authqueries := auth.New(database.DB)
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	authqueries := s.Store.Auth
+	queries := s.Store.Blog
+	ctx := r.Context()
 
-	profile, err := queries.ProfileRead(ctx, int64(id))
+	profile, err := queries.ProfileRead(ctx, id)
 
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(err)
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("profile not found")))
 		return
 	}
 
 	user, err := authqueries.UserRead(ctx, profile.UserID.Int64)
 
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(err)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	var output struct {
-		User    auth.UserReadRow `json:"user"`
-		Profile models.Profile   `json:"profile"`
+	avatar, err := s.profileAvatar(ctx, profile)
+
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
 	}
 
+	var output ProfileReadOutput
+
 	output.User = user
-	output.Profile = profile
+	output.Profile, err = s.profileItem(profile, avatar)
+
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if auth.NotModified(w, r, auth.ETag(profile.Version, user, output.Profile.AvatarURL)) {
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(output)
 }
 
-func ProfileList(w http.ResponseWriter, r *http.Request) {
-	authqueries := auth.New(database.DB)
-	queries := models.New(database.DB)
-	ctx := context.Background()
+type ProfileListItem struct {
+	User    authmodels.UserListRow `json:"user"`
+	Profile ProfileItem            `json:"profile"`
+}
+
+func (s *Service) ProfileList(w http.ResponseWriter, r *http.Request) {
+	authqueries := s.Store.Auth
+	queries := s.Store.Blog
+	ctx := r.Context()
 
 	// Fetch user list
 	userlist, err := authqueries.UserList(ctx)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(err)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	// Fetch profile list
 	profilelist, err := queries.ProfileList(ctx)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(err)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	// Combine users and profiles
-	type useroutput struct {
-		User    auth.UserListRow `json:"user"`
-		Profile models.Profile   `json:"profile"`
+	// Fetch uploaded avatars
+	avatarlist, err := queries.MediaAvatarList(ctx)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
 	}
-	var output []useroutput
+
+	avatars := map[int64]*models.Media{}
+	for i := range avatarlist {
+		avatars[avatarlist[i].ID] = &avatarlist[i]
+	}
+
+	// Combine users and profiles
+	var output []ProfileListItem
 
 	for _, profile := range profilelist {
 		for _, user := range userlist {
 			if profile.UserID.Int64 == user.ID {
-				output = append(output, useroutput{
+				item, err := s.profileItem(profile, avatars[profile.AvatarID.Int64])
+				if err != nil {
+					apierror.Write(w, r, err)
+					return
+				}
+				output = append(output, ProfileListItem{
 					User:    user,
-					Profile: profile,
+					Profile: item,
 				})
 			}
 		}
@@ -187,51 +237,74 @@ func ProfileList(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(output)
 }
 
-func ProfileUpdate(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("%s/update/", ProfileRouteGroup))
-	idStr = strings.TrimLeft(idStr, "/")
-	id, err := strconv.Atoi(idStr)
+type ProfileUpdateInput struct {
+	Username string `json:"username" validate:"required,max=50"`
+	Image    string `json:"image" validate:"max=2048,http_url"`
+	Bio      string `json:"bio" validate:"max=1000"`
+}
+
+type ProfileUpdateOutput struct {
+	Profile ProfileItem `json:"profile"`
+}
+
+func (s *Service) ProfileUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(err)
+		apierror.Write(w, r, apierror.NotFound("profile not found").Wrap(err))
 		return
 	}
 
-	var data map[string]string
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(err)
+	var input ProfileUpdateInput
+	if !validate.Bind(w, r, &input) {
 		return
 	}
 
 	// Entities To Update; User
-	queries := models.New(database.DB)
-	ctx := context.Background()
-
-	profile, err := queries.ProfileUpdate(ctx, models.ProfileUpdateParams{
-		ID:        int64(id),
-		Username:  data["username"],
-		Image:     sql.NullString{String: data["image"], Valid: true},
-		Bio:       sql.NullString{String: data["bio"], Valid: true},
-		UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	ctx := r.Context()
+
+	var profile models.Profile
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		version, err := tx.Blog.ProfileVersion(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := auth.CheckIfMatch(r, version); err != nil {
+			return err
+		}
+
+		profile, err = tx.Blog.ProfileUpdate(ctx, models.ProfileUpdateParams{
+			ID:        id,
+			Username:  input.Username,
+			Image:     sql.NullString{String: input.Image, Valid: input.Image != ""},
+			Bio:       sql.NullString{String: input.Bio, Valid: input.Bio != ""},
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		return err
 	})
 
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(err)
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("profile not found")))
 		return
 	}
 
-	var output struct {
-		Profile models.Profile `json:"profile"`
+	avatar, err := s.profileAvatar(ctx, profile)
+
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
 	}
 
-	output.Profile = profile
+	var output ProfileUpdateOutput
+
+	output.Profile, err = s.profileItem(profile, avatar)
+
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
+	w.Header().Set("ETag", auth.ETag(profile.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(output)
@@ -0,0 +1,360 @@
+package views
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/immanuel-254/blog/apierror"
+	"github.com/immanuel-254/blog/auth"
+	"github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/diff"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/store"
+)
+
+// diffContext is how many unchanged lines surround each change of a unified diff.
+const diffContext = 3
+
+func (s *Service) BlogRevisionListView() View {
+	return View{
+		Route:   BlogRouteGroup + "/{id}/revisions",
+		Handler: http.HandlerFunc(s.BlogRevisionList),
+		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:  "List the revisions of a blog, newest first",
+			Tags:     []string{"Blogs"},
+			Response: BlogRevisionListOutput{},
+		},
+	}
+}
+
+func (s *Service) BlogRevisionReadView() View {
+	return View{
+		Route:   BlogRouteGroup + "/{id}/revisions/{number}",
+		Handler: http.HandlerFunc(s.BlogRevisionRead),
+		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:  "Read a revision of a blog",
+			Tags:     []string{"Blogs"},
+			Response: BlogRevisionOutput{},
+		},
+	}
+}
+
+func (s *Service) BlogRevisionDiffView() View {
+	return View{
+		Route:   BlogRouteGroup + "/{id}/revisions/diff",
+		Handler: http.HandlerFunc(s.BlogRevisionDiff),
+		Methods: []string{http.MethodGet},
+		Doc: openapi.Operation{
+			Summary:     "Compare two revisions of a blog",
+			Description: "from defaults to the revision before to, and to to the latest revision. mode is line, the default, for a unified diff of the body, or word.",
+			Tags:        []string{"Blogs"},
+			Query:       []string{"from", "to", "mode"},
+			Response:    BlogRevisionDiffOutput{},
+		},
+	}
+}
+
+func (s *Service) BlogRevisionRestoreView() View {
+	return View{
+		Route:   BlogRouteGroup + "/{id}/revisions/{number}/restore",
+		Handler: http.HandlerFunc(s.BlogRevisionRestore),
+		Methods: []string{http.MethodPost},
+		Doc: openapi.Operation{
+			Summary:     "Restore a revision of a blog as its newest revision",
+			Description: "Only the owner of the blog and staff can restore its revisions.",
+			Tags:        []string{"Blogs"},
+			Response:    BlogRevisionOutput{},
+		},
+	}
+}
+
+// recordRevision stores what a blog holds after a write as its next revision, and
+// deletes its oldest revisions beyond keep. It runs in the transaction of the write.
+func recordRevision(tx *store.Store, ctx context.Context, blogId int64, title, body string, author int64, restoredFrom int64, keep int) (models.BlogRevision, error) {
+	revision, err := tx.Blog.BlogRevisionCreate(ctx, models.BlogRevisionCreateParams{
+		BlogID:       blogId,
+		BlogID_2:     blogId,
+		Title:        title,
+		Body:         body,
+		AuthorID:     sql.NullInt64{Int64: author, Valid: author != 0},
+		RestoredFrom: sql.NullInt64{Int64: restoredFrom, Valid: restoredFrom != 0},
+		CreatedAt:    sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		return revision, err
+	}
+
+	if keep > 0 {
+		_, err = tx.Blog.BlogRevisionPrune(ctx, models.BlogRevisionPruneParams{
+			BlogID:   blogId,
+			BlogID_2: blogId,
+			Limit:    int64(keep),
+		})
+	}
+
+	return revision, err
+}
+
+// revisionAuthor returns the signed in user making a request, or 0, stored as
+// no author, when the request has none.
+func revisionAuthor(r *http.Request) int64 {
+	if info := auth.RequestInfoFromContext(r.Context()); info != nil {
+		return info.UserID
+	}
+	return 0
+}
+
+type BlogRevisionListOutput struct {
+	Revisions []models.BlogRevisionListRow `json:"revisions"`
+}
+
+func (s *Service) BlogRevisionList(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound("blog not found").Wrap(err))
+		return
+	}
+
+	queries := s.Store.Blog
+	ctx := r.Context()
+
+	exists, err := queries.BlogExists(ctx, id)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if exists != 1 {
+		apierror.Write(w, r, apierror.NotFound("blog not found"))
+		return
+	}
+
+	revisions, err := queries.BlogRevisionList(ctx, id)
+
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var output BlogRevisionListOutput
+
+	output.Revisions = revisions
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(output)
+}
+
+type BlogRevisionOutput struct {
+	Revision models.BlogRevision `json:"revision"`
+}
+
+func (s *Service) BlogRevisionRead(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound("blog not found").Wrap(err))
+		return
+	}
+
+	number, err := strconv.ParseInt(r.PathValue("number"), 10, 64)
+
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound("revision not found").Wrap(err))
+		return
+	}
+
+	revision, err := s.Store.Blog.BlogRevisionRead(r.Context(), models.BlogRevisionReadParams{BlogID: id, Number: number})
+
+	if err != nil {
+		apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("revision not found")))
+		return
+	}
+
+	var output BlogRevisionOutput
+
+	output.Revision = revision
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(output)
+}
+
+type BlogRevisionDiffOutput struct {
+	From    int64       `json:"from"`
+	To      int64       `json:"to"`
+	Mode    string      `json:"mode"`
+	Title   []diff.Edit `json:"title"`
+	Body    []diff.Edit `json:"body"`
+	Unified string      `json:"unified,omitempty"` // the body as a unified diff, in line mode
+}
+
+func (s *Service) BlogRevisionDiff(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound("blog not found").Wrap(err))
+		return
+	}
+
+	queryParams := r.URL.Query()
+
+	mode := queryParams.Get("mode")
+	if mode == "" {
+		mode = "line"
+	}
+	if mode != "line" && mode != "word" {
+		apierror.Write(w, r, apierror.Validation(apierror.FieldError{Field: "mode", Message: "must be line or word"}))
+		return
+	}
+
+	var numbers [2]int64
+	for i, name := range []string{"from", "to"} {
+		value := queryParams.Get(name)
+		if value == "" {
+			continue
+		}
+		numbers[i], err = strconv.ParseInt(value, 10, 64)
+		if err != nil || numbers[i] < 1 {
+			apierror.Write(w, r, apierror.Validation(apierror.FieldError{Field: name, Message: "must be a revision number"}))
+			return
+		}
+	}
+
+	queries := s.Store.Blog
+	ctx := r.Context()
+
+	if numbers[1] == 0 {
+		latest, err := queries.BlogRevisionLatest(ctx, id)
+		if err != nil {
+			apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound("blog not found")))
+			return
+		}
+		numbers[1] = latest.Number
+	}
+	if numbers[0] == 0 {
+		numbers[0] = max(numbers[1]-1, 1)
+	}
+
+	var revisions [2]models.BlogRevision
+	for i, number := range numbers {
+		revisions[i], err = queries.BlogRevisionRead(ctx, models.BlogRevisionReadParams{BlogID: id, Number: number})
+		if err != nil {
+			apierror.Write(w, r, apierror.IfNotFound(err, apierror.NotFound(fmt.Sprintf("revision %d not found", number))))
+			return
+		}
+	}
+	from, to := revisions[0], revisions[1]
+
+	output := BlogRevisionDiffOutput{
+		From:  from.Number,
+		To:    to.Number,
+		Mode:  mode,
+		Title: diff.Words(from.Title, to.Title),
+	}
+
+	if mode == "word" {
+		output.Body = diff.Words(from.Body, to.Body)
+	} else {
+		output.Body = diff.Lines(from.Body, to.Body)
+		output.Unified = diff.Unified(fmt.Sprintf("revision %d", from.Number), fmt.Sprintf("revision %d", to.Number), output.Body, diffContext)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(output)
+}
+
+func (s *Service) BlogRevisionRestore(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound("blog not found").Wrap(err))
+		return
+	}
+
+	number, err := strconv.ParseInt(r.PathValue("number"), 10, 64)
+
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound("revision not found").Wrap(err))
+		return
+	}
+
+	ctx := r.Context()
+	keep := s.Config.Blog.RevisionsKeep
+
+	user, err := auth.CurrentUser(ctx)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// the blog takes the old title and body back, and the history grows by one
+	var (
+		revision models.BlogRevision
+		etag     string
+	)
+	err = s.Store.WithTx(ctx, func(tx *store.Store) error {
+		version, err := tx.Blog.BlogVersion(ctx, id)
+		if err != nil {
+			return apierror.IfNotFound(err, apierror.NotFound("blog not found"))
+		}
+
+		owner, err := tx.Blog.BlogOwner(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !user.Isstaff.Bool && !user.Isadmin.Bool && (!owner.Valid || owner.Int64 != user.ID) {
+			return apierror.Forbidden("only the owner of a blog can restore its revisions")
+		}
+
+		if err := auth.CheckIfMatch(r, version); err != nil {
+			return err
+		}
+
+		old, err := tx.Blog.BlogRevisionRead(ctx, models.BlogRevisionReadParams{BlogID: id, Number: number})
+		if err != nil {
+			return apierror.IfNotFound(err, apierror.NotFound("revision not found"))
+		}
+
+		blog, err := tx.Blog.BlogUpdate(ctx, models.BlogUpdateParams{
+			ID:        id,
+			Title:     old.Title,
+			Body:      old.Body,
+			UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		revision, err = recordRevision(tx, ctx, id, blog.Title, blog.Body, user.ID, old.Number, keep)
+		if err != nil {
+			return err
+		}
+
+		read, err := tx.Blog.BlogRead(ctx, id)
+		etag = blogETag(read)
+		return err
+	})
+
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var output BlogRevisionOutput
+
+	output.Revision = revision
+
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(output)
+}
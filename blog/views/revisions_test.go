@@ -0,0 +1,193 @@
+package views
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/immanuel-254/blog/auth"
+	authmodels "github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/diff"
+)
+
+func TestBlogRevisionDiff(t *testing.T) {
+	s := newTestService(t)
+	blog := createBlog(t, s, "First title", "one\ntwo\nthree")
+
+	if _, err := recordRevision(s.Store, context.Background(), blog.ID, "Second title", "one\n2\nthree", blog.UserID.Int64, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	diffOf := func(query string) (*httptest.ResponseRecorder, BlogRevisionDiffOutput) {
+		w := serve(s.BlogRevisionDiff, httptest.NewRequest(http.MethodGet, "/blogs/1/revisions/diff?"+query, nil), blog.ID)
+
+		var output BlogRevisionDiffOutput
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &output); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, output
+	}
+
+	// the latest revision against the one before by default
+	w, output := diffOf("")
+	if w.Code != http.StatusOK || output.From != 1 || output.To != 2 || output.Mode != "line" {
+		t.Fatalf("got %d %+v", w.Code, output)
+	}
+	wantBody := []diff.Edit{{Op: diff.Equal, Text: "one"}, {Op: diff.Delete, Text: "two"}, {Op: diff.Insert, Text: "2"}, {Op: diff.Equal, Text: "three"}}
+	if !reflect.DeepEqual(output.Body, wantBody) {
+		t.Errorf("body: got %v", output.Body)
+	}
+	wantTitle := []diff.Edit{{Op: diff.Delete, Text: "First"}, {Op: diff.Insert, Text: "Second"}, {Op: diff.Equal, Text: " title"}}
+	if !reflect.DeepEqual(output.Title, wantTitle) {
+		t.Errorf("title: got %v", output.Title)
+	}
+	if want := "--- revision 1\n+++ revision 2\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n"; output.Unified != want {
+		t.Errorf("unified: got %q", output.Unified)
+	}
+
+	// the other way round, word by word
+	w, output = diffOf("from=2&to=1&mode=word")
+	if w.Code != http.StatusOK || output.From != 2 || output.To != 1 || output.Unified != "" {
+		t.Fatalf("word mode: got %d %+v", w.Code, output)
+	}
+	if want := []diff.Edit{{Op: diff.Equal, Text: "one\n"}, {Op: diff.Delete, Text: "2"}, {Op: diff.Insert, Text: "two"}, {Op: diff.Equal, Text: "\nthree"}}; !reflect.DeepEqual(output.Body, want) {
+		t.Errorf("word mode body: got %v", output.Body)
+	}
+
+	for query, status := range map[string]int{
+		"mode=char":     http.StatusUnprocessableEntity,
+		"from=0":        http.StatusUnprocessableEntity,
+		"to=two":        http.StatusUnprocessableEntity,
+		"from=1&to=3":   http.StatusNotFound,
+		"from=1&to=1":   http.StatusOK,
+		"from=2&to=2":   http.StatusOK,
+		"to=1":          http.StatusOK,
+		"from=5&mode=x": http.StatusUnprocessableEntity,
+	} {
+		if w, _ := diffOf(query); w.Code != status {
+			t.Errorf("%s: got %d, want %d", query, w.Code, status)
+		}
+	}
+
+	if w := serve(s.BlogRevisionDiff, httptest.NewRequest(http.MethodGet, "/blogs/99/revisions/diff", nil), 99); w.Code != http.StatusNotFound {
+		t.Errorf("unknown blog: got %d", w.Code)
+	}
+}
+
+// restore asks for revision number of blog to be restored, as user when it is
+// set, with the If-Match header ifMatch when it is not empty.
+func restore(t *testing.T, s *Service, blog int64, number int, user *authmodels.AuthUserReadRow, ifMatch string) (*httptest.ResponseRecorder, models.BlogRevision) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/blogs/1/revisions/1/restore", nil)
+	r.SetPathValue("number", strconv.Itoa(number))
+	if user != nil {
+		r = r.WithContext(auth.WithCurrentUser(r.Context(), *user))
+	}
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+
+	w := serve(s.BlogRevisionRestore, r, blog)
+
+	var output BlogRevisionOutput
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &output); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w, output.Revision
+}
+
+func TestBlogRevisionRestore(t *testing.T) {
+	s := newTestService(t)
+	blog := createBlog(t, s, "First title", "First body")
+	owner := signedIn(t, s, blog.UserID.Int64)
+	other := createUser(t, s, "other@example.com", false)
+	staff := createUser(t, s, "staff@example.com", true)
+
+	if _, err := recordRevision(s.Store, context.Background(), blog.ID, "Second title", "Second body", owner.ID, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if w, _ := restore(t, s, blog.ID, 1, &other, ""); w.Code != http.StatusForbidden {
+		t.Errorf("by another user: got %d %s", w.Code, w.Body)
+	}
+	if w, _ := restore(t, s, blog.ID, 1, &owner, `"stale"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("with a stale If-Match: got %d %s", w.Code, w.Body)
+	}
+	if w, _ := restore(t, s, blog.ID, 9, &owner, ""); w.Code != http.StatusNotFound {
+		t.Errorf("an unknown revision: got %d %s", w.Code, w.Body)
+	}
+	if w, _ := restore(t, s, 99, 1, &owner, ""); w.Code != http.StatusNotFound {
+		t.Errorf("an unknown blog: got %d %s", w.Code, w.Body)
+	}
+
+	// the old content comes back as the newest revision
+	w, revision := restore(t, s, blog.ID, 1, &owner, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("by the owner: got %d %s", w.Code, w.Body)
+	}
+	if revision.Number != 3 || revision.RestoredFrom.Int64 != 1 || revision.AuthorID.Int64 != owner.ID || revision.Title != "First title" {
+		t.Errorf("by the owner: got %+v", revision)
+	}
+	read, err := s.Store.Blog.BlogRead(context.Background(), blog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.BlogTitle != "First title" || read.BlogBody != "First body" || w.Header().Get("ETag") != blogETag(read) {
+		t.Errorf("the blog is %q %q, ETag %s", read.BlogTitle, read.BlogBody, w.Header().Get("ETag"))
+	}
+
+	// staff restore any blog, with the ETag of the last write
+	w, revision = restore(t, s, blog.ID, 2, &staff, w.Header().Get("ETag"))
+	if w.Code != http.StatusOK || revision.Number != 4 || revision.RestoredFrom.Int64 != 2 || revision.AuthorID.Int64 != staff.ID {
+		t.Errorf("by staff: got %d %+v", w.Code, revision)
+	}
+}
+
+func TestBlogRevisionsArePruned(t *testing.T) {
+	s := newTestService(t)
+	s.Config.Blog.RevisionsKeep = 3
+	blog := createBlog(t, s, "Title 1", "Body")
+	owner := signedIn(t, s, blog.UserID.Int64)
+
+	for i := 2; i <= 5; i++ {
+		r := httptest.NewRequest(http.MethodPut, "/blogs/1", strings.NewReader(`{"title": "Title `+strconv.Itoa(i)+`", "body": "Body"}`))
+		if w := serve(s.BlogUpdate, r, blog.ID); w.Code != http.StatusOK {
+			t.Fatalf("update %d: got %d %s", i, w.Code, w.Body)
+		}
+	}
+	if w, _ := restore(t, s, blog.ID, 4, &owner, ""); w.Code != http.StatusOK {
+		t.Fatalf("restore: got %d %s", w.Code, w.Body)
+	}
+
+	revisions, err := s.Store.Blog.BlogRevisionList(context.Background(), blog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numbers []int64
+	for _, revision := range revisions {
+		numbers = append(numbers, revision.Number)
+		// nobody was signed in for the updates
+		if revision.Number < 6 && revision.AuthorID.Valid {
+			t.Errorf("revision %d has the author %d", revision.Number, revision.AuthorID.Int64)
+		}
+	}
+	if !reflect.DeepEqual(numbers, []int64{6, 5, 4}) {
+		t.Errorf("kept %v", numbers)
+	}
+
+	// the pruned ones are gone for good
+	if w, _ := restore(t, s, blog.ID, 1, &owner, ""); w.Code != http.StatusNotFound {
+		t.Errorf("restore a pruned revision: got %d %s", w.Code, w.Body)
+	}
+}
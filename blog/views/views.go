@@ -1,39 +1,52 @@
 package views
 
 import (
-	"database/sql"
+	"context"
 	"net/http"
+	"strconv"
+
+	"github.com/immanuel-254/blog/auth"
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/media"
+	"github.com/immanuel-254/blog/store"
+	"github.com/immanuel-254/blog/validate"
 )
 
-type View struct {
-	Route       string
-	Middlewares []func(http.Handler) http.Handler
-	Handler     http.Handler
-	Methods     []string
+// View is a route of the blog API, registered like the auth routes.
+type View = auth.View
+
+// Service serves the blog views on a store with the settings of Config, and keeps
+// uploads in Media.
+type Service struct {
+	Store  *store.Store
+	Config *config.Config
+	Media  media.Storage
+	APIURL string // where the views are served, for links to them in responses
 }
 
-var DB *sql.DB
+// NewService returns the blog service on st, and registers the blog and category
+// validators used by the exists tag.
+func NewService(st *store.Store, cfg *config.Config, storage media.Storage, apiURL string) *Service {
+	s := &Service{Store: st, Config: cfg, Media: storage, APIURL: apiURL}
+
+	validate.RegisterExists("blog", func(ctx context.Context, id int64) (bool, error) {
+		exists, err := s.Store.Blog.BlogExists(ctx, id)
+		return exists == 1, err
+	})
+	validate.RegisterExists("category", func(ctx context.Context, id int64) (bool, error) {
+		exists, err := s.Store.Blog.CategoryExists(ctx, id)
+		return exists == 1, err
+	})
 
-// Middleware chaining
-func chainMiddlewares(handler http.Handler, middlewares []func(http.Handler) http.Handler) http.Handler {
-	for i := 0; i < len(middlewares); i++ { // Apply middlewares in normal order
-		handler = middlewares[i](handler)
-	}
-	return handler
+	return s
 }
 
-// Routes function
+// Routes registers views at the root of mux.
 func Routes(mux *http.ServeMux, views []View) {
-	for _, view := range views {
-		handlerWithMiddlewares := chainMiddlewares(view.Handler, view.Middlewares)
-		for _, method := range view.Methods {
-			mux.HandleFunc(view.Route, func(w http.ResponseWriter, r *http.Request) {
-				if r.Method != method {
-					http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-					return
-				}
-				handlerWithMiddlewares.ServeHTTP(w, r)
-			})
-		}
-	}
+	auth.Routes(mux, views)
+}
+
+// pathID returns the {id} wildcard of the matched route.
+func pathID(r *http.Request) (int64, error) {
+	return strconv.ParseInt(r.PathValue("id"), 10, 64)
 }
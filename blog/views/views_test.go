@@ -0,0 +1,115 @@
+package views
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	authmodels "github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/internal/testdb"
+	"github.com/immanuel-254/blog/media"
+	"github.com/immanuel-254/blog/store"
+)
+
+// newTestService returns the blog service on a scratch database, with uploads in
+// a scratch directory.
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Domain = "https://example.com"
+
+	storage := &media.Local{Dir: t.TempDir(), BaseURL: cfg.Domain + "/media"}
+	return NewService(store.New(testdb.New(t)), &cfg, storage, cfg.Domain+"/api/v1")
+}
+
+// createBlog adds a user and a blog of theirs with its first revision.
+func createBlog(t *testing.T, s *Service, title, body string) models.Blog {
+	t.Helper()
+
+	ctx := context.Background()
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+
+	user, err := s.Store.Auth.UserCreate(ctx, authmodels.UserCreateParams{Email: "jane@example.com", Password: "not a hash", CreatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := sql.NullInt64{Int64: user.ID, Valid: true}
+
+	blog, err := s.Store.Blog.BlogCreate(ctx, models.BlogCreateParams{UserID: owner, Title: title, Body: body, CreatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recordRevision(s.Store, ctx, blog.ID, title, body, user.ID, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	return blog
+}
+
+// createUser adds a user, staff when staff is set, as RequireAuth signs them in.
+func createUser(t *testing.T, s *Service, email string, staff bool) authmodels.AuthUserReadRow {
+	t.Helper()
+
+	ctx := context.Background()
+	user, err := s.Store.Auth.UserCreate(ctx, authmodels.UserCreateParams{
+		Email:     email,
+		Password:  "not a hash",
+		Isactive:  sql.NullBool{Bool: true, Valid: true},
+		Isstaff:   sql.NullBool{Bool: staff, Valid: true},
+		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signedIn(t, s, user.ID)
+}
+
+// signedIn returns the user id as RequireAuth signs them in.
+func signedIn(t *testing.T, s *Service, id int64) authmodels.AuthUserReadRow {
+	t.Helper()
+
+	user, err := s.Store.Auth.AuthUserRead(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// serve runs handler on a request to the blog id, with the path value set as
+// the mux would.
+func serve(handler http.HandlerFunc, r *http.Request, id int64) *httptest.ResponseRecorder {
+	r.SetPathValue("id", strconv.FormatInt(id, 10))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestViewsStopWithTheRequest(t *testing.T) {
+	s := newTestService(t)
+	blog := createBlog(t, s, "Title", "Body")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := httptest.NewRequest(http.MethodPut, "/blogs/1", strings.NewReader(`{"title": "New title", "body": "New body"}`)).WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+
+	if w := serve(s.BlogUpdate, r, blog.ID); w.Code < http.StatusInternalServerError {
+		t.Errorf("an update of a cancelled request answered %d", w.Code)
+	}
+
+	read, err := s.Store.Blog.BlogRead(context.Background(), blog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.BlogTitle != "Title" {
+		t.Errorf("a cancelled request updated the blog: %q", read.BlogTitle)
+	}
+}
@@ -1,180 +1,682 @@
 package cmd
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/immanuel-254/blog/auth"
+	"github.com/immanuel-254/blog/backup"
 	"github.com/immanuel-254/blog/blog/views"
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/media"
+	"github.com/immanuel-254/blog/metrics"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/store"
 )
 
-var (
-	Login = auth.View{
+// Container holds the dependencies of the API and builds its views from them.
+type Container struct {
+	Config *config.Config
+	Store  *store.Store
+	Auth   *auth.Service
+	Blog   *views.Service
+
+	openapiOnce     sync.Once
+	openapiDocument []byte
+}
+
+// NewContainer wires the services of the API to st.
+func NewContainer(cfg *config.Config, st *store.Store) *Container {
+	storage := media.New(cfg.Media, cfg.Domain)
+
+	return &Container{
+		Config: cfg,
+		Store:  st,
+		Auth:   auth.NewService(st, cfg, storage),
+		Blog:   views.NewService(st, cfg, storage, strings.TrimSuffix(cfg.Domain, "/")+APIPrefix),
+	}
+}
+
+func (c *Container) Login() auth.View {
+	return auth.View{
 		Route:   "/login",
-		Handler: http.HandlerFunc(auth.Login),
+		Methods: []string{http.MethodPost},
+		Handler: http.HandlerFunc(c.Auth.Login),
+		Doc: openapi.Operation{
+			Summary:     "Sign in",
+			Description: "Returns a session token for the auth header, or sets the session cookie when cookie is true.",
+			Tags:        []string{"Session"},
+			Request:     auth.LoginInput{},
+			Response:    auth.LoginOutput{},
+		},
 	}
+}
 
-	Logout = auth.View{
+func (c *Container) Logout() auth.View {
+	return auth.View{
 		Route:   "/logout",
-		Handler: http.HandlerFunc(auth.Logout),
+		Methods: []string{http.MethodPost},
+		Handler: http.HandlerFunc(c.Auth.Logout),
+		Doc: openapi.Operation{
+			Summary:  "Sign out",
+			Tags:     []string{"Session"},
+			Response: auth.MessageOutput{},
+		},
 	}
+}
 
-	Signup = auth.View{
+func (c *Container) Signup() auth.View {
+	return auth.View{
 		Route:   "/signup",
-		Handler: http.HandlerFunc(auth.Signup),
+		Methods: []string{http.MethodPost},
+		Handler: http.HandlerFunc(c.Auth.Signup),
+		Doc: openapi.Operation{
+			Summary:     "Create an account",
+			Description: "Sends an email with the activation link.",
+			Tags:        []string{"Account"},
+			Request:     auth.SignupInput{},
+			Response:    auth.MessageOutput{},
+		},
 	}
+}
 
-	ActivateEmail = auth.View{
+func (c *Container) ActivateEmail() auth.View {
+	return auth.View{
 		Route:   "/activate",
-		Handler: http.HandlerFunc(auth.ActivateEmail),
+		Methods: []string{http.MethodPut},
+		Handler: http.HandlerFunc(c.Auth.ActivateEmail),
+		Doc: openapi.Operation{
+			Summary:  "Activate an account with the token from the signup email",
+			Tags:     []string{"Account"},
+			Query:    []string{"token"},
+			Response: auth.MessageOutput{},
+		},
 	}
+}
 
-	UserRead = auth.View{
-		Route:       "/read",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAdmin},
-		Handler:     http.HandlerFunc(auth.UserRead),
+func (c *Container) UserRead() auth.View {
+	return auth.View{
+		Route:   "/users/{id}",
+		Methods: []string{http.MethodGet},
+		Auth:    c.Auth.RequireAdmin,
+		Handler: http.HandlerFunc(c.Auth.UserRead),
+		Doc: openapi.Operation{
+			Summary:  "Read a user",
+			Tags:     []string{"Users"},
+			Response: auth.UserReadOutput{},
+		},
 	}
+}
 
-	UserList = auth.View{
-		Route:       "/list",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAdmin},
-		Handler:     http.HandlerFunc(auth.UserList),
+func (c *Container) UserList() auth.View {
+	return auth.View{
+		Route:   "/users",
+		Methods: []string{http.MethodGet},
+		Auth:    c.Auth.RequireAdmin,
+		Handler: http.HandlerFunc(c.Auth.UserList),
+		Doc: openapi.Operation{
+			Summary:  "List users",
+			Tags:     []string{"Users"},
+			Response: auth.UserListOutput{},
+		},
 	}
+}
 
-	ChangeEmailRequest = auth.View{
-		Route:       "/change-email-request",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAuth},
-		Handler:     http.HandlerFunc(auth.ChangeEmailRequest),
+func (c *Container) ChangeEmailRequest() auth.View {
+	return auth.View{
+		Route:   "/change-email-request",
+		Methods: []string{http.MethodPost},
+		Auth:    c.Auth.RequireAuth,
+		Handler: http.HandlerFunc(c.Auth.ChangeEmailRequest),
+		Doc: openapi.Operation{
+			Summary:     "Request an email change",
+			Description: "Sends a confirmation link to the new address and a cancel link to the old one. Both work until the change is a day old.",
+			Tags:        []string{"Account"},
+			Request:     auth.ChangeEmailInput{},
+			Response:    auth.MessageOutput{},
+		},
 	}
+}
 
-	ChangeEmail = auth.View{
-		Route:       "/change-email",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAuth},
-		Handler:     http.HandlerFunc(auth.ChangeEmail),
+func (c *Container) ChangeEmail() auth.View {
+	return auth.View{
+		Route:   "/change-email",
+		Methods: []string{http.MethodPut},
+		Auth:    c.Auth.RequireAuth,
+		Handler: http.HandlerFunc(c.Auth.ChangeEmail),
+		Doc: openapi.Operation{
+			Summary:  "Change the email with the token from the confirmation email",
+			Tags:     []string{"Account"},
+			Query:    []string{"token"},
+			Response: auth.MessageOutput{},
+		},
 	}
+}
 
-	ChangePasswordRequest = auth.View{
-		Route:       "/change-password-request",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAuth},
-		Handler:     http.HandlerFunc(auth.ChangePasswordRequest),
+func (c *Container) ChangeEmailCancel() auth.View {
+	return auth.View{
+		Route:   "/change-email-cancel",
+		Methods: []string{http.MethodPut},
+		Handler: http.HandlerFunc(c.Auth.ChangeEmailCancel),
+		Doc: openapi.Operation{
+			Summary:  "Cancel an email change with the token from the notification email",
+			Tags:     []string{"Account"},
+			Query:    []string{"token"},
+			Response: auth.MessageOutput{},
+		},
 	}
+}
 
-	ChangePassword = auth.View{
-		Route:       "/change-password",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAuth},
-		Handler:     http.HandlerFunc(auth.ChangePassword),
+func (c *Container) ChangePasswordRequest() auth.View {
+	return auth.View{
+		Route:   "/change-password-request",
+		Methods: []string{http.MethodPost},
+		Auth:    c.Auth.RequireAuth,
+		Handler: http.HandlerFunc(c.Auth.ChangePasswordRequest),
+		Doc: openapi.Operation{
+			Summary:     "Request a password change",
+			Description: "Sends a confirmation link by email.",
+			Tags:        []string{"Account"},
+			Response:    auth.MessageOutput{},
+		},
 	}
+}
 
-	ResetPasswordRequest = auth.View{
-		Route:       "/reset-password-request",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAuth},
-		Handler:     http.HandlerFunc(auth.ResetPasswordRequest),
+func (c *Container) ChangePassword() auth.View {
+	return auth.View{
+		Route:   "/change-password",
+		Methods: []string{http.MethodPut},
+		Auth:    c.Auth.RequireAuth,
+		Handler: http.HandlerFunc(c.Auth.ChangePassword),
+		Doc: openapi.Operation{
+			Summary:  "Change the password with the token from the confirmation email",
+			Tags:     []string{"Account"},
+			Query:    []string{"token"},
+			Request:  auth.ChangePasswordInput{},
+			Response: auth.MessageOutput{},
+		},
 	}
+}
 
-	ResetPassword = auth.View{
-		Route:       "/reset-password",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAuth},
-		Handler:     http.HandlerFunc(auth.ResetPassword),
+func (c *Container) ResetPasswordRequest() auth.View {
+	return auth.View{
+		Route:   "/reset-password-request",
+		Methods: []string{http.MethodPost},
+		Auth:    c.Auth.RequireAuth,
+		Handler: http.HandlerFunc(c.Auth.ResetPasswordRequest),
+		Doc: openapi.Operation{
+			Summary:     "Request a password reset",
+			Description: "Sends a reset link by email.",
+			Tags:        []string{"Account"},
+			Response:    auth.MessageOutput{},
+		},
 	}
+}
 
-	DeleteUserRequest = auth.View{
-		Route:       "/delete-user-request",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAuth},
-		Handler:     http.HandlerFunc(auth.DeleteUserRequest),
+func (c *Container) ResetPassword() auth.View {
+	return auth.View{
+		Route:   "/reset-password",
+		Methods: []string{http.MethodPut},
+		Auth:    c.Auth.RequireAuth,
+		Handler: http.HandlerFunc(c.Auth.ResetPassword),
+		Doc: openapi.Operation{
+			Summary:  "Reset the password with the token from the reset email",
+			Tags:     []string{"Account"},
+			Query:    []string{"token"},
+			Request:  auth.ResetPasswordInput{},
+			Response: auth.MessageOutput{},
+		},
 	}
+}
 
-	DeleteUser = auth.View{
-		Route:       "/delete-user",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAuth},
-		Handler:     http.HandlerFunc(auth.DeleteUser),
+func (c *Container) DeleteUserRequest() auth.View {
+	return auth.View{
+		Route:   "/delete-user-request",
+		Methods: []string{http.MethodPost},
+		Auth:    c.Auth.RequireAuth,
+		Handler: http.HandlerFunc(c.Auth.DeleteUserRequest),
+		Doc: openapi.Operation{
+			Summary:     "Request the deletion of the account",
+			Description: "Sends a confirmation link by email.",
+			Tags:        []string{"Account"},
+			Response:    auth.MessageOutput{},
+		},
 	}
+}
 
-	IsActiveChange = auth.View{
-		Route:       "/isactive",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAdmin},
-		Handler:     http.HandlerFunc(auth.IsActiveChange),
+func (c *Container) DeleteUser() auth.View {
+	return auth.View{
+		Route:   "/delete-user",
+		Methods: []string{http.MethodDelete},
+		Auth:    c.Auth.RequireAuth,
+		Handler: http.HandlerFunc(c.Auth.DeleteUser),
+		Doc: openapi.Operation{
+			Summary:     "Delete the account with the token from the confirmation email",
+			Description: "The deletion is carried out after the grace period, and can be cancelled until then.",
+			Tags:        []string{"Account"},
+			Query:       []string{"token"},
+			Request:     auth.DeleteUserInput{},
+			Response:    auth.DeleteUserOutput{},
+		},
 	}
+}
 
-	IsStaffChange = auth.View{
-		Route:       "/isstaff",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAdmin},
-		Handler:     http.HandlerFunc(auth.IsStaffChange),
+func (c *Container) DeleteUserCancel() auth.View {
+	return auth.View{
+		Route:   "/delete-user-cancel",
+		Methods: []string{http.MethodPut},
+		Handler: http.HandlerFunc(c.Auth.DeleteUserCancel),
+		Doc: openapi.Operation{
+			Summary:  "Cancel a scheduled deletion with the token from the notification email",
+			Tags:     []string{"Account"},
+			Query:    []string{"token"},
+			Response: auth.MessageOutput{},
+		},
 	}
+}
 
-	SessionList = auth.View{
-		Route:       "/session/list",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAdmin},
-		Handler:     http.HandlerFunc(auth.SessionList),
+func (c *Container) UserExport() auth.View {
+	return auth.View{
+		Route:   "/export",
+		Methods: []string{http.MethodGet},
+		Auth:    c.Auth.RequireAuth,
+		Handler: http.HandlerFunc(c.Auth.UserExport),
+		Doc: openapi.Operation{
+			Summary: "Export the account and its content as a zip archive",
+			Tags:    []string{"Account"},
+		},
 	}
+}
 
-	LogList = auth.View{
-		Route:       "/log/list",
-		Middlewares: []func(http.Handler) http.Handler{auth.RequireAdmin},
-		Handler:     http.HandlerFunc(auth.LogList),
+func (c *Container) IsActiveChange() auth.View {
+	return auth.View{
+		Route:   "/users/{id}/isactive",
+		Methods: []string{http.MethodPut},
+		Auth:    c.Auth.RequireAdmin,
+		Handler: http.HandlerFunc(c.Auth.IsActiveChange),
+		Doc: openapi.Operation{
+			Summary:  "Activate or deactivate a user",
+			Tags:     []string{"Users"},
+			Request:  auth.IsActiveInput{},
+			Response: auth.MessageOutput{},
+		},
 	}
-)
+}
 
-func Api() {
-	mux := http.NewServeMux()
+func (c *Container) IsStaffChange() auth.View {
+	return auth.View{
+		Route:   "/users/{id}/isstaff",
+		Methods: []string{http.MethodPut},
+		Auth:    c.Auth.RequireAdmin,
+		Handler: http.HandlerFunc(c.Auth.IsStaffChange),
+		Doc: openapi.Operation{
+			Summary:  "Grant or revoke staff status",
+			Tags:     []string{"Users"},
+			Request:  auth.IsStaffInput{},
+			Response: auth.MessageOutput{},
+		},
+	}
+}
 
+func (c *Container) SessionList() auth.View {
+	return auth.View{
+		Route:   "/sessions",
+		Methods: []string{http.MethodGet},
+		Auth:    c.Auth.RequireAdmin,
+		Handler: http.HandlerFunc(c.Auth.SessionList),
+		Doc: openapi.Operation{
+			Summary:  "List sessions",
+			Tags:     []string{"Admin"},
+			Response: auth.SessionListOutput{},
+		},
+	}
+}
+
+func (c *Container) LogList() auth.View {
+	return auth.View{
+		Route:   "/logs",
+		Methods: []string{http.MethodGet},
+		Auth:    c.Auth.RequireAdmin,
+		Handler: http.HandlerFunc(c.Auth.LogList),
+		Doc: openapi.Operation{
+			Summary:  "List the audit log",
+			Tags:     []string{"Admin"},
+			Response: auth.LogListOutput{},
+		},
+	}
+}
+
+func (c *Container) ReadyzView() auth.View {
+	return auth.View{
+		Route:   "/readyz",
+		Methods: []string{http.MethodGet},
+		Handler: http.HandlerFunc(c.Readyz),
+		Doc: openapi.Operation{
+			Summary: "Report whether the server can handle traffic",
+			Tags:    []string{"Operations"},
+		},
+	}
+}
+
+var HealthzView = auth.View{
+	Route:   "/healthz",
+	Methods: []string{http.MethodGet},
+	Handler: http.HandlerFunc(Healthz),
+	Doc: openapi.Operation{
+		Summary: "Report that the process is alive",
+		Tags:    []string{"Operations"},
+	},
+}
+
+func (c *Container) MetricsView() auth.View {
+	return auth.View{
+		Route:   "/metrics",
+		Methods: []string{http.MethodGet},
+		Handler: http.HandlerFunc(c.Metrics),
+		Doc: openapi.Operation{
+			Summary:     "Expose metrics in the Prometheus text format",
+			Description: "Scrapers send METRICS_TOKEN as a bearer token when one is set. With METRICS_ADDR set, the metrics are only served on that address.",
+			Tags:        []string{"Operations"},
+		},
+	}
+}
+
+// MediaFilesView serves the uploads kept in local storage.
+func MediaFilesView(local *media.Local) auth.View {
+	return auth.View{
+		Route:   "/media/{key...}",
+		Methods: []string{http.MethodGet},
+		Handler: local.Handler(),
+		Doc: openapi.Operation{
+			Summary: "Download an uploaded file",
+			Tags:    []string{"Media"},
+		},
+	}
+}
+
+// requireAuth puts view behind RequireAuth, for views of services that do not
+// know the auth service.
+func (c *Container) requireAuth(view auth.View) auth.View {
+	view.Auth = c.Auth.RequireAuth
+	return view
+}
+
+// APIPrefix is where the current version of the API is served.
+const APIPrefix = "/api/v1"
+
+// Routes registers every view of the API on mux.
+func (c *Container) Routes(mux *http.ServeMux) {
 	allviews := []auth.View{
-		Login,
-		Logout,
-		Signup,
-		ActivateEmail,
-		UserRead,
-		UserList,
-		ChangeEmailRequest,
-		ChangeEmail,
-		ResetPasswordRequest,
-		ResetPassword,
-		DeleteUserRequest,
-		DeleteUser,
-		IsActiveChange,
-		IsStaffChange,
-
-		SessionList,
-
-		LogList,
+		c.Login(),
+		c.Logout(),
+		c.Signup(),
+		c.ActivateEmail(),
+		c.UserRead(),
+		c.UserList(),
+		c.ChangeEmailRequest(),
+		c.ChangeEmail(),
+		c.ChangeEmailCancel(),
+		c.ChangePasswordRequest(),
+		c.ChangePassword(),
+		c.ResetPasswordRequest(),
+		c.ResetPassword(),
+		c.DeleteUserRequest(),
+		c.DeleteUser(),
+		c.DeleteUserCancel(),
+		c.UserExport(),
+		c.IsActiveChange(),
+		c.IsStaffChange(),
+
+		c.SessionList(),
+
+		c.LogList(),
 	}
 
 	allblogviews := []views.View{
-		views.BlogCreateView,
-		views.BlogDeleteView,
-		views.BlogListView,
-		views.BlogReadView,
-		views.BlogUpdateView,
-		views.CategoryCreateView,
-		views.CategoryDeleteView,
-		views.CategoryReadView,
-		views.CategoryListView,
-		views.CategoryUpdateView,
-		views.CommentCreateView,
-		views.CommentDeleteView,
-		views.CommentReadView,
-		views.CommentListView,
-		views.CommentUpdateView,
-		views.ProfileListView,
-		views.ProfileReadView,
-		views.ProfileUpdateView,
-	}
-
-	auth.Routes(mux, allviews)
-	views.Routes(mux, allblogviews)
+		c.Blog.BlogCreateView(),
+		c.Blog.BlogDeleteView(),
+		c.Blog.BlogListView(),
+		c.Blog.BlogReadView(),
+		c.Blog.BlogUpdateView(),
+		c.Blog.BlogRevisionListView(),
+		c.Blog.BlogRevisionReadView(),
+		c.Blog.BlogRevisionDiffView(),
+		c.requireAuth(c.Blog.BlogRevisionRestoreView()),
+		c.Blog.CategoryCreateView(),
+		c.Blog.CategoryDeleteView(),
+		c.Blog.CategoryReadView(),
+		c.Blog.CategoryListView(),
+		c.Blog.CategoryUpdateView(),
+		c.Blog.CommentCreateView(),
+		c.Blog.CommentDeleteView(),
+		c.Blog.CommentReadView(),
+		c.Blog.CommentListView(),
+		c.Blog.CommentUpdateView(),
+		c.Blog.ProfileCreateView(),
+		c.Blog.ProfileListView(),
+		c.Blog.ProfileReadView(),
+		c.Blog.ProfileUpdateView(),
+		c.Blog.ProfileAvatarView(),
+		c.requireAuth(c.Blog.ProfileAvatarUploadView()),
+		c.requireAuth(c.Blog.ProfileAvatarDeleteView()),
+		c.requireAuth(c.Blog.MediaUploadView()),
+		c.requireAuth(c.Blog.MediaListView()),
+		c.requireAuth(c.Blog.MediaReadView()),
+		c.requireAuth(c.Blog.MediaUpdateView()),
+		c.requireAuth(c.Blog.MediaDeleteView()),
+	}
+
+	cors := auth.NewCorsConfig(c.Config.Cors)
+
+	v1 := append(allviews, allblogviews...)
+	auth.Group{Prefix: APIPrefix, Cors: &cors}.Routes(mux, v1)
+
+	// A new version starts from the views of the previous one and replaces those
+	// whose requests or responses change, the rest keep their v1 handlers:
+	//
+	//	auth.Group{Prefix: "/api/v2", Cors: &cors}.Routes(mux, auth.Override(v1, c.Blog.BlogReadViewV2()))
+	//
+	// Retire the old version by giving its group a Deprecation.
+
+	root := auth.Group{Cors: &cors}
+
+	// operational routes are not part of any version
+	root.Routes(mux, []auth.View{
+		HealthzView,
+		c.ReadyzView(),
+		c.OpenAPIView(),
+		DocsView,
+	})
+
+	// metrics with an address of their own are served by Api on it
+	if c.Config.Metrics.Addr == "" {
+		root.Routes(mux, []auth.View{c.MetricsView()})
+	}
+
+	// files in local storage are served by the API itself
+	if local, ok := c.Blog.Media.(*media.Local); ok {
+		root.Routes(mux, []auth.View{MediaFilesView(local)})
+	}
+
+	if c.Config.API.LegacyRoutes {
+		root.Routes(mux, c.legacyViews(v1, auth.Deprecation{
+			Since:  legacyDeprecated,
+			Sunset: c.Config.API.LegacySunsetTime(),
+		}))
+	}
+}
+
+// Api serves the API on st until ctx is cancelled, then stops accepting
+// connections and gives in-flight requests and background workers up to
+// cfg.ShutdownTimeout to finish.
+func Api(ctx context.Context, cfg *config.Config, st *store.Store) error {
+	c := NewContainer(cfg, st)
+
+	mux := http.NewServeMux()
+	c.Routes(mux)
+
+	// PostgreSQL reads and writes on the one pool
+	pools := map[string]*sql.DB{"writer": st.DB.DB}
+	if st.DB.Reader != nil {
+		pools["reader"] = st.DB.Reader
+	}
+	metrics.RegisterDBStats(pools)
+
+	// background workers are stopped after the server has drained
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var workers sync.WaitGroup
+
+	// purge accounts whose deletion grace period has passed
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		c.Auth.RunDeletionWorker(workerCtx, time.Hour)
+	}()
+
+	// remove the files of deleted media
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		c.Blog.RunMediaPurgeWorker(workerCtx, time.Hour)
+	}()
+
+	// take scheduled snapshots of a SQLite database
+	if cfg.Backup.Interval > 0 && st.DB.Driver == database.SQLite {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			backup.Run(workerCtx, st.DB, cfg.Backup)
+		}()
+	}
 
 	server := &http.Server{
-		Addr: fmt.Sprintf(":%s", os.Getenv("PORT")), // Custom port
-		//Handler:      internal.LoggingMiddleware(internal.Cors(internal.New(internal.ConfigDefault)(mux))), // Attach the mux as the handler
-		Handler:      auth.LoggingMiddleware(mux),
+		Addr: fmt.Sprintf(":%d", cfg.Port), // Custom port
+		// CORS is applied per route in Routes so views can override it
+		Handler:      auth.RequestID(auth.LoggingMiddleware(auth.New(auth.SecurityHeaders(cfg.Security, cfg.HTTPS))(auth.CSRF(auth.MuxErrors(mux))))),
 		ReadTimeout:  10 * time.Second, // Set read timeout
 		WriteTimeout: 10 * time.Second, // Set write timeout
 		IdleTimeout:  30 * time.Second, // Set idle timeout
 	}
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Println("Error starting server:", err)
+	servers := []*http.Server{server}
+
+	// keep the metrics off the public listener
+	if cfg.Metrics.Addr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", http.HandlerFunc(c.Metrics))
+		servers = append(servers, &http.Server{
+			Addr:         cfg.Metrics.Addr,
+			Handler:      auth.RequestID(auth.LoggingMiddleware(metricsMux)),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			IdleTimeout:  30 * time.Second,
+		})
+	}
+
+	serveErr := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() {
+			slog.Info("listening", "addr", server.Addr)
+			serveErr <- server.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		for _, server := range servers {
+			server.Close()
+		}
+		stopWorkers()
+		workers.Wait()
+		return err
+	case <-ctx.Done():
 	}
+
+	slog.Info("shutting down, waiting for requests to finish", "timeout", cfg.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, server := range servers {
+		errs = append(errs, server.Shutdown(shutdownCtx))
+	}
+	err := errors.Join(errs...)
+
+	stopWorkers()
+	workers.Wait()
+
+	if err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+
+	slog.Info("server stopped")
+	return nil
+}
+
+func serveCommand() *Command {
+	cmd := newCommand("serve", "[flags]", "Run the HTTP server. Refuses to start while migrations are pending.")
+	cmd.Aliases = []string{"runserver"}
+	port := cmd.Flags.Int("port", 0, "port to listen on (default from the configuration)")
+	autoMigrate := cmd.Flags.Bool("auto-migrate", false, "apply pending migrations before starting")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) > 0 {
+			return usageErrorf("serve takes no arguments")
+		}
+
+		cfg, err := env.Config()
+		if err != nil {
+			return err
+		}
+		if err := cfg.ValidateServer(); err != nil {
+			return err
+		}
+
+		if *autoMigrate {
+			_, st, closeDB, err := env.openDB()
+			if err != nil {
+				return err
+			}
+
+			err = migrateUp(context.Background(), st.DB, env.Stderr)
+			closeDB()
+			if err != nil {
+				return err
+			}
+		}
+
+		_, st, closeDB, err := env.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		if *port != 0 {
+			cfg.Port = *port
+		}
+
+		setupLogger(cfg.Log, env.Stderr)
+
+		// SIGINT and SIGTERM drain the server instead of killing it
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return Api(ctx, cfg, st)
+	}
+
+	return cmd
 }
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/store"
+)
+
+// TestRoutesAreDocumented registers every route, the legacy ones included, and
+// fails on those missing from the OpenAPI document.
+func TestRoutesAreDocumented(t *testing.T) {
+	cfg := config.Default()
+	cfg.Domain = "https://example.com"
+	cfg.API.LegacyRoutes = true
+
+	// the views are only described, so they need no database
+	openapi.Default = openapi.NewRegistry()
+	NewContainer(&cfg, &store.Store{}).Routes(http.NewServeMux())
+
+	doc := openapi.Default.Document(apiInfo(&cfg))
+	if err := openapi.Default.Check(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, path string
+		secured      bool
+	}{
+		{"post", APIPrefix + "/login", false},
+		{"get", APIPrefix + "/blogs", false},
+		{"get", APIPrefix + "/users", true},
+		{"get", APIPrefix + "/sessions", true},
+		{"post", APIPrefix + "/media", true},
+	}
+
+	for _, test := range tests {
+		item, ok := doc.Paths[test.path][test.method]
+		if !ok {
+			t.Errorf("%s %s is not in the document", test.method, test.path)
+			continue
+		}
+		if secured := item.Security != nil; secured != test.secured {
+			t.Errorf("%s %s: secured %v, want %v", test.method, test.path, secured, test.secured)
+		}
+	}
+}
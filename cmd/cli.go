@@ -4,69 +4,451 @@ import (
 	"bufio"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/immanuel-254/blog/auth"
 	"github.com/immanuel-254/blog/auth/models"
-	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/store"
 	"golang.org/x/term"
 )
 
-func CreateAdminUser() {
-	reader := bufio.NewReader(os.Stdin)
+const (
+	RoleUser  = "user"
+	RoleStaff = "staff"
+	RoleAdmin = "admin"
+)
 
-	fmt.Print("Email: ")
-	email, err := reader.ReadString('\n')
-	if err != nil {
-		fmt.Printf("Error reading email: %v\n", err)
-		return
+// roleFlags maps a role to the isstaff and isadmin columns.
+func roleFlags(role string) (staff bool, admin bool, err error) {
+	switch role {
+	case RoleUser:
+		return false, false, nil
+	case RoleStaff:
+		return true, false, nil
+	case RoleAdmin:
+		return true, true, nil
+	}
+	return false, false, usageErrorf("unknown role %q, must be user, staff or admin", role)
+}
+
+func (env *Env) stdinReader() *bufio.Reader {
+	if reader, ok := env.Stdin.(*bufio.Reader); ok {
+		return reader
+	}
+	reader := bufio.NewReader(env.Stdin)
+	env.Stdin = reader
+	return reader
+}
+
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// readLine reads one line from stdin, prompting for it when stdin is a terminal.
+func readLine(env *Env, prompt string) (string, error) {
+	if stdinIsTerminal() {
+		fmt.Fprint(env.Stderr, prompt)
+	}
+
+	line, err := env.stdinReader().ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("reading %s from stdin: %w", strings.ToLower(strings.TrimSuffix(prompt, ": ")), err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readPassword reads a password from the terminal without echoing it, or as a line
+// from stdin when fromStdin is set, so scripts can pipe it in.
+func readPassword(env *Env, fromStdin bool) (string, error) {
+	if fromStdin {
+		return readLine(env, "Password: ")
+	}
+
+	if !stdinIsTerminal() {
+		return "", usageErrorf("stdin is not a terminal, pass the password with --password-stdin")
 	}
-	email = email[:len(email)-1] // Remove the trailing newline
-	email = strings.TrimSuffix(email, "\r")
 
-	fmt.Print("Password (input will be hidden): ")
+	fmt.Fprint(env.Stderr, "Password (input will be hidden): ")
 	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+	fmt.Fprintln(env.Stderr) // Print a newline after password input
 	if err != nil {
-		fmt.Printf("Error reading password: %v\n", err)
-		return
+		return "", fmt.Errorf("reading password: %w", err)
 	}
-	fmt.Println() // Print a newline after password input
 
-	password := string(bytePassword)
+	return string(bytePassword), nil
+}
+
+// validatePassword checks a password against the policy and lists every violation.
+func validatePassword(cfg *config.Config, password, email string) error {
+	err := auth.ValidatePassword(cfg.Password, password, email)
 
-	hash, err := auth.HashPassword(password)
-	if err != nil {
-		panic(err)
+	if policyErr, ok := err.(*auth.PasswordPolicyError); ok {
+		messages := make([]string, len(policyErr.Violations))
+		for i, violation := range policyErr.Violations {
+			messages[i] = violation.Message
+		}
+		return fmt.Errorf("password does not meet policy:\n  - %s", strings.Join(messages, "\n  - "))
 	}
 
-	queries := models.New(database.DB)
-	ctx := context.Background()
+	return err
+}
 
-	user, err := queries.UserCreate(ctx, models.UserCreateParams{
-		Email:     email,
-		Password:  hash,
-		Isactive:  sql.NullBool{Bool: true, Valid: true},
-		Isstaff:   sql.NullBool{Bool: true, Valid: true},
-		Isadmin:   sql.NullBool{Bool: true, Valid: true},
-		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
-	})
-	if err != nil {
-		panic(err)
+func userByEmail(queries models.Querier, ctx context.Context, email string) (models.UserEmailReadRow, error) {
+	user, err := queries.UserEmailRead(ctx, email)
+	if err == sql.ErrNoRows {
+		return user, fmt.Errorf("no user with the email %s", email)
 	}
+	return user, err
+}
 
-	err = queries.LogCreate(ctx, models.LogCreateParams{
-		DbTable:   "user",
-		Action:    "create",
-		ObjectID:  user.ID,
+func logAction(queries models.Querier, ctx context.Context, table, action string, objectId int64) error {
+	return queries.LogCreate(ctx, models.LogCreateParams{
+		DbTable:   table,
+		Action:    action,
+		ObjectID:  objectId,
 		UserID:    0,
 		CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
 	})
+}
+
+// CreateUser creates a user with the given role, reading the email and password from stdin when they are not given.
+func CreateUser(env *Env, cfg *config.Config, st *store.Store, email string, passwordStdin bool, role string, active bool) error {
+	ctx := context.Background()
 
+	staff, admin, err := roleFlags(role)
 	if err != nil {
-		panic(err)
+		return err
 	}
+
+	if email == "" {
+		if email, err = readLine(env, "Email: "); err != nil {
+			return err
+		}
+	}
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return usageErrorf("an email is required")
+	}
+
+	password, err := readPassword(env, passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	if err := validatePassword(cfg, password, email); err != nil {
+		return err
+	}
+
+	hash, err := auth.HashPassword(cfg.Password, password)
+	if err != nil {
+		return err
+	}
+
+	var user models.UserCreateRow
+	err = st.WithTx(ctx, func(tx *store.Store) (err error) {
+		user, err = tx.Auth.UserCreate(ctx, models.UserCreateParams{
+			Email:     email,
+			Password:  hash,
+			Isactive:  sql.NullBool{Bool: active, Valid: true},
+			Isstaff:   sql.NullBool{Bool: staff, Valid: true},
+			Isadmin:   sql.NullBool{Bool: admin, Valid: true},
+			CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		return logAction(tx.Auth, ctx, "user", "create", user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(env.Stdout, "Created %s %s with id %d\n", role, user.Email, user.ID)
+	return nil
+}
+
+func createAdminCommand() *Command {
+	cmd := newCommand("createadmin", "[flags]", "Create an admin user. Prompts for anything not given by flags.")
+	email := cmd.Flags.String("email", "", "email of the admin")
+	passwordStdin := cmd.Flags.Bool("password-stdin", false, "read the password from stdin instead of prompting")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) > 0 {
+			return usageErrorf("createadmin takes no arguments")
+		}
+
+		cfg, st, closeDB, err := env.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		return CreateUser(env, cfg, st, *email, *passwordStdin, RoleAdmin, true)
+	}
+
+	return cmd
+}
+
+func userCommand() *Command {
+	cmd := newCommand("user", "", "Manage users.")
+
+	cmd.Subcommands = []*Command{
+		userCreateCommand(),
+		userListCommand(),
+		userActivateCommand(),
+		userSetRoleCommand(),
+		userResetPasswordCommand(),
+	}
+
+	return cmd
+}
+
+func userCreateCommand() *Command {
+	cmd := newCommand("create", "[flags]", "Create a user. Prompts for anything not given by flags.")
+	email := cmd.Flags.String("email", "", "email of the user")
+	passwordStdin := cmd.Flags.Bool("password-stdin", false, "read the password from stdin instead of prompting")
+	role := cmd.Flags.String("role", RoleUser, "role of the user, user, staff or admin")
+	inactive := cmd.Flags.Bool("inactive", false, "create the user without activating it")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) > 0 {
+			return usageErrorf("user create takes no arguments")
+		}
+
+		if _, _, err := roleFlags(*role); err != nil {
+			return err
+		}
+
+		cfg, st, closeDB, err := env.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		return CreateUser(env, cfg, st, *email, *passwordStdin, *role, !*inactive)
+	}
+
+	return cmd
+}
+
+func userListCommand() *Command {
+	cmd := newCommand("list", "[flags]", "List all users with their roles.")
+	asJSON := cmd.Flags.Bool("json", false, "print the users as JSON")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) > 0 {
+			return usageErrorf("user list takes no arguments")
+		}
+
+		_, st, closeDB, err := env.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		users, err := st.Auth.UserRoleList(context.Background())
+		if err != nil {
+			return err
+		}
+
+		if *asJSON {
+			encoder := json.NewEncoder(env.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(users)
+		}
+
+		writer := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tEMAIL\tROLE\tACTIVE\tCREATED")
+
+		for _, user := range users {
+			role := RoleUser
+			if user.Isadmin.Bool {
+				role = RoleAdmin
+			} else if user.Isstaff.Bool {
+				role = RoleStaff
+			}
+
+			fmt.Fprintf(writer, "%d\t%s\t%s\t%t\t%s\n", user.ID, user.Email, role, user.Isactive.Bool, user.CreatedAt.Time.Format(time.DateTime))
+		}
+
+		return writer.Flush()
+	}
+
+	return cmd
+}
+
+func userActivateCommand() *Command {
+	cmd := newCommand("activate", "[flags] <email>", "Activate a user, or deactivate it with --deactivate.")
+	deactivate := cmd.Flags.Bool("deactivate", false, "deactivate the user instead")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) != 1 {
+			return usageErrorf("user activate needs exactly one email")
+		}
+
+		_, st, closeDB, err := env.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		queries := st.Auth
+		ctx := context.Background()
+
+		user, err := userByEmail(queries, ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		err = st.WithTx(ctx, func(tx *store.Store) error {
+			_, err := tx.Auth.UserUpdateIsActive(ctx, models.UserUpdateIsActiveParams{
+				Isactive:  sql.NullBool{Bool: !*deactivate, Valid: true},
+				UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+				ID:        user.ID,
+			})
+			if err != nil {
+				return err
+			}
+
+			return logAction(tx.Auth, ctx, "user", "update", user.ID)
+		})
+		if err != nil {
+			return err
+		}
+
+		if *deactivate {
+			fmt.Fprintf(env.Stdout, "Deactivated %s\n", user.Email)
+		} else {
+			fmt.Fprintf(env.Stdout, "Activated %s\n", user.Email)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+func userSetRoleCommand() *Command {
+	cmd := newCommand("set-role", "<email> <user|staff|admin>", "Change the role of a user.")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) != 2 {
+			return usageErrorf("user set-role needs an email and a role")
+		}
+
+		staff, admin, err := roleFlags(args[1])
+		if err != nil {
+			return err
+		}
+
+		_, st, closeDB, err := env.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		queries := st.Auth
+		ctx := context.Background()
+
+		user, err := userByEmail(queries, ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		err = st.WithTx(ctx, func(tx *store.Store) error {
+			_, err := tx.Auth.UserUpdateRole(ctx, models.UserUpdateRoleParams{
+				Isstaff:   sql.NullBool{Bool: staff, Valid: true},
+				Isadmin:   sql.NullBool{Bool: admin, Valid: true},
+				UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+				ID:        user.ID,
+			})
+			if err != nil {
+				return err
+			}
+
+			return logAction(tx.Auth, ctx, "user", "update", user.ID)
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(env.Stdout, "%s is now %s\n", user.Email, args[1])
+		return nil
+	}
+
+	return cmd
+}
+
+func userResetPasswordCommand() *Command {
+	cmd := newCommand("reset-password", "[flags] <email>", "Set a new password for a user and end all their sessions.")
+	passwordStdin := cmd.Flags.Bool("password-stdin", false, "read the password from stdin instead of prompting")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) != 1 {
+			return usageErrorf("user reset-password needs exactly one email")
+		}
+
+		cfg, st, closeDB, err := env.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		queries := st.Auth
+		ctx := context.Background()
+
+		user, err := userByEmail(queries, ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		password, err := readPassword(env, *passwordStdin)
+		if err != nil {
+			return err
+		}
+
+		if err := validatePassword(cfg, password, user.Email); err != nil {
+			return err
+		}
+
+		hash, err := auth.HashPassword(cfg.Password, password)
+		if err != nil {
+			return err
+		}
+
+		err = st.WithTx(ctx, func(tx *store.Store) error {
+			_, err := tx.Auth.UserUpdatePassword(ctx, models.UserUpdatePasswordParams{
+				Password:  hash,
+				UpdatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+				ID:        user.ID,
+			})
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Auth.SessionUserDelete(ctx, user.ID); err != nil {
+				return err
+			}
+
+			return logAction(tx.Auth, ctx, "user", "update", user.ID)
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(env.Stdout, "Password of %s was reset\n", user.Email)
+		return nil
+	}
+
+	return cmd
 }
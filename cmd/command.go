@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/migrations"
+	"github.com/immanuel-254/blog/store"
+)
+
+// Exit codes of the command line, so scripts can tell a failure from a wrong invocation.
+const (
+	ExitOK    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// UsageError reports a command that was invoked wrongly.
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &UsageError{Message: fmt.Sprintf(format, args...)}
+}
+
+// Env is what every command runs with.
+type Env struct {
+	ConfigPath string
+	Stdin      io.Reader
+	Stdout     io.Writer
+	Stderr     io.Writer
+
+	cfg *config.Config
+}
+
+// Config loads the configuration the first time it is needed.
+func (env *Env) Config() (*config.Config, error) {
+	if env.cfg != nil {
+		return env.cfg, nil
+	}
+
+	cfg, err := config.Load(env.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	env.cfg = cfg
+	return cfg, nil
+}
+
+// ValidConfig loads the configuration and fails if it is not valid.
+func (env *Env) ValidConfig() (*config.Config, error) {
+	cfg, err := env.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// OpenDB connects to the configured database and makes sure its schema is current.
+// It returns the queries of every app on it, and a function closing the connection.
+func (env *Env) OpenDB() (*config.Config, *store.Store, func(), error) {
+	cfg, st, closeDB, err := env.openDB()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := migrations.Check(context.Background(), st.DB.Driver, st.DB.DB); err != nil {
+		closeDB()
+		if errors.Is(err, migrations.ErrSchemaBehind) {
+			return nil, nil, nil, fmt.Errorf("%w, run 'blog migrate up' first", err)
+		}
+		return nil, nil, nil, err
+	}
+
+	return cfg, st, closeDB, nil
+}
+
+// openDB connects to the configured database without touching its schema.
+func (env *Env) openDB() (*config.Config, *store.Store, func(), error) {
+	cfg, err := env.ValidConfig()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	db, err := database.Open(database.Driver(cfg.DBDriver), cfg.DB, cfg.SQLite)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+
+	if err := db.Verify(context.Background()); err != nil {
+		db.Close()
+		return nil, nil, nil, fmt.Errorf("the database does not run with the configured settings: %w", err)
+	}
+
+	return cfg, store.New(db), func() {
+		if err := db.Close(); err != nil {
+			fmt.Fprintln(env.Stderr, "Error closing database", err)
+		}
+	}, nil
+}
+
+// Command is a node of the command tree. Commands with subcommands only dispatch to them.
+type Command struct {
+	Name        string
+	Aliases     []string
+	Usage       string // arguments after the command path
+	Summary     string
+	Flags       *flag.FlagSet
+	Run         func(env *Env, args []string) error
+	Subcommands []*Command
+}
+
+func newCommand(name, usage, summary string) *Command {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard) // usage is printed by printHelp
+
+	return &Command{
+		Name:    name,
+		Usage:   usage,
+		Summary: summary,
+		Flags:   flags,
+	}
+}
+
+func (c *Command) find(name string) *Command {
+	for _, sub := range c.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+		for _, alias := range sub.Aliases {
+			if alias == name {
+				return sub
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Command) execute(env *Env, path []string, args []string) error {
+	path = append(path, c.Name)
+
+	if err := c.Flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			c.printHelp(env.Stdout, path)
+			return nil
+		}
+		return usageErrorf("%s: %v", strings.Join(path, " "), err)
+	}
+
+	args = c.Flags.Args()
+
+	if len(c.Subcommands) == 0 {
+		return c.Run(env, args)
+	}
+
+	if len(args) == 0 {
+		c.printHelp(env.Stderr, path)
+		return usageErrorf("%s: missing command", strings.Join(path, " "))
+	}
+
+	// "help a b" prints the help of the a b command
+	if args[0] == "help" {
+		target := c
+		for _, name := range args[1:] {
+			if target = target.find(name); target == nil {
+				return usageErrorf("%s: unknown command %q", strings.Join(path, " "), name)
+			}
+			path = append(path, target.Name)
+		}
+		target.printHelp(env.Stdout, path)
+		return nil
+	}
+
+	sub := c.find(args[0])
+	if sub == nil {
+		return usageErrorf("%s: unknown command %q", strings.Join(path, " "), args[0])
+	}
+
+	return sub.execute(env, path, args[1:])
+}
+
+func (c *Command) printHelp(w io.Writer, path []string) {
+	usage := c.Usage
+	if len(c.Subcommands) > 0 {
+		usage = "<command> " + usage
+	}
+
+	fmt.Fprintf(w, "Usage: %s %s\n\n%s\n", strings.Join(path, " "), strings.TrimSpace(usage), c.Summary)
+
+	if len(c.Subcommands) > 0 {
+		fmt.Fprintln(w, "\nCommands:")
+		for _, sub := range c.Subcommands {
+			fmt.Fprintf(w, "  %-16s %s\n", sub.Name, sub.Summary)
+		}
+	}
+
+	hasFlags := false
+	c.Flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+
+	if hasFlags {
+		fmt.Fprintln(w, "\nFlags:")
+		c.Flags.SetOutput(w)
+		c.Flags.PrintDefaults()
+		c.Flags.SetOutput(io.Discard)
+	}
+
+	if len(c.Subcommands) > 0 {
+		fmt.Fprintf(w, "\nRun '%s help <command>' for more information on a command.\n", strings.Join(path, " "))
+	}
+}
+
+// Root builds the command tree.
+func Root(env *Env) *Command {
+	root := newCommand("blog", "[flags]", "Blog server and administration tool.")
+	root.Flags.StringVar(&env.ConfigPath, "config", "", "YAML or TOML config file (default $CONFIG_FILE)")
+
+	root.Subcommands = []*Command{
+		serveCommand(),
+		configCommand(),
+		migrateCommand(),
+		createAdminCommand(),
+		userCommand(),
+		sessionCommand(),
+		tokenCommand(),
+		dbCommand(),
+		exportCommand(),
+		importCommand(),
+		openapiCommand(),
+	}
+
+	return root
+}
+
+// Execute runs the command line and returns the exit code.
+func Execute(args []string) int {
+	return run(&Env{
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}, args)
+}
+
+// run runs the command line in env and returns the exit code.
+func run(env *Env, args []string) int {
+	err := Root(env).execute(env, nil, args)
+	if err == nil {
+		return ExitOK
+	}
+
+	fmt.Fprintln(env.Stderr, "Error:", err)
+
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintln(env.Stderr, "Run 'blog --help' for usage.")
+		return ExitUsage
+	}
+
+	return ExitError
+}
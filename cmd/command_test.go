@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/config"
+)
+
+// testConfig returns the configuration of a command line on a scratch SQLite
+// database, hashing passwords cheaply.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.DB = filepath.Join(t.TempDir(), "blog.sqlite")
+	cfg.Password.Hasher = "bcrypt"
+	cfg.Password.BcryptCost = 4
+	return &cfg
+}
+
+// runCommand runs the command line with args on cfg, reading stdin, and returns
+// the exit code and what was written to stdout and stderr.
+func runCommand(cfg *config.Config, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(&Env{Stdin: strings.NewReader(stdin), Stdout: &stdout, Stderr: &stderr, cfg: cfg}, args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestHelp(t *testing.T) {
+	cfg := testConfig(t)
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--help"}, []string{"Usage: blog <command>", "Commands:", "migrate", "-config"}},
+		{[]string{"help", "user", "create"}, []string{"Usage: blog user create [flags]", "-password-stdin", "(default \"user\")"}},
+		{[]string{"token", "purge", "-h"}, []string{"pending email changes", "(default 24h0m0s)"}},
+		{[]string{"help", "token"}, []string{"cannot be purged", "purge"}},
+	}
+
+	for _, test := range tests {
+		code, stdout, stderr := runCommand(cfg, "", test.args...)
+		if code != ExitOK || stderr != "" {
+			t.Errorf("%v: exit %d, stderr %q", test.args, code, stderr)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(stdout, want) {
+				t.Errorf("%v: %q is not in\n%s", test.args, want, stdout)
+			}
+		}
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	cfg := testConfig(t)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "missing command"},
+		{[]string{"nope"}, `unknown command "nope"`},
+		{[]string{"help", "user", "nope"}, `unknown command "nope"`},
+		{[]string{"session", "purge", "--older-than", "soon"}, "invalid value"},
+		{[]string{"user", "create", "--unknown"}, "flag provided but not defined"},
+		{[]string{"token", "purge", "extra"}, "takes no arguments"},
+		{[]string{"user", "create", "--role", "owner"}, `unknown role "owner"`},
+	}
+
+	for _, test := range tests {
+		code, _, stderr := runCommand(cfg, "", test.args...)
+		if code != ExitUsage || !strings.Contains(stderr, test.want) || !strings.Contains(stderr, "blog --help") {
+			t.Errorf("%v: exit %d, stderr %q", test.args, code, stderr)
+		}
+	}
+}
+
+func TestUserCreateFromStdin(t *testing.T) {
+	cfg := testConfig(t)
+
+	// nothing runs on a schema that is behind
+	code, _, stderr := runCommand(cfg, "", "user", "list")
+	if code != ExitError || !strings.Contains(stderr, "blog migrate up") {
+		t.Errorf("before migrating: exit %d, stderr %q", code, stderr)
+	}
+	if code, _, stderr := runCommand(cfg, "", "migrate", "up"); code != ExitOK {
+		t.Fatalf("migrate up: exit %d, stderr %q", code, stderr)
+	}
+
+	// the email and the password are read as lines
+	code, stdout, stderr := runCommand(cfg, "writer@example.com\ncorrect horse battery staple\n", "user", "create", "--password-stdin", "--role", "staff")
+	if code != ExitOK || !strings.Contains(stdout, "Created staff writer@example.com") {
+		t.Fatalf("create: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+
+	code, stdout, _ = runCommand(cfg, "", "user", "list")
+	if code != ExitOK || !strings.Contains(stdout, "writer@example.com") || !strings.Contains(stdout, "staff") {
+		t.Errorf("list: exit %d\n%s", code, stdout)
+	}
+
+	tests := []struct {
+		name, stdin string
+		args        []string
+		code        int
+		want        string
+	}{
+		{"a taken email", "correct horse battery staple\n", []string{"--email", "writer@example.com"}, ExitError, "UNIQUE"},
+		{"a weak password", "password\n", []string{"--email", "weak@example.com"}, ExitError, "password does not meet policy"},
+		{"no password", "", []string{"--email", "empty@example.com"}, ExitError, "reading password from stdin"},
+		{"no email", "\n", nil, ExitUsage, "an email is required"},
+	}
+
+	for _, test := range tests {
+		args := append([]string{"user", "create", "--password-stdin"}, test.args...)
+		code, _, stderr := runCommand(cfg, test.stdin, args...)
+		if code != test.code || !strings.Contains(stderr, test.want) {
+			t.Errorf("%s: exit %d, stderr %q", test.name, code, stderr)
+		}
+	}
+}
+
+func TestTokenPurge(t *testing.T) {
+	cfg := testConfig(t)
+	if code, _, stderr := runCommand(cfg, "", "migrate", "up"); code != ExitOK {
+		t.Fatalf("migrate up: exit %d, stderr %q", code, stderr)
+	}
+	if code, _, stderr := runCommand(cfg, "correct horse battery staple\n", "user", "create", "--email", "writer@example.com", "--password-stdin"); code != ExitOK {
+		t.Fatalf("create: exit %d, stderr %q", code, stderr)
+	}
+
+	_, st, closeDB, err := (&Env{cfg: cfg}).OpenDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := st.Auth.UserEmailRead(context.Background(), "writer@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, age := range []time.Duration{time.Hour, 2 * 24 * time.Hour} {
+		_, err := st.Auth.EmailChangeCreate(context.Background(), models.EmailChangeCreateParams{
+			UserID:       user.ID,
+			NewEmail:     "new@example.com",
+			ConfirmToken: "confirm" + string(rune('a'+i)),
+			CancelToken:  "cancel" + string(rune('a'+i)),
+			CreatedAt:    sql.NullTime{Time: time.Now().Add(-age), Valid: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	closeDB()
+
+	// only the change older than a day has expired
+	code, stdout, stderr := runCommand(cfg, "", "token", "purge")
+	if code != ExitOK || !strings.Contains(stdout, "Deleted 1 expired email changes") {
+		t.Errorf("purge: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	code, stdout, _ = runCommand(cfg, "", "token", "purge", "--older-than", "30m")
+	if code != ExitOK || !strings.Contains(stdout, "Deleted 1 expired email changes") {
+		t.Errorf("purge --older-than 30m: exit %d, stdout %q", code, stdout)
+	}
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+)
+
+func configCommand() *Command {
+	cmd := newCommand("config", "", "Print the configuration with secrets hidden and check it is enough to run the server.")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) > 0 {
+			return usageErrorf("config takes no arguments")
+		}
+
+		cfg, err := env.Config()
+		if err != nil {
+			return err
+		}
+
+		out, err := cfg.YAML()
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(env.Stdout, out)
+
+		return cfg.ValidateServer()
+	}
+
+	return cmd
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/immanuel-254/blog/auth"
+	"github.com/immanuel-254/blog/media"
+)
+
+func exportCommand() *Command {
+	cmd := newCommand("export", "[flags] <email>", "Export everything stored about a user as a ZIP of JSON files and their uploads.")
+	out := cmd.Flags.String("out", "-", "file to write the ZIP to, - for stdout")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) != 1 {
+			return usageErrorf("export needs exactly one email")
+		}
+
+		cfg, st, closeDB, err := env.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		queries := st.Auth
+		ctx := context.Background()
+
+		user, err := userByEmail(queries, ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		files, err := auth.NewService(st, cfg, media.New(cfg.Media, cfg.Domain)).ExportFiles(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		var writer io.Writer = env.Stdout
+
+		if *out != "-" {
+			file, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := auth.WriteExport(writer, files); err != nil {
+			return err
+		}
+
+		if err := logAction(queries, ctx, "user", "export", user.ID); err != nil {
+			return err
+		}
+
+		if *out != "-" {
+			fmt.Fprintf(env.Stderr, "Exported %s to %s\n", user.Email, *out)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+func importCommand() *Command {
+	cmd := newCommand("import", "<file>", "Recreate a user and their content from a ZIP made by export.")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) != 1 {
+			return usageErrorf("import needs exactly one file")
+		}
+
+		cfg, st, closeDB, err := env.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		archive, err := zip.OpenReader(args[0])
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+
+		result, err := auth.NewService(st, cfg, media.New(cfg.Media, cfg.Domain)).ImportUser(context.Background(), &archive.Reader)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(env.Stdout, "Imported %s with id %d: %d blogs, %d comments", result.Email, result.UserID, result.Blogs, result.Comments)
+		if result.Profile {
+			fmt.Fprint(env.Stdout, " and the profile")
+		}
+		fmt.Fprintln(env.Stdout)
+
+		if result.Skipped > 0 {
+			fmt.Fprintf(env.Stdout, "Skipped %d comments on blogs of other users\n", result.Skipped)
+		}
+		fmt.Fprintf(env.Stdout, "Set a password with: blog user reset-password %s\n", result.Email)
+
+		return nil
+	}
+
+	return cmd
+}
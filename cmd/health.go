@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/immanuel-254/blog/apierror"
+	"github.com/immanuel-254/blog/metrics"
+	"github.com/immanuel-254/blog/migrations"
+)
+
+func writeHealth(w http.ResponseWriter, status int, data map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		slog.Error("failed to write response", "error", err)
+	}
+}
+
+// Healthz reports that the process is alive. It checks nothing else, so a slow
+// database never gets an otherwise healthy process restarted.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+// Readyz reports whether the server can handle traffic: the database answers,
+// its schema is current and emails can be sent. The response is public, so it
+// only says which checks fail, the reasons are logged.
+func (c *Container) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	ready := true
+	checks := map[string]string{}
+
+	check := func(name string, err error) {
+		if err != nil {
+			ready = false
+			checks[name] = "failing"
+			slog.WarnContext(ctx, "readiness check failed", "check", name, "error", err)
+			return
+		}
+		checks[name] = "ok"
+	}
+
+	check("database", c.Store.DB.PingContext(ctx))
+	check("migrations", c.checkMigrations(ctx))
+
+	var mailer error
+	if c.Config.ResendAPIKey == "" || c.Config.ResendEmail == "" {
+		mailer = errors.New("RESENDAPIKEY and RESENDEMAIL must be set")
+	}
+	check("mailer", mailer)
+
+	if !ready {
+		writeHealth(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "unavailable", "checks": checks})
+		return
+	}
+
+	writeHealth(w, http.StatusOK, map[string]interface{}{"status": "ok", "checks": checks})
+}
+
+// checkMigrations fails when the schema is behind this build. It reads the
+// version on the reader pool, so probes never queue behind writes.
+func (c *Container) checkMigrations(ctx context.Context) error {
+	db := c.Store.DB.Reader
+	if db == nil {
+		db = c.Store.DB.DB
+	}
+
+	current, latest, err := migrations.Versions(ctx, c.Store.DB.Driver, db)
+	if err != nil {
+		return err
+	}
+	if current < latest {
+		return fmt.Errorf("%w: it is at version %d, this build expects %d", migrations.ErrSchemaBehind, current, latest)
+	}
+	return nil
+}
+
+// Metrics serves the metrics to scrapers that send METRICS_TOKEN as a bearer
+// token, or to anyone when no token is set.
+func (c *Container) Metrics(w http.ResponseWriter, r *http.Request) {
+	if token := c.Config.Metrics.Token; token != "" {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			apierror.Write(w, r, apierror.Unauthorized("a valid metrics token is required"))
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	metrics.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/internal/testdb"
+	"github.com/immanuel-254/blog/migrations"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/store"
+)
+
+// readyz returns the status and checks of a readiness probe of a container on db.
+func readyz(t *testing.T, db *database.Database) (int, map[string]string, string) {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Domain = "https://example.com"
+	cfg.ResendAPIKey, cfg.ResendEmail = "re_key", "blog@example.com"
+
+	w := httptest.NewRecorder()
+	NewContainer(&cfg, store.New(db)).Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var body struct {
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, body.Checks, w.Body.String()
+}
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	Healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"ok"`) || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	status, checks, _ := readyz(t, testdb.New(t))
+	if status != http.StatusOK || checks["database"] != "ok" || checks["migrations"] != "ok" || checks["mailer"] != "ok" {
+		t.Errorf("a ready server: got %d %v", status, checks)
+	}
+
+	// a schema one migration behind
+	behind := testdb.Open(t)
+	provider, err := migrations.NewProvider(behind.Driver, behind.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := provider.ListSources()
+	if _, err := provider.UpTo(context.Background(), sources[len(sources)-2].Version); err != nil {
+		t.Fatal(err)
+	}
+	status, checks, _ = readyz(t, behind)
+	if status != http.StatusServiceUnavailable || checks["migrations"] != "failing" || checks["database"] != "ok" {
+		t.Errorf("pending migrations: got %d %v", status, checks)
+	}
+
+	closed := testdb.New(t)
+	closed.Close()
+	status, checks, body := readyz(t, closed)
+	if status != http.StatusServiceUnavailable || checks["database"] != "failing" {
+		t.Errorf("a closed database: got %d %v", status, checks)
+	}
+	// the reasons stay in the logs
+	if strings.Contains(body, "closed") || strings.Contains(body, "sql") {
+		t.Errorf("the response tells why: %s", body)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	cfg := config.Default()
+	cfg.Domain = "https://example.com"
+
+	scrape := func(addr, token, authorization string) *httptest.ResponseRecorder {
+		cfg.Metrics.Addr, cfg.Metrics.Token = addr, token
+
+		openapi.Default = openapi.NewRegistry()
+		mux := http.NewServeMux()
+		NewContainer(&cfg, &store.Store{}).Routes(mux)
+
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name, addr, token, authorization string
+		status                           int
+	}{
+		{"no token", "", "", "", http.StatusOK},
+		{"the token", "", "s3cret", "Bearer s3cret", http.StatusOK},
+		{"without the token", "", "s3cret", "", http.StatusUnauthorized},
+		{"a wrong token", "", "s3cret", "Bearer s3cre", http.StatusUnauthorized},
+		{"the token in another scheme", "", "s3cret", "Basic s3cret", http.StatusUnauthorized},
+		// only served on its own address
+		{"an address", "127.0.0.1:9090", "", "", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		w := scrape(test.addr, test.token, test.authorization)
+		if w.Code != test.status {
+			t.Errorf("%s: got %d %s", test.name, w.Code, w.Body)
+			continue
+		}
+		switch w.Code {
+		case http.StatusOK:
+			if !strings.Contains(w.Body.String(), "# TYPE http_requests_total counter") || w.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("%s: sent %v %s", test.name, w.Header(), w.Body)
+			}
+		case http.StatusUnauthorized:
+			if w.Header().Get("WWW-Authenticate") == "" || strings.Contains(w.Body.String(), "http_requests_total") {
+				t.Errorf("%s: sent %v %s", test.name, w.Header(), w.Body)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/immanuel-254/blog/auth"
+)
+
+// legacyDeprecated is when the unversioned routes were deprecated in favour of
+// APIPrefix.
+var legacyDeprecated = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// legacyViews keeps the routes served before the API was versioned working
+// during the transition: the current routes without the version prefix, and the
+// older /blog/read/{id} style routes.
+func (c *Container) legacyViews(v1 []auth.View, d auth.Deprecation) []auth.View {
+	legacy := auth.Aliases(v1, APIPrefix, d)
+
+	alias := func(route string, view auth.View) auth.View {
+		return auth.Alias(route, view, APIPrefix+view.Route, d)
+	}
+
+	legacy = append(legacy,
+		// the user routes took the user id from the query string
+		redirectUser("/read", c.UserRead(), d),
+		alias("/list", c.UserList()),
+		redirectUser("/isactive", c.IsActiveChange(), d),
+		redirectUser("/isstaff", c.IsStaffChange(), d),
+		alias("/session/list", c.SessionList()),
+		alias("/log/list", c.LogList()),
+
+		alias("/blog/create", c.Blog.BlogCreateView()),
+		alias("/blog/read/{id}", c.Blog.BlogReadView()),
+		alias("/blog/list", c.Blog.BlogListView()),
+		alias("/blog/update/{id}", c.Blog.BlogUpdateView()),
+		alias("/blog/delete/{id}", c.Blog.BlogDeleteView()),
+
+		alias("/category/create", c.Blog.CategoryCreateView()),
+		alias("/category/read/{id}", c.Blog.CategoryReadView()),
+		alias("/category/list", c.Blog.CategoryListView()),
+		alias("/category/update/{id}", c.Blog.CategoryUpdateView()),
+		alias("/category/delete/{id}", c.Blog.CategoryDeleteView()),
+
+		alias("/comment/create", c.Blog.CommentCreateView()),
+		alias("/comment/read/{id}", c.Blog.CommentReadView()),
+		alias("/comment/list", c.Blog.CommentListView()),
+		alias("/comment/update/{id}", c.Blog.CommentUpdateView()),
+		alias("/comment/delete/{id}", c.Blog.CommentDeleteView()),
+
+		alias("/profile/create/{$}", c.Blog.ProfileCreateView()),
+		alias("/profile/read/{id}", c.Blog.ProfileReadView()),
+		alias("/profile/list", c.Blog.ProfileListView()),
+		alias("/profile/update/{id}", c.Blog.ProfileUpdateView()),
+	)
+
+	return legacy
+}
+
+// redirectUser serves route with a permanent redirect to view, moving the user
+// query parameter into the {id} of its path. The redirect keeps the method and
+// body of the request.
+func redirectUser(route string, view auth.View, d auth.Deprecation) auth.View {
+	doc := view.Doc
+	doc.Query = []string{"user"}
+	doc.Request = nil
+	doc.Response = nil
+	doc.Status = http.StatusPermanentRedirect
+
+	return auth.View{
+		Route:       route,
+		Methods:     view.Methods,
+		Deprecation: &d,
+		Doc:         doc,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			user := query.Get("user")
+			query.Del("user")
+
+			target := APIPrefix + strings.Replace(view.Route, "{id}", url.PathEscape(user), 1)
+			if encoded := query.Encode(); encoded != "" {
+				target += "?" + encoded
+			}
+
+			http.Redirect(w, r, target, http.StatusPermanentRedirect)
+		}),
+	}
+}
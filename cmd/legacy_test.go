@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	authmodels "github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/internal/testdb"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/store"
+)
+
+// legacyAPI returns the routes of a container on a scratch database holding a
+// blog, whose id it returns too.
+func legacyAPI(t *testing.T, legacyRoutes bool, sunset string) (*http.ServeMux, int64) {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Domain = "https://example.com"
+	cfg.Media.Dir = t.TempDir()
+	cfg.API.LegacyRoutes, cfg.API.LegacySunset = legacyRoutes, sunset
+
+	st := store.New(testdb.New(t))
+	ctx := context.Background()
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	user, err := st.Auth.UserCreate(ctx, authmodels.UserCreateParams{Email: "jane@example.com", Password: "not a hash", CreatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := st.Blog.BlogCreate(ctx, models.BlogCreateParams{UserID: sql.NullInt64{Int64: user.ID, Valid: true}, Title: "Title", Body: "Body", CreatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openapi.Default = openapi.NewRegistry()
+	mux := http.NewServeMux()
+	NewContainer(&cfg, st).Routes(mux)
+	return mux, blog.ID
+}
+
+func get(mux *http.ServeMux, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestLegacyRoutes(t *testing.T) {
+	mux, id := legacyAPI(t, true, "2027-04-01")
+	blogID := strconv.FormatInt(id, 10)
+	deprecation := "@" + strconv.FormatInt(legacyDeprecated.Unix(), 10)
+
+	tests := []struct {
+		target, successor string
+	}{
+		// the current routes without the version prefix
+		{"/blogs", APIPrefix + "/blogs"},
+		{"/blogs/" + blogID, APIPrefix + "/blogs/" + blogID},
+		// the routes from before the API had resources
+		{"/blog/read/" + blogID, APIPrefix + "/blogs/" + blogID},
+		{"/blog/list", APIPrefix + "/blogs"},
+	}
+
+	for _, test := range tests {
+		w := get(mux, test.target)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got %d %s", test.target, w.Code, w.Body)
+		}
+		if got := w.Header().Get("Deprecation"); got != deprecation {
+			t.Errorf("%s: Deprecation %q, want %q", test.target, got, deprecation)
+		}
+		if got := w.Header().Get("Sunset"); got != "Thu, 01 Apr 2027 00:00:00 GMT" {
+			t.Errorf("%s: Sunset %q", test.target, got)
+		}
+		if got, want := w.Header().Get("Link"), "<"+test.successor+">; rel=\"successor-version\""; got != want {
+			t.Errorf("%s: Link %q, want %q", test.target, got, want)
+		}
+	}
+
+	// the user routes that took ?user= redirect to the versioned ones
+	w := get(mux, "/read?user=7&fields=email")
+	if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != APIPrefix+"/users/7?fields=email" || w.Header().Get("Deprecation") != deprecation {
+		t.Errorf("/read: got %d to %q, %v", w.Code, w.Header().Get("Location"), w.Header())
+	}
+
+	// the versioned routes are not deprecated
+	w = get(mux, APIPrefix+"/blogs/"+blogID)
+	if w.Code != http.StatusOK || w.Header().Get("Deprecation") != "" || w.Header().Get("Sunset") != "" || w.Header().Get("Link") != "" {
+		t.Errorf("%s/blogs: got %d %v", APIPrefix, w.Code, w.Header())
+	}
+}
+
+func TestLegacyRoutesWithoutSunset(t *testing.T) {
+	mux, _ := legacyAPI(t, true, "")
+
+	w := get(mux, "/blogs")
+	if w.Code != http.StatusOK || w.Header().Get("Deprecation") == "" || w.Header().Get("Sunset") != "" {
+		t.Errorf("got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestLegacyRoutesTurnedOff(t *testing.T) {
+	mux, id := legacyAPI(t, false, "")
+	blogID := strconv.FormatInt(id, 10)
+
+	for _, target := range []string{"/blogs", "/blogs/" + blogID, "/blog/read/" + blogID, "/blog/list", "/read?user=7", "/list"} {
+		if w := get(mux, target); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d %v", target, w.Code, w.Header())
+		}
+	}
+
+	if w := get(mux, APIPrefix+"/blogs/"+blogID); w.Code != http.StatusOK {
+		t.Errorf("%s/blogs: got %d %s", APIPrefix, w.Code, w.Body)
+	}
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/immanuel-254/blog/auth"
+	"github.com/immanuel-254/blog/config"
+)
+
+// setupLogger makes the configured logger the default of log/slog, which the
+// standard log package writes through as well.
+func setupLogger(cfg config.LogConfig, w io.Writer) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Format, "text") {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	slog.SetDefault(slog.New(auth.NewLogHandler(handler)))
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/immanuel-254/blog/auth"
+	"github.com/immanuel-254/blog/backup"
+	"github.com/immanuel-254/blog/database"
+)
+
+func sessionCommand() *Command {
+	cmd := newCommand("session", "", "Manage login sessions.")
+	cmd.Subcommands = []*Command{sessionPurgeCommand()}
+	return cmd
+}
+
+func sessionPurgeCommand() *Command {
+	cmd := newCommand("purge", "[flags]", "Delete expired sessions, or every session of one user.")
+	olderThan := cmd.Flags.Duration("older-than", auth.SessionMaxAge, "delete sessions created longer ago than this")
+	email := cmd.Flags.String("user", "", "delete every session of the user with this email instead")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) > 0 {
+			return usageErrorf("session purge takes no arguments")
+		}
+
+		_, st, closeDB, err := env.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		queries := st.Auth
+		ctx := context.Background()
+
+		if *email != "" {
+			user, err := userByEmail(queries, ctx, *email)
+			if err != nil {
+				return err
+			}
+
+			if err := queries.SessionUserDelete(ctx, user.ID); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(env.Stdout, "Deleted every session of %s\n", user.Email)
+			return nil
+		}
+
+		purged, err := queries.SessionPurge(ctx, sql.NullTime{Time: time.Now().Add(-*olderThan), Valid: true})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(env.Stdout, "Deleted %d sessions\n", purged)
+		return nil
+	}
+
+	return cmd
+}
+
+func tokenCommand() *Command {
+	cmd := newCommand("token", "", "Manage stored tokens. One-time tokens, such as password reset links, live in the memory of the server and cannot be purged.")
+	cmd.Subcommands = []*Command{tokenPurgeCommand()}
+	return cmd
+}
+
+func tokenPurgeCommand() *Command {
+	cmd := newCommand("purge", "[flags]", "Delete pending email changes whose confirmation and cancel links have expired.")
+	olderThan := cmd.Flags.Duration("older-than", auth.EmailChangeTTL, "delete pending email changes requested longer ago than this")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) > 0 {
+			return usageErrorf("token purge takes no arguments")
+		}
+
+		_, st, closeDB, err := env.OpenDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		purged, err := st.Auth.EmailChangePurge(context.Background(), sql.NullTime{Time: time.Now().Add(-*olderThan), Valid: true})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(env.Stdout, "Deleted %d expired email changes\n", purged)
+		return nil
+	}
+
+	return cmd
+}
+
+func dbCommand() *Command {
+	cmd := newCommand("db", "", "Back up and restore the database.")
+	cmd.Subcommands = []*Command{dbBackupCommand(), dbRestoreCommand()}
+	return cmd
+}
+
+func dbBackupCommand() *Command {
+	cmd := newCommand("backup", "[flags] [file]", "Write a consistent copy of the database while it is in use, by default a timestamped snapshot in BACKUP_DIR.")
+	dir := cmd.Flags.String("dir", "", "write the snapshot to this directory instead of BACKUP_DIR")
+	compress := cmd.Flags.Bool("gzip", false, "compress the snapshot, defaults to BACKUP_GZIP")
+	keep := cmd.Flags.Int("keep", 0, "snapshots to keep, defaults to BACKUP_KEEP, 0 keeps all")
+	maxAge := cmd.Flags.Duration("max-age", 0, "delete snapshots older than this, defaults to BACKUP_MAX_AGE")
+	force := cmd.Flags.Bool("force", false, "overwrite the file if it exists")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) > 1 {
+			return usageErrorf("db backup takes at most one file")
+		}
+
+		cfg, st, closeDB, err := env.openDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		if st.DB.Driver != database.SQLite {
+			return fmt.Errorf("db backup only supports SQLite, back up %s with its own tools such as pg_dump", st.DB.Driver)
+		}
+
+		ctx := context.Background()
+
+		// a file is written as given, compressed if it ends in .gz, and never pruned
+		if len(args) == 1 {
+			if _, err := os.Stat(args[0]); err == nil {
+				if !*force {
+					return fmt.Errorf("%s already exists, pass --force to overwrite it", args[0])
+				}
+				if err := os.Remove(args[0]); err != nil {
+					return err
+				}
+			}
+
+			if err := backup.Write(ctx, st.DB, args[0]); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(env.Stdout, "Backed up to %s\n", args[0])
+			return nil
+		}
+
+		opts := cfg.Backup
+		set := setFlags(cmd)
+		if set["dir"] {
+			opts.Dir = *dir
+		}
+		if set["gzip"] {
+			opts.Gzip = *compress
+		}
+		if set["keep"] {
+			opts.Keep = *keep
+		}
+		if set["max-age"] {
+			opts.MaxAge = *maxAge
+		}
+
+		path, err := backup.Take(ctx, st.DB, opts.Dir, opts.Gzip)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Stdout, "Backed up to %s\n", path)
+
+		pruned, err := backup.Prune(opts.Dir, opts.Keep, opts.MaxAge, time.Now())
+		for _, snapshot := range pruned {
+			fmt.Fprintf(env.Stdout, "Deleted %s\n", snapshot.Path)
+		}
+		return err
+	}
+
+	return cmd
+}
+
+// setFlags returns the flags of cmd given on the command line.
+func setFlags(cmd *Command) map[string]bool {
+	set := map[string]bool{}
+	cmd.Flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+func dbRestoreCommand() *Command {
+	cmd := newCommand("restore", "[flags] <file>", "Replace the database with a backup, plain or gzip compressed. Stop the server first.")
+	force := cmd.Flags.Bool("force", false, "replace the database if it exists")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) != 1 {
+			return usageErrorf("db restore needs exactly one file")
+		}
+
+		cfg, err := env.ValidConfig()
+		if err != nil {
+			return err
+		}
+		if database.Driver(cfg.DBDriver) != database.SQLite {
+			return fmt.Errorf("db restore only supports SQLite, restore %s with its own tools such as pg_restore", cfg.DBDriver)
+		}
+
+		if _, err := os.Stat(args[0]); err != nil {
+			return err
+		}
+		if _, err := os.Stat(cfg.DB); err == nil && !*force {
+			return fmt.Errorf("%s already exists, pass --force to replace it", cfg.DB)
+		}
+
+		result, err := backup.Restore(context.Background(), args[0], cfg.DB)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(env.Stdout, "Restored %s from %s, at schema version %d\n", cfg.DB, args[0], result.Version)
+		if result.Version < result.Latest {
+			fmt.Fprintf(env.Stdout, "This build expects version %d, run 'blog migrate up' before starting the server\n", result.Latest)
+		}
+		return nil
+	}
+
+	return cmd
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/migrations"
+	"github.com/pressly/goose/v3"
+)
+
+func printMigrationResults(w io.Writer, results ...*goose.MigrationResult) {
+	for _, result := range results {
+		fmt.Fprintf(w, "%-4s %s (%s)\n", result.Direction, result.Source.Path, result.Duration.Round(time.Millisecond))
+	}
+}
+
+// migrateUp applies every pending migration.
+func migrateUp(ctx context.Context, db *database.Database, w io.Writer) error {
+	provider, err := migrations.NewProvider(db.Driver, db.DB)
+	if err != nil {
+		return err
+	}
+
+	results, err := provider.Up(ctx)
+	printMigrationResults(w, results...)
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		fmt.Fprintln(w, "No pending migrations")
+	}
+	return nil
+}
+
+func migrateCommand() *Command {
+	cmd := newCommand("migrate", "", "Manage database migrations.")
+
+	cmd.Subcommands = []*Command{
+		migrateUpCommand(),
+		migrateDownCommand(),
+		migrateRedoCommand(),
+		migrateStatusCommand(),
+		migrateVersionCommand(),
+		migrateCreateCommand(),
+	}
+
+	return cmd
+}
+
+// migrateRun opens the database without checking its schema and runs fn with a provider.
+func migrateRun(env *Env, args []string, fn func(ctx context.Context, provider *goose.Provider) error) error {
+	if len(args) > 0 {
+		return usageErrorf("unexpected arguments %v", args)
+	}
+
+	_, st, closeDB, err := env.openDB()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	provider, err := migrations.NewProvider(st.DB.Driver, st.DB.DB)
+	if err != nil {
+		return err
+	}
+
+	return fn(context.Background(), provider)
+}
+
+func migrateUpCommand() *Command {
+	cmd := newCommand("up", "", "Apply all pending migrations.")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) > 0 {
+			return usageErrorf("migrate up takes no arguments")
+		}
+
+		_, st, closeDB, err := env.openDB()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		return migrateUp(context.Background(), st.DB, env.Stdout)
+	}
+
+	return cmd
+}
+
+func migrateDownCommand() *Command {
+	cmd := newCommand("down", "", "Roll back the most recently applied migration.")
+
+	cmd.Run = func(env *Env, args []string) error {
+		return migrateRun(env, args, func(ctx context.Context, provider *goose.Provider) error {
+			result, err := provider.Down(ctx)
+			if result != nil {
+				printMigrationResults(env.Stdout, result)
+			}
+			return err
+		})
+	}
+
+	return cmd
+}
+
+func migrateRedoCommand() *Command {
+	cmd := newCommand("redo", "", "Roll back the most recently applied migration and apply it again.")
+
+	cmd.Run = func(env *Env, args []string) error {
+		return migrateRun(env, args, func(ctx context.Context, provider *goose.Provider) error {
+			down, err := provider.Down(ctx)
+			if down != nil {
+				printMigrationResults(env.Stdout, down)
+			}
+			if err != nil {
+				return err
+			}
+
+			up, err := provider.ApplyVersion(ctx, down.Source.Version, true)
+			if up != nil {
+				printMigrationResults(env.Stdout, up)
+			}
+			return err
+		})
+	}
+
+	return cmd
+}
+
+func migrateStatusCommand() *Command {
+	cmd := newCommand("status", "", "Show which migrations are applied.")
+
+	cmd.Run = func(env *Env, args []string) error {
+		return migrateRun(env, args, func(ctx context.Context, provider *goose.Provider) error {
+			statuses, err := provider.Status(ctx)
+			if err != nil {
+				return err
+			}
+
+			writer := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(writer, "APPLIED AT\tMIGRATION")
+
+			for _, status := range statuses {
+				appliedAt := "pending"
+				if status.State == goose.StateApplied {
+					appliedAt = status.AppliedAt.Format(time.DateTime)
+				}
+				fmt.Fprintf(writer, "%s\t%s\n", appliedAt, status.Source.Path)
+			}
+
+			return writer.Flush()
+		})
+	}
+
+	return cmd
+}
+
+func migrateVersionCommand() *Command {
+	cmd := newCommand("version", "", "Print the schema version of the database and of this build.")
+
+	cmd.Run = func(env *Env, args []string) error {
+		return migrateRun(env, args, func(ctx context.Context, provider *goose.Provider) error {
+			current, target, err := provider.GetVersions(ctx)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(env.Stdout, "database: %d\nlatest:   %d\n", current, target)
+			return nil
+		})
+	}
+
+	return cmd
+}
+
+func migrateCreateCommand() *Command {
+	cmd := newCommand("create", "[flags] <name>", "Create a new empty SQL migration for every database engine in the source tree.")
+	dir := cmd.Flags.String("dir", "migrations", "directory of the migrations, with a subdirectory per engine")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) != 1 {
+			return usageErrorf("migrate create needs exactly one name")
+		}
+
+		// every engine gets the same version, so their histories stay in step
+		name := time.Now().UTC().Format("20060102150405") + "_" + strings.ToLower(args[0]) + ".sql"
+		for _, driver := range database.Drivers {
+			path := filepath.Join(*dir, string(driver), name)
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(file, migrationTemplate)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(env.Stdout, "Created %s\n", path)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+const migrationTemplate = `-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+`
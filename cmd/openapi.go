@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/immanuel-254/blog/auth"
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/openapi"
+	"github.com/immanuel-254/blog/store"
+)
+
+// apiVersion is the version of the API reported in the OpenAPI document.
+const apiVersion = "1.0.0"
+
+func (c *Container) OpenAPIView() auth.View {
+	return auth.View{
+		Route:   "/openapi.json",
+		Methods: []string{http.MethodGet},
+		Handler: http.HandlerFunc(c.OpenAPI),
+		Doc: openapi.Operation{
+			Summary: "Describe the API as an OpenAPI 3.1 document",
+			Tags:    []string{"Documentation"},
+		},
+	}
+}
+
+var DocsView = auth.View{
+	Route:   "/docs/",
+	Methods: []string{http.MethodGet},
+	Handler: http.StripPrefix("/docs", openapi.UIHandler("/openapi.json")),
+	Doc: openapi.Operation{
+		Summary: "Browse the API reference",
+		Tags:    []string{"Documentation"},
+	},
+}
+
+// apiInfo describes the API for the OpenAPI document.
+func apiInfo(cfg *config.Config) openapi.Info {
+	info := openapi.Info{
+		Title:   "Blog API",
+		Version: apiVersion,
+		SecuritySchemes: map[string]openapi.SecurityScheme{
+			"token": {
+				Type:        "apiKey",
+				In:          "header",
+				Name:        "auth",
+				Description: "The session token returned by /login",
+			},
+			"cookie": {
+				Type:        "apiKey",
+				In:          "cookie",
+				Name:        auth.SessionCookieName,
+				Description: "The session cookie set by /login when cookie is true, unsafe methods also need the " + auth.CSRFHeaderName + " header",
+			},
+		},
+	}
+	if cfg.Domain != "" {
+		info.Servers = []string{cfg.Domain}
+	}
+	return info
+}
+
+// OpenAPI serves the OpenAPI document of the registered routes. It is built on
+// the first request, once every route is registered.
+func (c *Container) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	c.openapiOnce.Do(func() {
+		doc, err := json.Marshal(openapi.Default.Document(apiInfo(c.Config)))
+		if err != nil {
+			panic(err) // the document only holds types that encode
+		}
+		c.openapiDocument = doc
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(c.openapiDocument); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+func openapiCommand() *Command {
+	cmd := newCommand("openapi", "", "Print the OpenAPI document of the API.")
+	check := cmd.Flags.Bool("check", false, "only check that every route is in the document, for CI")
+
+	cmd.Run = func(env *Env, args []string) error {
+		if len(args) > 0 {
+			return usageErrorf("openapi: unexpected argument %q", args[0])
+		}
+
+		cfg, err := env.Config()
+		if err != nil {
+			return err
+		}
+
+		// the views are only described, so they need no database
+		NewContainer(cfg, &store.Store{}).Routes(http.NewServeMux())
+		doc := openapi.Default.Document(apiInfo(cfg))
+
+		if err := openapi.Default.Check(doc); err != nil {
+			return err
+		}
+		if *check {
+			fmt.Fprintf(env.Stdout, "All %d routes are in the OpenAPI document\n", len(openapi.Default.Routes()))
+			return nil
+		}
+
+		encoder := json.NewEncoder(env.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(doc)
+	}
+
+	return cmd
+}
@@ -1,5 +1,112 @@
+// Package database connects to the database the apps run on, whichever engine
+// that is.
 package database
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 
-var DB *sql.DB
+	"github.com/immanuel-254/blog/config"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Driver names a supported database engine.
+type Driver string
+
+const (
+	SQLite   Driver = "sqlite"
+	Postgres Driver = "postgres"
+)
+
+// Drivers lists every supported engine.
+var Drivers = []Driver{SQLite, Postgres}
+
+// Database is the connection pool to a database and the engine it runs. The
+// generated queries run on it directly: on SQLite, statements that only read go
+// to the pool of Reader, anything else and every transaction to the single
+// connection of DB.
+type Database struct {
+	*sql.DB
+	Reader *sql.DB // nil when reads share DB
+	Driver Driver
+
+	sqlite config.SQLiteConfig
+}
+
+// Open connects to the database named by dsn, a file for SQLite and a connection
+// string for PostgreSQL. SQLite connections are tuned by the settings of sqlite.
+// The SQLite driver is registered by the main package.
+func Open(driver Driver, dsn string, sqlite config.SQLiteConfig) (*Database, error) {
+	switch driver {
+	case SQLite:
+		return openSQLite(dsn, sqlite)
+	case Postgres:
+		pgconfig, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return &Database{DB: sql.OpenDB(stdlib.GetConnector(*pgconfig)), Driver: driver}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// QueryContext runs query on the reader pool if it only reads.
+func (db *Database) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.pool(query).QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext runs query on the reader pool if it only reads.
+func (db *Database) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.pool(query).QueryRowContext(ctx, query, args...)
+}
+
+func (db *Database) pool(query string) *sql.DB {
+	if db.Reader != nil && readOnly(query) {
+		return db.Reader
+	}
+	return db.DB
+}
+
+// readOnly reports whether query is a SELECT, after the sqlc name comment. Writes
+// with RETURNING also run through QueryRowContext, so the statement decides.
+func readOnly(query string) bool {
+	for {
+		query = strings.TrimSpace(query)
+		if !strings.HasPrefix(query, "--") {
+			break
+		}
+		_, query, _ = strings.Cut(query, "\n")
+	}
+	fields := strings.Fields(query)
+	return len(fields) > 0 && strings.EqualFold(fields[0], "SELECT")
+}
+
+// Close closes the writer and the reader pool.
+func (db *Database) Close() error {
+	err := db.DB.Close()
+	if db.Reader != nil {
+		err = errors.Join(err, db.Reader.Close())
+	}
+	return err
+}
+
+// WithTx runs fn in a transaction, which is committed if fn returns nil and
+// rolled back otherwise.
+func (db *Database) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/immanuel-254/blog/config"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openTest opens a SQLite database in a scratch directory with cfg and closes it
+// when the test ends.
+func openTest(t *testing.T, cfg config.SQLiteConfig) *Database {
+	t.Helper()
+
+	db, err := Open(SQLite, filepath.Join(t.TempDir(), "test.sqlite"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	cfg := config.Default().SQLite
+	cfg.JournalMode, cfg.Synchronous, cfg.BusyTimeout, cfg.ForeignKeys = "wal", "normal", 2500*time.Millisecond, true
+
+	dsn := sqliteDSN("data/blog.sqlite?cache=shared&_journal_mode=delete&_foreign_keys=false", cfg, url.Values{"_txlock": {"immediate"}})
+
+	file, query, ok := strings.Cut(dsn, "?")
+	if !ok || file != "data/blog.sqlite" {
+		t.Fatalf("got %s", dsn)
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the settings win over the path, other parameters are kept
+	want := map[string]string{
+		"cache":         "shared",
+		"_journal_mode": "WAL",
+		"_synchronous":  "NORMAL",
+		"_busy_timeout": "2500",
+		"_foreign_keys": "true",
+		"_txlock":       "immediate",
+	}
+	for key, value := range want {
+		if got := params[key]; len(got) != 1 || got[0] != value {
+			t.Errorf("%s: got %v, want %s", key, got, value)
+		}
+	}
+	if len(params) != len(want) {
+		t.Errorf("got %v", params)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT 1", true},
+		{"  select id FROM users", true},
+		{"-- name: UserRead :one\nSELECT id FROM users WHERE id = ?", true},
+		{"-- name: A :one\n-- another comment\n\tSELECT 1", true},
+		{"-- name: UserCreate :one\nINSERT INTO users (email) VALUES (?) RETURNING id", false},
+		{"UPDATE users SET email = ? RETURNING id", false},
+		// a common table expression may hold a write, so WITH goes to the writer
+		{"WITH old AS (SELECT id FROM users) DELETE FROM users WHERE id IN old RETURNING id", false},
+		{"WITH ids AS (SELECT 1) SELECT * FROM ids", false},
+		{"-- name: Empty :exec", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := readOnly(test.query); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestSQLitePools(t *testing.T) {
+	cfg := config.Default().SQLite
+	cfg.MaxReaders = 3
+	db := openTest(t, cfg)
+	ctx := context.Background()
+
+	if db.Reader == nil || db.DB.Stats().MaxOpenConnections != 1 || db.Reader.Stats().MaxOpenConnections != 3 {
+		t.Fatalf("writer of %d connections, reader %v", db.DB.Stats().MaxOpenConnections, db.Reader)
+	}
+	if db.pool("-- name: A :one\nSELECT 1") != db.Reader || db.pool("WITH a AS (SELECT 1) SELECT * FROM a") != db.DB || db.pool("INSERT INTO a VALUES (1)") != db.DB {
+		t.Error("queries go to the wrong pool")
+	}
+
+	if _, err := db.ExecContext(ctx, "CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// writes that return rows run on the writer, whatever they start with
+	var id int64
+	for _, query := range []string{
+		"INSERT INTO notes (body) VALUES ('first') RETURNING id",
+		"WITH body AS (SELECT 'second' AS body) INSERT INTO notes (body) SELECT body FROM body RETURNING id",
+	} {
+		if err := db.QueryRowContext(ctx, query).Scan(&id); err != nil {
+			t.Errorf("%s: %v", query, err)
+		}
+	}
+
+	// reads see them from the reader pool
+	rows, err := db.QueryContext(ctx, "SELECT body FROM notes ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bodies []string
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, body)
+	}
+	rows.Close()
+	if strings.Join(bodies, ",") != "first,second" {
+		t.Errorf("read %v", bodies)
+	}
+	if db.Reader.Stats().OpenConnections == 0 {
+		t.Error("the reads did not use the reader pool")
+	}
+
+	// the readers refuse to write
+	if _, err := db.Reader.ExecContext(ctx, "INSERT INTO notes (body) VALUES ('third')"); err == nil || !strings.Contains(err.Error(), "readonly") {
+		t.Errorf("a write on a reader: %v", err)
+	}
+
+	// transactions run on the writer
+	err = db.WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO notes (body) VALUES ('third')")
+		return err
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	for _, journalMode := range []string{"wal", "delete"} {
+		cfg := config.Default().SQLite
+		cfg.JournalMode = journalMode
+		if err := openTest(t, cfg).Verify(ctx); err != nil {
+			t.Errorf("journal mode %s: %v", journalMode, err)
+		}
+	}
+
+	// settings the connections do not run with are reported for both pools
+	db := openTest(t, config.Default().SQLite)
+	db.sqlite.BusyTimeout += time.Second
+	db.sqlite.Synchronous = "extra"
+	err := db.Verify(ctx)
+	for _, want := range []string{"writer connection", "reader connection", "busy_timeout is", "synchronous is"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q is not in %v", want, err)
+		}
+	}
+
+	// a journal mode SQLite cannot switch to
+	cfg := config.Default().SQLite
+	cfg.JournalMode = "wal"
+	memory, err := Open(SQLite, ":memory:", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memory.Close()
+	if err := memory.Verify(ctx); err == nil || !strings.Contains(err.Error(), "journal_mode is memory, want wal") {
+		t.Errorf("an in-memory database in WAL mode: %v", err)
+	}
+
+	if err := (&Database{Driver: Postgres}).Verify(ctx); err != nil {
+		t.Errorf("PostgreSQL: %v", err)
+	}
+}
+
+func TestOpenUnsupported(t *testing.T) {
+	if _, err := Open("mysql", "blog", config.Default().SQLite); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/immanuel-254/blog/config"
+)
+
+// openSQLite opens the file at path twice: a single connection for writes, so
+// writers queue in the pool instead of failing with "database is locked", and a
+// pool of query only connections for reads. Both apply the pragmas of cfg to
+// every connection they open.
+func openSQLite(path string, cfg config.SQLiteConfig) (*Database, error) {
+	writer, err := sql.Open("sqlite3", sqliteDSN(path, cfg, url.Values{
+		// take the write lock when the transaction starts, rather than failing
+		// when a read transaction has to be upgraded
+		"_txlock": {"immediate"},
+	}))
+	if err != nil {
+		return nil, err
+	}
+	writer.SetMaxOpenConns(1)
+	writer.SetMaxIdleConns(1)
+	writer.SetConnMaxLifetime(0)
+
+	// the writer switches the file to the journal mode before a reader opens it
+	if err := writer.Ping(); err != nil {
+		writer.Close()
+		return nil, err
+	}
+
+	reader, err := sql.Open("sqlite3", sqliteDSN(path, cfg, url.Values{
+		"_query_only": {"true"},
+	}))
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	reader.SetMaxOpenConns(cfg.MaxReaders)
+	reader.SetMaxIdleConns(cfg.MaxReaders)
+
+	return &Database{DB: writer, Reader: reader, Driver: SQLite, sqlite: cfg}, nil
+}
+
+// sqliteDSN adds the pragmas of cfg and the extra parameters to path, over any
+// given in it.
+func sqliteDSN(path string, cfg config.SQLiteConfig, extra url.Values) string {
+	file, query, _ := strings.Cut(path, "?")
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		params = url.Values{}
+	}
+
+	params.Set("_journal_mode", strings.ToUpper(cfg.JournalMode))
+	params.Set("_synchronous", strings.ToUpper(cfg.Synchronous))
+	params.Set("_busy_timeout", strconv.FormatInt(cfg.BusyTimeout.Milliseconds(), 10))
+	params.Set("_foreign_keys", strconv.FormatBool(cfg.ForeignKeys))
+	for key, values := range extra {
+		params[key] = values
+	}
+
+	return file + "?" + params.Encode()
+}
+
+// synchronousLevels are the values PRAGMA synchronous reports for each setting.
+var synchronousLevels = map[string]int{"off": 0, "normal": 1, "full": 2, "extra": 3}
+
+// Verify checks that the connections to a SQLite database run with the
+// configured pragmas, which SQLite otherwise ignores silently, for example when
+// the journal mode cannot be changed. It does nothing on other engines.
+func (db *Database) Verify(ctx context.Context) error {
+	if db.Driver != SQLite {
+		return nil
+	}
+
+	var errs []error
+	for _, pool := range []struct {
+		name string
+		db   *sql.DB
+	}{{"writer", db.DB}, {"reader", db.Reader}} {
+		if err := verifySQLite(ctx, pool.db, db.sqlite); err != nil {
+			errs = append(errs, fmt.Errorf("%s connection: %w", pool.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func verifySQLite(ctx context.Context, db *sql.DB, cfg config.SQLiteConfig) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	pragma := func(name string, dest interface{}) error {
+		if err := conn.QueryRowContext(ctx, "PRAGMA "+name).Scan(dest); err != nil {
+			return fmt.Errorf("reading PRAGMA %s: %w", name, err)
+		}
+		return nil
+	}
+
+	var (
+		journalMode string
+		synchronous int
+		busyTimeout int64
+		foreignKeys bool
+	)
+	if err := errors.Join(
+		pragma("journal_mode", &journalMode),
+		pragma("synchronous", &synchronous),
+		pragma("busy_timeout", &busyTimeout),
+		pragma("foreign_keys", &foreignKeys),
+	); err != nil {
+		return err
+	}
+
+	var problems []string
+	if !strings.EqualFold(journalMode, cfg.JournalMode) {
+		problems = append(problems, fmt.Sprintf("journal_mode is %s, want %s", journalMode, strings.ToLower(cfg.JournalMode)))
+	}
+	if want := synchronousLevels[strings.ToLower(cfg.Synchronous)]; synchronous != want {
+		problems = append(problems, fmt.Sprintf("synchronous is %d, want %d (%s)", synchronous, want, strings.ToLower(cfg.Synchronous)))
+	}
+	if want := cfg.BusyTimeout.Milliseconds(); busyTimeout != want {
+		problems = append(problems, fmt.Sprintf("busy_timeout is %dms, want %dms", busyTimeout, want))
+	}
+	if foreignKeys != cfg.ForeignKeys {
+		problems = append(problems, fmt.Sprintf("foreign_keys is %t, want %t", foreignKeys, cfg.ForeignKeys))
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+// Package diff compares two texts line by line or word by word, and formats line
+// diffs in the unified format.
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Op is what an edit does to the old text.
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Edit is a run of text that both texts share, or that only one of them has.
+type Edit struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// maxEdits bounds the work of comparing two texts. Texts that differ by more are
+// reported as a deletion of the old text and an insertion of the new one.
+const maxEdits = 2000
+
+// Lines compares a and b line by line. Each edit holds one line, without its
+// line break.
+func Lines(a, b string) []Edit {
+	return compare(splitLines(a), splitLines(b))
+}
+
+var words = regexp.MustCompile(`\s+|[^\s]+`)
+
+// Words compares a and b word by word, keeping the white space between words, so
+// that joining the text of the edits that are not insertions gives back a, and of
+// those that are not deletions b. Consecutive edits of the same kind are merged.
+func Words(a, b string) []Edit {
+	edits := compare(words.FindAllString(a, -1), words.FindAllString(b, -1))
+
+	var merged []Edit
+	for _, edit := range edits {
+		if n := len(merged); n > 0 && merged[n-1].Op == edit.Op {
+			merged[n-1].Text += edit.Text
+			continue
+		}
+		merged = append(merged, edit)
+	}
+	return merged
+}
+
+// Unified formats the edits of Lines as a unified diff between the files named
+// from and to, with context unchanged lines around each change. It returns an
+// empty string when the texts are equal.
+func Unified(from, to string, edits []Edit, context int) string {
+	type line struct {
+		Edit
+		a, b int // lines of a and b before this one
+	}
+
+	lines := make([]line, len(edits))
+	a, b := 0, 0
+	var changes []int
+	for i, edit := range edits {
+		lines[i] = line{edit, a, b}
+		if edit.Op != Insert {
+			a++
+		}
+		if edit.Op != Delete {
+			b++
+		}
+		if edit.Op != Equal {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", from, to)
+
+	for i := 0; i < len(changes); {
+		start := max(changes[i]-context, 0)
+		end := changes[i] + 1
+		// changes closer than twice the context share a hunk
+		for i++; i < len(changes) && changes[i]-end < 2*context; i++ {
+			end = changes[i] + 1
+		}
+		end = min(end+context, len(lines))
+
+		hunk := lines[start:end]
+		var aCount, bCount int
+		for _, l := range hunk {
+			if l.Op != Insert {
+				aCount++
+			}
+			if l.Op != Delete {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(hunk[0].a, aCount), hunkRange(hunk[0].b, bCount))
+
+		for _, l := range hunk {
+			switch l.Op {
+			case Equal:
+				out.WriteString(" ")
+			case Insert:
+				out.WriteString("+")
+			case Delete:
+				out.WriteString("-")
+			}
+			out.WriteString(l.Text)
+			out.WriteString("\n")
+		}
+	}
+
+	return out.String()
+}
+
+// hunkRange formats the lines of a hunk starting after line start, which is
+// where an empty range sits.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// compare returns the edits that turn a into b.
+func compare(a, b []string) []Edit {
+	// the common prefix and suffix are left out of the search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var edits []Edit
+	for _, text := range a[:prefix] {
+		edits = append(edits, Edit{Equal, text})
+	}
+
+	middle, ok := myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	if !ok {
+		middle = nil
+		for _, text := range a[prefix : len(a)-suffix] {
+			middle = append(middle, Edit{Delete, text})
+		}
+		for _, text := range b[prefix : len(b)-suffix] {
+			middle = append(middle, Edit{Insert, text})
+		}
+	}
+	edits = append(edits, middle...)
+
+	for _, text := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Equal, text})
+	}
+	return edits
+}
+
+// myers finds the shortest edit script from a to b with the algorithm of Eugene
+// Myers, "An O(ND) Difference Algorithm and Its Variations". It gives up when the
+// script is longer than maxEdits.
+func myers(a, b []string) ([]Edit, bool) {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEdits)
+
+	// v[k+offset] is the furthest x reached on diagonal k, and trace[d] holds
+	// diagonals -d-1 to d+1 of v before step d
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // down: insert from b
+			} else {
+				x = v[offset+k-1] + 1 // right: delete from a
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// backtrack follows the trace of myers back from the end of both texts.
+func backtrack(a, b []string, trace [][]int) []Edit {
+	var edits []Edit
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, Edit{Equal, a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, Edit{Insert, b[prevY]})
+			} else {
+				edits = append(edits, Edit{Delete, a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
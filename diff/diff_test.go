@@ -0,0 +1,171 @@
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sides joins the text of the edits that are not insertions, and of those that
+// are not deletions, which gives back the two texts compared.
+func sides(edits []Edit, sep string) (string, string) {
+	var a, b []string
+	for _, edit := range edits {
+		if edit.Op != Insert {
+			a = append(a, edit.Text)
+		}
+		if edit.Op != Delete {
+			b = append(b, edit.Text)
+		}
+	}
+	return strings.Join(a, sep), strings.Join(b, sep)
+}
+
+func changes(edits []Edit) int {
+	n := 0
+	for _, edit := range edits {
+		if edit.Op != Equal {
+			n++
+		}
+	}
+	return n
+}
+
+// lcs returns the length of the longest common subsequence of a and b.
+func lcs(a, b []string) int {
+	row := make([]int, len(b)+1)
+	for i := range a {
+		prev := 0
+		for j := range b {
+			next := row[j+1]
+			if a[i] == b[j] {
+				row[j+1] = prev + 1
+			} else {
+				row[j+1] = max(row[j+1], row[j])
+			}
+			prev = next
+		}
+	}
+	return row[len(b)]
+}
+
+func TestLines(t *testing.T) {
+	got := Lines("a\nb\nc\n", "a\nc\nd")
+	want := []Edit{{Equal, "a"}, {Delete, "b"}, {Equal, "c"}, {Insert, "d"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := Lines("a\r\nb\r\n", "a\nb\n"); changes(got) != 0 {
+		t.Errorf("line endings: got %v", got)
+	}
+	if got := Lines("", "a"); !reflect.DeepEqual(got, []Edit{{Insert, "a"}}) {
+		t.Errorf("from nothing: got %v", got)
+	}
+	if got := Lines("", ""); len(got) != 0 {
+		t.Errorf("two empty texts: got %v", got)
+	}
+}
+
+func TestLinesAreShortest(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	text := func() []string {
+		lines := make([]string, random.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := text(), text()
+		edits := Lines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+
+		gotA, gotB := sides(edits, "\n")
+		if gotA != strings.Join(a, "\n") || gotB != strings.Join(b, "\n") {
+			t.Fatalf("%q to %q: the edits give %q and %q", a, b, gotA, gotB)
+		}
+		if got, want := changes(edits), len(a)+len(b)-2*lcs(a, b); got != want {
+			t.Fatalf("%q to %q: %d changes, the shortest script has %d", a, b, got, want)
+		}
+	}
+}
+
+func TestLinesGiveUpOnLargeChanges(t *testing.T) {
+	var a, b []string
+	for i := 0; i < maxEdits; i++ {
+		a = append(a, "old")
+		b = append(b, "new")
+	}
+	a = append([]string{"same"}, append(a, "end")...)
+	b = append([]string{"same"}, append(b, "end")...)
+
+	edits := Lines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+	if len(edits) != 2*maxEdits+2 || edits[0] != (Edit{Equal, "same"}) || edits[1].Op != Delete || edits[maxEdits+1].Op != Insert {
+		t.Fatalf("got %d edits starting with %v", len(edits), edits[:3])
+	}
+
+	gotA, gotB := sides(edits, "\n")
+	if gotA != strings.Join(a, "\n") || gotB != strings.Join(b, "\n") {
+		t.Error("the edits do not give back the texts")
+	}
+}
+
+func TestWords(t *testing.T) {
+	a := "the quick brown fox  jumps"
+	b := "the slow brown fox jumps high"
+
+	edits := Words(a, b)
+	want := []Edit{
+		{Equal, "the "},
+		{Delete, "quick"},
+		{Insert, "slow"},
+		{Equal, " brown fox"},
+		{Delete, "  "},
+		{Insert, " "},
+		{Equal, "jumps"},
+		{Insert, " high"},
+	}
+	if !reflect.DeepEqual(edits, want) {
+		t.Errorf("got %v, want %v", edits, want)
+	}
+
+	if gotA, gotB := sides(edits, ""); gotA != a || gotB != b {
+		t.Errorf("the edits give %q and %q", gotA, gotB)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n"
+
+	got := Unified("a/blog", "b/blog", Lines(a, b), 1)
+	want := `--- a/blog
++++ b/blog
+@@ -2,3 +2,3 @@
+ 2
+-3
++three
+ 4
+@@ -10,1 +10,2 @@
+ 10
++11
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// with more context the two changes share a hunk
+	if got := Unified("a", "b", Lines(a, b), 4); strings.Count(got, "@@ -") != 1 || !strings.Contains(got, "@@ -1,10 +1,11 @@") {
+		t.Errorf("one hunk: got\n%s", got)
+	}
+
+	if got := Unified("a", "b", Lines(a, a), 3); got != "" {
+		t.Errorf("equal texts: got %q", got)
+	}
+
+	if got := Unified("a", "b", Lines("", "new\n"), 3); got != "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+new\n" {
+		t.Errorf("from nothing: got %q", got)
+	}
+}
@@ -0,0 +1,49 @@
+// Package testdb gives the tests of the apps a scratch database, migrated like
+// the one the server runs on.
+package testdb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/migrations"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open opens a SQLite database in a scratch directory of t, with the default
+// settings, and closes it when the test ends.
+func Open(t testing.TB) *database.Database {
+	t.Helper()
+
+	db, err := database.Open(database.SQLite, filepath.Join(t.TempDir(), "test.sqlite"), config.Default().SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Migrate applies every migration to db.
+func Migrate(t testing.TB, db *database.Database) {
+	t.Helper()
+
+	provider, err := migrations.NewProvider(db.Driver, db.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+}
+
+// New returns a migrated scratch SQLite database.
+func New(t testing.TB) *database.Database {
+	t.Helper()
+
+	db := Open(t)
+	Migrate(t, db)
+	return db
+}
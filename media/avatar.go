@@ -0,0 +1,107 @@
+package media
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// AvatarSizes are the sides of the square copies of an avatar, the largest is
+// stored in place of the original.
+var AvatarSizes = []int{32, 64, 128, 256, 512}
+
+// Avatar crops the image in data to the square in its middle and scales it to
+// each of AvatarSizes. Only the copies are kept, not the uploaded image.
+func Avatar(data []byte, maxPixels int) (*Upload, error) {
+	contentType, err := sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("%w: %s is not an image", ErrUnsupported, contentType)
+	}
+
+	img, _, err := decode(data, maxPixels)
+	if err != nil {
+		return nil, err
+	}
+	crop := centerSquare(img.Bounds())
+
+	upload := &Upload{}
+	for i, size := range AvatarSizes {
+		// small images are enlarged too, so every size exists
+		v, err := variant(AvatarVariant(size), scale(img, crop, size))
+		if err != nil {
+			return nil, err
+		}
+		if i == len(AvatarSizes)-1 {
+			upload.ContentType, upload.Data = v.ContentType, v.Data
+			upload.Width, upload.Height = v.Width, v.Height
+			break
+		}
+		upload.Variants = append(upload.Variants, v)
+	}
+
+	return upload, nil
+}
+
+// AvatarVariant returns the name of the variant of an avatar of side size.
+func AvatarVariant(size int) string {
+	return fmt.Sprintf("s%d", size)
+}
+
+// GeneratedAvatar returns an SVG avatar of side size for those who uploaded
+// none: the initials of name on a colour picked by seed, or a symmetric pattern
+// in that colour when name has no letters or digits. The same seed and name
+// always give the same picture.
+func GeneratedAvatar(seed, name string, size int) []byte {
+	sum := sha256.Sum256([]byte(seed))
+	hue := (int(sum[0])<<8 | int(sum[1])) % 360
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 100 100">`, size, size)
+
+	if initials := initials(name); initials != "" {
+		fmt.Fprintf(&svg, `<rect width="100" height="100" fill="hsl(%d, 55%%, 45%%)"/>`, hue)
+		fmt.Fprintf(&svg, `<text x="50" y="50" dy=".35em" text-anchor="middle" font-family="sans-serif" font-size="42" fill="#fff">%s</text>`, html.EscapeString(initials))
+	} else {
+		// a 5 by 5 grid mirrored around its middle column, 10 units of margin
+		svg.WriteString(`<rect width="100" height="100" fill="#f0f0f0"/>`)
+		fmt.Fprintf(&svg, `<g fill="hsl(%d, 55%%, 45%%)">`, hue)
+		for row := 0; row < 5; row++ {
+			for col := 0; col < 3; col++ {
+				bit := row*3 + col
+				if sum[2+bit/8]&(1<<(bit%8)) == 0 {
+					continue
+				}
+				fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="16" height="16"/>`, 10+col*16, 10+row*16)
+				if col < 2 {
+					fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="16" height="16"/>`, 10+(4-col)*16, 10+row*16)
+				}
+			}
+		}
+		svg.WriteString(`</g>`)
+	}
+
+	svg.WriteString(`</svg>`)
+	return []byte(svg.String())
+}
+
+// initials returns the first letters or digits of the first two words of name,
+// in upper case.
+func initials(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var out []rune
+	for _, word := range words {
+		out = append(out, unicode.ToUpper([]rune(word)[0]))
+		if len(out) == 2 {
+			break
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,140 @@
+package media
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// stripes returns a PNG of three equal columns, blue, red and blue, each width
+// wide and height high.
+func stripes(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 3*width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < 3*width; x++ {
+			c := color.NRGBA{B: 0xFF, A: 0xFF}
+			if x >= width && x < 2*width {
+				c = color.NRGBA{R: 0xFF, A: 0xFF}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// isRed reports whether c is close to pure red, after lossy compression.
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xD000 && g < 0x3000 && b < 0x3000
+}
+
+func TestAvatar(t *testing.T) {
+	upload, err := Avatar(stripes(t, 100, 100), 1_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the largest size is the original, the others are its variants
+	copies := map[int][]byte{upload.Width: upload.Data}
+	if upload.Width != 512 || upload.Height != 512 {
+		t.Errorf("the original is %dx%d", upload.Width, upload.Height)
+	}
+	for _, v := range upload.Variants {
+		if v.Name != AvatarVariant(v.Width) || v.Width != v.Height || v.Size != len(v.Data) {
+			t.Errorf("variant %s is %dx%d of %d bytes", v.Name, v.Width, v.Height, v.Size)
+		}
+		copies[v.Width] = v.Data
+	}
+
+	for _, size := range AvatarSizes {
+		data, ok := copies[size]
+		if !ok {
+			t.Errorf("no copy %d pixels wide", size)
+			continue
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() != size || bounds.Dy() != size {
+			t.Errorf("size %d: decoded %v", size, bounds)
+		}
+		// the middle square is the red column, the blue ones are cut off
+		for _, p := range []image.Point{{1, 1}, {size / 2, size / 2}, {size - 2, size - 2}} {
+			if c := img.At(p.X, p.Y); !isRed(c) {
+				t.Errorf("size %d: %v is %v", size, p, c)
+			}
+		}
+	}
+}
+
+func TestAvatarRefuses(t *testing.T) {
+	if _, err := Avatar([]byte("%PDF-1.4\n"), 1_000_000); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("a PDF: %v", err)
+	}
+	if _, err := Avatar(stripes(t, 100, 100), 100*100); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("a large image: %v", err)
+	}
+}
+
+// svgText returns the text drawn by an SVG avatar, failing if it is not XML.
+func svgText(t *testing.T, svg []byte) string {
+	t.Helper()
+
+	var doc struct {
+		Text string `xml:"text"`
+	}
+	if err := xml.Unmarshal(svg, &doc); err != nil {
+		t.Fatalf("%s: %v", svg, err)
+	}
+	return doc.Text
+}
+
+func TestGeneratedAvatar(t *testing.T) {
+	first := GeneratedAvatar("42", "jane doe", 64)
+	if !bytes.Equal(first, GeneratedAvatar("42", "jane doe", 64)) {
+		t.Error("the same seed and name give different pictures")
+	}
+	if bytes.Equal(first, GeneratedAvatar("43", "jane doe", 64)) {
+		t.Error("another seed gives the same colour")
+	}
+	if !bytes.Contains(first, []byte(`width="64" height="64"`)) || svgText(t, first) != "JD" {
+		t.Errorf("got %s", first)
+	}
+
+	tests := []struct {
+		name, want string
+	}{
+		{`<script>alert("x")</script>`, "SA"},
+		{`"'><img src=x onerror=alert(1)>`, "IS"},
+		{"élodie & ömer", "ÉÖ"},
+		{"solo", "S"},
+	}
+	for _, test := range tests {
+		svg := GeneratedAvatar("42", test.name, 128)
+		if got := svgText(t, svg); got != test.want {
+			t.Errorf("%q: drew %q, want %q", test.name, got, test.want)
+		}
+		if strings.Contains(string(svg), "<script") || strings.Contains(string(svg), "<img") {
+			t.Errorf("%q: the name is in the picture: %s", test.name, svg)
+		}
+	}
+
+	// no letters give the pattern instead
+	pattern := GeneratedAvatar("42", "!!! ???", 32)
+	if svgText(t, pattern) != "" || !bytes.Contains(pattern, []byte("<g fill=")) {
+		t.Errorf("got %s", pattern)
+	}
+}
@@ -0,0 +1,303 @@
+// Package media checks and processes uploaded files and keeps them in a
+// Storage. Images and PDF files lose their metadata, and images gain a thumbnail
+// and smaller copies for responsive pages.
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"path"
+	"time"
+
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Types maps the content types accepted for uploads to the extension of their
+// files. The type is sniffed from the content, never taken from the client.
+var Types = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+var (
+	// ErrUnsupported is returned for files of a type missing from Types.
+	ErrUnsupported = errors.New("the file type is not supported")
+	// ErrInvalid is returned for files that are damaged or not of the type their
+	// first bytes claim.
+	ErrInvalid = errors.New("the file is damaged")
+	// ErrTooManyPixels is returned for images larger than the pixel limit.
+	ErrTooManyPixels = errors.New("the image has too many pixels")
+)
+
+const (
+	// ThumbnailSize is the side of the square thumbnail of an image.
+	ThumbnailSize = 320
+	jpegQuality   = 85
+)
+
+// Widths are the widths of the responsive copies of an image. Only those
+// narrower than the image are made.
+var Widths = []int{480, 960, 1920}
+
+// Variant is a copy of an image made for display.
+type Variant struct {
+	Name        string `json:"name"` // thumbnail, or w and the width such as w960
+	Key         string `json:"key"`
+	URL         string `json:"url,omitempty"` // filled in when the variant is sent to a client
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int    `json:"size"`
+	Data        []byte `json:"-"`
+}
+
+// Upload is a processed file ready to be saved.
+type Upload struct {
+	ContentType string
+	Data        []byte // the original, without its metadata
+	Width       int    // the dimensions of images, as displayed
+	Height      int
+	Variants    []Variant
+}
+
+// Process sniffs the type of data and prepares it for storage. Images of more
+// than maxPixels pixels are refused before they are decoded.
+func Process(data []byte, maxPixels int) (*Upload, error) {
+	contentType, err := sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	upload := &Upload{ContentType: contentType}
+	if contentType == "application/pdf" {
+		upload.Data, err = stripPDF(data)
+		return upload, err
+	}
+
+	img, orientation, err := decode(data, maxPixels)
+	if err != nil {
+		return nil, err
+	}
+
+	switch contentType {
+	case "image/jpeg":
+		// the orientation goes with the EXIF data, so turned photos are
+		// encoded again upright
+		if orientation != 1 {
+			upload.Data, err = encodeJPEG(img, 92)
+		} else {
+			upload.Data, err = stripJPEG(data)
+		}
+	case "image/png":
+		upload.Data, err = stripPNG(data)
+	case "image/webp":
+		upload.Data, err = stripWebP(data)
+	default:
+		// GIF has no EXIF, and is kept as is so animations survive
+		upload.Data = data
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	upload.Width, upload.Height = bounds.Dx(), bounds.Dy()
+
+	thumbnail, err := variant("thumbnail", cover(img, ThumbnailSize))
+	if err != nil {
+		return nil, err
+	}
+	upload.Variants = append(upload.Variants, thumbnail)
+
+	for _, width := range Widths {
+		if width >= upload.Width {
+			break
+		}
+		height := max(1, upload.Height*width/upload.Width)
+		resized, err := variant(fmt.Sprintf("w%d", width), resize(img, width, height))
+		if err != nil {
+			return nil, err
+		}
+		upload.Variants = append(upload.Variants, resized)
+	}
+
+	return upload, nil
+}
+
+// sniff returns the content type of data, when it is one of Types.
+func sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := Types[contentType]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, contentType)
+	}
+	return contentType, nil
+}
+
+// decode decodes the image in data, turned upright, and returns it with the
+// EXIF orientation it had. Images of more than maxPixels pixels are refused
+// before they are decoded.
+func decode(data []byte, maxPixels int) (image.Image, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, 0, fmt.Errorf("%w: %dx%d, at most %d pixels are allowed", ErrTooManyPixels, config.Width, config.Height, maxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	orientation := jpegOrientation(data)
+	if orientation != 1 {
+		img = orient(img, orientation)
+	}
+	return img, orientation, nil
+}
+
+// variant encodes img as a JPEG, or as a PNG when it has transparency.
+func variant(name string, img image.Image) (Variant, error) {
+	v := Variant{Name: name, Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+
+	var err error
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+		v.ContentType = "image/png"
+		var out bytes.Buffer
+		err = png.Encode(&out, img)
+		v.Data = out.Bytes()
+	} else {
+		v.ContentType = "image/jpeg"
+		v.Data, err = encodeJPEG(img, jpegQuality)
+	}
+
+	v.Size = len(v.Data)
+	return v, err
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var out bytes.Buffer
+	err := jpeg.Encode(&out, img, &jpeg.Options{Quality: quality})
+	return out.Bytes(), err
+}
+
+// resize scales img to width by height.
+func resize(img image.Image, width, height int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// cover scales img to fill a square of side size, cropping the middle of its
+// longer side. Images smaller than the square are not enlarged.
+func cover(img image.Image, size int) *image.NRGBA {
+	crop := centerSquare(img.Bounds())
+	return scale(img, crop, min(size, crop.Dx()))
+}
+
+// centerSquare returns the largest square in the middle of bounds.
+func centerSquare(bounds image.Rectangle) image.Rectangle {
+	side := min(bounds.Dx(), bounds.Dy())
+	return image.Rect(0, 0, side, side).Add(bounds.Min).Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+}
+
+// scale scales the part crop of img to a square of side size.
+func scale(img image.Image, crop image.Rectangle, size int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
+
+// orient turns img upright according to its EXIF orientation.
+func orient(img image.Image, orientation int) image.Image {
+	bounds := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // flipped horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // flipped vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counterclockwise
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
+
+// Save stores upload and its variants in a directory of their own, and returns
+// the key of the original and the stored variants. Nothing is left behind when
+// it fails.
+func Save(ctx context.Context, storage Storage, upload *Upload, now time.Time) (string, []Variant, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	dir := path.Join(now.UTC().Format("2006/01"), hex.EncodeToString(id))
+
+	key := path.Join(dir, "original"+Types[upload.ContentType])
+	if err := storage.Put(ctx, key, upload.Data, upload.ContentType); err != nil {
+		return "", nil, err
+	}
+
+	variants := make([]Variant, len(upload.Variants))
+	for i, v := range upload.Variants {
+		v.Key = path.Join(dir, v.Name+Types[v.ContentType])
+		if err := storage.Put(ctx, v.Key, v.Data, v.ContentType); err != nil {
+			Remove(context.WithoutCancel(ctx), storage, key, variants[:i])
+			return "", nil, err
+		}
+		v.Data = nil
+		variants[i] = v
+	}
+
+	return key, variants, nil
+}
+
+// Remove deletes a saved upload and its variants.
+func Remove(ctx context.Context, storage Storage, key string, variants []Variant) error {
+	var errs []error
+	for _, v := range variants {
+		errs = append(errs, storage.Delete(ctx, v.Key))
+	}
+	// the original goes last, so a failed removal can be tried again
+	errs = append(errs, storage.Delete(ctx, key))
+	return errors.Join(errs...)
+}
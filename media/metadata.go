@@ -0,0 +1,318 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"regexp"
+)
+
+// The metadata of an upload, such as where and with what a photo was taken, is
+// removed from the original without decoding it, so the image data is kept
+// bit for bit.
+
+// stripJPEG removes the APP1 segments, which hold EXIF and XMP, and the APP13
+// segments, which hold IPTC, from a JPEG file.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrInvalid
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+
+	i := 2
+	for {
+		if i+1 >= len(data) || data[i] != 0xFF {
+			return nil, ErrInvalid
+		}
+		// markers may be padded with any number of 0xFF
+		for i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+1 >= len(data) {
+			return nil, ErrInvalid
+		}
+		marker := data[i+1]
+
+		// the scan runs to the end of the image, markers inside it need no parsing
+		if marker == 0xDA || marker == 0xD9 {
+			return append(out, data[i:]...), nil
+		}
+		// markers without a length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return nil, ErrInvalid
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, ErrInvalid
+		}
+		if marker != 0xE1 && marker != 0xED {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG file, from 1 to 8, or 1
+// when it has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) {
+			break
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[i+4:end], []byte("Exif\x00\x00")) {
+			return exifOrientation(data[i+10 : end])
+		}
+		i = end
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag of the first IFD of a TIFF header.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + 12*n
+		if entry+12 > len(tiff) {
+			break
+		}
+		// a SHORT value sits at the start of the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+		}
+	}
+	return 1
+}
+
+// pngSignature starts every PNG file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// stripPNG removes the chunks of a PNG file that hold EXIF, text and the time
+// it was last changed.
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, ErrInvalid
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	for i := len(pngSignature); ; {
+		if i+8 > len(data) {
+			return nil, ErrInvalid
+		}
+		// length, type, data and CRC
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i+12 {
+			return nil, ErrInvalid
+		}
+
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out = append(out, data[i:end]...)
+		}
+
+		if string(data[i+4:i+8]) == "IEND" {
+			return out, nil
+		}
+		i = end
+	}
+}
+
+// stripWebP removes the EXIF and XMP chunks of a WebP file, and clears the flags
+// that announce them.
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrInvalid
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrInvalid
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		// chunks are padded to an even size
+		end := i + 8 + size + size%2
+		if end > len(data) || end < i+8 {
+			return nil, ErrInvalid
+		}
+
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04 // EXIF and XMP flags
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+var (
+	pdfInfoRef     = regexp.MustCompile(`/Info\s*(\d+)\s+(\d+)\s+R`)
+	pdfMetadataRef = regexp.MustCompile(`/Metadata\s*(\d+)\s+(\d+)\s+R`)
+)
+
+// stripPDF removes the document information dictionary of a PDF file, which
+// holds its author, title and the software that made it, and its XMP metadata.
+// Every object has to keep its offset for the cross-reference table, so nothing
+// is cut: the references to the metadata are overwritten with spaces, as are the
+// strings of the dictionary and the XMP streams stored uncompressed. Metadata in
+// compressed streams loses its references but stays in the file.
+func stripPDF(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, ErrInvalid
+	}
+
+	out := append([]byte(nil), data...)
+
+	// references sit in the trailers, including those of incremental updates
+	for _, ref := range pdfInfoRef.FindAllSubmatchIndex(data, -1) {
+		for _, object := range pdfObjects(data, data[ref[2]:ref[3]], data[ref[4]:ref[5]]) {
+			blankPDFStrings(out[object[0]:object[1]])
+		}
+		blank(out[ref[0]:ref[1]])
+	}
+	// and in the catalog, pages and images
+	for _, ref := range pdfMetadataRef.FindAllSubmatchIndex(data, -1) {
+		for _, object := range pdfObjects(data, data[ref[2]:ref[3]], data[ref[4]:ref[5]]) {
+			blankPDFStream(out[object[0]:object[1]])
+		}
+		blank(out[ref[0]:ref[1]])
+	}
+
+	return out, nil
+}
+
+// pdfObjects returns where every uncompressed definition of an object starts and
+// ends. Updates appended to a file may define it again.
+func pdfObjects(data, number, generation []byte) [][2]int {
+	start := regexp.MustCompile(`(?:^|\s)` + string(number) + `\s+` + string(generation) + `\s+obj\b`)
+
+	var objects [][2]int
+	for _, match := range start.FindAllIndex(data, -1) {
+		end := bytes.Index(data[match[1]:], []byte("endobj"))
+		if end < 0 {
+			continue
+		}
+		objects = append(objects, [2]int{match[1], match[1] + end})
+	}
+	return objects
+}
+
+// blankPDFStrings overwrites the content of the literal and hexadecimal strings
+// of a dictionary with spaces. Spaces are ignored in hexadecimal strings, which
+// become empty.
+func blankPDFStrings(object []byte) {
+	for i := 0; i < len(object); i++ {
+		switch {
+		case object[i] == '(':
+			// literal strings nest balanced parentheses and escape others
+			depth := 1
+			for i++; i < len(object) && depth > 0; i++ {
+				switch object[i] {
+				case '\\':
+					object[i] = ' '
+					if i+1 < len(object) {
+						i++
+					}
+				case '(':
+					depth++
+				case ')':
+					depth--
+				}
+				if depth > 0 {
+					object[i] = ' '
+				}
+			}
+			i--
+		case object[i] == '<' && i+1 < len(object) && object[i+1] == '<':
+			i++
+		case object[i] == '<':
+			for i++; i < len(object) && object[i] != '>'; i++ {
+				object[i] = ' '
+			}
+		}
+	}
+}
+
+// blankPDFStream overwrites the content of an uncompressed stream with spaces,
+// which leaves an XMP stream empty of metadata. Compressed ones are kept, as
+// spaces would not decode.
+func blankPDFStream(object []byte) {
+	start := bytes.Index(object, []byte("stream"))
+	end := bytes.LastIndex(object, []byte("endstream"))
+	if start < 0 || end < start || bytes.Contains(object[:start], []byte("/Filter")) {
+		return
+	}
+
+	// the line break after the keyword belongs to it
+	start += len("stream")
+	if bytes.HasPrefix(object[start:], []byte("\r\n")) {
+		start += 2
+	} else if bytes.HasPrefix(object[start:], []byte("\n")) {
+		start++
+	}
+	// and so does the one before endstream
+	if bytes.HasSuffix(object[:end], []byte("\n")) {
+		end--
+	}
+	if bytes.HasSuffix(object[:end], []byte("\r")) {
+		end--
+	}
+	if start < end {
+		blank(object[start:end])
+	}
+}
+
+func blank(data []byte) {
+	for i := range data {
+		data[i] = ' '
+	}
+}
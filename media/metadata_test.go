@@ -0,0 +1,308 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testImage returns a width by height image, red on the left half and white on
+// the right.
+func testImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.NRGBA{R: 0xFF, A: 0xFF})
+			} else {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	return img
+}
+
+// exifSegment returns an APP1 segment with the EXIF orientation and a camera
+// name after the first IFD.
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("MM\x00*\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, "Secret Camera"...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// testJPEG returns a JPEG with EXIF and IPTC segments after its start marker.
+func testJPEG(t *testing.T, width, height int, orientation uint16) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testImage(width, height), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	iptc := []byte{0xFF, 0xED, 0x00, 0x0F}
+	iptc = append(iptc, "Photoshop 3.0"...)
+
+	data := append([]byte{0xFF, 0xD8}, exifSegment(orientation)...)
+	data = append(data, iptc...)
+	return append(data, encoded.Bytes()[2:]...)
+}
+
+func TestStripJPEG(t *testing.T) {
+	data := testJPEG(t, 8, 4, 1)
+
+	stripped, err := stripJPEG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("Secret Camera")) || bytes.Contains(stripped, []byte("Photoshop")) {
+		t.Error("the metadata is still there")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("the stripped file does not decode: %v", err)
+	}
+
+	for _, bad := range [][]byte{nil, []byte("GIF89a"), data[:len(data)/8]} {
+		if _, err := stripJPEG(bad); err != ErrInvalid {
+			t.Errorf("%d bytes: got %v", len(bad), err)
+		}
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	for orientation := uint16(1); orientation <= 8; orientation++ {
+		if got := jpegOrientation(testJPEG(t, 2, 2, orientation)); got != int(orientation) {
+			t.Errorf("got %d, want %d", got, orientation)
+		}
+	}
+	if got := jpegOrientation(testJPEG(t, 2, 2, 9)); got != 1 {
+		t.Errorf("out of range: got %d", got)
+	}
+}
+
+func TestProcessTurnsPhotosUpright(t *testing.T) {
+	// the left of a photo turned 90° clockwise is shown at the top
+	upload, err := Process(testJPEG(t, 32, 16, 6), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Width != 16 || upload.Height != 32 {
+		t.Errorf("got %dx%d, want 16x32", upload.Width, upload.Height)
+	}
+	if bytes.Contains(upload.Data, []byte("Secret Camera")) || jpegOrientation(upload.Data) != 1 {
+		t.Error("the metadata is still there")
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(upload.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, bottom := color.NRGBAModel.Convert(img.At(8, 4)).(color.NRGBA), color.NRGBAModel.Convert(img.At(8, 28)).(color.NRGBA)
+	if top.G > 0x40 || bottom.G < 0xC0 {
+		t.Errorf("the top is %v and the bottom %v, want red above white", top, bottom)
+	}
+
+	if _, err := Process(testJPEG(t, 40, 40, 1), 1000); err == nil {
+		t.Error("an image of too many pixels was processed")
+	}
+}
+
+// pngChunk returns a chunk of a PNG file with its CRC.
+func pngChunk(kind, data string) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, kind+data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE([]byte(kind+data)))
+}
+
+func TestStripPNG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage(3, 3)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the metadata goes before the image data
+	data := encoded.Bytes()
+	ihdrEnd := len(pngSignature) + 25
+	withMetadata := append([]byte(nil), data[:ihdrEnd]...)
+	withMetadata = append(withMetadata, pngChunk("tEXt", "Author\x00Jane Doe")...)
+	withMetadata = append(withMetadata, pngChunk("eXIf", "MM\x00*Secret Camera")...)
+	withMetadata = append(withMetadata, pngChunk("tIME", "\x07\xea\x0a\x13\x0c\x00\x00")...)
+	withMetadata = append(withMetadata, data[ihdrEnd:]...)
+
+	stripped, err := stripPNG(withMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, data) {
+		t.Errorf("got %d bytes, want the %d bytes of the file without metadata", len(stripped), len(data))
+	}
+
+	if _, err := stripPNG(data[:len(data)-4]); err != ErrInvalid {
+		t.Errorf("a truncated file: got %v", err)
+	}
+}
+
+// webpChunk returns a chunk of a WebP file, padded to an even size.
+func webpChunk(kind, data string) []byte {
+	chunk := append([]byte(kind), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func TestStripWebP(t *testing.T) {
+	// VP8X with the alpha, EXIF and XMP flags, and a 1x1 canvas
+	vp8x := "\x1c\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+
+	var chunks []byte
+	chunks = append(chunks, webpChunk("VP8X", vp8x)...)
+	chunks = append(chunks, webpChunk("VP8L", "image")...)
+	chunks = append(chunks, webpChunk("EXIF", "Secret Camera")...)
+	chunks = append(chunks, webpChunk("XMP ", "<x:xmpmeta/>")...)
+
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(chunks)+4))...)
+	data = append(data, "WEBP"...)
+	data = append(data, chunks...)
+
+	stripped, err := stripWebP(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := append([]byte("WEBP"), webpChunk("VP8X", "\x10"+vp8x[1:])...)
+	want = append(want, webpChunk("VP8L", "image")...)
+	want = append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(want)))...), want...)
+	if !bytes.Equal(stripped, want) {
+		t.Errorf("got %q, want %q", stripped, want)
+	}
+
+	if _, err := stripWebP(data[:len(data)-1]); err != ErrInvalid {
+		t.Errorf("a truncated file: got %v", err)
+	}
+}
+
+// testPDF returns a PDF file of the objects, numbered from 1, with a correct
+// cross-reference table and the trailer entries.
+func testPDF(trailer string, objects ...string) []byte {
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R %s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+	return out.Bytes()
+}
+
+// checkXref fails unless every offset in the cross-reference table of data
+// still points at its object.
+func checkXref(t *testing.T, data []byte) {
+	t.Helper()
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data, -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Errorf("object %d is no longer at %d", i+1, offset)
+		}
+	}
+}
+
+func TestStripPDF(t *testing.T) {
+	xmp := "<?xpacket begin=''?><x:xmpmeta><dc:creator>Jane Doe</dc:creator></x:xmpmeta><?xpacket end='w'?>"
+	data := testPDF("/Info 3 0 R",
+		"<< /Type /Catalog /Pages 2 0 R /Metadata 4 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		`<< /Author (Jane \(J\) Doe) /Title (Notes (upstream)) /Producer <4A616E65> /CreationDate (D:20261019) >>`,
+		fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n%s\nendstream", len(xmp), xmp),
+	)
+
+	stripped, err := stripPDF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stripped) != len(data) {
+		t.Fatalf("got %d bytes, want %d", len(stripped), len(data))
+	}
+	checkXref(t, stripped)
+
+	for _, gone := range []string{"Jane", "Doe", "upstream", "4A616E65", "D:2026", "/Info", "/Metadata 4"} {
+		if bytes.Contains(stripped, []byte(gone)) {
+			t.Errorf("%s is still there", gone)
+		}
+	}
+	for _, kept := range []string{"/Root 1 0 R", "/Pages 2 0 R", "/Title (", "/Producer <", "stream\n", "\nendstream", "/Length"} {
+		if !bytes.Contains(stripped, []byte(kept)) {
+			t.Errorf("%s is gone", kept)
+		}
+	}
+
+	if _, err := stripPDF([]byte("not a PDF")); err != ErrInvalid {
+		t.Errorf("not a PDF: got %v", err)
+	}
+}
+
+func TestStripPDFKeepsCompressedStreams(t *testing.T) {
+	data := testPDF("/Info 3 0 R",
+		"<< /Type /Catalog /Pages 2 0 R /Metadata 3 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"<< /Type /Metadata /Subtype /XML /Filter /FlateDecode /Length 4 >>\nstream\n\x78\x9c\x03\x00\nendstream",
+	)
+
+	stripped, err := stripPDF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkXref(t, stripped)
+
+	// the stream could not be read with spaces in it, so only its references go
+	if !bytes.Contains(stripped, []byte("stream\n\x78\x9c\x03\x00\nendstream")) {
+		t.Error("the compressed stream was changed")
+	}
+	if bytes.Contains(stripped, []byte("/Metadata 3")) || bytes.Contains(stripped, []byte("/Info")) {
+		t.Error("the references are still there")
+	}
+	if !strings.HasPrefix(string(stripped), "%PDF-1.7") {
+		t.Error("the header is gone")
+	}
+}
+
+func TestProcessStripsPDF(t *testing.T) {
+	data := testPDF("/Info 2 0 R", "<< /Type /Catalog >>", "<< /Author (Jane Doe) >>")
+
+	upload, err := Process(data, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.ContentType != "application/pdf" || bytes.Contains(upload.Data, []byte("Jane")) || len(upload.Variants) != 0 {
+		t.Errorf("got %s with %d variants: %q", upload.ContentType, len(upload.Variants), upload.Data)
+	}
+}
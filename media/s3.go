@@ -0,0 +1,219 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/immanuel-254/blog/config"
+)
+
+// S3 keeps files in a bucket of Amazon S3, or of any server that speaks its API
+// such as MinIO, signing requests with AWS Signature Version 4.
+type S3 struct {
+	Config  config.S3Config
+	BaseURL string       // URL the bucket is served at, the object URLs of the endpoint when empty
+	Client  *http.Client // http.DefaultClient when nil
+}
+
+func NewS3(cfg config.S3Config, baseURL string) *S3 {
+	return &S3{Config: cfg, BaseURL: baseURL}
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Cache-Control", cacheControl)
+
+	resp, err := s.do(ctx, http.MethodPut, key, data, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) URL(key string) string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/") + "/" + key
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// objectURL returns the URL of the object under key, with the bucket in the path
+// or in the host name.
+func (s *S3) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(s.Config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	object := key
+	if s.Config.PathStyle {
+		object = s.Config.Bucket + "/" + key
+	} else {
+		u.Host = s.Config.Bucket + "." + u.Host
+	}
+
+	u.Path = path.Join("/", u.Path, object)
+	u.RawPath = uriEncode(u.Path)
+	return u, nil
+}
+
+// s3Error is the body of a failed request.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a signed request for the object under key. Responses other than 2xx
+// are returned as errors, wrapping ErrNotExist for missing objects.
+func (s *S3) do(ctx context.Context, method, key string, body []byte, header http.Header) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	s.sign(req, body, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var failure s3Error
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&failure)
+	if failure.Code == "" {
+		failure.Code = resp.Status
+	}
+
+	err = fmt.Errorf("s3 %s %s: %s %s", method, key, failure.Code, failure.Message)
+	if resp.StatusCode == http.StatusNotFound {
+		err = fmt.Errorf("%w: %w", ErrNotExist, err)
+	}
+	return nil, err
+}
+
+// sign adds the headers of AWS Signature Version 4 to req, whose body is body.
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	stamp := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// the host and every x-amz- header are signed
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if name = strings.ToLower(name); strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Config.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.Config.SecretKey)
+	for _, part := range []string{date, s.Config.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.Config.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode escapes every byte of the path s but slashes and the unreserved
+// characters of RFC 3986, as signatures expect.
+func uriEncode(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			out.WriteByte(c)
+		default:
+			fmt.Fprintf(&out, "%%%02X", c)
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,258 @@
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/immanuel-254/blog/config"
+)
+
+// s3Object is a file kept by the stand-in.
+type s3Object struct {
+	data         []byte
+	contentType  string
+	cacheControl string
+}
+
+// s3StandIn answers the object requests of the S3 API for a single bucket, as
+// S3 does, after checking their signatures.
+type s3StandIn struct {
+	bucket, region, accessKey, secretKey string
+
+	mu      sync.Mutex
+	objects map[string]s3Object
+}
+
+func (s *s3StandIn) fail(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if problem := s.checkSignature(r, body); problem != "" {
+		s.fail(w, http.StatusForbidden, "SignatureDoesNotMatch", problem)
+		return
+	}
+
+	// the bucket is either the first label of the host or the first directory
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+s.bucket+"/")
+	if strings.HasPrefix(r.Host, s.bucket+".") {
+		key, ok = strings.TrimPrefix(r.URL.Path, "/"), true
+	}
+	if !ok || key == "" {
+		s.fail(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = s3Object{data: body, contentType: r.Header.Get("Content-Type"), cacheControl: r.Header.Get("Cache-Control")}
+	case http.MethodGet:
+		object, ok := s.objects[key]
+		if !ok {
+			s.fail(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Write(object.data)
+	case http.MethodDelete:
+		// deleting a missing key succeeds
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// checkSignature works out the AWS Signature Version 4 of r from what was sent,
+// and returns why it does not match the one in the Authorization header.
+func (s *s3StandIn) checkSignature(r *http.Request, body []byte) string {
+	auth := r.Header.Get("Authorization")
+	var credential, signedHeaders, signature string
+	if _, err := fmt.Sscanf(strings.ReplaceAll(auth, ",", ""), "AWS4-HMAC-SHA256 Credential=%s SignedHeaders=%s Signature=%s", &credential, &signedHeaders, &signature); err != nil {
+		return "malformed Authorization header " + auth
+	}
+
+	payload := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(payload[:]) {
+		return "the body does not match its hash"
+	}
+
+	stamp := r.Header.Get("X-Amz-Date")
+	if len(stamp) != len("20060102T150405Z") {
+		return "missing X-Amz-Date"
+	}
+	scope := stamp[:8] + "/" + s.region + "/s3/aws4_request"
+	if credential != s.accessKey+"/"+scope {
+		return "unexpected credential " + credential
+	}
+
+	names := strings.Split(signedHeaders, ";")
+	if !sort.StringsAreSorted(names) {
+		return "the signed headers are not sorted"
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+
+	path, query, _ := strings.Cut(r.RequestURI, "?")
+	canonicalRequest := strings.Join([]string{r.Method, path, query, canonicalHeaders.String(), signedHeaders, hex.EncodeToString(payload[:])}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{stamp[:8], s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	if want := hex.EncodeToString(hmacSHA256(key, "AWS4-HMAC-SHA256\n"+stamp+"\n"+scope+"\n"+hex.EncodeToString(requestHash[:]))); signature != want {
+		return "the signature of " + canonicalRequest + " does not match"
+	}
+	return ""
+}
+
+// newS3 returns an S3 storage and the stand-in behind it. Requests for any host
+// reach the stand-in, so the bucket can be in the host name.
+func newS3(t *testing.T, pathStyle bool) (*S3, *s3StandIn) {
+	t.Helper()
+
+	standIn := &s3StandIn{bucket: "uploads", region: "eu-west-1", accessKey: "AKIDEXAMPLE", secretKey: "secret", objects: map[string]s3Object{}}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}
+
+	storage := NewS3(config.S3Config{
+		Endpoint:  server.URL,
+		Region:    standIn.region,
+		Bucket:    standIn.bucket,
+		AccessKey: standIn.accessKey,
+		SecretKey: standIn.secretKey,
+		PathStyle: pathStyle,
+	}, "")
+	storage.Client = client
+	return storage, standIn
+}
+
+func TestS3(t *testing.T) {
+	for _, pathStyle := range []bool{true, false} {
+		storage, standIn := newS3(t, pathStyle)
+		ctx := context.Background()
+		key := "2026/10/8c1f0e5b/a file+name (1).jpg"
+
+		if err := storage.Put(ctx, key, []byte("image data"), "image/jpeg"); err != nil {
+			t.Fatalf("path style %v: put: %v", pathStyle, err)
+		}
+		object := standIn.objects[key]
+		if string(object.data) != "image data" || object.contentType != "image/jpeg" || object.cacheControl != cacheControl {
+			t.Errorf("path style %v: stored %+v", pathStyle, object)
+		}
+
+		file, err := storage.Open(ctx, key)
+		if err != nil {
+			t.Fatalf("path style %v: open: %v", pathStyle, err)
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil || string(data) != "image data" {
+			t.Errorf("path style %v: read %q, %v", pathStyle, data, err)
+		}
+
+		if err := storage.Delete(ctx, key); err != nil {
+			t.Errorf("path style %v: delete: %v", pathStyle, err)
+		}
+		if err := storage.Delete(ctx, key); err != nil {
+			t.Errorf("path style %v: delete a missing key: %v", pathStyle, err)
+		}
+
+		_, err = storage.Open(ctx, key)
+		if !errors.Is(err, ErrNotExist) || !strings.Contains(err.Error(), "NoSuchKey") {
+			t.Errorf("path style %v: open a deleted key: %v", pathStyle, err)
+		}
+	}
+}
+
+func TestS3ReportsFailures(t *testing.T) {
+	storage, _ := newS3(t, true)
+	storage.Config.SecretKey = "wrong"
+
+	err := storage.Put(context.Background(), "key.png", []byte("data"), "image/png")
+	if err == nil || errors.Is(err, ErrNotExist) || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestS3SaveAndRemove(t *testing.T) {
+	storage, standIn := newS3(t, true)
+	ctx := context.Background()
+
+	upload, err := Process(testJPEG(t, 600, 300, 1), 1_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, variants, err := Save(ctx, storage, upload, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the original, the thumbnail and the copy 480 pixels wide
+	if len(standIn.objects) != 3 || !strings.HasPrefix(key, "2026/10/") {
+		t.Errorf("saved %s and %d objects", key, len(standIn.objects))
+	}
+
+	if err := Remove(ctx, storage, key, variants); err != nil {
+		t.Fatal(err)
+	}
+	if len(standIn.objects) != 0 {
+		t.Errorf("%d objects left", len(standIn.objects))
+	}
+}
+
+func TestS3URL(t *testing.T) {
+	cfg := config.S3Config{Endpoint: "https://s3.eu-west-1.amazonaws.com", Bucket: "uploads"}
+
+	tests := []struct {
+		pathStyle bool
+		baseURL   string
+		want      string
+	}{
+		{false, "", "https://uploads.s3.eu-west-1.amazonaws.com/2026/10/a%20b%2B%281%29.jpg"},
+		{true, "", "https://s3.eu-west-1.amazonaws.com/uploads/2026/10/a%20b%2B%281%29.jpg"},
+		{false, "https://cdn.example.com/", "https://cdn.example.com/2026/10/a b+(1).jpg"},
+	}
+
+	for _, test := range tests {
+		cfg.PathStyle = test.pathStyle
+		if got := NewS3(cfg, test.baseURL).URL("2026/10/a b+(1).jpg"); got != test.want {
+			t.Errorf("path style %v, base URL %q: got %s, want %s", test.pathStyle, test.baseURL, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/immanuel-254/blog/config"
+)
+
+// ErrNotExist is wrapped by the errors of Open for keys that hold no file.
+var ErrNotExist = fs.ErrNotExist
+
+// Files are served with a long cache lifetime, as Save never reuses a key.
+const cacheControl = "public, max-age=31536000, immutable"
+
+// Storage keeps the files of uploads under keys such as
+// 2026/10/8c1f0e5b2a9d4e37/original.jpg, made by Save.
+type Storage interface {
+	// Put stores data under key, replacing any file already there.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Open returns the file stored under key.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file under key. A key that holds no file is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns where clients download the file under key.
+	URL(key string) string
+}
+
+// New returns the storage set by cfg. Files in local storage are served by the
+// API at domain/media unless cfg.URL says otherwise.
+func New(cfg config.MediaConfig, domain string) Storage {
+	if cfg.Storage == "s3" {
+		return NewS3(cfg.S3, cfg.URL)
+	}
+
+	url := cfg.URL
+	if url == "" {
+		url = strings.TrimSuffix(domain, "/") + "/media"
+	}
+	return &Local{Dir: cfg.Dir, BaseURL: url}
+}
+
+// Local keeps files in a directory of the local file system.
+type Local struct {
+	Dir     string
+	BaseURL string // URL the directory is served at
+}
+
+// path returns the file of key, which must name a file under the directory.
+func (l *Local) path(key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if !filepath.IsLocal(name) || filepath.Clean(name) == "." {
+		return "", fmt.Errorf("invalid media key %q", key)
+	}
+	return filepath.Join(l.Dir, name), nil
+}
+
+// Put writes data to a temporary file next to its destination and renames it,
+// so readers never see part of a file.
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Delete removes the file under key, and the directories above it that it
+// leaves empty.
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	root := filepath.Clean(l.Dir)
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break // not empty
+		}
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return strings.TrimSuffix(l.BaseURL, "/") + "/" + key
+}
+
+// Handler serves the file under the {key...} wildcard of the route. Directories
+// are not listed.
+func (l *Local) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, err := l.path(r.PathValue("key"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", cacheControl)
+		// uploads are public and meant to be shown by pages of other origins
+		w.Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
+		http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+	})
+}
@@ -0,0 +1,228 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// files returns the files under dir, by their path from it.
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var found []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		found = append(found, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestLocal(t *testing.T) {
+	storage := &Local{Dir: t.TempDir(), BaseURL: "https://example.com/media/"}
+	ctx := context.Background()
+	key := "2026/10/8c1f0e5b/original.png"
+
+	if err := storage.Put(ctx, key, []byte("image data"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	// replaced in place
+	if err := storage.Put(ctx, key, []byte("new image data"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if got := files(t, storage.Dir); len(got) != 1 || got[0] != key {
+		t.Errorf("stored %v", got)
+	}
+	info, err := os.Stat(filepath.Join(storage.Dir, filepath.FromSlash(key)))
+	if err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("stored with the mode %v, %v", info.Mode(), err)
+	}
+
+	file, err := storage.Open(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || string(data) != "new image data" {
+		t.Errorf("read %q, %v", data, err)
+	}
+
+	if got := storage.URL(key); got != "https://example.com/media/"+key {
+		t.Errorf("got %s", got)
+	}
+
+	// the directories of the key go with its file, the storage directory stays
+	if err := storage.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Delete(ctx, key); err != nil {
+		t.Errorf("delete a missing key: %v", err)
+	}
+	entries, err := os.ReadDir(storage.Dir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("left %v, %v", entries, err)
+	}
+	if _, err := storage.Open(ctx, key); !errors.Is(err, ErrNotExist) {
+		t.Errorf("open a deleted key: %v", err)
+	}
+}
+
+func TestLocalRefusesKeysOutside(t *testing.T) {
+	root := t.TempDir()
+	storage := &Local{Dir: filepath.Join(root, "media")}
+	ctx := context.Background()
+	if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../secret.txt", "2026/../../secret.txt", "/etc/passwd", "", ".", "2026/.."} {
+		if err := storage.Put(ctx, key, []byte("data"), "text/plain"); err == nil {
+			t.Errorf("put %q", key)
+		}
+		if file, err := storage.Open(ctx, key); err == nil {
+			file.Close()
+			t.Errorf("opened %q", key)
+		}
+		if err := storage.Delete(ctx, key); err == nil {
+			t.Errorf("deleted %q", key)
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(root, "secret.txt")); err != nil || string(data) != "secret" {
+		t.Errorf("the file outside became %q, %v", data, err)
+	}
+}
+
+func TestLocalHandler(t *testing.T) {
+	root := t.TempDir()
+	storage := &Local{Dir: filepath.Join(root, "media")}
+	if err := storage.Put(context.Background(), "2026/10/8c1f0e5b/original.png", []byte("image data"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /media/{key...}", storage.Handler())
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/media/2026/10/8c1f0e5b/original.png", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "image data" {
+		t.Errorf("got %d %q", w.Code, w.Body)
+	}
+	if w.Header().Get("Cache-Control") != cacheControl || w.Header().Get("Cross-Origin-Resource-Policy") != "cross-origin" {
+		t.Errorf("sent %v", w.Header())
+	}
+
+	for _, target := range []string{
+		"/media/2026/10/8c1f0e5b/missing.png",
+		"/media/2026/10", // directories are not listed
+		"/media/..%2fsecret.txt",
+		"/media/2026/..%2f..%2f..%2fsecret.txt",
+		"/media/%2e%2e/secret.txt",
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code == http.StatusOK || strings.Contains(w.Body.String(), "secret") || strings.Contains(w.Body.String(), "8c1f0e5b") {
+			t.Errorf("%s: got %d %q", target, w.Code, w.Body)
+		}
+	}
+}
+
+// failingStorage fails to put its failAfter+1th file.
+type failingStorage struct {
+	*Local
+	failAfter int
+}
+
+func (s *failingStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if s.failAfter == 0 {
+		return errors.New("the disk is full")
+	}
+	s.failAfter--
+	return s.Local.Put(ctx, key, data, contentType)
+}
+
+func TestSaveAndRemove(t *testing.T) {
+	storage := &Local{Dir: t.TempDir()}
+	ctx := context.Background()
+
+	upload, err := Process(testJPEG(t, 1000, 500, 1), 1_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, variants, err := Save(ctx, storage, upload, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, "2026/10/") || !strings.HasSuffix(key, "/original.jpg") {
+		t.Errorf("saved under %s", key)
+	}
+
+	// the thumbnail is square, the copies keep the shape of the image and only
+	// those narrower than it are made
+	want := map[string]image.Point{"thumbnail": {ThumbnailSize, ThumbnailSize}, "w480": {480, 240}, "w960": {960, 480}}
+	if len(variants) != len(want) {
+		t.Errorf("got %d variants", len(variants))
+	}
+	for _, v := range variants {
+		size, ok := want[v.Name]
+		if !ok || v.Width != size.X || v.Height != size.Y || v.Data != nil || filepath.Dir(v.Key) != filepath.Dir(key) {
+			t.Errorf("variant %+v", v)
+			continue
+		}
+
+		file, err := storage.Open(ctx, v.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil || len(data) != v.Size {
+			t.Fatalf("%s: read %d bytes, %v", v.Name, len(data), err)
+		}
+		img, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || img.Width != size.X || img.Height != size.Y {
+			t.Errorf("%s: decoded %dx%d, %v", v.Name, img.Width, img.Height, err)
+		}
+	}
+	if got := files(t, storage.Dir); len(got) != 1+len(want) {
+		t.Errorf("stored %v", got)
+	}
+
+	if err := Remove(ctx, storage, key, variants); err != nil {
+		t.Fatal(err)
+	}
+	if got := files(t, storage.Dir); len(got) != 0 {
+		t.Errorf("left %v", got)
+	}
+
+	// a failed save leaves nothing behind
+	failing := &failingStorage{Local: storage, failAfter: 2}
+	if _, _, err := Save(ctx, failing, upload, time.Now()); err == nil {
+		t.Error("a failed put was not reported")
+	}
+	if entries, err := os.ReadDir(storage.Dir); err != nil || len(entries) != 0 {
+		t.Errorf("left %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequests = NewCounterVec("http_requests_total",
+		"HTTP requests handled, by route pattern, method and status code.", "route", "method", "status")
+	httpDuration = NewHistogramVec("http_request_duration_seconds",
+		"Time spent handling HTTP requests, by route pattern and method.", DefaultBuckets, "route", "method")
+	httpInFlight = NewGaugeVec("http_requests_in_flight",
+		"HTTP requests currently being handled, by route pattern.", "route")
+)
+
+// Domain counters, incremented where the event happens.
+var (
+	Signups        = NewCounter("blog_signups_total", "Accounts created through signup.")
+	Logins         = NewCounter("blog_logins_total", "Successful logins.")
+	LoginFailures  = NewCounter("blog_login_failures_total", "Logins rejected for an unknown email or a wrong password.")
+	PostsPublished = NewCounter("blog_posts_published_total", "Blog posts published.")
+	Comments       = NewCounter("blog_comments_created_total", "Comments created.")
+	EmailsSent     = NewCounter("blog_emails_sent_total", "Emails accepted by the email provider.")
+	EmailsFailed   = NewCounter("blog_emails_failed_total", "Emails the email provider failed to accept.")
+)
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Instrument records request count, latency and in-flight requests of a handler under
+// the route pattern it is registered with, so paths with ids do not create new series.
+func Instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		httpInFlight.Inc(route)
+		defer httpInFlight.Dec(route)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		httpRequests.Inc(route, r.Method, strconv.Itoa(rec.status))
+		httpDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+	})
+}
+
+// RegisterDBStats exposes the connection pool statistics of each of pools,
+// labelled with its name as pool.
+func RegisterDBStats(pools map[string]*sql.DB) {
+	stat := func(fn func(sql.DBStats) float64) func() map[string]float64 {
+		return func() map[string]float64 {
+			values := make(map[string]float64, len(pools))
+			for name, db := range pools {
+				values[name] = fn(db.Stats())
+			}
+			return values
+		}
+	}
+
+	NewGaugeFuncVec("db_max_open_connections", "Maximum number of open connections to the database.", "pool",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	NewGaugeFuncVec("db_open_connections", "Established connections, in use and idle.", "pool",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	NewGaugeFuncVec("db_in_use_connections", "Connections currently in use.", "pool",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	NewGaugeFuncVec("db_idle_connections", "Idle connections.", "pool",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	NewCounterFuncVec("db_wait_count_total", "Connections waited for.", "pool",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	NewCounterFuncVec("db_wait_duration_seconds_total", "Time blocked waiting for a new connection.", "pool",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	NewCounterFuncVec("db_max_idle_closed_total", "Connections closed due to the idle connection limit.", "pool",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	NewCounterFuncVec("db_max_lifetime_closed_total", "Connections closed due to the maximum connection lifetime.", "pool",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
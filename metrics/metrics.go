@@ -0,0 +1,337 @@
+// Package metrics collects counters, gauges and histograms and exposes them
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds, suited to HTTP handlers.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds every metric exposed by Handler.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry metrics are created in by the package level constructors.
+var Default = NewRegistry()
+
+func (reg *Registry) register(c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.collectors = append(reg.collectors, c)
+}
+
+// Expose writes every metric in the text exposition format.
+func (reg *Registry) Expose(w io.Writer) {
+	reg.mu.Lock()
+	collectors := append([]collector(nil), reg.collectors...)
+	reg.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the metrics of the registry.
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.Expose(w)
+	})
+}
+
+// Handler serves the metrics of the default registry.
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// desc is what every metric family has in common.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+// key joins label values into a map key, the separator cannot appear in valid UTF-8.
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// series formats a series name with its labels, extra is appended as is.
+func (d desc) series(suffix, key string, extra string) string {
+	var pairs []string
+
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", d.labels[i], escapeLabel(value)))
+		}
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+
+	if len(pairs) == 0 {
+		return d.name + suffix
+	}
+	return d.name + suffix + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// valueVec is a counter or gauge family, one value per label combination.
+type valueVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newValueVec(kind, name, help string, labels []string) *valueVec {
+	vec := &valueVec{
+		desc:   desc{name: name, help: help, kind: kind, labels: labels},
+		values: map[string]float64{},
+	}
+	if len(labels) == 0 {
+		vec.values[""] = 0 // unlabelled metrics are exposed from the start
+	}
+	return vec
+}
+
+func (vec *valueVec) add(delta float64, values []string) {
+	key := vec.key(values)
+	vec.mu.Lock()
+	vec.values[key] += delta
+	vec.mu.Unlock()
+}
+
+func (vec *valueVec) set(value float64, values []string) {
+	key := vec.key(values)
+	vec.mu.Lock()
+	vec.values[key] = value
+	vec.mu.Unlock()
+}
+
+func (vec *valueVec) write(w io.Writer) {
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+
+	vec.header(w)
+	for _, key := range sortedKeys(vec.values) {
+		fmt.Fprintf(w, "%s %s\n", vec.series("", key, ""), formatFloat(vec.values[key]))
+	}
+}
+
+// CounterVec is a counter per label combination. Counters only go up.
+type CounterVec struct {
+	vec *valueVec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	counter := &CounterVec{vec: newValueVec("counter", name, help, labels)}
+	Default.register(counter.vec)
+	return counter
+}
+
+// NewCounter creates a counter without labels.
+func NewCounter(name, help string) *CounterVec {
+	return NewCounterVec(name, help)
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.vec.add(1, labelValues)
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.vec.add(delta, labelValues)
+}
+
+// GaugeVec is a value per label combination that can go up and down.
+type GaugeVec struct {
+	vec *valueVec
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	gauge := &GaugeVec{vec: newValueVec("gauge", name, help, labels)}
+	Default.register(gauge.vec)
+	return gauge
+}
+
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.vec.add(1, labelValues)
+}
+
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.vec.add(-1, labelValues)
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.vec.set(value, labelValues)
+}
+
+// funcMetric reads its value when the metrics are collected.
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+func (m *funcMetric) write(w io.Writer) {
+	m.header(w)
+	fmt.Fprintf(w, "%s %s\n", m.name, formatFloat(m.fn()))
+}
+
+// NewGaugeFunc exposes the value returned by fn as a gauge.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.register(&funcMetric{desc: desc{name: name, help: help, kind: "gauge"}, fn: fn})
+}
+
+// NewCounterFunc exposes the value returned by fn as a counter, fn must never decrease.
+func NewCounterFunc(name, help string, fn func() float64) {
+	Default.register(&funcMetric{desc: desc{name: name, help: help, kind: "counter"}, fn: fn})
+}
+
+// funcVec reads a value per value of its label when the metrics are collected.
+type funcVec struct {
+	desc
+	fn func() map[string]float64
+}
+
+func (m *funcVec) write(w io.Writer) {
+	values := m.fn()
+
+	m.header(w)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s %s\n", m.series("", key, ""), formatFloat(values[key]))
+	}
+}
+
+// NewGaugeFuncVec exposes the values returned by fn as a gauge, one series per
+// key of the map, which is the value of label.
+func NewGaugeFuncVec(name, help, label string, fn func() map[string]float64) {
+	Default.register(&funcVec{desc: desc{name: name, help: help, kind: "gauge", labels: []string{label}}, fn: fn})
+}
+
+// NewCounterFuncVec exposes the values returned by fn as a counter like
+// NewGaugeFuncVec, none of them must ever decrease.
+func NewCounterFuncVec(name, help, label string, fn func() map[string]float64) {
+	Default.register(&funcVec{desc: desc{name: name, help: help, kind: "counter", labels: []string{label}}, fn: fn})
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec counts observations into buckets per label combination.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		values:  map[string]*histogram{},
+	}
+	Default.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, ok := h.values[key]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = series
+	}
+
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		series.counts[i]++
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	for _, key := range sortedKeys(h.values) {
+		series := h.values[key]
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += series.counts[i]
+			fmt.Fprintf(w, "%s %d\n", h.series("_bucket", key, fmt.Sprintf("le=\"%s\"", formatFloat(bound))), cumulative)
+		}
+		fmt.Fprintf(w, "%s %d\n", h.series("_bucket", key, `le="+Inf"`), series.count)
+		fmt.Fprintf(w, "%s %s\n", h.series("_sum", key, ""), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s %d\n", h.series("_count", key, ""), series.count)
+	}
+}
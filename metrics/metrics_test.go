@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// exposed returns what the default registry exposes.
+func exposed() string {
+	var out strings.Builder
+	Default.Expose(&out)
+	return out.String()
+}
+
+// noConnector opens no connections, the statistics of its pool stay empty.
+type noConnector struct{}
+
+func (noConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("no connections")
+}
+
+func (noConnector) Driver() driver.Driver {
+	return nil
+}
+
+func TestRegisterDBStats(t *testing.T) {
+	writer, reader := sql.OpenDB(noConnector{}), sql.OpenDB(noConnector{})
+	defer writer.Close()
+	defer reader.Close()
+	writer.SetMaxOpenConns(1)
+	reader.SetMaxOpenConns(4)
+
+	RegisterDBStats(map[string]*sql.DB{"writer": writer, "reader": reader})
+
+	out := exposed()
+	for _, want := range []string{
+		"# TYPE db_max_open_connections gauge\ndb_max_open_connections{pool=\"reader\"} 4\ndb_max_open_connections{pool=\"writer\"} 1\n",
+		"# TYPE db_wait_count_total counter\n",
+		"db_open_connections{pool=\"writer\"} 0\n",
+		"db_max_lifetime_closed_total{pool=\"reader\"} 0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q is not in\n%s", want, out)
+		}
+	}
+}
+
+// family returns the lines exposed for the metric name, from its HELP line to
+// the next metric.
+func family(name string) string {
+	out := exposed()
+	start := strings.Index(out, "# HELP "+name+" ")
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(out[start+1:], "# HELP ")
+	if end < 0 {
+		return out[start:]
+	}
+	return out[start : start+1+end]
+}
+
+func TestCounter(t *testing.T) {
+	plain := NewCounter("test_plain_total", "A counter without labels.")
+	if got := family("test_plain_total"); got != "# HELP test_plain_total A counter without labels.\n# TYPE test_plain_total counter\ntest_plain_total 0\n" {
+		t.Errorf("before any event:\n%s", got)
+	}
+	plain.Inc()
+	plain.Add(2.5)
+	if got := family("test_plain_total"); !strings.HasSuffix(got, "\ntest_plain_total 3.5\n") {
+		t.Errorf("after events:\n%s", got)
+	}
+
+	// labelled series appear once used, sorted, with their values escaped
+	counter := NewCounterVec("test_events_total", "Events,\nby kind \\ source.", "kind", "source")
+	counter.Inc("b", "web")
+	counter.Inc("a", `say "hi"`+"\n"+`\`)
+	counter.Add(3, "b", "web")
+	want := "# HELP test_events_total Events,\\nby kind \\\\ source.\n" +
+		"# TYPE test_events_total counter\n" +
+		"test_events_total{kind=\"a\",source=\"say \\\"hi\\\"\\n\\\\\"} 1\n" +
+		"test_events_total{kind=\"b\",source=\"web\"} 4\n"
+	if got := family("test_events_total"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	for name, fn := range map[string]func(){
+		"a decrease":            func() { counter.Add(-1, "a", "web") },
+		"missing label values":  func() { counter.Inc("a") },
+		"too many label values": func() { plain.Inc("a") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestGauge(t *testing.T) {
+	gauge := NewGaugeVec("test_queue_length", "Jobs waiting.", "queue")
+	gauge.Inc("mail")
+	gauge.Inc("mail")
+	gauge.Dec("mail")
+	gauge.Set(-2, "backup")
+
+	want := "# HELP test_queue_length Jobs waiting.\n# TYPE test_queue_length gauge\n" +
+		"test_queue_length{queue=\"backup\"} -2\ntest_queue_length{queue=\"mail\"} 1\n"
+	if got := family("test_queue_length"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// values of functions are read when exposed
+	value := 1.0
+	NewGaugeFunc("test_temperature", "A reading.", func() float64 { return value })
+	value = math.Inf(1)
+	if got := family("test_temperature"); !strings.HasSuffix(got, "# TYPE test_temperature gauge\ntest_temperature +Inf\n") {
+		t.Errorf("got\n%s", got)
+	}
+	NewCounterFunc("test_reads_total", "Reads.", func() float64 { return 42 })
+	if got := family("test_reads_total"); !strings.HasSuffix(got, "# TYPE test_reads_total counter\ntest_reads_total 42\n") {
+		t.Errorf("got\n%s", got)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogramVec("test_duration_seconds", "Time taken.", []float64{1, 0.1, 0.5}, "job")
+	for _, value := range []float64{0.05, 0.1, 0.3, 2} {
+		histogram.Observe(value, "mail")
+	}
+
+	// the buckets are sorted, cumulative and include their upper bound
+	want := "# HELP test_duration_seconds Time taken.\n# TYPE test_duration_seconds histogram\n" +
+		"test_duration_seconds_bucket{job=\"mail\",le=\"0.1\"} 2\n" +
+		"test_duration_seconds_bucket{job=\"mail\",le=\"0.5\"} 3\n" +
+		"test_duration_seconds_bucket{job=\"mail\",le=\"1\"} 3\n" +
+		"test_duration_seconds_bucket{job=\"mail\",le=\"+Inf\"} 4\n" +
+		"test_duration_seconds_sum{job=\"mail\"} 2.45\n" +
+		"test_duration_seconds_count{job=\"mail\"} 4\n"
+	if got := family("test_duration_seconds"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /test/{id}", Instrument("GET /test/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "0" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("found"))
+	})))
+
+	for _, path := range []string{"/test/1", "/test/2", "/test/0"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// the requests are counted under the pattern, not their paths
+	out := exposed()
+	for _, want := range []string{
+		"http_requests_total{route=\"GET /test/{id}\",method=\"GET\",status=\"200\"} 2\n",
+		"http_requests_total{route=\"GET /test/{id}\",method=\"GET\",status=\"404\"} 1\n",
+		"http_request_duration_seconds_count{route=\"GET /test/{id}\",method=\"GET\"} 3\n",
+		"http_requests_in_flight{route=\"GET /test/{id}\"} 0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q is not in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "/test/1") {
+		t.Errorf("a path is a label:\n%s", out)
+	}
+
+	// handlers see the requests in flight
+	var inFlight string
+	handler := Instrument("GET /busy", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight = family("http_requests_in_flight")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/busy", nil))
+	if !strings.Contains(inFlight, "http_requests_in_flight{route=\"GET /busy\"} 1\n") {
+		t.Errorf("got\n%s", inFlight)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") || !strings.Contains(w.Body.String(), "# TYPE blog_signups_total counter\n") {
+		t.Errorf("got %d %v\n%s", w.Code, w.Header(), w.Body)
+	}
+}
@@ -0,0 +1,84 @@
+// Package migrations holds the schema history of every app as one ordered sequence
+// per database engine, embedded in the binary so it runs from any working directory.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/immanuel-254/blog/database"
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed sqlite/*.sql postgres/*.sql
+var FS embed.FS
+
+// dialects maps each engine to its goose dialect.
+var dialects = map[database.Driver]goose.Dialect{
+	database.SQLite:   goose.DialectSQLite3,
+	database.Postgres: goose.DialectPostgres,
+}
+
+// ErrSchemaBehind is returned by Check when the database is missing migrations.
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// NewProvider returns a goose provider for the embedded migrations of driver,
+// which db is connected to. Closing the provider closes db.
+func NewProvider(driver database.Driver, db *sql.DB, opts ...goose.ProviderOption) (*goose.Provider, error) {
+	dialect, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for database driver %q", driver)
+	}
+
+	fsys, err := fs.Sub(FS, string(driver))
+	if err != nil {
+		return nil, err
+	}
+
+	return goose.NewProvider(dialect, db, fsys, opts...)
+}
+
+// Check returns ErrSchemaBehind if any embedded migration of driver has not been
+// applied to db.
+func Check(ctx context.Context, driver database.Driver, db *sql.DB) error {
+	provider, err := NewProvider(driver, db)
+	if err != nil {
+		return err
+	}
+
+	pending, err := provider.HasPending(ctx)
+	if err != nil {
+		return err
+	}
+	if !pending {
+		return nil
+	}
+
+	current, target, err := provider.GetVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: it is at version %d, this build expects %d", ErrSchemaBehind, current, target)
+}
+
+// Versions returns the highest migration of driver applied to db and the latest
+// one embedded in this build. Unlike GetVersions of the provider, it does not
+// create the version table, so db may be read only.
+func Versions(ctx context.Context, driver database.Driver, db *sql.DB) (current, latest int64, err error) {
+	provider, err := NewProvider(driver, db)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if sources := provider.ListSources(); len(sources) > 0 {
+		latest = sources[len(sources)-1].Version
+	}
+
+	err = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version_id), 0) FROM "+goose.DefaultTablename+" WHERE is_applied").Scan(&current)
+	return current, latest, err
+}
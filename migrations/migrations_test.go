@@ -0,0 +1,136 @@
+package migrations_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/internal/testdb"
+	"github.com/immanuel-254/blog/migrations"
+)
+
+// versions returns the versions of the embedded migrations of driver, in order.
+func versions(t *testing.T, driver database.Driver) []int64 {
+	t.Helper()
+
+	files, err := fs.Glob(migrations.FS, string(driver)+"/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("%s: found %v, %v", driver, files, err)
+	}
+
+	var found []int64
+	for _, file := range files {
+		prefix, _, _ := strings.Cut(path.Base(file), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			t.Fatalf("%s has no version: %v", file, err)
+		}
+		found = append(found, version)
+	}
+	slices.Sort(found)
+	return found
+}
+
+// TestHistoriesMatch checks that every migration has its counterpart for the
+// other engine. The PostgreSQL history starts from a schema equal to the one
+// SQLite reached at that version, after which both grow together.
+func TestHistoriesMatch(t *testing.T) {
+	sqlite, postgres := versions(t, database.SQLite), versions(t, database.Postgres)
+
+	baseline := postgres[0]
+	if !slices.Contains(sqlite, baseline) {
+		t.Errorf("the PostgreSQL baseline %d is not a SQLite version", baseline)
+	}
+	for _, version := range postgres {
+		if !slices.Contains(sqlite, version) {
+			t.Errorf("%d is only a PostgreSQL migration", version)
+		}
+	}
+	for _, version := range sqlite {
+		if version >= baseline && !slices.Contains(postgres, version) {
+			t.Errorf("%d is only a SQLite migration", version)
+		}
+	}
+	if sqlite[len(sqlite)-1] != postgres[len(postgres)-1] {
+		t.Errorf("the latest versions differ: %d for SQLite, %d for PostgreSQL", sqlite[len(sqlite)-1], postgres[len(postgres)-1])
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.Open(t)
+	sources := versions(t, database.SQLite)
+	latest := sources[len(sources)-1]
+
+	if err := migrations.Check(ctx, db.Driver, db.DB); !errors.Is(err, migrations.ErrSchemaBehind) {
+		t.Errorf("an empty database: got %v", err)
+	}
+
+	provider, err := migrations.NewProvider(db.Driver, db.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	behind := sources[len(sources)-2]
+	if _, err := provider.UpTo(ctx, behind); err != nil {
+		t.Fatal(err)
+	}
+	err = migrations.Check(ctx, db.Driver, db.DB)
+	if !errors.Is(err, migrations.ErrSchemaBehind) || !strings.Contains(err.Error(), "version "+strconv.FormatInt(behind, 10)+", this build expects "+strconv.FormatInt(latest, 10)) {
+		t.Errorf("a migration behind: got %v", err)
+	}
+	if current, got, err := migrations.Versions(ctx, db.Driver, db.DB); current != behind || got != latest || err != nil {
+		t.Errorf("a migration behind: versions %d and %d, %v", current, got, err)
+	}
+
+	if _, err := provider.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrations.Check(ctx, db.Driver, db.DB); err != nil {
+		t.Errorf("a current database: got %v", err)
+	}
+	if current, got, err := migrations.Versions(ctx, db.Driver, db.DB); current != latest || got != latest || err != nil {
+		t.Errorf("a current database: versions %d and %d, %v", current, got, err)
+	}
+
+	if _, err := migrations.NewProvider("mysql", db.DB); err == nil {
+		t.Error("a provider for an unknown engine")
+	}
+}
+
+// TestCommentsRebuildRedo undoes the rebuild of the SQLite comments table,
+// which leaves it as it is, and applies it again.
+func TestCommentsRebuildRedo(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.New(t)
+	const rebuild = 20261019160000
+
+	if _, err := db.Exec("INSERT INTO comments (body) VALUES ('first')"); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := migrations.NewProvider(db.Driver, db.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := versions(t, database.SQLite)
+	if _, err := provider.DownTo(ctx, sources[slices.Index(sources, rebuild)-1]); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if _, err := provider.Up(ctx); err != nil {
+		t.Fatalf("up again: %v", err)
+	}
+	if err := migrations.Check(ctx, db.Driver, db.DB); err != nil {
+		t.Error(err)
+	}
+
+	var body string
+	if err := db.QueryRow("SELECT body FROM comments").Scan(&body); err != nil || body != "first" {
+		t.Errorf("the comments hold %q, %v", body, err)
+	}
+}
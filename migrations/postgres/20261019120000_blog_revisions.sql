@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS blog_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    blog_id BIGINT NOT NULL REFERENCES blogs (id) ON DELETE CASCADE,
+    number BIGINT NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    author_id BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    restored_from BIGINT,
+    created_at TIMESTAMPTZ,
+    UNIQUE (blog_id, number)
+);
+
+-- every existing blog starts its history at what it holds now
+INSERT INTO blog_revisions (blog_id, number, title, body, author_id, created_at)
+SELECT id, 1, title, body, user_id, COALESCE(updated_at, created_at) FROM blogs;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS blog_revisions;
+-- +goose StatementEnd
@@ -0,0 +1,6 @@
+-- The SQLite comments table is rebuilt at this version to drop a malformed
+-- definition; the PostgreSQL schema was well-formed from the start.
+
+-- +goose Up
+
+-- +goose Down
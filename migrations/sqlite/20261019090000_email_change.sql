@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS email_changes (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    new_email TEXT NOT NULL,
+    confirm_token TEXT NOT NULL UNIQUE,
+    cancel_token TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS email_changes;
+-- +goose StatementEnd
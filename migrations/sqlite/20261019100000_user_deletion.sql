@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_deletions (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL UNIQUE,
+    content TEXT NOT NULL,
+    cancel_token TEXT NOT NULL UNIQUE,
+    scheduled_for TIMESTAMP NOT NULL,
+    created_at TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_deletions;
+-- +goose StatementEnd
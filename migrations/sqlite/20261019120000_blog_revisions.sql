@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS blog_revisions (
+    id INTEGER PRIMARY KEY,
+    blog_id INTEGER NOT NULL,
+    number INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    author_id INTEGER,
+    restored_from INTEGER,
+    created_at TIMESTAMP,
+    UNIQUE (blog_id, number),
+    FOREIGN KEY (blog_id)
+        REFERENCES blogs (id)
+            ON DELETE CASCADE
+            ON UPDATE NO ACTION,
+    FOREIGN KEY (author_id)
+        REFERENCES users (id)
+            ON DELETE SET NULL
+            ON UPDATE NO ACTION
+);
+
+-- every existing blog starts its history at what it holds now
+INSERT INTO blog_revisions (blog_id, number, title, body, author_id, created_at)
+SELECT id, 1, title, body, user_id, COALESCE(updated_at, created_at) FROM blogs;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS blog_revisions;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE blogs ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE comments ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE categories ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE profiles ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE profiles DROP COLUMN version;
+ALTER TABLE categories DROP COLUMN version;
+ALTER TABLE comments DROP COLUMN version;
+ALTER TABLE blogs DROP COLUMN version;
+ALTER TABLE users DROP COLUMN version;
+-- +goose StatementEnd
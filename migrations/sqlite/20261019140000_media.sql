@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS media (
+    id INTEGER PRIMARY KEY,
+    owner_id INTEGER,
+    blog_id INTEGER,
+    key TEXT NOT NULL UNIQUE,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    alt TEXT NOT NULL DEFAULT '',
+    variants TEXT NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP,
+    deleted_at TIMESTAMP,
+    FOREIGN KEY (owner_id)
+        REFERENCES users (id)
+            ON DELETE SET NULL
+            ON UPDATE NO ACTION,
+    FOREIGN KEY (blog_id)
+        REFERENCES blogs (id)
+            ON DELETE SET NULL
+            ON UPDATE NO ACTION
+);
+
+CREATE INDEX IF NOT EXISTS media_owner_id ON media (owner_id);
+CREATE INDEX IF NOT EXISTS media_blog_id ON media (blog_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS media;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE profiles ADD COLUMN avatar_id INTEGER REFERENCES media (id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE profiles DROP COLUMN avatar_id;
+-- +goose StatementEnd
@@ -0,0 +1,36 @@
+-- The comments table was created without a comma between its two foreign keys.
+-- SQLite accepts that and keeps both keys, but sqlc reads the second one as a
+-- column named "foreign", so the table is rebuilt from a well-formed definition
+-- with the same columns, keys and rows.
+
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE comments_rebuild (
+   id INTEGER PRIMARY KEY,
+   user_id INTEGER,
+   blog_id INTEGER,
+   body TEXT NOT NULL,
+   created_at TIMESTAMP,
+   updated_at TIMESTAMP,
+   version INTEGER NOT NULL DEFAULT 1,
+   FOREIGN KEY (user_id)
+      REFERENCES users (id)
+         ON DELETE CASCADE
+         ON UPDATE NO ACTION,
+   FOREIGN KEY (blog_id)
+      REFERENCES blogs (id)
+        ON DELETE CASCADE
+        ON UPDATE NO ACTION
+);
+
+INSERT INTO comments_rebuild (id, user_id, blog_id, body, created_at, updated_at, version)
+SELECT id, user_id, blog_id, body, created_at, updated_at, version FROM comments;
+
+DROP TABLE comments;
+ALTER TABLE comments_rebuild RENAME TO comments;
+-- +goose StatementEnd
+
+-- +goose Down
+-- This migration is not undone. Rebuilding the malformed definition would only
+-- bring back what sqlc cannot read: the rebuilt table has the same columns, keys
+-- and rows, so the earlier migrations run on it as they did on the old one.
@@ -0,0 +1,319 @@
+// Package openapi builds an OpenAPI 3.1 document from the routes the server
+// registers. Routes are added to Default as they are registered, each with an
+// Operation describing it:
+//
+//	openapi.Default.Add(http.MethodGet, "/blogs/{id}", openapi.Operation{
+//		Summary:  "Read a blog",
+//		Response: BlogReadOutput{},
+//	})
+//
+// Request and response schemas are derived from the Go types by reflection,
+// using their json tags for names and their validate tags for constraints.
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/immanuel-254/blog/apierror"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.1.0"
+
+// Operation describes what a route does and what it exchanges.
+type Operation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Query       []string    // names of the query string parameters
+	Request     interface{} // a value of the request body type, nil when there is no body
+	RequestType string      // content type of the request body, application/json when empty
+	Response    interface{} // a value of the response body type on success
+	Status      int         // status of the success response, 200 when zero
+	Secured     bool        // the route requires a session
+	Deprecated  bool
+}
+
+// Route is a registered method and path with its operation.
+type Route struct {
+	Method    string
+	Path      string
+	Operation Operation
+}
+
+// Registry collects the routes of a server.
+type Registry struct {
+	mu     sync.Mutex
+	routes []Route
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry the auth package adds routes to.
+var Default = NewRegistry()
+
+// Add records a route. An empty method means the route accepts every method,
+// which cannot be described and is reported by Check.
+func (reg *Registry) Add(method, path string, op Operation) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.routes = append(reg.routes, Route{Method: method, Path: path, Operation: op})
+}
+
+// Routes returns the routes added so far, in the order they were added.
+func (reg *Registry) Routes() []Route {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return append([]Route(nil), reg.routes...)
+}
+
+// Info is the part of the document that does not come from the routes.
+type Info struct {
+	Title           string
+	Version         string
+	Description     string
+	Servers         []string
+	SecuritySchemes map[string]SecurityScheme // any of them satisfies a secured route
+}
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       DocumentInfo                    `json:"info"`
+	Servers    []Server                        `json:"servers,omitempty"`
+	Paths      map[string]map[string]*PathItem `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type DocumentInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem is a single operation of a path. Paths map methods to them, which is
+// how a path item object is laid out in JSON.
+type PathItem struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	In          string `json:"in,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	Responses       map[string]Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// ErrorResponse is the body apierror.Write sends.
+type ErrorResponse struct {
+	Error struct {
+		apierror.Error
+		RequestID string `json:"request_id,omitempty"`
+	} `json:"error"`
+}
+
+// Document builds the OpenAPI document of every described route.
+func (reg *Registry) Document(info Info) *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    DocumentInfo{Title: info.Title, Version: info.Version, Description: info.Description},
+		Paths:   map[string]map[string]*PathItem{},
+		Components: Components{
+			Responses:       map[string]Response{},
+			SecuritySchemes: info.SecuritySchemes,
+		},
+	}
+	for _, url := range info.Servers {
+		doc.Servers = append(doc.Servers, Server{URL: url})
+	}
+
+	schemas := newSchemaSet()
+
+	doc.Components.Responses["Error"] = Response{
+		Description: "The request failed, see the error code",
+		Content:     jsonContent(schemas.of(ErrorResponse{})),
+	}
+
+	var security []map[string][]string
+	for _, name := range sortedNames(info.SecuritySchemes) {
+		security = append(security, map[string][]string{name: {}})
+	}
+
+	for _, route := range reg.Routes() {
+		if route.Method == "" || route.Operation.Summary == "" {
+			continue
+		}
+
+		path, params := pathParameters(route.Path)
+		op := route.Operation
+
+		item := &PathItem{
+			OperationID: operationID(route.Method, path),
+			Summary:     op.Summary,
+			Description: op.Description,
+			Tags:        op.Tags,
+			Parameters:  params,
+			Deprecated:  op.Deprecated,
+			Responses: map[string]Response{
+				"default": {Ref: "#/components/responses/Error"},
+			},
+		}
+
+		for _, name := range op.Query {
+			item.Parameters = append(item.Parameters, Parameter{Name: name, In: "query", Schema: &Schema{Type: "string"}})
+		}
+
+		if op.Request != nil {
+			contentType := op.RequestType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			item.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+				contentType: {Schema: schemas.ofRequest(op.Request, contentType)},
+			}}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := Response{Description: http.StatusText(status)}
+		if op.Response != nil {
+			success.Content = jsonContent(schemas.of(op.Response))
+		}
+		item.Responses[fmt.Sprint(status)] = success
+
+		if op.Secured {
+			item.Security = security
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = item
+	}
+
+	doc.Components.Schemas = schemas.components
+	return doc
+}
+
+// Check reports every registered route that is missing from the document,
+// because it accepts any method or has no summary.
+func (reg *Registry) Check(doc *Document) error {
+	var errs []error
+	for _, route := range reg.Routes() {
+		path, _ := pathParameters(route.Path)
+		if _, ok := doc.Paths[path][strings.ToLower(route.Method)]; ok && route.Method != "" {
+			continue
+		}
+
+		method := route.Method
+		if method == "" {
+			method = "ANY"
+		}
+		errs = append(errs, fmt.Errorf("%s %s is not in the OpenAPI document", method, route.Path))
+	}
+	return errors.Join(errs...)
+}
+
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+var wildcard = regexp.MustCompile(`\{([^}]*)\}`)
+
+// pathParameters turns a ServeMux pattern into an OpenAPI path and its path
+// parameters: {id} stays as is, {rest...} becomes {rest} and {$} is dropped.
+func pathParameters(pattern string) (string, []Parameter) {
+	var params []Parameter
+
+	path := wildcard.ReplaceAllStringFunc(pattern, func(match string) string {
+		name := strings.TrimSuffix(strings.Trim(match, "{}"), "...")
+		if name == "$" {
+			return ""
+		}
+
+		schema := &Schema{Type: "string"}
+		if name == "id" || strings.HasSuffix(name, "_id") {
+			schema = &Schema{Type: "integer", Format: "int64"}
+		}
+		params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: schema})
+		return "{" + name + "}"
+	})
+
+	return path, params
+}
+
+// operationID derives an id such as getBlogsById from the method and path.
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" {
+			continue
+		}
+		if strings.HasPrefix(segment, "{") {
+			segment = "by-" + strings.Trim(segment, "{}")
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,241 @@
+package openapi
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema as used by OpenAPI 3.1.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"` // a type name or a list of them
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaSet turns Go types into schemas. Named structs become components that
+// are referenced, so each is described once.
+type schemaSet struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+
+	// request is set while describing a request body, whose fields are required
+	// by their validate tags. Response fields are required unless omitempty.
+	request bool
+	// form is set while describing a multipart/form-data body, where []byte
+	// fields are files rather than base64 strings.
+	form bool
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{components: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+func (s *schemaSet) of(v interface{}) *Schema {
+	return s.schema(reflect.TypeOf(v))
+}
+
+func (s *schemaSet) ofRequest(v interface{}, contentType string) *Schema {
+	s.request = true
+	s.form = contentType == "multipart/form-data"
+	defer func() { s.request, s.form = false, false }()
+	return s.schema(reflect.TypeOf(v))
+}
+
+func (s *schemaSet) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if s.form {
+				return &Schema{Type: "string", Format: "binary"}
+			}
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + s.component(t)}
+	default:
+		return &Schema{} // interfaces accept anything
+	}
+}
+
+// component registers the named struct t and returns its component name.
+func (s *schemaSet) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+
+	name := s.componentName(t)
+	s.names[t] = name
+	s.components[name] = nil // reserve the name while the fields are described
+	s.components[name] = s.object(t)
+	return name
+}
+
+// componentName is the type name, qualified by as much of its package path as
+// needed to tell it apart from types of the same name in other packages.
+func (s *schemaSet) componentName(t reflect.Type) string {
+	name := t.Name()
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i] // generic instantiations
+	}
+
+	dir := t.PkgPath()
+	for {
+		if _, taken := s.components[name]; !taken || dir == "." || dir == "/" || dir == "" {
+			return name
+		}
+		name = path.Base(dir) + "." + name
+		dir = path.Dir(dir)
+	}
+}
+
+func (s *schemaSet) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.fields(t, schema)
+	return schema
+}
+
+func (s *schemaSet) fields(t reflect.Type, schema *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		// embedded structs without a json name are flattened, as encoding/json does
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.fields(embedded, schema)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := s.schema(field.Type)
+		required := constrain(property, field.Tag.Get("validate"))
+		if field.Type.Kind() == reflect.Pointer && property.Ref == "" && property.Type != nil {
+			property.Type = []string{property.Type.(string), "null"}
+		}
+
+		schema.Properties[name] = property
+		if required || (!s.request && !strings.Contains(options, "omitempty")) {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// constrain applies the rules of a validate tag to schema and reports whether
+// the field is required.
+func constrain(schema *Schema, tag string) bool {
+	required := false
+	if tag == "" {
+		return required
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		rule, param, _ := strings.Cut(rule, "=")
+
+		switch rule {
+		case "required":
+			required = true
+		case "email":
+			schema.Format = "email"
+		case "http_url":
+			schema.Format = "uri"
+		case "oneof":
+			schema.Enum = strings.Fields(param)
+		case "min", "max":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			setLimit(schema, rule, limit)
+		}
+	}
+
+	return required
+}
+
+func setLimit(schema *Schema, rule string, limit float64) {
+	n := int(limit)
+	switch schema.Type {
+	case "string":
+		if rule == "min" {
+			schema.MinLength = &n
+		} else {
+			schema.MaxLength = &n
+		}
+	case "array":
+		if rule == "min" {
+			schema.MinItems = &n
+		} else {
+			schema.MaxItems = &n
+		}
+	case "integer", "number":
+		if rule == "min" {
+			schema.Minimum = &limit
+		} else {
+			schema.Maximum = &limit
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package openapi
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+var uiIndex = template.Must(template.ParseFS(uiFiles, "ui/index.html"))
+
+// UIHandler serves a page that renders the document at specURL, with its script
+// and stylesheet. It must be mounted on a path ending in a slash and have that
+// path stripped, for example with http.StripPrefix.
+func UIHandler(specURL string) http.Handler {
+	var index bytes.Buffer
+	if err := uiIndex.Execute(&index, specURL); err != nil {
+		panic(err)
+	}
+
+	assets, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	files := http.FileServerFS(assets)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/") == "" || r.URL.Path == "/index.html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(index.Bytes())
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
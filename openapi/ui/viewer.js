@@ -0,0 +1,179 @@
+// Renders the OpenAPI document named by the openapi-spec meta tag: a list of
+// operations grouped by tag, each with its parameters and body schemas.
+"use strict";
+
+const methods = ["get", "post", "put", "patch", "delete"];
+
+function element(tag, attributes, ...children) {
+	const node = document.createElement(tag);
+	for (const [name, value] of Object.entries(attributes || {})) {
+		node.setAttribute(name, value);
+	}
+	for (const child of children) {
+		node.append(child);
+	}
+	return node;
+}
+
+// resolve follows a local $ref such as #/components/schemas/Blog.
+function resolve(spec, object) {
+	if (!object || !object.$ref) {
+		return object;
+	}
+	return object.$ref
+		.replace(/^#\//, "")
+		.split("/")
+		.reduce((node, key) => node && node[key], spec);
+}
+
+function refName(schema) {
+	return schema.$ref ? schema.$ref.split("/").pop() : "";
+}
+
+function typeName(schema) {
+	const type = Array.isArray(schema.type) ? schema.type.join(" | ") : schema.type || "any";
+	return schema.format ? `${type} (${schema.format})` : type;
+}
+
+function constraints(schema) {
+	const notes = [];
+	if (schema.enum) notes.push(`one of ${schema.enum.join(", ")}`);
+	if (schema.minLength !== undefined) notes.push(`min length ${schema.minLength}`);
+	if (schema.maxLength !== undefined) notes.push(`max length ${schema.maxLength}`);
+	if (schema.minItems !== undefined) notes.push(`min items ${schema.minItems}`);
+	if (schema.maxItems !== undefined) notes.push(`max items ${schema.maxItems}`);
+	if (schema.minimum !== undefined) notes.push(`minimum ${schema.minimum}`);
+	if (schema.maximum !== undefined) notes.push(`maximum ${schema.maximum}`);
+	return notes.length ? `  // ${notes.join(", ")}` : "";
+}
+
+// describe writes schema as indented pseudo JSON, expanding references once
+// per branch so recursive types terminate.
+function describe(spec, schema, indent, seen) {
+	if (!schema) {
+		return "any";
+	}
+
+	const name = refName(schema);
+	if (name) {
+		if (seen.has(name)) {
+			return name;
+		}
+		seen = new Set(seen).add(name);
+		schema = resolve(spec, schema) || {};
+	}
+
+	const pad = "  ".repeat(indent + 1);
+
+	if (schema.type === "array") {
+		return `[${describe(spec, schema.items, indent, seen)}]`;
+	}
+
+	if (schema.type === "object" && schema.properties) {
+		const required = new Set(schema.required || []);
+		const lines = Object.entries(schema.properties).map(([key, property]) => {
+			const optional = required.has(key) ? "" : "?";
+			const value = describe(spec, property, indent + 1, seen);
+			return `${pad}${key}${optional}: ${value}${constraints(resolve(spec, property) || {})}`;
+		});
+		return `${name ? name + " " : ""}{\n${lines.join("\n")}\n${"  ".repeat(indent)}}`;
+	}
+
+	if (schema.type === "object" && schema.additionalProperties) {
+		return `{[key]: ${describe(spec, schema.additionalProperties, indent, seen)}}`;
+	}
+
+	return typeName(schema);
+}
+
+function parameters(operation) {
+	const table = element("table", {},
+		element("tr", {}, element("th", {}, "Name"), element("th", {}, "In"), element("th", {}, "Type")));
+	for (const parameter of operation.parameters) {
+		table.append(element("tr", {},
+			element("td", {}, element("code", {}, parameter.name + (parameter.required ? "" : "?"))),
+			element("td", {}, parameter.in),
+			element("td", {}, typeName(parameter.schema || {}))));
+	}
+	return table;
+}
+
+function body(spec, content) {
+	const media = content && content["application/json"];
+	return element("div", { class: "schema" }, describe(spec, media && media.schema, 0, new Set()));
+}
+
+function operationSection(spec, path, method, operation) {
+	const section = element("section", { class: "operation", id: operation.operationId });
+
+	const title = element("h3", {}, element("span", { class: `method ${method}` }, method), path);
+	if (operation.security) {
+		title.append(element("span", { class: "secured" }, "requires a session"));
+	}
+	section.append(title);
+
+	if (operation.summary) section.append(element("p", {}, operation.summary));
+	if (operation.description) section.append(element("p", {}, operation.description));
+
+	if (operation.parameters && operation.parameters.length) {
+		section.append(element("h4", {}, "Parameters"), parameters(operation));
+	}
+
+	if (operation.requestBody) {
+		section.append(element("h4", {}, "Request body"), body(spec, operation.requestBody.content));
+	}
+
+	for (const [status, reference] of Object.entries(operation.responses || {})) {
+		const response = resolve(spec, reference);
+		const heading = status === "default" ? "Errors" : `Response ${status}`;
+		section.append(element("h4", {}, heading));
+		if (response.content) {
+			section.append(body(spec, response.content));
+		} else {
+			section.append(element("p", {}, response.description || ""));
+		}
+	}
+
+	return section;
+}
+
+function render(spec) {
+	const nav = document.getElementById("nav");
+	const main = document.getElementById("main");
+	main.replaceChildren(element("h1", {}, `${spec.info.title} ${spec.info.version}`));
+	if (spec.info.description) {
+		main.append(element("p", {}, spec.info.description));
+	}
+
+	const groups = new Map();
+	for (const path of Object.keys(spec.paths).sort()) {
+		for (const method of methods) {
+			const operation = spec.paths[path][method];
+			if (!operation) continue;
+			const tag = (operation.tags && operation.tags[0]) || "default";
+			if (!groups.has(tag)) groups.set(tag, []);
+			groups.get(tag).push({ path, method, operation });
+		}
+	}
+
+	for (const [tag, operations] of [...groups].sort(([a], [b]) => a.localeCompare(b))) {
+		nav.append(element("h2", {}, tag));
+		main.append(element("h2", {}, tag));
+		for (const { path, method, operation } of operations) {
+			nav.append(element("a", { href: `#${operation.operationId}` }, `${method.toUpperCase()} ${path}`));
+			main.append(operationSection(spec, path, method, operation));
+		}
+	}
+}
+
+const url = document.querySelector('meta[name="openapi-spec"]').content;
+
+fetch(url)
+	.then((response) => {
+		if (!response.ok) throw new Error(`${url} answered ${response.status}`);
+		return response.json();
+	})
+	.then(render)
+	.catch((error) => {
+		document.getElementById("main").replaceChildren(element("p", { class: "error" }, String(error)));
+	});
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	models "github.com/immanuel-254/blog/auth/models"
+	"github.com/immanuel-254/blog/auth/models/postgres"
+)
+
+// authPostgres runs the PostgreSQL queries of the auth app behind the interface of
+// the SQLite ones, whose types are the same but for the package.
+type authPostgres struct {
+	q *postgres.Queries
+}
+
+var _ models.Querier = authPostgres{}
+
+func (p authPostgres) AuthUserRead(ctx context.Context, id int64) (models.AuthUserReadRow, error) {
+	row, err := p.q.AuthUserRead(ctx, id)
+	return models.AuthUserReadRow(row), err
+}
+
+func (p authPostgres) EmailChangeCancelRead(ctx context.Context, cancelToken string) (models.EmailChangeCancelReadRow, error) {
+	row, err := p.q.EmailChangeCancelRead(ctx, cancelToken)
+	return models.EmailChangeCancelReadRow(row), err
+}
+
+func (p authPostgres) EmailChangeConfirmRead(ctx context.Context, confirmToken string) (models.EmailChangeConfirmReadRow, error) {
+	row, err := p.q.EmailChangeConfirmRead(ctx, confirmToken)
+	return models.EmailChangeConfirmReadRow(row), err
+}
+
+func (p authPostgres) EmailChangeCreate(ctx context.Context, arg models.EmailChangeCreateParams) (models.EmailChangeCreateRow, error) {
+	row, err := p.q.EmailChangeCreate(ctx, postgres.EmailChangeCreateParams(arg))
+	return models.EmailChangeCreateRow(row), err
+}
+
+func (p authPostgres) EmailChangePurge(ctx context.Context, createdAt sql.NullTime) (int64, error) {
+	return p.q.EmailChangePurge(ctx, createdAt)
+}
+
+func (p authPostgres) EmailChangeUserDelete(ctx context.Context, userID int64) error {
+	return p.q.EmailChangeUserDelete(ctx, userID)
+}
+
+func (p authPostgres) LogCreate(ctx context.Context, arg models.LogCreateParams) error {
+	return p.q.LogCreate(ctx, postgres.LogCreateParams(arg))
+}
+
+func (p authPostgres) LogList(ctx context.Context) ([]models.LogListRow, error) {
+	rows, err := p.q.LogList(ctx)
+	return convertRows(rows, err, func(row postgres.LogListRow) models.LogListRow { return models.LogListRow(row) })
+}
+
+func (p authPostgres) LogMonthlyList(ctx context.Context) ([]models.LogMonthlyListRow, error) {
+	rows, err := p.q.LogMonthlyList(ctx)
+	return convertRows(rows, err, func(row postgres.LogMonthlyListRow) models.LogMonthlyListRow { return models.LogMonthlyListRow(row) })
+}
+
+func (p authPostgres) LogPreviousMonthlyList(ctx context.Context) ([]models.LogPreviousMonthlyListRow, error) {
+	rows, err := p.q.LogPreviousMonthlyList(ctx)
+	return convertRows(rows, err, func(row postgres.LogPreviousMonthlyListRow) models.LogPreviousMonthlyListRow {
+		return models.LogPreviousMonthlyListRow(row)
+	})
+}
+
+func (p authPostgres) LogPreviousWeeklyList(ctx context.Context) ([]models.LogPreviousWeeklyListRow, error) {
+	rows, err := p.q.LogPreviousWeeklyList(ctx)
+	return convertRows(rows, err, func(row postgres.LogPreviousWeeklyListRow) models.LogPreviousWeeklyListRow {
+		return models.LogPreviousWeeklyListRow(row)
+	})
+}
+
+func (p authPostgres) LogTodayList(ctx context.Context) ([]models.LogTodayListRow, error) {
+	rows, err := p.q.LogTodayList(ctx)
+	return convertRows(rows, err, func(row postgres.LogTodayListRow) models.LogTodayListRow { return models.LogTodayListRow(row) })
+}
+
+func (p authPostgres) LogUserList(ctx context.Context, userID int64) ([]models.LogUserListRow, error) {
+	rows, err := p.q.LogUserList(ctx, userID)
+	return convertRows(rows, err, func(row postgres.LogUserListRow) models.LogUserListRow { return models.LogUserListRow(row) })
+}
+
+func (p authPostgres) LogWeeklyList(ctx context.Context) ([]models.LogWeeklyListRow, error) {
+	rows, err := p.q.LogWeeklyList(ctx)
+	return convertRows(rows, err, func(row postgres.LogWeeklyListRow) models.LogWeeklyListRow { return models.LogWeeklyListRow(row) })
+}
+
+func (p authPostgres) LogYesterdayList(ctx context.Context) ([]models.LogYesterdayListRow, error) {
+	rows, err := p.q.LogYesterdayList(ctx)
+	return convertRows(rows, err, func(row postgres.LogYesterdayListRow) models.LogYesterdayListRow {
+		return models.LogYesterdayListRow(row)
+	})
+}
+
+func (p authPostgres) SessionCreate(ctx context.Context, arg models.SessionCreateParams) (models.SessionCreateRow, error) {
+	row, err := p.q.SessionCreate(ctx, postgres.SessionCreateParams(arg))
+	return models.SessionCreateRow(row), err
+}
+
+func (p authPostgres) SessionDelete(ctx context.Context, key string) error {
+	return p.q.SessionDelete(ctx, key)
+}
+
+func (p authPostgres) SessionList(ctx context.Context) ([]models.SessionListRow, error) {
+	rows, err := p.q.SessionList(ctx)
+	return convertRows(rows, err, func(row postgres.SessionListRow) models.SessionListRow { return models.SessionListRow(row) })
+}
+
+func (p authPostgres) SessionMonthlyList(ctx context.Context) ([]models.SessionMonthlyListRow, error) {
+	rows, err := p.q.SessionMonthlyList(ctx)
+	return convertRows(rows, err, func(row postgres.SessionMonthlyListRow) models.SessionMonthlyListRow {
+		return models.SessionMonthlyListRow(row)
+	})
+}
+
+func (p authPostgres) SessionPreviousMonthlyList(ctx context.Context) ([]models.SessionPreviousMonthlyListRow, error) {
+	rows, err := p.q.SessionPreviousMonthlyList(ctx)
+	return convertRows(rows, err, func(row postgres.SessionPreviousMonthlyListRow) models.SessionPreviousMonthlyListRow {
+		return models.SessionPreviousMonthlyListRow(row)
+	})
+}
+
+func (p authPostgres) SessionPreviousWeeklyList(ctx context.Context) ([]models.SessionPreviousWeeklyListRow, error) {
+	rows, err := p.q.SessionPreviousWeeklyList(ctx)
+	return convertRows(rows, err, func(row postgres.SessionPreviousWeeklyListRow) models.SessionPreviousWeeklyListRow {
+		return models.SessionPreviousWeeklyListRow(row)
+	})
+}
+
+func (p authPostgres) SessionPurge(ctx context.Context, createdAt sql.NullTime) (int64, error) {
+	return p.q.SessionPurge(ctx, createdAt)
+}
+
+func (p authPostgres) SessionRead(ctx context.Context, key string) (models.SessionReadRow, error) {
+	row, err := p.q.SessionRead(ctx, key)
+	return models.SessionReadRow(row), err
+}
+
+func (p authPostgres) SessionTodayList(ctx context.Context) ([]models.SessionTodayListRow, error) {
+	rows, err := p.q.SessionTodayList(ctx)
+	return convertRows(rows, err, func(row postgres.SessionTodayListRow) models.SessionTodayListRow {
+		return models.SessionTodayListRow(row)
+	})
+}
+
+func (p authPostgres) SessionUserDelete(ctx context.Context, userID int64) error {
+	return p.q.SessionUserDelete(ctx, userID)
+}
+
+func (p authPostgres) SessionUserList(ctx context.Context, userID int64) ([]models.SessionUserListRow, error) {
+	rows, err := p.q.SessionUserList(ctx, userID)
+	return convertRows(rows, err, func(row postgres.SessionUserListRow) models.SessionUserListRow { return models.SessionUserListRow(row) })
+}
+
+func (p authPostgres) SessionWeeklyList(ctx context.Context) ([]models.SessionWeeklyListRow, error) {
+	rows, err := p.q.SessionWeeklyList(ctx)
+	return convertRows(rows, err, func(row postgres.SessionWeeklyListRow) models.SessionWeeklyListRow {
+		return models.SessionWeeklyListRow(row)
+	})
+}
+
+func (p authPostgres) SessionYesterdayList(ctx context.Context) ([]models.SessionYesterdayListRow, error) {
+	rows, err := p.q.SessionYesterdayList(ctx)
+	return convertRows(rows, err, func(row postgres.SessionYesterdayListRow) models.SessionYesterdayListRow {
+		return models.SessionYesterdayListRow(row)
+	})
+}
+
+func (p authPostgres) UserCreate(ctx context.Context, arg models.UserCreateParams) (models.UserCreateRow, error) {
+	row, err := p.q.UserCreate(ctx, postgres.UserCreateParams(arg))
+	return models.UserCreateRow(row), err
+}
+
+func (p authPostgres) UserDelete(ctx context.Context, id int64) error {
+	return p.q.UserDelete(ctx, id)
+}
+
+func (p authPostgres) UserDeletionCancelRead(ctx context.Context, cancelToken string) (models.UserDeletionCancelReadRow, error) {
+	row, err := p.q.UserDeletionCancelRead(ctx, cancelToken)
+	return models.UserDeletionCancelReadRow(row), err
+}
+
+func (p authPostgres) UserDeletionCreate(ctx context.Context, arg models.UserDeletionCreateParams) (models.UserDeletionCreateRow, error) {
+	row, err := p.q.UserDeletionCreate(ctx, postgres.UserDeletionCreateParams(arg))
+	return models.UserDeletionCreateRow(row), err
+}
+
+func (p authPostgres) UserDeletionDueList(ctx context.Context, scheduledFor time.Time) ([]models.UserDeletionDueListRow, error) {
+	rows, err := p.q.UserDeletionDueList(ctx, scheduledFor)
+	return convertRows(rows, err, func(row postgres.UserDeletionDueListRow) models.UserDeletionDueListRow {
+		return models.UserDeletionDueListRow(row)
+	})
+}
+
+func (p authPostgres) UserDeletionUserDelete(ctx context.Context, userID int64) error {
+	return p.q.UserDeletionUserDelete(ctx, userID)
+}
+
+func (p authPostgres) UserEmailExists(ctx context.Context, email string) (int64, error) {
+	return p.q.UserEmailExists(ctx, email)
+}
+
+func (p authPostgres) UserEmailRead(ctx context.Context, email string) (models.UserEmailReadRow, error) {
+	row, err := p.q.UserEmailRead(ctx, email)
+	return models.UserEmailReadRow(row), err
+}
+
+func (p authPostgres) UserExists(ctx context.Context, id int64) (int64, error) {
+	return p.q.UserExists(ctx, id)
+}
+
+func (p authPostgres) UserList(ctx context.Context) ([]models.UserListRow, error) {
+	rows, err := p.q.UserList(ctx)
+	return convertRows(rows, err, func(row postgres.UserListRow) models.UserListRow { return models.UserListRow(row) })
+}
+
+func (p authPostgres) UserLoginRead(ctx context.Context, email string) (models.UserLoginReadRow, error) {
+	row, err := p.q.UserLoginRead(ctx, email)
+	return models.UserLoginReadRow(row), err
+}
+
+func (p authPostgres) UserRead(ctx context.Context, id int64) (models.UserReadRow, error) {
+	row, err := p.q.UserRead(ctx, id)
+	return models.UserReadRow(row), err
+}
+
+func (p authPostgres) UserRoleList(ctx context.Context) ([]models.UserRoleListRow, error) {
+	rows, err := p.q.UserRoleList(ctx)
+	return convertRows(rows, err, func(row postgres.UserRoleListRow) models.UserRoleListRow { return models.UserRoleListRow(row) })
+}
+
+func (p authPostgres) UserUpdateEmail(ctx context.Context, arg models.UserUpdateEmailParams) (models.UserUpdateEmailRow, error) {
+	row, err := p.q.UserUpdateEmail(ctx, postgres.UserUpdateEmailParams(arg))
+	return models.UserUpdateEmailRow(row), err
+}
+
+func (p authPostgres) UserUpdateIsActive(ctx context.Context, arg models.UserUpdateIsActiveParams) (models.UserUpdateIsActiveRow, error) {
+	row, err := p.q.UserUpdateIsActive(ctx, postgres.UserUpdateIsActiveParams(arg))
+	return models.UserUpdateIsActiveRow(row), err
+}
+
+func (p authPostgres) UserUpdateIsStaff(ctx context.Context, arg models.UserUpdateIsStaffParams) (models.UserUpdateIsStaffRow, error) {
+	row, err := p.q.UserUpdateIsStaff(ctx, postgres.UserUpdateIsStaffParams(arg))
+	return models.UserUpdateIsStaffRow(row), err
+}
+
+func (p authPostgres) UserUpdatePassword(ctx context.Context, arg models.UserUpdatePasswordParams) (models.UserUpdatePasswordRow, error) {
+	row, err := p.q.UserUpdatePassword(ctx, postgres.UserUpdatePasswordParams(arg))
+	return models.UserUpdatePasswordRow(row), err
+}
+
+func (p authPostgres) UserUpdateRole(ctx context.Context, arg models.UserUpdateRoleParams) (models.UserUpdateRoleRow, error) {
+	row, err := p.q.UserUpdateRole(ctx, postgres.UserUpdateRoleParams(arg))
+	return models.UserUpdateRoleRow(row), err
+}
+
+func (p authPostgres) UserVersion(ctx context.Context, id int64) (int64, error) {
+	return p.q.UserVersion(ctx, id)
+}
@@ -0,0 +1,341 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	models "github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/blog/models/postgres"
+)
+
+// blogPostgres runs the PostgreSQL queries of the blog app behind the interface of
+// the SQLite ones, whose types are the same but for the package.
+type blogPostgres struct {
+	q *postgres.Queries
+}
+
+var _ models.Querier = blogPostgres{}
+
+func (p blogPostgres) AssignBlogToCategory(ctx context.Context, arg models.AssignBlogToCategoryParams) error {
+	return p.q.AssignBlogToCategory(ctx, postgres.AssignBlogToCategoryParams(arg))
+}
+
+func (p blogPostgres) BlogCategoriesList(ctx context.Context, blogID int64) ([]models.BlogCategoriesListRow, error) {
+	rows, err := p.q.BlogCategoriesList(ctx, blogID)
+	return convertRows(rows, err, func(row postgres.BlogCategoriesListRow) models.BlogCategoriesListRow {
+		return models.BlogCategoriesListRow(row)
+	})
+}
+
+func (p blogPostgres) BlogCommentsList(ctx context.Context, blogID sql.NullInt64) ([]models.BlogCommentsListRow, error) {
+	rows, err := p.q.BlogCommentsList(ctx, blogID)
+	return convertRows(rows, err, func(row postgres.BlogCommentsListRow) models.BlogCommentsListRow {
+		return models.BlogCommentsListRow(row)
+	})
+}
+
+func (p blogPostgres) BlogCreate(ctx context.Context, arg models.BlogCreateParams) (models.Blog, error) {
+	row, err := p.q.BlogCreate(ctx, postgres.BlogCreateParams(arg))
+	return models.Blog(row), err
+}
+
+func (p blogPostgres) BlogDelete(ctx context.Context, id int64) error {
+	return p.q.BlogDelete(ctx, id)
+}
+
+func (p blogPostgres) BlogExists(ctx context.Context, id int64) (int64, error) {
+	return p.q.BlogExists(ctx, id)
+}
+
+func (p blogPostgres) BlogImport(ctx context.Context, arg models.BlogImportParams) (models.Blog, error) {
+	row, err := p.q.BlogImport(ctx, postgres.BlogImportParams(arg))
+	return models.Blog(row), err
+}
+
+func (p blogPostgres) BlogList(ctx context.Context) ([]models.BlogListRow, error) {
+	rows, err := p.q.BlogList(ctx)
+	return convertRows(rows, err, func(row postgres.BlogListRow) models.BlogListRow { return models.BlogListRow(row) })
+}
+
+func (p blogPostgres) BlogRead(ctx context.Context, id int64) (models.BlogReadRow, error) {
+	row, err := p.q.BlogRead(ctx, id)
+	return models.BlogReadRow(row), err
+}
+
+func (p blogPostgres) BlogRevisionAuthorReassign(ctx context.Context, arg models.BlogRevisionAuthorReassignParams) error {
+	return p.q.BlogRevisionAuthorReassign(ctx, postgres.BlogRevisionAuthorReassignParams(arg))
+}
+
+func (p blogPostgres) BlogRevisionBlogDelete(ctx context.Context, blogID int64) error {
+	return p.q.BlogRevisionBlogDelete(ctx, blogID)
+}
+
+func (p blogPostgres) BlogRevisionCreate(ctx context.Context, arg models.BlogRevisionCreateParams) (models.BlogRevision, error) {
+	row, err := p.q.BlogRevisionCreate(ctx, postgres.BlogRevisionCreateParams(arg))
+	return models.BlogRevision(row), err
+}
+
+func (p blogPostgres) BlogRevisionLatest(ctx context.Context, blogID int64) (models.BlogRevision, error) {
+	row, err := p.q.BlogRevisionLatest(ctx, blogID)
+	return models.BlogRevision(row), err
+}
+
+func (p blogPostgres) BlogRevisionList(ctx context.Context, blogID int64) ([]models.BlogRevisionListRow, error) {
+	rows, err := p.q.BlogRevisionList(ctx, blogID)
+	return convertRows(rows, err, func(row postgres.BlogRevisionListRow) models.BlogRevisionListRow {
+		return models.BlogRevisionListRow(row)
+	})
+}
+
+func (p blogPostgres) BlogRevisionPrune(ctx context.Context, arg models.BlogRevisionPruneParams) (int64, error) {
+	// PostgreSQL names the blog once, SQLite takes it twice
+	return p.q.BlogRevisionPrune(ctx, postgres.BlogRevisionPruneParams{BlogID: arg.BlogID, Limit: arg.Limit})
+}
+
+func (p blogPostgres) BlogRevisionRead(ctx context.Context, arg models.BlogRevisionReadParams) (models.BlogRevision, error) {
+	row, err := p.q.BlogRevisionRead(ctx, postgres.BlogRevisionReadParams(arg))
+	return models.BlogRevision(row), err
+}
+
+func (p blogPostgres) BlogRevisionUserDelete(ctx context.Context, userID sql.NullInt64) error {
+	return p.q.BlogRevisionUserDelete(ctx, userID)
+}
+
+func (p blogPostgres) BlogRevisionUserList(ctx context.Context, arg models.BlogRevisionUserListParams) ([]models.BlogRevision, error) {
+	// PostgreSQL names the user once, SQLite takes it twice
+	rows, err := p.q.BlogRevisionUserList(ctx, arg.AuthorID)
+	return convertRows(rows, err, func(row postgres.BlogRevision) models.BlogRevision { return models.BlogRevision(row) })
+}
+
+func (p blogPostgres) BlogUpdate(ctx context.Context, arg models.BlogUpdateParams) (models.BlogUpdateRow, error) {
+	row, err := p.q.BlogUpdate(ctx, postgres.BlogUpdateParams(arg))
+	return models.BlogUpdateRow(row), err
+}
+
+func (p blogPostgres) BlogUserDelete(ctx context.Context, userID sql.NullInt64) error {
+	return p.q.BlogUserDelete(ctx, userID)
+}
+
+func (p blogPostgres) BlogUserList(ctx context.Context, userID sql.NullInt64) ([]models.BlogUserListRow, error) {
+	rows, err := p.q.BlogUserList(ctx, userID)
+	return convertRows(rows, err, func(row postgres.BlogUserListRow) models.BlogUserListRow { return models.BlogUserListRow(row) })
+}
+
+func (p blogPostgres) BlogUserReassign(ctx context.Context, arg models.BlogUserReassignParams) error {
+	return p.q.BlogUserReassign(ctx, postgres.BlogUserReassignParams(arg))
+}
+
+func (p blogPostgres) BlogOwner(ctx context.Context, id int64) (sql.NullInt64, error) {
+	return p.q.BlogOwner(ctx, id)
+}
+
+func (p blogPostgres) BlogVersion(ctx context.Context, id int64) (int64, error) {
+	return p.q.BlogVersion(ctx, id)
+}
+
+func (p blogPostgres) CategoryBlogDelete(ctx context.Context, arg models.CategoryBlogDeleteParams) error {
+	return p.q.CategoryBlogDelete(ctx, postgres.CategoryBlogDeleteParams(arg))
+}
+
+func (p blogPostgres) CategoryBlogList(ctx context.Context) ([]models.CategoryBlogListRow, error) {
+	rows, err := p.q.CategoryBlogList(ctx)
+	return convertRows(rows, err, func(row postgres.CategoryBlogListRow) models.CategoryBlogListRow {
+		return models.CategoryBlogListRow(row)
+	})
+}
+
+func (p blogPostgres) CategoryBlogUserDelete(ctx context.Context, userID sql.NullInt64) error {
+	return p.q.CategoryBlogUserDelete(ctx, userID)
+}
+
+func (p blogPostgres) CategoryCreate(ctx context.Context, arg models.CategoryCreateParams) (models.Category, error) {
+	row, err := p.q.CategoryCreate(ctx, postgres.CategoryCreateParams(arg))
+	return models.Category(row), err
+}
+
+func (p blogPostgres) CategoryDelete(ctx context.Context, id int64) error {
+	return p.q.CategoryDelete(ctx, id)
+}
+
+func (p blogPostgres) CategoryExists(ctx context.Context, id int64) (int64, error) {
+	return p.q.CategoryExists(ctx, id)
+}
+
+func (p blogPostgres) CategoryList(ctx context.Context) ([]models.CategoryListRow, error) {
+	rows, err := p.q.CategoryList(ctx)
+	return convertRows(rows, err, func(row postgres.CategoryListRow) models.CategoryListRow { return models.CategoryListRow(row) })
+}
+
+func (p blogPostgres) CategoryRead(ctx context.Context, id int64) (models.CategoryReadRow, error) {
+	row, err := p.q.CategoryRead(ctx, id)
+	return models.CategoryReadRow(row), err
+}
+
+func (p blogPostgres) CategoryUpdate(ctx context.Context, arg models.CategoryUpdateParams) (models.CategoryUpdateRow, error) {
+	row, err := p.q.CategoryUpdate(ctx, postgres.CategoryUpdateParams(arg))
+	return models.CategoryUpdateRow(row), err
+}
+
+func (p blogPostgres) CategoryUserReassign(ctx context.Context, arg models.CategoryUserReassignParams) error {
+	return p.q.CategoryUserReassign(ctx, postgres.CategoryUserReassignParams(arg))
+}
+
+func (p blogPostgres) CategoryVersion(ctx context.Context, id int64) (int64, error) {
+	return p.q.CategoryVersion(ctx, id)
+}
+
+func (p blogPostgres) CommentCreate(ctx context.Context, arg models.CommentCreateParams) (models.Comment, error) {
+	row, err := p.q.CommentCreate(ctx, postgres.CommentCreateParams(arg))
+	return models.Comment(row), err
+}
+
+func (p blogPostgres) CommentDelete(ctx context.Context, id int64) error {
+	return p.q.CommentDelete(ctx, id)
+}
+
+func (p blogPostgres) CommentImport(ctx context.Context, arg models.CommentImportParams) (models.Comment, error) {
+	row, err := p.q.CommentImport(ctx, postgres.CommentImportParams(arg))
+	return models.Comment(row), err
+}
+
+func (p blogPostgres) CommentList(ctx context.Context) ([]models.CommentListRow, error) {
+	rows, err := p.q.CommentList(ctx)
+	return convertRows(rows, err, func(row postgres.CommentListRow) models.CommentListRow { return models.CommentListRow(row) })
+}
+
+func (p blogPostgres) CommentRead(ctx context.Context, id int64) (models.CommentReadRow, error) {
+	row, err := p.q.CommentRead(ctx, id)
+	return models.CommentReadRow(row), err
+}
+
+func (p blogPostgres) CommentUpdate(ctx context.Context, arg models.CommentUpdateParams) (models.CommentUpdateRow, error) {
+	row, err := p.q.CommentUpdate(ctx, postgres.CommentUpdateParams(arg))
+	return models.CommentUpdateRow(row), err
+}
+
+func (p blogPostgres) CommentUserBlogsDelete(ctx context.Context, arg models.CommentUserBlogsDeleteParams) error {
+	return p.q.CommentUserBlogsDelete(ctx, postgres.CommentUserBlogsDeleteParams(arg))
+}
+
+func (p blogPostgres) CommentUserList(ctx context.Context, userID sql.NullInt64) ([]models.CommentUserListRow, error) {
+	rows, err := p.q.CommentUserList(ctx, userID)
+	return convertRows(rows, err, func(row postgres.CommentUserListRow) models.CommentUserListRow { return models.CommentUserListRow(row) })
+}
+
+func (p blogPostgres) CommentUserReassign(ctx context.Context, arg models.CommentUserReassignParams) error {
+	return p.q.CommentUserReassign(ctx, postgres.CommentUserReassignParams(arg))
+}
+
+func (p blogPostgres) CommentVersion(ctx context.Context, id int64) (int64, error) {
+	return p.q.CommentVersion(ctx, id)
+}
+
+func (p blogPostgres) MediaAvatarList(ctx context.Context) ([]models.Media, error) {
+	rows, err := p.q.MediaAvatarList(ctx)
+	return convertRows(rows, err, func(row postgres.Media) models.Media { return models.Media(row) })
+}
+
+func (p blogPostgres) MediaBlogUnlink(ctx context.Context, blogID sql.NullInt64) error {
+	return p.q.MediaBlogUnlink(ctx, blogID)
+}
+
+func (p blogPostgres) MediaCreate(ctx context.Context, arg models.MediaCreateParams) (models.Media, error) {
+	row, err := p.q.MediaCreate(ctx, postgres.MediaCreateParams(arg))
+	return models.Media(row), err
+}
+
+func (p blogPostgres) MediaList(ctx context.Context, arg models.MediaListParams) ([]models.Media, error) {
+	rows, err := p.q.MediaList(ctx, postgres.MediaListParams(arg))
+	return convertRows(rows, err, func(row postgres.Media) models.Media { return models.Media(row) })
+}
+
+func (p blogPostgres) MediaPurge(ctx context.Context, id int64) error {
+	return p.q.MediaPurge(ctx, id)
+}
+
+func (p blogPostgres) MediaRead(ctx context.Context, id int64) (models.Media, error) {
+	row, err := p.q.MediaRead(ctx, id)
+	return models.Media(row), err
+}
+
+func (p blogPostgres) MediaTrash(ctx context.Context, arg models.MediaTrashParams) error {
+	return p.q.MediaTrash(ctx, postgres.MediaTrashParams(arg))
+}
+
+func (p blogPostgres) MediaTrashedList(ctx context.Context, limit int64) ([]models.Media, error) {
+	rows, err := p.q.MediaTrashedList(ctx, limit)
+	return convertRows(rows, err, func(row postgres.Media) models.Media { return models.Media(row) })
+}
+
+func (p blogPostgres) MediaUpdate(ctx context.Context, arg models.MediaUpdateParams) (models.Media, error) {
+	row, err := p.q.MediaUpdate(ctx, postgres.MediaUpdateParams(arg))
+	return models.Media(row), err
+}
+
+func (p blogPostgres) MediaUserAvatarTrash(ctx context.Context, arg models.MediaUserAvatarTrashParams) error {
+	return p.q.MediaUserAvatarTrash(ctx, postgres.MediaUserAvatarTrashParams(arg))
+}
+
+func (p blogPostgres) MediaUserBlogsUnlink(ctx context.Context, userID sql.NullInt64) error {
+	return p.q.MediaUserBlogsUnlink(ctx, userID)
+}
+
+func (p blogPostgres) MediaUserList(ctx context.Context, ownerID sql.NullInt64) ([]models.Media, error) {
+	rows, err := p.q.MediaUserList(ctx, ownerID)
+	return convertRows(rows, err, func(row postgres.Media) models.Media { return models.Media(row) })
+}
+
+func (p blogPostgres) MediaUserReassign(ctx context.Context, arg models.MediaUserReassignParams) error {
+	return p.q.MediaUserReassign(ctx, postgres.MediaUserReassignParams(arg))
+}
+
+func (p blogPostgres) MediaUserTrash(ctx context.Context, arg models.MediaUserTrashParams) error {
+	return p.q.MediaUserTrash(ctx, postgres.MediaUserTrashParams(arg))
+}
+
+func (p blogPostgres) ProfileAvatarUpdate(ctx context.Context, arg models.ProfileAvatarUpdateParams) (models.Profile, error) {
+	row, err := p.q.ProfileAvatarUpdate(ctx, postgres.ProfileAvatarUpdateParams(arg))
+	return models.Profile(row), err
+}
+
+func (p blogPostgres) ProfileCreate(ctx context.Context, arg models.ProfileCreateParams) (models.Profile, error) {
+	row, err := p.q.ProfileCreate(ctx, postgres.ProfileCreateParams(arg))
+	return models.Profile(row), err
+}
+
+func (p blogPostgres) ProfileDelete(ctx context.Context, id int64) error {
+	return p.q.ProfileDelete(ctx, id)
+}
+
+func (p blogPostgres) ProfileImport(ctx context.Context, arg models.ProfileImportParams) (models.Profile, error) {
+	row, err := p.q.ProfileImport(ctx, postgres.ProfileImportParams(arg))
+	return models.Profile(row), err
+}
+
+func (p blogPostgres) ProfileList(ctx context.Context) ([]models.Profile, error) {
+	rows, err := p.q.ProfileList(ctx)
+	return convertRows(rows, err, func(row postgres.Profile) models.Profile { return models.Profile(row) })
+}
+
+func (p blogPostgres) ProfileRead(ctx context.Context, id int64) (models.Profile, error) {
+	row, err := p.q.ProfileRead(ctx, id)
+	return models.Profile(row), err
+}
+
+func (p blogPostgres) ProfileUpdate(ctx context.Context, arg models.ProfileUpdateParams) (models.Profile, error) {
+	row, err := p.q.ProfileUpdate(ctx, postgres.ProfileUpdateParams(arg))
+	return models.Profile(row), err
+}
+
+func (p blogPostgres) ProfileUserDelete(ctx context.Context, userID sql.NullInt64) error {
+	return p.q.ProfileUserDelete(ctx, userID)
+}
+
+func (p blogPostgres) ProfileUserRead(ctx context.Context, userID sql.NullInt64) (models.Profile, error) {
+	row, err := p.q.ProfileUserRead(ctx, userID)
+	return models.Profile(row), err
+}
+
+func (p blogPostgres) ProfileVersion(ctx context.Context, id int64) (int64, error) {
+	return p.q.ProfileVersion(ctx, id)
+}
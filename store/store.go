@@ -0,0 +1,76 @@
+// Package store holds the queries of every app on one database, so services can
+// run them together in a transaction.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	authmodels "github.com/immanuel-254/blog/auth/models"
+	authpostgres "github.com/immanuel-254/blog/auth/models/postgres"
+	blogmodels "github.com/immanuel-254/blog/blog/models"
+	blogpostgres "github.com/immanuel-254/blog/blog/models/postgres"
+	"github.com/immanuel-254/blog/database"
+)
+
+// Store is the repository of every app. Auth and Blog are the interfaces sqlc
+// generates from the SQLite queries; on PostgreSQL the queries generated for it
+// run behind them.
+type Store struct {
+	DB   *database.Database
+	Auth authmodels.Querier
+	Blog blogmodels.Querier
+
+	engine engine
+}
+
+// engine builds the queries of each app for one database engine, on a
+// connection pool or a transaction.
+type engine struct {
+	auth func(db authmodels.DBTX) authmodels.Querier
+	blog func(db blogmodels.DBTX) blogmodels.Querier
+}
+
+var engines = map[database.Driver]engine{
+	database.SQLite: {
+		auth: func(db authmodels.DBTX) authmodels.Querier { return authmodels.New(db) },
+		blog: func(db blogmodels.DBTX) blogmodels.Querier { return blogmodels.New(db) },
+	},
+	database.Postgres: {
+		auth: func(db authmodels.DBTX) authmodels.Querier { return authPostgres{authpostgres.New(db)} },
+		blog: func(db blogmodels.DBTX) blogmodels.Querier { return blogPostgres{blogpostgres.New(db)} },
+	},
+}
+
+// New returns the store of db, running the queries of its engine. It panics on
+// an engine without queries, which Open does not connect to.
+func New(db *database.Database) *Store {
+	e, ok := engines[db.Driver]
+	if !ok {
+		panic(fmt.Sprintf("store: no queries for database driver %q", db.Driver))
+	}
+	return &Store{DB: db, Auth: e.auth(db), Blog: e.blog(db), engine: e}
+}
+
+// WithTx runs fn with a store whose queries all run in one transaction, which is
+// committed if fn returns nil and rolled back otherwise. The store given to fn
+// must not outlive it, and must not start another transaction.
+func (s *Store) WithTx(ctx context.Context, fn func(tx *Store) error) error {
+	return s.DB.WithTx(ctx, func(tx *sql.Tx) error {
+		return fn(&Store{DB: s.DB, Auth: s.engine.auth(tx), Blog: s.engine.blog(tx), engine: s.engine})
+	})
+}
+
+// convertRows converts the rows of a PostgreSQL query to the type of the SQLite
+// one, keeping a nil slice nil as the generated code returns it.
+func convertRows[From, To any](rows []From, err error, convert func(From) To) ([]To, error) {
+	if err != nil {
+		return nil, err
+	}
+	var out []To
+	for _, row := range rows {
+		out = append(out, convert(row))
+	}
+	return out, nil
+}
@@ -0,0 +1,280 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/immanuel-254/blog/apierror"
+	authmodels "github.com/immanuel-254/blog/auth/models"
+	blogmodels "github.com/immanuel-254/blog/blog/models"
+	"github.com/immanuel-254/blog/config"
+	"github.com/immanuel-254/blog/database"
+	"github.com/immanuel-254/blog/internal/testdb"
+	"github.com/immanuel-254/blog/store"
+)
+
+// TestStore migrates a scratch database of every engine and runs the store
+// through the common paths of the apps. PostgreSQL is tested in a temporary
+// schema of the server in TEST_POSTGRES_URL, and skipped without one.
+func TestStore(t *testing.T) {
+	t.Run("sqlite", func(t *testing.T) {
+		testStore(t, testdb.Open(t))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_POSTGRES_URL")
+		if dsn == "" {
+			t.Skip("TEST_POSTGRES_URL is not set")
+		}
+
+		admin, err := database.Open(database.Postgres, dsn, config.SQLiteConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { admin.Close() })
+
+		schema := fmt.Sprintf("blog_test_%d", time.Now().UnixNano())
+		if _, err := admin.ExecContext(context.Background(), "CREATE SCHEMA "+schema); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { admin.ExecContext(context.Background(), "DROP SCHEMA "+schema+" CASCADE") })
+
+		db, err := database.Open(database.Postgres, withSearchPath(dsn, schema), config.SQLiteConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		testStore(t, db)
+	})
+}
+
+// withSearchPath adds the search_path parameter to dsn, a URL or a list of
+// keyword=value settings.
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
+
+// testStore migrates db, then writes and reads back a user with a session, a log
+// entry and a blog with its category, comment, revisions, media and author
+// profile, the way the views do, and rolls back a failed transaction.
+func testStore(t *testing.T, db *database.Database) {
+	ctx := context.Background()
+
+	if err := db.Verify(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	testdb.Migrate(t, db)
+
+	st := store.New(db)
+	queries := st.Auth
+	blogqueries := st.Blog
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+
+	user, err := queries.UserCreate(ctx, authmodels.UserCreateParams{
+		Email:     "check@example.com",
+		Password:  "not a hash",
+		Isactive:  sql.NullBool{Bool: true, Valid: true},
+		Isstaff:   sql.NullBool{Bool: false, Valid: true},
+		Isadmin:   sql.NullBool{Bool: false, Valid: true},
+		CreatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("UserCreate: %v", err)
+	}
+
+	_, err = queries.UserCreate(ctx, authmodels.UserCreateParams{Email: user.Email, Password: "not a hash", CreatedAt: now})
+	if !apierror.IsUniqueViolation(err) {
+		t.Fatalf("UserCreate with a taken email: want a unique violation, got %v", err)
+	}
+
+	if exists, err := queries.UserEmailExists(ctx, user.Email); err != nil || exists != 1 {
+		t.Fatalf("UserEmailExists: got %d, %v", exists, err)
+	}
+
+	authUser, err := queries.AuthUserRead(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("AuthUserRead: %v", err)
+	}
+	if !authUser.Isactive.Bool || authUser.Isadmin.Bool {
+		t.Fatalf("AuthUserRead: flags did not round trip: %+v", authUser)
+	}
+
+	session, err := queries.SessionCreate(ctx, authmodels.SessionCreateParams{Key: "check", UserID: user.ID, CreatedAt: now})
+	if err != nil {
+		t.Fatalf("SessionCreate: %v", err)
+	}
+	if _, err := queries.SessionRead(ctx, session.Key); err != nil {
+		t.Fatalf("SessionRead: %v", err)
+	}
+
+	if err := queries.LogCreate(ctx, authmodels.LogCreateParams{
+		DbTable:   "session",
+		Action:    "create",
+		ObjectID:  session.ID,
+		UserID:    user.ID,
+		RequestID: sql.NullString{String: "check", Valid: true},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("LogCreate: %v", err)
+	}
+	if logs, err := queries.LogTodayList(ctx); err != nil || len(logs) != 1 {
+		t.Fatalf("LogTodayList: got %d entries, %v", len(logs), err)
+	}
+	if logs, err := queries.SessionMonthlyList(ctx); err != nil || len(logs) != 1 {
+		t.Fatalf("SessionMonthlyList: got %d entries, %v", len(logs), err)
+	}
+
+	author := sql.NullInt64{Int64: user.ID, Valid: true}
+
+	profile := blogmodels.ProfileCreateParams{UserID: author, Username: "check", CreatedAt: now, UpdatedAt: now}
+	created, err := blogqueries.ProfileCreate(ctx, profile)
+	if err != nil {
+		t.Fatalf("ProfileCreate: %v", err)
+	}
+	if _, err := blogqueries.ProfileCreate(ctx, profile); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ProfileCreate for a user with a profile: want no rows, got %v", err)
+	}
+
+	blog, err := blogqueries.BlogCreate(ctx, blogmodels.BlogCreateParams{UserID: author, Title: "Check", Body: "Body", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatalf("BlogCreate: %v", err)
+	}
+	category, err := blogqueries.CategoryCreate(ctx, blogmodels.CategoryCreateParams{UserID: author, Name: "Check", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatalf("CategoryCreate: %v", err)
+	}
+	if err := blogqueries.AssignBlogToCategory(ctx, blogmodels.AssignBlogToCategoryParams{BlogID: blog.ID, CategoryID: category.ID, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("AssignBlogToCategory: %v", err)
+	}
+	if _, err := blogqueries.CommentCreate(ctx, blogmodels.CommentCreateParams{UserID: author, BlogID: sql.NullInt64{Int64: blog.ID, Valid: true}, Body: "Comment", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CommentCreate: %v", err)
+	}
+
+	read, err := blogqueries.BlogRead(ctx, blog.ID)
+	if err != nil {
+		t.Fatalf("BlogRead: %v", err)
+	}
+	if read.UserName.String != "check" || !strings.Contains(fmt.Sprintf("%s", read.Categories), `"name":"Check"`) {
+		t.Fatalf("BlogRead: joins did not round trip: %+v", read)
+	}
+
+	if exists, err := blogqueries.BlogExists(ctx, blog.ID); err != nil || exists != 1 {
+		t.Fatalf("BlogExists: got %d, %v", exists, err)
+	}
+
+	if updated, err := blogqueries.BlogUpdate(ctx, blogmodels.BlogUpdateParams{ID: blog.ID, Title: "Check", Body: "Updated", UpdatedAt: now}); err != nil || updated.Version != 2 {
+		t.Fatalf("BlogUpdate: want version 2, got %+v, %v", updated, err)
+	}
+	if version, err := blogqueries.BlogVersion(ctx, blog.ID); err != nil || version != 2 {
+		t.Fatalf("BlogVersion: got %d, %v", version, err)
+	}
+
+	for _, title := range []string{"First", "Second", "Third"} {
+		if _, err := blogqueries.BlogRevisionCreate(ctx, blogmodels.BlogRevisionCreateParams{BlogID: blog.ID, BlogID_2: blog.ID, Title: title, Body: "Body", AuthorID: author, CreatedAt: now}); err != nil {
+			t.Fatalf("BlogRevisionCreate: %v", err)
+		}
+	}
+	if pruned, err := blogqueries.BlogRevisionPrune(ctx, blogmodels.BlogRevisionPruneParams{BlogID: blog.ID, BlogID_2: blog.ID, Limit: 2}); err != nil || pruned != 1 {
+		t.Fatalf("BlogRevisionPrune: got %d, %v", pruned, err)
+	}
+	if latest, err := blogqueries.BlogRevisionLatest(ctx, blog.ID); err != nil || latest.Number != 3 || latest.Title != "Third" {
+		t.Fatalf("BlogRevisionLatest: got %+v, %v", latest, err)
+	}
+	if revisions, err := blogqueries.BlogRevisionList(ctx, blog.ID); err != nil || len(revisions) != 2 || revisions[1].Number != 2 {
+		t.Fatalf("BlogRevisionList: got %+v, %v", revisions, err)
+	}
+	if revisions, err := blogqueries.BlogRevisionUserList(ctx, blogmodels.BlogRevisionUserListParams{AuthorID: author, UserID: author}); err != nil || len(revisions) != 2 || revisions[0].Number != 2 {
+		t.Fatalf("BlogRevisionUserList: got %+v, %v", revisions, err)
+	}
+
+	upload, err := blogqueries.MediaCreate(ctx, blogmodels.MediaCreateParams{
+		OwnerID:     author,
+		BlogID:      sql.NullInt64{Int64: blog.ID, Valid: true},
+		Key:         "check/original.png",
+		Filename:    "check.png",
+		ContentType: "image/png",
+		Size:        1,
+		Width:       sql.NullInt64{Int64: 1, Valid: true},
+		Height:      sql.NullInt64{Int64: 1, Valid: true},
+		Variants:    "[]",
+		CreatedAt:   now,
+	})
+	if err != nil {
+		t.Fatalf("MediaCreate: %v", err)
+	}
+	for _, params := range []blogmodels.MediaListParams{
+		{OwnerID: author, ContentType: "image/%", Limit: 10},
+		{BlogID: sql.NullInt64{Int64: blog.ID, Valid: true}, ContentType: "%", Limit: 10},
+	} {
+		if listed, err := blogqueries.MediaList(ctx, params); err != nil || len(listed) != 1 || listed[0].ID != upload.ID {
+			t.Fatalf("MediaList %+v: got %+v, %v", params, listed, err)
+		}
+	}
+	if listed, err := blogqueries.MediaList(ctx, blogmodels.MediaListParams{ContentType: "application/%", Limit: 10}); err != nil || len(listed) != 0 {
+		t.Fatalf("MediaList by type: got %+v, %v", listed, err)
+	}
+	if listed, err := blogqueries.MediaUserList(ctx, author); err != nil || len(listed) != 1 || listed[0].ID != upload.ID {
+		t.Fatalf("MediaUserList: got %+v, %v", listed, err)
+	}
+	avatar := sql.NullInt64{Int64: upload.ID, Valid: true}
+	if updated, err := blogqueries.ProfileAvatarUpdate(ctx, blogmodels.ProfileAvatarUpdateParams{ID: created.ID, AvatarID: avatar, UpdatedAt: now}); err != nil || updated.AvatarID != avatar || updated.Version != 2 {
+		t.Fatalf("ProfileAvatarUpdate: got %+v, %v", updated, err)
+	}
+	if avatars, err := blogqueries.MediaAvatarList(ctx); err != nil || len(avatars) != 1 || avatars[0].ID != upload.ID {
+		t.Fatalf("MediaAvatarList: got %+v, %v", avatars, err)
+	}
+	if err := blogqueries.MediaUserAvatarTrash(ctx, blogmodels.MediaUserAvatarTrashParams{DeletedAt: now, UserID: author}); err != nil {
+		t.Fatalf("MediaUserAvatarTrash: %v", err)
+	}
+	if avatars, err := blogqueries.MediaAvatarList(ctx); err != nil || len(avatars) != 0 {
+		t.Fatalf("MediaAvatarList after MediaUserAvatarTrash: got %+v, %v", avatars, err)
+	}
+	if err := blogqueries.MediaTrash(ctx, blogmodels.MediaTrashParams{DeletedAt: now, ID: upload.ID}); err != nil {
+		t.Fatalf("MediaTrash: %v", err)
+	}
+	if _, err := blogqueries.MediaRead(ctx, upload.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("MediaRead of trashed media: want no rows, got %v", err)
+	}
+	if trashed, err := blogqueries.MediaTrashedList(ctx, 10); err != nil || len(trashed) != 1 {
+		t.Fatalf("MediaTrashedList: got %+v, %v", trashed, err)
+	}
+	if err := blogqueries.MediaPurge(ctx, upload.ID); err != nil {
+		t.Fatalf("MediaPurge: %v", err)
+	}
+	if read, err := blogqueries.ProfileRead(ctx, created.ID); err != nil || read.AvatarID.Valid {
+		t.Fatalf("ProfileRead after MediaPurge: want no avatar, got %+v, %v", read, err)
+	}
+
+	var rolledBack blogmodels.Category
+	errCheck := errors.New("check")
+	err = st.WithTx(ctx, func(tx *store.Store) (err error) {
+		rolledBack, err = tx.Blog.CategoryCreate(ctx, blogmodels.CategoryCreateParams{UserID: author, Name: "Rolled back", CreatedAt: now, UpdatedAt: now})
+		if err != nil {
+			return err
+		}
+		return errCheck
+	})
+	if !errors.Is(err, errCheck) {
+		t.Fatalf("WithTx: want the error of the transaction, got %v", err)
+	}
+	if exists, err := blogqueries.CategoryExists(ctx, rolledBack.ID); err != nil || exists != 0 {
+		t.Fatalf("WithTx: the category of a failed transaction was kept: %d, %v", exists, err)
+	}
+
+}
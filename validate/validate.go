@@ -0,0 +1,312 @@
+// Package validate decodes JSON request bodies into typed request structs and
+// checks them against the rules in their `validate` struct tags:
+//
+//	type SignupRequest struct {
+//		Email    string `json:"email" validate:"required,email,max=254"`
+//		Password string `json:"password" validate:"required"`
+//		Confirm  string `json:"confirm-password" validate:"required,eqfield=Password"`
+//	}
+//
+// Rules are separated by commas:
+//
+//	required      the field is not its zero value
+//	min=N, max=N  length of a string or slice, value of a number
+//	email         a plain email address
+//	http_url      an absolute http or https URL
+//	oneof=a b c   one of the listed values
+//	eqfield=F     equal to field F of the same struct
+//	exists=name   every id refers to a row, checked with the func registered by RegisterExists
+//
+// Rules other than required skip zero values, so optional fields only need to be
+// valid when they are given.
+package validate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/immanuel-254/blog/apierror"
+)
+
+// MaxBodyBytes is the largest request body Decode reads.
+var MaxBodyBytes int64 = 1 << 20
+
+// ExistsFunc reports whether the row with id exists.
+type ExistsFunc func(ctx context.Context, id int64) (bool, error)
+
+var (
+	existsMu    sync.RWMutex
+	existsFuncs = map[string]ExistsFunc{}
+)
+
+// RegisterExists makes fn available to the exists=name rule.
+func RegisterExists(name string, fn ExistsFunc) {
+	existsMu.Lock()
+	defer existsMu.Unlock()
+	existsFuncs[name] = fn
+}
+
+func lookupExists(name string) (ExistsFunc, bool) {
+	existsMu.RLock()
+	defer existsMu.RUnlock()
+	fn, ok := existsFuncs[name]
+	return fn, ok
+}
+
+// Decode reads the JSON body of r into dst. Bodies over MaxBodyBytes, unknown
+// fields, values of the wrong type and trailing data are rejected.
+func Decode(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return apierror.BadRequest("request body must contain a single JSON object")
+	}
+
+	return nil
+}
+
+func decodeError(err error) error {
+	var (
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+		maxBytesErr *http.MaxBytesError
+		invalidErr  *json.InvalidUnmarshalError
+	)
+
+	switch {
+	case errors.As(err, &invalidErr):
+		return err // a bug in the handler, not the request
+	case errors.Is(err, io.EOF):
+		return apierror.BadRequest("request body must not be empty")
+	case errors.As(err, &maxBytesErr):
+		return apierror.New(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body must not be larger than %d bytes", maxBytesErr.Limit))
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return apierror.BadRequest("request body is not valid JSON").Wrap(err)
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			return apierror.BadRequest("request body must be a JSON object").Wrap(err)
+		}
+		apiErr := apierror.Validation(apierror.FieldError{
+			Field:   field,
+			Code:    "type",
+			Message: fmt.Sprintf("must be a %s", jsonType(typeErr.Type)),
+		})
+		return apiErr.Wrap(err)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return apierror.Validation(apierror.FieldError{Field: field, Code: "unknown", Message: "is not a known field"}).Wrap(err)
+	default:
+		return apierror.BadRequest("request body could not be read").Wrap(err)
+	}
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	default:
+		return "object"
+	}
+}
+
+// Bind decodes the body of r into dst and validates it. On failure it writes the
+// error and returns false, so handlers can simply return.
+func Bind(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := Decode(w, r, dst); err != nil {
+		apierror.Write(w, r, err)
+		return false
+	}
+
+	if err := Struct(r.Context(), dst); err != nil {
+		apierror.Write(w, r, err)
+		return false
+	}
+
+	return true
+}
+
+// Struct checks every field of the struct v points to and returns a validation
+// error listing each failing field.
+func Struct(ctx context.Context, v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: %T is not a struct", v)
+	}
+
+	var fields []apierror.FieldError
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+
+		name := jsonName(field)
+
+		for _, rule := range strings.Split(tag, ",") {
+			rule, param, _ := strings.Cut(rule, "=")
+
+			fieldErr, err := check(ctx, value, value.Field(i), rule, param)
+			if err != nil {
+				return err
+			}
+			if fieldErr != nil {
+				fieldErr.Field = name
+				fields = append(fields, *fieldErr)
+				break // report the first failing rule of a field
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		return apierror.Validation(fields...)
+	}
+	return nil
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func check(ctx context.Context, parent, value reflect.Value, rule, param string) (*apierror.FieldError, error) {
+	fail := func(format string, args ...interface{}) (*apierror.FieldError, error) {
+		return &apierror.FieldError{Code: rule, Message: fmt.Sprintf(format, args...)}, nil
+	}
+
+	if rule == "required" {
+		if value.IsZero() {
+			return fail("is required")
+		}
+		return nil, nil
+	}
+
+	if value.IsZero() {
+		return nil, nil
+	}
+
+	switch rule {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return nil, fmt.Errorf("validate: bad %s limit %q", rule, param)
+		}
+
+		size, unit := measure(value)
+		if rule == "min" && size < limit {
+			return fail("must be at least %s%s", param, unit)
+		}
+		if rule == "max" && size > limit {
+			return fail("must be at most %s%s", param, unit)
+		}
+	case "email":
+		address, err := mail.ParseAddress(value.String())
+		if err != nil || address.Address != value.String() {
+			return fail("must be an email address")
+		}
+	case "http_url":
+		if !IsHTTPURL(value.String()) {
+			return fail("must be an http or https URL")
+		}
+	case "oneof":
+		options := strings.Fields(param)
+		for _, option := range options {
+			if fmt.Sprint(value.Interface()) == option {
+				return nil, nil
+			}
+		}
+		return fail("must be one of %s", strings.Join(options, ", "))
+	case "eqfield":
+		other := parent.FieldByName(param)
+		if !other.IsValid() {
+			return nil, fmt.Errorf("validate: unknown field %q in eqfield", param)
+		}
+		if !reflect.DeepEqual(value.Interface(), other.Interface()) {
+			otherField, _ := parent.Type().FieldByName(param)
+			return fail("must match %s", jsonName(otherField))
+		}
+	case "exists":
+		exists, ok := lookupExists(param)
+		if !ok {
+			return nil, fmt.Errorf("validate: no exists check registered for %q", param)
+		}
+
+		ids := []int64{}
+		switch value.Kind() {
+		case reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				ids = append(ids, value.Index(i).Int())
+			}
+		default:
+			ids = append(ids, value.Int())
+		}
+
+		for _, id := range ids {
+			found, err := exists(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				return fail("%s %d does not exist", param, id)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("validate: unknown rule %q", rule)
+	}
+
+	return nil, nil
+}
+
+// IsHTTPURL reports whether s is an absolute http or https URL with a host, the
+// only links that are safe to send clients to.
+func IsHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil
+}
+
+// measure returns what min and max compare against and the unit to report.
+func measure(value reflect.Value) (float64, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), ""
+	}
+	return 0, ""
+}